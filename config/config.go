@@ -68,6 +68,22 @@ type ServerConfig struct {
 	MQPort                string `yaml:"mqport"`
 	MQServerPort          string `yaml:"mqserverport"`
 	Server                string `yaml:"server"`
+	NodeCheckInTimeout    int64  `yaml:"nodecheckintimeout"`
+	AuthRateLimitAttempts int64  `yaml:"authratelimitattempts"`
+	AuthRateLimitWindow   int64  `yaml:"authratelimitwindow"`
+	IdempotencyKeyTTL     int64  `yaml:"idempotencykeyttl"`
+	NodeDrainGracePeriod  int64  `yaml:"nodedraingraceperiod"`
+	PeerUpdateBatchWindow int64  `yaml:"peerupdatebatchwindow"`
+	NodeRecoveryWindow    int64  `yaml:"noderecoverywindow"`
+	UserTokenCacheTTL     int64  `yaml:"usertokencachettl"`
+	EgressTargetRefresh   int64  `yaml:"egresstargetrefresh"`
+	AllowedMethods        string `yaml:"allowedmethods"`
+	AllowedHeaders        string `yaml:"allowedheaders"`
+	AllowCredentials      string `yaml:"allowcredentials"`
+	StructuredLogging     string `yaml:"structuredlogging"`
+	NodePasswordCost      int    `yaml:"nodepasswordcost"`
+	UtilizationThreshold  int    `yaml:"utilizationthreshold"`
+	UtilizationWebhook    string `yaml:"utilizationwebhook"`
 }
 
 // SQLConfig - Generic SQL Config
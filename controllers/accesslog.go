@@ -0,0 +1,63 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gravitl/netmaker/servercfg"
+)
+
+// accessLogOutput - where access log lines are written
+var accessLogOutput io.Writer = os.Stdout
+
+// accessLogKey - request context key of the access log entry being built for a request
+type accessLogKey struct{}
+
+// accessLogEntry - one json access log line per request
+type accessLogEntry struct {
+	Time      string  `json:"time"`
+	Method    string  `json:"method"`
+	Path      string  `json:"path"`
+	Network   string  `json:"network,omitempty"`
+	Node      string  `json:"node,omitempty"`
+	User      string  `json:"user,omitempty"`
+	Status    int     `json:"status"`
+	LatencyMS float64 `json:"latencyms"`
+	ErrorCode string  `json:"errorcode,omitempty"`
+}
+
+// logRequests - middleware writing a json access log line per request when structured logging is on,
+// the error code is filled in by returnErrorResponse through the request context
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !servercfg.IsStructuredLogging() {
+			next.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		entry := &accessLogEntry{Method: r.Method, Path: r.URL.Path}
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		r = r.WithContext(context.WithValue(r.Context(), accessLogKey{}, entry))
+		next.ServeHTTP(rec, r)
+		entry.Time = start.UTC().Format(time.RFC3339Nano)
+		entry.Network = mux.Vars(r)["network"]
+		entry.Node = mux.Vars(r)["nodeid"]
+		// the auth middleware sets the acting user on the shared headers
+		entry.User = r.Header.Get("user")
+		entry.Status = rec.status
+		entry.LatencyMS = float64(time.Since(start).Microseconds()) / 1000
+		json.NewEncoder(accessLogOutput).Encode(entry)
+	})
+}
+
+// setAccessLogErrorCode - records the error code of a request on its access log entry, if it has one
+func setAccessLogErrorCode(r *http.Request, errorCode string) {
+	if entry, ok := r.Context().Value(accessLogKey{}).(*accessLogEntry); ok {
+		entry.ErrorCode = errorCode
+	}
+}
@@ -0,0 +1,70 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/gravitl/netmaker/database"
+	"github.com/gravitl/netmaker/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogRequests(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	deleteAllNodes()
+	createNet()
+	var output bytes.Buffer
+	accessLogOutput = &output
+	defer func() { accessLogOutput = os.Stdout }()
+	router := mux.NewRouter()
+	nodeHandlers(router)
+	userHandlers(router)
+	call := func(method, path string) {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer secretkey")
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	os.Setenv("MASTER_KEY", "secretkey")
+	defer os.Unsetenv("MASTER_KEY")
+
+	t.Run("Off", func(t *testing.T) {
+		call(http.MethodGet, "/api/nodes/skynet")
+		assert.Empty(t, output.String())
+	})
+	os.Setenv("STRUCTURED_LOGGING", "on")
+	defer os.Unsetenv("STRUCTURED_LOGGING")
+	t.Run("Success", func(t *testing.T) {
+		output.Reset()
+		call(http.MethodGet, "/api/nodes/skynet")
+		var entry accessLogEntry
+		assert.Nil(t, json.Unmarshal(output.Bytes(), &entry))
+		assert.Equal(t, http.MethodGet, entry.Method)
+		assert.Equal(t, "/api/nodes/skynet", entry.Path)
+		assert.Equal(t, "skynet", entry.Network)
+		assert.Equal(t, http.StatusOK, entry.Status)
+		assert.NotEmpty(t, entry.User)
+		assert.NotEmpty(t, entry.Time)
+		assert.Empty(t, entry.ErrorCode)
+	})
+	t.Run("Error", func(t *testing.T) {
+		output.Reset()
+		call(http.MethodGet, "/api/nodes/skynet/missingnode")
+		var entry accessLogEntry
+		assert.Nil(t, json.Unmarshal(output.Bytes(), &entry))
+		assert.Equal(t, "missingnode", entry.Node)
+		assert.Equal(t, http.StatusNotFound, entry.Status)
+		assert.Equal(t, models.ERR_NODE_NOT_FOUND, entry.ErrorCode)
+	})
+	t.Run("OtherControllers", func(t *testing.T) {
+		output.Reset()
+		call(http.MethodGet, "/api/users")
+		assert.Empty(t, output.String())
+	})
+	deleteAllNetworks()
+}
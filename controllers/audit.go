@@ -0,0 +1,43 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/gravitl/netmaker/logger"
+	"github.com/gravitl/netmaker/logic"
+	"github.com/gravitl/netmaker/models"
+)
+
+func auditHandlers(r *mux.Router) {
+	r.HandleFunc("/api/audit", securityCheck(true, http.HandlerFunc(getAuditEntries))).Methods("GET")
+}
+
+// recordNodeAudit - records a node operation against the user set by the auth middleware
+func recordNodeAudit(r *http.Request, action string, before, after *models.Node) {
+	logic.RecordNodeAudit(r.Header.Get("user"), action, before, after)
+}
+
+// getAuditEntries - the audit trail of node operations, filtered by ?network=, ?node= and ?since= (unix seconds)
+func getAuditEntries(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	query := r.URL.Query()
+	var since int64
+	if query.Get("since") != "" {
+		var err error
+		if since, err = strconv.ParseInt(query.Get("since"), 10, 64); err != nil {
+			returnErrorResponse(w, r, formatErrorCode(err, "badrequest", models.ERR_INVALID_REQUEST))
+			return
+		}
+	}
+	entries, err := logic.GetAuditEntries(query.Get("network"), query.Get("node"), since)
+	if err != nil {
+		returnErrorResponse(w, r, formatError(err, "internal"))
+		return
+	}
+	logger.Log(2, r.Header.Get("user"), "fetched audit entries")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(entries)
+}
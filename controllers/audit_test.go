@@ -0,0 +1,178 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gravitl/netmaker/database"
+	"github.com/gravitl/netmaker/logic"
+	"github.com/gravitl/netmaker/models"
+	"github.com/stretchr/testify/assert"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestAuditEntries(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	deleteAllNodes()
+	createNet()
+	node := createTestNode()
+	start := time.Now().Unix()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/nodes/skynet/"+node.ID+"/creategateway", strings.NewReader(`{"ranges":["10.100.0.0/16"],"interface":"eth0"}`))
+	req = mux.SetURLVars(req, map[string]string{"network": "skynet", "nodeid": node.ID})
+	req.Header.Set("user", "ci-admin")
+	w := httptest.NewRecorder()
+	createEgressGateway(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	getEntries := func(query string) []models.AuditEntry {
+		req := httptest.NewRequest(http.MethodGet, "/api/audit"+query, nil)
+		w := httptest.NewRecorder()
+		getAuditEntries(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var entries []models.AuditEntry
+		assert.Nil(t, json.NewDecoder(w.Body).Decode(&entries))
+		return entries
+	}
+	t.Run("Recorded", func(t *testing.T) {
+		assert.Eventually(t, func() bool {
+			entries, err := logic.GetAuditEntries("skynet", node.ID, start)
+			return err == nil && len(entries) == 1
+		}, time.Second, time.Millisecond*10)
+		entries := getEntries("?network=skynet&node=" + node.ID)
+		assert.Len(t, entries, 1)
+		entry := entries[0]
+		assert.Equal(t, "ci-admin", entry.User)
+		assert.Equal(t, models.AUDIT_CREATE_EGRESS, entry.Action)
+		assert.Equal(t, "skynet", entry.Network)
+		var fields []string
+		for _, change := range entry.Changes {
+			fields = append(fields, change.Field)
+		}
+		assert.Contains(t, fields, "isegressgateway")
+		assert.Contains(t, fields, "egressgatewayranges")
+	})
+	t.Run("Filtered", func(t *testing.T) {
+		assert.Empty(t, getEntries("?network=othernet"))
+		assert.Empty(t, getEntries("?node=missing-node"))
+		assert.Empty(t, getEntries("?since=9999999999"))
+	})
+	t.Run("InvalidSince", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/audit?since=yesterday", nil)
+		w := httptest.NewRecorder()
+		getAuditEntries(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+	deleteAllNodes()
+	deleteAllNetworks()
+}
+
+func TestAuditCreateNodeSecrets(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	deleteAllNodes()
+	createNet()
+	network, err := logic.GetNetwork("skynet")
+	assert.Nil(t, err)
+	key, err := logic.CreateAccessKey(models.AccessKey{Name: "audited", Uses: 10}, network)
+	assert.Nil(t, err)
+	start := time.Now().Unix()
+	body := `{"accesskey":"` + key.Value + `","publickey":"DM5qhLAE20PG9BbfBCger+Ac9D2NDOwCtY1rbYDLf34=","name":"audited","endpoint":"10.0.0.50","macaddress":"01:02:03:04:05:06","password":"password","os":"linux","traffickeys":{"mine":"AQID"}}`
+	req := httptest.NewRequest(http.MethodPost, "/api/nodes/skynet", strings.NewReader(body))
+	req = mux.SetURLVars(req, map[string]string{"network": "skynet"})
+	w := httptest.NewRecorder()
+	createNode(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var nodeGet models.NodeGet
+	assert.Nil(t, json.NewDecoder(w.Body).Decode(&nodeGet))
+	var entries []models.AuditEntry
+	assert.Eventually(t, func() bool {
+		entries, err = logic.GetAuditEntries("skynet", nodeGet.Node.ID, start)
+		return err == nil && len(entries) == 1
+	}, time.Second, time.Millisecond*10)
+	assert.Equal(t, models.AUDIT_CREATE_NODE, entries[0].Action)
+	for _, change := range entries[0].Changes {
+		assert.NotContains(t, []string{"accesskey", "accesskeyhash", "password"}, change.Field)
+	}
+	data, err := json.Marshal(entries)
+	assert.Nil(t, err)
+	assert.NotContains(t, string(data), key.Value)
+	deleteAllNodes()
+	deleteAllNetworks()
+}
+
+func TestAuditNodeOperations(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	deleteAllNodes()
+	createNet()
+	node := createTestNode()
+	pending := []models.Node{}
+	for i, name := range []string{"uncordoned", "approved"} {
+		key, err := wgtypes.GeneratePrivateKey()
+		assert.Nil(t, err)
+		peer := models.Node{PublicKey: key.PublicKey().String(), Name: name, Endpoint: fmt.Sprintf("10.0.1.%d", i+1), MacAddress: fmt.Sprintf("01:02:03:04:05:%02d", i+10), Password: "password", Network: "skynet", OS: "linux", IsPending: "yes"}
+		assert.Nil(t, logic.CreateNode(&peer))
+		pending = append(pending, peer)
+	}
+	start := time.Now().Unix()
+	call := func(handler http.HandlerFunc, nodeid, body string) {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		req = mux.SetURLVars(req, map[string]string{"network": "skynet", "nodeid": nodeid})
+		req.Header.Set("user", "ci-admin")
+		w := httptest.NewRecorder()
+		handler(w, req)
+		assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	}
+	call(reassignNodeIP, node.ID, `{"address":"10.0.0.77"}`)
+	call(rotateNodeKeys, node.ID, "")
+	call(drainNode, node.ID, "")
+	call(uncordonNode, pending[0].ID, "")
+	call(approveNodes, "", fmt.Sprintf(`{"nodeids":[%q]}`, pending[1].ID))
+	_, err := logic.CreateNetwork(models.Network{NetID: "movenet", AddressRange: "10.0.70.0/24"})
+	assert.Nil(t, err)
+	call(moveNode, pending[0].ID, `{"network":"movenet"}`)
+	expected := map[string]string{
+		models.AUDIT_REASSIGN_ADDRESS: "address",
+		models.AUDIT_ROTATE_KEYS:      "action",
+		models.AUDIT_DRAIN_NODE:       "isdraining",
+		models.AUDIT_APPROVE_NODE:     "ispending",
+		models.AUDIT_MOVE_NODE:        "network",
+	}
+	var entries []models.AuditEntry
+	assert.Eventually(t, func() bool {
+		entries, err = logic.GetAuditEntries("", "", start)
+		return err == nil && len(entries) >= 6
+	}, time.Second, time.Millisecond*10)
+	var approvals int
+	for _, entry := range entries {
+		field, ok := expected[entry.Action]
+		if !ok {
+			continue
+		}
+		assert.Equal(t, "ci-admin", entry.User)
+		var fields []string
+		for _, change := range entry.Changes {
+			fields = append(fields, change.Field)
+		}
+		assert.Contains(t, fields, field, entry.Action)
+		if entry.Action == models.AUDIT_APPROVE_NODE {
+			approvals++
+		}
+	}
+	assert.Equal(t, 2, approvals)
+	var moved bool
+	for _, entry := range entries {
+		moved = moved || entry.Action == models.AUDIT_MOVE_NODE
+	}
+	assert.True(t, moved)
+	deleteAllNodes()
+	deleteAllNetworks()
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
 	"github.com/gravitl/netmaker/logger"
+	"github.com/gravitl/netmaker/logic"
 	"github.com/gravitl/netmaker/servercfg"
 )
 
@@ -24,6 +25,32 @@ var HttpHandlers = []interface{}{
 	fileHandlers,
 	serverHandlers,
 	extClientHandlers,
+	metricsHandlers,
+	serviceAccountHandlers,
+	auditHandlers,
+}
+
+// corsHandler - wraps the api in the cors policy from the server config, preflight requests are
+// answered here before reaching any auth middleware and no origin is allowed unless configured
+func corsHandler(h http.Handler) http.Handler {
+	options := []handlers.CORSOption{
+		handlers.AllowedHeaders(servercfg.GetAllowedHeaders()),
+		handlers.AllowedMethods(servercfg.GetAllowedMethods()),
+		handlers.ExposedHeaders([]string{"X-Total-Count", "ETag"}),
+	}
+	origins := servercfg.GetAllowedOrigins()
+	if logic.StringSliceContains(origins, "*") {
+		options = append(options, handlers.AllowedOrigins([]string{"*"}))
+	} else {
+		// an empty origin list means any origin to the cors handler, so origins are matched here
+		options = append(options, handlers.AllowedOriginValidator(func(origin string) bool {
+			return logic.StringSliceContains(origins, origin)
+		}))
+	}
+	if servercfg.IsCORSAllowCredentials() {
+		options = append(options, handlers.AllowCredentials())
+	}
+	return handlers.CORS(options...)(h)
 }
 
 // HandleRESTRequests - handles the rest requests
@@ -31,12 +58,7 @@ func HandleRESTRequests(wg *sync.WaitGroup) {
 	defer wg.Done()
 
 	r := mux.NewRouter()
-
-	// Currently allowed dev origin is all. Should change in prod
-	// should consider analyzing the allowed methods further
-	headersOk := handlers.AllowedHeaders([]string{"Access-Control-Allow-Origin", "X-Requested-With", "Content-Type", "authorization"})
-	originsOk := handlers.AllowedOrigins([]string{servercfg.GetAllowedOrigin()})
-	methodsOk := handlers.AllowedMethods([]string{"GET", "PUT", "POST", "DELETE"})
+	r.Use(instrumentRequests)
 
 	for _, handler := range HttpHandlers {
 		handler.(func(*mux.Router))(r)
@@ -44,7 +66,7 @@ func HandleRESTRequests(wg *sync.WaitGroup) {
 
 	port := servercfg.GetAPIPort()
 
-	srv := &http.Server{Addr: ":" + port, Handler: handlers.CORS(originsOk, headersOk, methodsOk)(r)}
+	srv := &http.Server{Addr: ":" + port, Handler: corsHandler(r)}
 	go func() {
 		err := srv.ListenAndServe()
 		if err != nil {
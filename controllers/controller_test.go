@@ -0,0 +1,65 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCORSHandler(t *testing.T) {
+	var reached bool
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+		// stands in for the auth middleware
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+	call := func(method, origin string) *httptest.ResponseRecorder {
+		reached = false
+		req := httptest.NewRequest(method, "/api/nodes/skynet", nil)
+		req.Header.Set("Origin", origin)
+		if method == http.MethodOptions {
+			req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+			req.Header.Set("Access-Control-Request-Headers", "authorization")
+		}
+		w := httptest.NewRecorder()
+		corsHandler(next).ServeHTTP(w, req)
+		return w
+	}
+	t.Run("DefaultDeniesOrigins", func(t *testing.T) {
+		t.Setenv("CORS_ALLOWED_ORIGIN", "")
+		w := call(http.MethodOptions, "https://dashboard.example.com")
+		assert.False(t, reached)
+		assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+		w = call(http.MethodGet, "https://dashboard.example.com")
+		assert.True(t, reached)
+		assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+	})
+	t.Run("AllowedOrigin", func(t *testing.T) {
+		t.Setenv("CORS_ALLOWED_ORIGIN", "https://other.example.com, https://dashboard.example.com")
+		w := call(http.MethodOptions, "https://dashboard.example.com")
+		assert.False(t, reached)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "https://dashboard.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+		assert.Empty(t, w.Header().Get("Access-Control-Allow-Credentials"))
+		w = call(http.MethodGet, "https://evil.example.com")
+		assert.True(t, reached)
+		assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+	})
+	t.Run("DisallowedMethod", func(t *testing.T) {
+		t.Setenv("CORS_ALLOWED_ORIGIN", "https://dashboard.example.com")
+		t.Setenv("CORS_ALLOWED_METHODS", "POST")
+		w := call(http.MethodOptions, "https://dashboard.example.com")
+		assert.False(t, reached)
+		assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	})
+	t.Run("AnyOriginWithCredentials", func(t *testing.T) {
+		t.Setenv("CORS_ALLOWED_ORIGIN", "*")
+		t.Setenv("CORS_ALLOW_CREDENTIALS", "on")
+		w := call(http.MethodGet, "https://dashboard.example.com")
+		assert.True(t, reached)
+		assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+		assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"strconv"
 
@@ -136,63 +137,7 @@ func getExtClientConf(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	addrString := client.Address
-	if addrString != "" {
-		addrString += "/32"
-	}
-	if client.Address6 != "" {
-		if addrString != "" {
-			addrString += ","
-		}
-		addrString += client.Address6 + "/128"
-	}
-
-	keepalive := ""
-	if network.DefaultKeepalive != 0 {
-		keepalive = "PersistentKeepalive = " + strconv.Itoa(int(network.DefaultKeepalive))
-	}
-	gwendpoint := gwnode.Endpoint + ":" + strconv.Itoa(int(gwnode.ListenPort))
-	newAllowedIPs := network.AddressRange
-	if newAllowedIPs != "" && network.AddressRange6 != "" {
-		newAllowedIPs += ","
-	}
-	if network.AddressRange6 != "" {
-		newAllowedIPs += network.AddressRange6
-	}
-	if egressGatewayRanges, err := logic.GetEgressRangesOnNetwork(&client); err == nil {
-		for _, egressGatewayRange := range egressGatewayRanges {
-			newAllowedIPs += "," + egressGatewayRange
-		}
-	}
-	defaultDNS := ""
-	if network.DefaultExtClientDNS != "" {
-		defaultDNS = "DNS = " + network.DefaultExtClientDNS
-	}
-
-	defaultMTU := 1420
-	if gwnode.MTU != 0 {
-		defaultMTU = int(gwnode.MTU)
-	}
-	config := fmt.Sprintf(`[Interface]
-Address = %s
-PrivateKey = %s
-MTU = %d
-%s
-
-[Peer]
-PublicKey = %s
-AllowedIPs = %s
-Endpoint = %s
-%s
-
-`, addrString,
-		client.PrivateKey,
-		defaultMTU,
-		defaultDNS,
-		gwnode.PublicKey,
-		newAllowedIPs,
-		gwendpoint,
-		keepalive)
+	config := logic.GetExtClientWGQuickConf(&client, &gwnode, &network)
 
 	if params["type"] == "qr" {
 		bytes, err := qrcode.Encode(config, qrcode.Medium, 220)
@@ -243,7 +188,13 @@ func createExtClient(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// the body is optional, it may ask for the client's addresses
 	var extclient models.ExtClient
+	if err := json.NewDecoder(r.Body).Decode(&extclient); err != nil && !errors.Is(err, io.EOF) {
+		returnErrorResponse(w, r, formatErrorCode(err, "badrequest", models.ERR_INVALID_REQUEST))
+		return
+	}
+	extclient = models.ExtClient{Address: extclient.Address, Address6: extclient.Address6}
 	extclient.Network = networkName
 	extclient.IngressGatewayID = nodeid
 	node, err := logic.GetNodeByID(nodeid)
@@ -260,7 +211,7 @@ func createExtClient(w http.ResponseWriter, r *http.Request) {
 	}
 	err = logic.CreateExtClient(&extclient)
 	if err != nil {
-		returnErrorResponse(w, r, formatError(err, "internal"))
+		returnErrorResponse(w, r, extClientAddressError(err))
 		return
 	}
 	logger.Log(0, r.Header.Get("user"), "created new ext client on network", networkName)
@@ -271,6 +222,25 @@ func createExtClient(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// extClientAddressError - 400 for an address outside the gateway's client cidr, 409 for a taken address
+// or a full client cidr, otherwise 500
+func extClientAddressError(err error) models.ErrorResponse {
+	if errors.Is(err, logic.ErrExtClientOutsideCIDR) {
+		return formatErrorCode(err, "badrequest", models.ERR_INVALID_REQUEST)
+	}
+	var conflict *logic.AddressConflictError
+	if errors.As(err, &conflict) {
+		errorResponse := formatErrorCode(err, "conflict", models.ERR_ADDRESS_IN_USE)
+		errorResponse.ConflictingNodeID = conflict.OwnerID
+		return errorResponse
+	}
+	var exhausted *logic.RequestedRangeExhaustedError
+	if errors.As(err, &exhausted) {
+		return formatErrorCode(err, "conflict", models.ERR_ADDRESS_RANGE_EXHAUSTED)
+	}
+	return formatError(err, "internal")
+}
+
 func updateExtClient(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
@@ -0,0 +1,33 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gravitl/netmaker/logger"
+	"github.com/gravitl/netmaker/logic"
+	"github.com/gravitl/netmaker/models"
+)
+
+// blockDuringMaintenance - middleware answering 503 with a Retry-After to node changes while the server
+// is in maintenance mode, the change is let through if the mode cannot be read; reads, metrics reported by
+// nodes and republishing updates that change no node are not blocked
+func blockDuringMaintenance(next http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		mode, err := logic.GetMaintenanceMode()
+		if err != nil {
+			logger.Log(1, "failed to read maintenance mode", err.Error())
+		}
+		if err != nil || !mode.Enabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+		err = logic.ErrMaintenance
+		if mode.Reason != "" {
+			err = fmt.Errorf("%w: %s", logic.ErrMaintenance, mode.Reason)
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(mode.RetryAfter))
+		returnErrorResponse(w, r, formatErrorCode(err, "unavailable", models.ERR_MAINTENANCE))
+	}
+}
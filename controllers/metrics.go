@@ -0,0 +1,59 @@
+package controller
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gravitl/netmaker/logic/metrics"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+func metricsHandlers(r *mux.Router) {
+	r.Handle("/metrics", securityCheck(true, promhttp.Handler())).Methods("GET")
+}
+
+// statusRecorder - captures the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// statusRecorder.WriteHeader - records the status before writing it
+func (rec *statusRecorder) WriteHeader(code int) {
+	rec.status = code
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+// statusRecorder.Flush - passes flushes through so streaming handlers still work
+func (rec *statusRecorder) Flush() {
+	if flusher, ok := rec.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// instrumentRequests - middleware counting requests and their latency per route
+func instrumentRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		endpoint := r.URL.Path
+		if route := mux.CurrentRoute(r); route != nil {
+			if template, err := route.GetPathTemplate(); err == nil {
+				endpoint = template
+			}
+		}
+		metrics.Requests.WithLabelValues(endpoint, r.Method, mux.Vars(r)["network"], metrics.StatusOutcome(rec.status)).Inc()
+		metrics.RequestDuration.WithLabelValues(endpoint, r.Method).Observe(time.Since(start).Seconds())
+	})
+}
+
+// instrumentNodeOperation - counts node create, update and delete calls by network and outcome
+func instrumentNodeOperation(operation string, next http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		metrics.NodeOperations.WithLabelValues(operation, mux.Vars(r)["network"], metrics.StatusOutcome(rec.status)).Inc()
+	}
+}
@@ -0,0 +1,35 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/gravitl/netmaker/logic/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInstrumentNodeOperation(t *testing.T) {
+	r := mux.NewRouter()
+	r.HandleFunc("/api/nodes/{network}", instrumentNodeOperation("create", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))).Methods("POST")
+	r.HandleFunc("/api/nodes/{network}/{nodeid}", instrumentNodeOperation("delete", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		returnErrorResponse(w, r, formatError(errors.New("bad request"), "badrequest"))
+	}))).Methods("DELETE")
+	t.Run("Success", func(t *testing.T) {
+		before := testutil.ToFloat64(metrics.NodeOperations.WithLabelValues("create", "metricsnet", metrics.OUTCOME_SUCCESS))
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/nodes/metricsnet", nil))
+		after := testutil.ToFloat64(metrics.NodeOperations.WithLabelValues("create", "metricsnet", metrics.OUTCOME_SUCCESS))
+		assert.Equal(t, before+1, after)
+	})
+	t.Run("Error", func(t *testing.T) {
+		before := testutil.ToFloat64(metrics.NodeOperations.WithLabelValues("delete", "metricsnet", metrics.OUTCOME_ERROR))
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodDelete, "/api/nodes/metricsnet/node", nil))
+		after := testutil.ToFloat64(metrics.NodeOperations.WithLabelValues("delete", "metricsnet", metrics.OUTCOME_ERROR))
+		assert.Equal(t, before+1, after)
+	})
+}
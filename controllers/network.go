@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/gorilla/mux"
@@ -31,9 +32,12 @@ func networkHandlers(r *mux.Router) {
 	r.HandleFunc("/api/networks/{networkname}/nodelimit", securityCheck(true, http.HandlerFunc(updateNetworkNodeLimit))).Methods("PUT")
 	r.HandleFunc("/api/networks/{networkname}", securityCheck(true, http.HandlerFunc(deleteNetwork))).Methods("DELETE")
 	r.HandleFunc("/api/networks/{networkname}/keyupdate", securityCheck(true, http.HandlerFunc(keyUpdate))).Methods("POST")
+	r.HandleFunc("/api/networks/{networkname}/utilization", securityCheck(false, http.HandlerFunc(getNetworkUtilization))).Methods("GET")
+	r.HandleFunc("/api/networks/{networkname}/rotatepsk", securityCheck(true, http.HandlerFunc(rotatePresharedKeys))).Methods("POST")
 	r.HandleFunc("/api/networks/{networkname}/keys", securityCheck(false, http.HandlerFunc(createAccessKey))).Methods("POST")
 	r.HandleFunc("/api/networks/{networkname}/keys", securityCheck(false, http.HandlerFunc(getAccessKeys))).Methods("GET")
 	r.HandleFunc("/api/networks/{networkname}/keys/{name}", securityCheck(false, http.HandlerFunc(deleteAccessKey))).Methods("DELETE")
+	r.HandleFunc("/api/networks/{networkname}/keys/{name}/nodes", securityCheck(false, http.HandlerFunc(getAccessKeyNodes))).Methods("GET")
 	// ACLs
 	r.HandleFunc("/api/networks/{networkname}/acls", securityCheck(true, http.HandlerFunc(updateNetworkACL))).Methods("PUT")
 	r.HandleFunc("/api/networks/{networkname}/acls", securityCheck(true, http.HandlerFunc(getNetworkACL))).Methods("GET")
@@ -123,6 +127,40 @@ func keyUpdate(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// getNetworkUtilization - how many addresses of a network's ranges are in use, so capacity can be added before it runs out
+func getNetworkUtilization(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	netname := mux.Vars(r)["networkname"]
+	utilization, err := logic.GetAddressUtilization(netname)
+	if err != nil {
+		if database.IsEmptyRecord(err) {
+			returnErrorResponse(w, r, formatErrorCode(errors.New("network does not exist"), "notfound", models.ERR_NETWORK_NOT_FOUND))
+			return
+		}
+		returnErrorResponse(w, r, formatError(err, "internal"))
+		return
+	}
+	logger.Log(2, r.Header.Get("user"), "fetched address utilization of network", netname)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(utilization)
+}
+
+// rotatePresharedKeys - gives every peer pair on a network a new preshared key, the keys themselves are never returned
+func rotatePresharedKeys(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	netname := mux.Vars(r)["networkname"]
+	if _, err := logic.RotatePresharedKeys(netname); err != nil {
+		if database.IsEmptyRecord(err) {
+			returnErrorResponse(w, r, formatErrorCode(errors.New("network does not exist"), "notfound", models.ERR_NETWORK_NOT_FOUND))
+			return
+		}
+		returnErrorResponse(w, r, formatError(err, "internal"))
+		return
+	}
+	logger.Log(1, r.Header.Get("user"), "rotated preshared keys on network", netname)
+	returnSuccessResponse(w, r, "rotated preshared keys on network "+netname)
+}
+
 // Update a network
 func updateNetwork(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
@@ -148,6 +186,14 @@ func updateNetwork(w http.ResponseWriter, r *http.Request) {
 	}
 
 	rangeupdate4, rangeupdate6, localrangeupdate, holepunchupdate, err := logic.UpdateNetwork(&network, &newNetwork)
+	if errors.Is(err, logic.ErrStaticAddress) {
+		returnErrorResponse(w, r, formatErrorCode(err, "conflict", models.ERR_STATIC_ADDRESS))
+		return
+	}
+	if errors.Is(err, logic.ErrInvalidPostCommandTemplate) {
+		returnErrorResponse(w, r, formatErrorCode(err, "badrequest", models.ERR_INVALID_POST_COMMAND_TEMPLATE))
+		return
+	}
 	if err != nil {
 		returnErrorResponse(w, r, formatError(err, "badrequest"))
 		return
@@ -181,6 +227,9 @@ func updateNetwork(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 	}
+	if newNetwork.PresharedKeys != network.PresharedKeys {
+		logic.PeerUpdateQueue(network.NetID)
+	}
 	if rangeupdate4 || rangeupdate6 || localrangeupdate || holepunchupdate {
 		nodes, err := logic.GetNetworkNodes(network.NetID)
 		if err != nil {
@@ -321,6 +370,10 @@ func createNetwork(w http.ResponseWriter, r *http.Request) {
 	}
 
 	network, err = logic.CreateNetwork(network)
+	if errors.Is(err, logic.ErrInvalidPostCommandTemplate) {
+		returnErrorResponse(w, r, formatErrorCode(err, "badrequest", models.ERR_INVALID_POST_COMMAND_TEMPLATE))
+		return
+	}
 	if err != nil {
 		returnErrorResponse(w, r, formatError(err, "badrequest"))
 		return
@@ -388,6 +441,39 @@ func getAccessKeys(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(keys)
 }
 
+// getAccessKeyNodes - nodes of a network that enrolled with an access key, paged and sorted like the
+// node list, oldest first by default
+func getAccessKeyNodes(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var params = mux.Vars(r)
+	query, err := parseNodeListQuery(r)
+	if err != nil {
+		returnErrorResponse(w, r, formatError(err, "badrequest"))
+		return
+	}
+	if query.sort == "" {
+		query.sort = "created"
+	}
+	nodes, err := logic.GetAccessKeyNodes(params["networkname"], params["name"])
+	if err != nil {
+		if database.IsEmptyRecord(err) {
+			returnErrorResponse(w, r, formatErrorCode(errors.New("network does not exist"), "notfound", models.ERR_NETWORK_NOT_FOUND))
+			return
+		}
+		if errors.Is(err, logic.ErrAccessKeyNotFound) {
+			returnErrorResponse(w, r, formatErrorCode(err, "notfound", models.ERR_ACCESS_KEY_NOT_FOUND))
+			return
+		}
+		returnErrorResponse(w, r, formatError(err, "internal"))
+		return
+	}
+	nodes, total := query.apply(nodes)
+	logger.Log(2, r.Header.Get("user"), "fetched nodes enrolled with access key", params["name"], "on network", params["networkname"])
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(nodes)
+}
+
 // delete key. Has to do a little funky logic since it's not a collection item
 func deleteAccessKey(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
@@ -1,13 +1,22 @@
 package controller
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/gorilla/mux"
 	"github.com/gravitl/netmaker/database"
 	"github.com/gravitl/netmaker/logic"
 	"github.com/gravitl/netmaker/models"
 	"github.com/stretchr/testify/assert"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 )
 
 type NetworkValidationTestCase struct {
@@ -133,6 +142,52 @@ func TestCreateKey(t *testing.T) {
 	})
 }
 
+func TestAccessKeyLifecycle(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	createNet()
+	t.Run("PastExpiration", func(t *testing.T) {
+		network, err := logic.GetNetwork("skynet")
+		assert.Nil(t, err)
+		_, err = logic.CreateAccessKey(models.AccessKey{Name: "expired", Expiration: time.Now().Add(-time.Minute).Unix()}, network)
+		assert.EqualError(t, err, "access key expiration must be in the future")
+	})
+	t.Run("SingleUse", func(t *testing.T) {
+		network, err := logic.GetNetwork("skynet")
+		assert.Nil(t, err)
+		key, err := logic.CreateAccessKey(models.AccessKey{Name: "singleuse", Uses: 1, Expiration: time.Now().Add(time.Hour).Unix()}, network)
+		assert.Nil(t, err)
+		assert.True(t, logic.IsKeyValid("skynet", key.Value))
+		logic.DecrimentKey("skynet", key.Value)
+		assert.False(t, logic.IsKeyValid("skynet", key.Value))
+	})
+	t.Run("Expired", func(t *testing.T) {
+		network, err := logic.GetNetwork("skynet")
+		assert.Nil(t, err)
+		key, err := logic.CreateAccessKey(models.AccessKey{Name: "shortlived", Uses: 5, Expiration: time.Now().Add(time.Hour).Unix()}, network)
+		assert.Nil(t, err)
+		// age the key past its expiration
+		network, err = logic.GetNetwork("skynet")
+		assert.Nil(t, err)
+		for i := range network.AccessKeys {
+			if network.AccessKeys[i].Name == key.Name {
+				network.AccessKeys[i].Expiration = time.Now().Add(-time.Second).Unix()
+			}
+		}
+		data, err := json.Marshal(&network)
+		assert.Nil(t, err)
+		err = database.Insert(network.NetID, string(data), database.NETWORKS_TABLE_NAME)
+		assert.Nil(t, err)
+		assert.False(t, logic.IsKeyValid("skynet", key.Value))
+		logic.DecrimentKey("skynet", "")
+		keys, err := logic.GetKeys("skynet")
+		assert.Nil(t, err)
+		for _, k := range keys {
+			assert.NotEqual(t, key.Name, k.Name)
+		}
+	})
+}
+
 func TestGetKeys(t *testing.T) {
 	database.InitializeDatabase()
 	deleteAllNetworks()
@@ -305,6 +360,239 @@ func TestIpv6Network(t *testing.T) {
 	})
 }
 
+func TestNetworkAddressExhaustion(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	_, err := logic.CreateNetwork(models.Network{NetID: "tinynet", AddressRange: "10.0.40.0/30"})
+	assert.Nil(t, err)
+	node1 := models.Node{PublicKey: "DM5qhLAE20PG9BbfBCger+Ac9D2NDOwCtY1rbYDLf34=", Name: "tinyone", Endpoint: "10.0.0.50", MacAddress: "01:02:03:04:05:06", Password: "password", Network: "tinynet", OS: "linux"}
+	node2 := models.Node{PublicKey: "DM5qhLAE20FG7BbfBCger+Ac9D2NDOwCtY1rbYDXf14=", Name: "tinytwo", Endpoint: "10.0.0.100", MacAddress: "01:02:03:04:05:07", Password: "password", Network: "tinynet", OS: "linux"}
+	assert.Nil(t, logic.CreateNode(&node1))
+	assert.Nil(t, logic.CreateNode(&node2))
+	getUtilization := func(network string) (int, models.AddressUtilization) {
+		req := httptest.NewRequest(http.MethodGet, "/api/networks/"+network+"/utilization", nil)
+		req = mux.SetURLVars(req, map[string]string{"networkname": network})
+		w := httptest.NewRecorder()
+		getNetworkUtilization(w, req)
+		var utilization models.AddressUtilization
+		json.NewDecoder(w.Body).Decode(&utilization)
+		return w.Code, utilization
+	}
+	t.Run("Utilization", func(t *testing.T) {
+		code, utilization := getUtilization("tinynet")
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, 2, utilization.Used)
+		assert.Equal(t, uint64(2), utilization.Total)
+		code, _ = getUtilization("missingnet")
+		assert.Equal(t, http.StatusNotFound, code)
+	})
+	t.Run("Exhausted", func(t *testing.T) {
+		node3 := models.Node{PublicKey: "yPKd5Gp8Tj8Z8qWfJ4Fz3Rr6cYb2Ly0zQ7Gx1kHhV2M=", Name: "tinythree", Endpoint: "10.0.0.150", MacAddress: "01:02:03:04:05:08", Password: "password", Network: "tinynet", OS: "linux"}
+		err := logic.CreateNode(&node3)
+		var exhausted *logic.AddressExhaustedError
+		assert.ErrorAs(t, err, &exhausted)
+		assert.Equal(t, "network tinynet is full, all 2 addresses of 10.0.40.0/30 are in use", err.Error())
+		assert.Equal(t, 2, exhausted.Utilization.Used)
+	})
+	deleteAllNodes()
+	deleteAllNetworks()
+}
+
+func TestPostCommandTemplates(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	network := models.Network{NetID: "tplnet", AddressRange: "10.0.50.0/24",
+		DefaultPostUp:   "iptables -A FORWARD -i {{.Interface}} -s {{.Address}} -j ACCEPT -m comment --comment {{.Network}}",
+		DefaultPostDown: "iptables -D FORWARD -i {{.Interface}} -s {{.Address}} -j ACCEPT -m comment --comment {{.Network}}",
+	}
+	t.Run("InvalidTemplate", func(t *testing.T) {
+		for _, postUp := range []string{"iptables -A FORWARD -i {{.Interface", "iptables -A FORWARD -i {{.Port}}"} {
+			invalid := network
+			invalid.DefaultPostUp = postUp
+			_, err := logic.CreateNetwork(invalid)
+			assert.ErrorIs(t, err, logic.ErrInvalidPostCommandTemplate, postUp)
+			assert.Contains(t, err.Error(), "defaultpostup")
+		}
+	})
+	_, err := logic.CreateNetwork(network)
+	assert.Nil(t, err)
+	t.Run("Rendered", func(t *testing.T) {
+		node := models.Node{PublicKey: "DM5qhLAE20PG9BbfBCger+Ac9D2NDOwCtY1rbYDLf34=", Name: "tplone", Endpoint: "10.0.0.50", MacAddress: "01:02:03:04:05:06", Password: "password", Network: "tplnet", OS: "linux"}
+		assert.Nil(t, logic.CreateNode(&node))
+		assert.Equal(t, "iptables -A FORWARD -i nm-tplnet -s "+node.Address+" -j ACCEPT -m comment --comment tplnet", node.PostUp)
+		assert.Equal(t, "iptables -D FORWARD -i nm-tplnet -s "+node.Address+" -j ACCEPT -m comment --comment tplnet", node.PostDown)
+	})
+	t.Run("NodeCommandKept", func(t *testing.T) {
+		node := models.Node{PublicKey: "DM5qhLAE20FG7BbfBCger+Ac9D2NDOwCtY1rbYDXf14=", Name: "tpltwo", Endpoint: "10.0.0.100", MacAddress: "01:02:03:04:05:07", Password: "password", Network: "tplnet", OS: "linux", PostUp: "echo up"}
+		assert.Nil(t, logic.CreateNode(&node))
+		assert.Equal(t, "echo up", node.PostUp)
+		assert.Contains(t, node.PostDown, "-s "+node.Address+" ")
+	})
+	t.Run("Update", func(t *testing.T) {
+		current, err := logic.GetNetwork("tplnet")
+		assert.Nil(t, err)
+		update := current
+		update.DefaultPostDown = "iptables -D FORWARD -i {{.Iface}}"
+		_, _, _, _, err = logic.UpdateNetwork(&current, &update)
+		assert.ErrorIs(t, err, logic.ErrInvalidPostCommandTemplate)
+		assert.Contains(t, err.Error(), "defaultpostdown")
+	})
+	deleteAllNodes()
+	deleteAllNetworks()
+}
+
+func TestAccessKeyNodes(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	createNet()
+	os.Setenv("MASTER_KEY", "secretkey")
+	defer os.Unsetenv("MASTER_KEY")
+	network, err := logic.GetNetwork("skynet")
+	assert.Nil(t, err)
+	fleetKey, err := logic.CreateAccessKey(models.AccessKey{Name: "fleet", Uses: 10}, network)
+	assert.Nil(t, err)
+	network, err = logic.GetNetwork("skynet")
+	assert.Nil(t, err)
+	otherKey, err := logic.CreateAccessKey(models.AccessKey{Name: "other", Uses: 10}, network)
+	assert.Nil(t, err)
+	r := mux.NewRouter()
+	nodeHandlers(r)
+	networkHandlers(r)
+	join := func(name, accessKey string) models.Node {
+		key, err := wgtypes.GeneratePrivateKey()
+		assert.Nil(t, err)
+		node := models.Node{Name: name, PublicKey: key.PublicKey().String(), Endpoint: "192.0.2.10", MacAddress: "02:00:00:00:00:" + name[len(name)-2:], Password: "password", Network: "skynet", OS: "linux", AccessKey: accessKey,
+			AccessKeyHash: "forged", AccessKeyName: "forged", TrafficKeys: models.TrafficKeys{Mine: []byte("node-traffic-key")}}
+		body, err := json.Marshal(&node)
+		assert.Nil(t, err)
+		req := httptest.NewRequest(http.MethodPost, "/api/nodes/skynet", bytes.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+accessKey)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var created models.NodeGet
+		assert.Nil(t, json.NewDecoder(w.Body).Decode(&created))
+		stored, err := logic.GetNodeByID(created.Node.ID)
+		assert.Nil(t, err)
+		return stored
+	}
+	list := func(keyname, query string) (*httptest.ResponseRecorder, []models.Node) {
+		req := httptest.NewRequest(http.MethodGet, "/api/networks/skynet/keys/"+keyname+"/nodes?"+query, nil)
+		req.Header.Set("Authorization", "Bearer secretkey")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		var nodes []models.Node
+		if w.Code == http.StatusOK {
+			assert.Nil(t, json.NewDecoder(w.Body).Decode(&nodes))
+		}
+		return w, nodes
+	}
+	fleet1 := join("fleet01", fleetKey.Value)
+	join("fleet02", fleetKey.Value)
+	join("fleet03", fleetKey.Value)
+	join("other04", otherKey.Value)
+	t.Run("HashStored", func(t *testing.T) {
+		assert.Equal(t, logic.HashAccessKey(fleetKey.Value), fleet1.AccessKeyHash)
+		assert.NotContains(t, fleet1.AccessKeyHash, fleetKey.Value)
+		assert.Equal(t, "fleet", fleet1.AccessKeyName)
+		update := fleet1
+		update.AccessKeyHash = "changed"
+		assert.Nil(t, logic.UpdateNode(&fleet1, &update))
+		stored, err := logic.GetNodeByID(fleet1.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, fleet1.AccessKeyHash, stored.AccessKeyHash)
+	})
+	t.Run("List", func(t *testing.T) {
+		w, nodes := list("fleet", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Len(t, nodes, 3)
+		assert.Equal(t, "3", w.Header().Get("X-Total-Count"))
+		w, nodes = list("other", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Len(t, nodes, 1)
+		assert.Equal(t, "other04", nodes[0].Name)
+	})
+	t.Run("Paged", func(t *testing.T) {
+		w, nodes := list("fleet", "limit=2&offset=1&sort=name")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "3", w.Header().Get("X-Total-Count"))
+		assert.Equal(t, 2, len(nodes))
+		assert.Equal(t, "fleet02", nodes[0].Name)
+		assert.Equal(t, "fleet03", nodes[1].Name)
+	})
+	t.Run("UsedUp", func(t *testing.T) {
+		network, err := logic.GetNetwork("skynet")
+		assert.Nil(t, err)
+		onceKey, err := logic.CreateAccessKey(models.AccessKey{Name: "once", Uses: 1}, network)
+		assert.Nil(t, err)
+		join("once05", onceKey.Value)
+		keys, err := logic.GetKeys("skynet")
+		assert.Nil(t, err)
+		for _, key := range keys {
+			assert.NotEqual(t, "once", key.Name)
+		}
+		w, nodes := list("once", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		if assert.Len(t, nodes, 1) {
+			assert.Equal(t, "once05", nodes[0].Name)
+		}
+	})
+	t.Run("Deleted", func(t *testing.T) {
+		assert.Nil(t, logic.DeleteKey("fleet", "skynet"))
+		w, nodes := list("fleet", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Len(t, nodes, 3)
+	})
+	t.Run("NotFound", func(t *testing.T) {
+		w, _ := list("missing", "")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		var errResp models.ErrorResponse
+		assert.Nil(t, json.NewDecoder(w.Body).Decode(&errResp))
+		assert.Equal(t, models.ERR_ACCESS_KEY_NOT_FOUND, errResp.ErrorCode)
+	})
+	deleteAllNodes()
+	deleteAllNetworks()
+}
+
+func TestSingleUseKeyConcurrentJoins(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	createNet()
+	network, err := logic.GetNetwork("skynet")
+	assert.Nil(t, err)
+	key, err := logic.CreateAccessKey(models.AccessKey{Name: "once", Uses: 1}, network)
+	assert.Nil(t, err)
+	var wg sync.WaitGroup
+	errs := make([]error, 5)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			wgKey, err := wgtypes.GeneratePrivateKey()
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			node := models.Node{Name: fmt.Sprintf("joiner%d", i), PublicKey: wgKey.PublicKey().String(), Endpoint: "192.0.2.10", MacAddress: fmt.Sprintf("02:00:00:00:01:%02d", i), Password: "password", Network: "skynet", OS: "linux", AccessKey: key.Value}
+			errs[i] = logic.CreateNode(&node)
+		}(i)
+	}
+	wg.Wait()
+	created := 0
+	for _, err := range errs {
+		if err == nil {
+			created++
+			continue
+		}
+		assert.ErrorIs(t, err, logic.ErrAccessKeyUnusable)
+	}
+	assert.Equal(t, 1, created)
+	nodes, err := logic.GetNetworkNodes("skynet")
+	assert.Nil(t, err)
+	assert.Len(t, nodes, 1)
+	deleteAllNetworks()
+}
+
 func deleteAllNetworks() {
 	deleteAllNodes()
 	nets, _ := logic.GetNetworks()
@@ -1,16 +1,27 @@
 package controller
 
 import (
+	"archive/zip"
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/gravitl/netmaker/database"
-	"github.com/gravitl/netmaker/functions"
 	"github.com/gravitl/netmaker/logger"
 	"github.com/gravitl/netmaker/logic"
+	"github.com/gravitl/netmaker/logic/metrics"
 	"github.com/gravitl/netmaker/models"
 	"github.com/gravitl/netmaker/mq"
 	"github.com/gravitl/netmaker/servercfg"
@@ -18,25 +29,62 @@ import (
 )
 
 func nodeHandlers(r *mux.Router) {
+	// node routes share a subrouter so only they are written to the structured access log
+	r = r.NewRoute().Subrouter()
+	r.Use(logRequests)
 
 	r.HandleFunc("/api/nodes", authorize(false, false, "user", http.HandlerFunc(getAllNodes))).Methods("GET")
+	r.HandleFunc("/api/nodes/bykey/{pubkey}", securityCheck(true, http.HandlerFunc(getNodeByPublicKey))).Methods("GET")
 	r.HandleFunc("/api/nodes/{network}", authorize(false, true, "network", http.HandlerFunc(getNetworkNodes))).Methods("GET")
+	r.HandleFunc("/api/nodes/{network}/gateways", authorize(false, true, "network", http.HandlerFunc(getNetworkGateways))).Methods("GET")
+	r.HandleFunc("/api/nodes/{network}/events", authorize(false, true, "network", http.HandlerFunc(streamNodeEvents))).Methods("GET")
+	r.HandleFunc("/api/nodes/{network}/approve", authorize(false, true, "user", blockDuringMaintenance(http.HandlerFunc(approveNodes)))).Methods("POST")
+	r.HandleFunc("/api/nodes/{network}/epoch", authorize(true, true, "network", http.HandlerFunc(getPeerEpoch))).Methods("GET")
+	r.HandleFunc("/api/nodes/{network}/summary", authorize(false, true, "network", http.HandlerFunc(getNetworkNodeSummary))).Methods("GET")
+	r.HandleFunc("/api/nodes/{network}/stale", authorize(false, true, "network", http.HandlerFunc(getStaleNodes))).Methods("GET")
+	r.HandleFunc("/api/nodes/{network}/signup", nodeauth(requireNetwork(http.HandlerFunc(getSignupPolicy)))).Methods("GET")
+	r.HandleFunc("/api/nodes/{network}/validatekey", authorize(false, true, "network", http.HandlerFunc(validateAccessKey))).Methods("POST")
+	r.HandleFunc("/api/nodes/{network}/metrics", authorize(false, true, "network", http.HandlerFunc(getNetworkMetrics))).Methods("GET")
+	r.HandleFunc("/api/nodes/{network}/peerupdate", authorize(false, true, "user", http.HandlerFunc(pushPeerUpdate))).Methods("POST")
+	r.HandleFunc("/api/nodes/{network}/resync", securityCheck(true, http.HandlerFunc(resyncNetworkPeers))).Methods("POST")
+	r.HandleFunc("/api/nodes/{network}/acks/{ackid}", authorize(false, true, "network", http.HandlerFunc(getUpdateAck))).Methods("GET")
 	r.HandleFunc("/api/nodes/{network}/{nodeid}", authorize(true, true, "node", http.HandlerFunc(getNode))).Methods("GET")
-	r.HandleFunc("/api/nodes/{network}/{nodeid}", authorize(false, true, "node", http.HandlerFunc(updateNode))).Methods("PUT")
-	r.HandleFunc("/api/nodes/{network}/{nodeid}", authorize(true, true, "node", http.HandlerFunc(deleteNode))).Methods("DELETE")
-	r.HandleFunc("/api/nodes/{network}/{nodeid}/createrelay", authorize(false, true, "user", http.HandlerFunc(createRelay))).Methods("POST")
-	r.HandleFunc("/api/nodes/{network}/{nodeid}/deleterelay", authorize(false, true, "user", http.HandlerFunc(deleteRelay))).Methods("DELETE")
-	r.HandleFunc("/api/nodes/{network}/{nodeid}/creategateway", authorize(false, true, "user", http.HandlerFunc(createEgressGateway))).Methods("POST")
-	r.HandleFunc("/api/nodes/{network}/{nodeid}/deletegateway", authorize(false, true, "user", http.HandlerFunc(deleteEgressGateway))).Methods("DELETE")
-	r.HandleFunc("/api/nodes/{network}/{nodeid}/createingress", securityCheck(false, http.HandlerFunc(createIngressGateway))).Methods("POST")
-	r.HandleFunc("/api/nodes/{network}/{nodeid}/deleteingress", securityCheck(false, http.HandlerFunc(deleteIngressGateway))).Methods("DELETE")
-	r.HandleFunc("/api/nodes/{network}/{nodeid}/approve", authorize(false, true, "user", http.HandlerFunc(uncordonNode))).Methods("POST")
-	r.HandleFunc("/api/nodes/{network}", nodeauth(http.HandlerFunc(createNode))).Methods("POST")
+	r.HandleFunc("/api/nodes/{network}/{nodeid}", authorize(false, true, "node", blockDuringMaintenance(instrumentNodeOperation("update", http.HandlerFunc(updateNode))))).Methods("PUT")
+	r.HandleFunc("/api/nodes/{network}/{nodeid}", authorize(false, true, "node", blockDuringMaintenance(instrumentNodeOperation("update", http.HandlerFunc(patchNode))))).Methods("PATCH")
+	r.HandleFunc("/api/nodes/{network}/{nodeid}", authorize(true, true, "node", blockDuringMaintenance(instrumentNodeOperation("delete", http.HandlerFunc(deleteNode))))).Methods("DELETE")
+	r.HandleFunc("/api/nodes/{network}/{nodeid}/config", authorize(true, true, "node", http.HandlerFunc(getNodeConfig))).Methods("GET")
+	r.HandleFunc("/api/nodes/{network}/{nodeid}/peers", authorize(true, true, "node", http.HandlerFunc(getNodePeers))).Methods("GET")
+	r.HandleFunc("/api/nodes/{network}/{nodeid}/updatestatus", authorize(true, true, "node", http.HandlerFunc(getNodeUpdateStatus))).Methods("GET")
+	r.HandleFunc("/api/nodes/{network}/{nodeid}/push", authorize(false, true, "user", http.HandlerFunc(pushNodeUpdate))).Methods("POST")
+	r.HandleFunc("/api/nodes/{network}/{nodeid}/dns", authorize(true, true, "node", http.HandlerFunc(getNodeDNSRecords))).Methods("GET")
+	r.HandleFunc("/api/nodes/{network}/{nodeid}/metrics", authorize(true, true, "node", http.HandlerFunc(updateNodeMetrics))).Methods("POST")
+	r.HandleFunc("/api/nodes/{network}/{nodeid}/createrelay", authorize(false, true, "user", blockDuringMaintenance(http.HandlerFunc(createRelay)))).Methods("POST")
+	r.HandleFunc("/api/nodes/{network}/{nodeid}/deleterelay", authorize(false, true, "user", blockDuringMaintenance(http.HandlerFunc(deleteRelay)))).Methods("DELETE")
+	r.HandleFunc("/api/nodes/{network}/{nodeid}/creategateway", authorize(false, true, "user", blockDuringMaintenance(http.HandlerFunc(createEgressGateway)))).Methods("POST")
+	r.HandleFunc("/api/nodes/{network}/{nodeid}/deletegateway", authorize(false, true, "user", blockDuringMaintenance(http.HandlerFunc(deleteEgressGateway)))).Methods("DELETE")
+	r.HandleFunc("/api/nodes/{network}/{nodeid}/createingress", securityCheck(false, blockDuringMaintenance(http.HandlerFunc(createIngressGateway)))).Methods("POST")
+	r.HandleFunc("/api/nodes/{network}/{nodeid}/deleteingress", securityCheck(false, blockDuringMaintenance(http.HandlerFunc(deleteIngressGateway)))).Methods("DELETE")
+	r.HandleFunc("/api/nodes/{network}/{nodeid}/ingressclients", securityCheck(false, http.HandlerFunc(getIngressClients))).Methods("GET")
+	r.HandleFunc("/api/nodes/{network}/{nodeid}/drain", authorize(false, true, "user", blockDuringMaintenance(http.HandlerFunc(drainNode)))).Methods("POST")
+	r.HandleFunc("/api/nodes/{network}/{nodeid}/drain", authorize(false, true, "user", http.HandlerFunc(getNodeDrainStatus))).Methods("GET")
+	r.HandleFunc("/api/nodes/{network}/{nodeid}/reassignip", authorize(false, true, "user", blockDuringMaintenance(http.HandlerFunc(reassignNodeIP)))).Methods("POST")
+	r.HandleFunc("/api/nodes/{network}/{nodeid}/move", authorize(false, true, "user", blockDuringMaintenance(http.HandlerFunc(moveNode)))).Methods("POST")
+	r.HandleFunc("/api/nodes/{network}/{nodeid}/restore", authorize(false, true, "user", blockDuringMaintenance(instrumentNodeOperation("restore", http.HandlerFunc(restoreNode))))).Methods("POST")
+	r.HandleFunc("/api/nodes/{network}/{nodeid}/rotatekeys", authorize(false, true, "user", blockDuringMaintenance(http.HandlerFunc(rotateNodeKeys)))).Methods("POST")
+	r.HandleFunc("/api/nodes/{network}/{nodeid}/approve", authorize(false, true, "user", blockDuringMaintenance(http.HandlerFunc(uncordonNode)))).Methods("POST")
+	r.HandleFunc("/api/nodes/{network}", nodeauth(requireNetwork(blockDuringMaintenance(instrumentNodeOperation("create", http.HandlerFunc(createNode)))))).Methods("POST")
+	r.HandleFunc("/api/nodes/{network}/challenge", createAccessKeyChallenge).Methods("POST")
 	r.HandleFunc("/api/nodes/adm/{network}/lastmodified", authorize(false, true, "network", http.HandlerFunc(getLastModified))).Methods("GET")
 	r.HandleFunc("/api/nodes/adm/{network}/authenticate", authenticate).Methods("POST")
+	r.HandleFunc("/api/nodes/{network}/{nodeid}/tokenchallenge", createNodeTokenChallenge).Methods("POST")
+	r.HandleFunc("/api/nodes/{network}/{nodeid}/token", createNodeToken).Methods("POST")
 }
 
+// authenticate - issues a node token that lives for the network's TokenLifetime,
+// once it expires authorize answers 401 TOKEN_EXPIRED and the node authenticates again for a new one
 func authenticate(response http.ResponseWriter, request *http.Request) {
+	// headers set after WriteHeader are dropped, so the content type goes first
+	response.Header().Set("Content-Type", "application/json")
 
 	var authRequest models.AuthParams
 	var result models.Node
@@ -51,10 +99,12 @@ func authenticate(response http.ResponseWriter, request *http.Request) {
 	if decoderErr != nil {
 		errorResponse.Code = http.StatusBadRequest
 		errorResponse.Message = decoderErr.Error()
+		errorResponse.ErrorCode = models.ERR_INVALID_REQUEST
 		returnErrorResponse(response, request, errorResponse)
 		return
 	} else {
 		errorResponse.Code = http.StatusBadRequest
+		errorResponse.ErrorCode = models.ERR_INVALID_REQUEST
 		if authRequest.ID == "" {
 			errorResponse.Message = "W1R3: ID can't be empty"
 			returnErrorResponse(response, request, errorResponse)
@@ -64,28 +114,52 @@ func authenticate(response http.ResponseWriter, request *http.Request) {
 			returnErrorResponse(response, request, errorResponse)
 			return
 		} else {
+			limitKeys := authLimitKeys(request, authRequest.ID)
+			if logic.IsAuthRateLimited(limitKeys...) {
+				logger.Log(1, "rate limited authentication for node", authRequest.ID)
+				returnErrorResponse(response, request, formatErrorCode(fmt.Errorf("too many failed authentication attempts, try again later"), "toomanyrequests", models.ERR_RATE_LIMITED))
+				return
+			}
 			var err error
 			result, err = logic.GetNodeByID(authRequest.ID)
 
 			if err != nil {
+				logic.RecordAuthFailure(limitKeys...)
 				errorResponse.Code = http.StatusBadRequest
 				errorResponse.Message = err.Error()
+				errorResponse.ErrorCode = models.ERR_INVALID_CREDENTIALS
 				returnErrorResponse(response, request, errorResponse)
 				return
 			}
 
 			err = bcrypt.CompareHashAndPassword([]byte(result.Password), []byte(authRequest.Password))
 			if err != nil {
+				logic.RecordAuthFailure(limitKeys...)
 				errorResponse.Code = http.StatusBadRequest
 				errorResponse.Message = err.Error()
+				errorResponse.ErrorCode = models.ERR_INVALID_CREDENTIALS
 				returnErrorResponse(response, request, errorResponse)
 				return
 			} else {
-				tokenString, _ := logic.CreateJWT(authRequest.ID, authRequest.MacAddress, result.Network)
+				// only the node's attempts are cleared, the source keeps its budget for guesses at other nodes
+				logic.ResetAuthFailures(nodeLimitKey(result.ID))
+				if err = logic.RehashNodePassword(&result, authRequest.Password); err != nil {
+					logger.Log(1, "failed to rehash password of node", result.ID, err.Error())
+				}
+				network, err := requestNetwork(request, result.Network)
+				if err != nil {
+					errorResponse.Message = err.Error()
+					errorResponse.ErrorCode = models.ERR_INTERNAL
+					returnErrorResponse(response, request, errorResponse)
+					return
+				}
+				lifetime := logic.GetNodeTokenLifetime(&network)
+				tokenString, _ := logic.CreateJWT(authRequest.ID, authRequest.MacAddress, result.Network, lifetime)
 
 				if tokenString == "" {
 					errorResponse.Code = http.StatusBadRequest
 					errorResponse.Message = "Could not create Token"
+					errorResponse.ErrorCode = models.ERR_INTERNAL
 					returnErrorResponse(response, request, errorResponse)
 					return
 				}
@@ -96,24 +170,132 @@ func authenticate(response http.ResponseWriter, request *http.Request) {
 					Response: models.SuccessfulLoginResponse{
 						AuthToken: tokenString,
 						ID:        authRequest.ID,
+						Expires:   time.Now().Add(lifetime).Unix(),
 					},
 				}
 				successJSONResponse, jsonError := json.Marshal(successResponse)
 
 				if jsonError != nil {
 					errorResponse.Code = http.StatusBadRequest
-					errorResponse.Message = err.Error()
+					errorResponse.Message = jsonError.Error()
+					errorResponse.ErrorCode = models.ERR_INTERNAL
 					returnErrorResponse(response, request, errorResponse)
 					return
 				}
 				response.WriteHeader(http.StatusOK)
-				response.Header().Set("Content-Type", "application/json")
 				response.Write(successJSONResponse)
 			}
 		}
 	}
 }
 
+// creates a single use nonce a node seals with its wireguard private key to get a token without its password
+func createNodeTokenChallenge(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var params = mux.Vars(r)
+	if !logic.AllowAuthRequest(challengeLimitKeys(r)...) {
+		logger.Log(1, "rate limited token challenges for", r.RemoteAddr)
+		returnErrorResponse(w, r, formatErrorCode(errors.New("too many challenges requested, try again later"), "toomanyrequests", models.ERR_RATE_LIMITED))
+		return
+	}
+	node, err := getNetworkNode(params["network"], params["nodeid"])
+	if err != nil {
+		returnErrorResponse(w, r, nodeLookupError(err, params["nodeid"]))
+		return
+	}
+	challenge, err := logic.CreateNodeTokenChallenge(node.ID)
+	if err != nil {
+		returnErrorResponse(w, r, formatError(err, "internal"))
+		return
+	}
+	logger.Log(2, "created token challenge for node", node.ID, "on network", node.Network)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(challenge)
+}
+
+// createNodeToken - issues a fresh token to a node that proves it holds its wireguard private key
+// by answering a token challenge, a password-less alternative to authenticate
+func createNodeToken(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var params = mux.Vars(r)
+	var tokenRequest models.NodeTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&tokenRequest); err != nil {
+		returnErrorResponse(w, r, formatErrorCode(err, "badrequest", models.ERR_INVALID_REQUEST))
+		return
+	}
+	limitKeys := authLimitKeys(r, params["nodeid"])
+	if logic.IsAuthRateLimited(limitKeys...) {
+		logger.Log(1, "rate limited token request for node", params["nodeid"])
+		returnErrorResponse(w, r, formatErrorCode(fmt.Errorf("too many failed authentication attempts, try again later"), "toomanyrequests", models.ERR_RATE_LIMITED))
+		return
+	}
+	node, err := getNetworkNode(params["network"], params["nodeid"])
+	if err != nil {
+		returnErrorResponse(w, r, nodeLookupError(err, params["nodeid"]))
+		return
+	}
+	if err = logic.VerifyNodeTokenChallenge(&node, tokenRequest.Nonce, tokenRequest.Signature); err != nil {
+		if errors.Is(err, logic.ErrInvalidNodeTokenChallenge) {
+			logic.RecordAuthFailure(limitKeys...)
+			returnErrorResponse(w, r, formatErrorCode(err, "unauthorized", models.ERR_INVALID_CREDENTIALS))
+			return
+		}
+		returnErrorResponse(w, r, formatError(err, "internal"))
+		return
+	}
+	logic.ResetAuthFailures(nodeLimitKey(node.ID))
+	network, err := requestNetwork(r, node.Network)
+	if err != nil {
+		returnErrorResponse(w, r, formatError(err, "internal"))
+		return
+	}
+	lifetime := logic.GetNodeTokenLifetime(&network)
+	tokenString, err := logic.CreateJWT(node.ID, node.MacAddress, node.Network, lifetime)
+	if err != nil {
+		returnErrorResponse(w, r, formatError(err, "internal"))
+		return
+	}
+	logger.Log(1, "issued token to node", node.ID, "on network", node.Network, "by key challenge")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.SuccessResponse{
+		Code:    http.StatusOK,
+		Message: "W1R3: Device " + node.ID + " Authorized",
+		Response: models.SuccessfulLoginResponse{
+			AuthToken: tokenString,
+			ID:        node.ID,
+			Expires:   time.Now().Add(lifetime).Unix(),
+		},
+	})
+}
+
+// authLimitKeys - rate limit keys for an auth request, the node id and the source ip
+func authLimitKeys(request *http.Request, nodeID string) []string {
+	return append([]string{nodeLimitKey(nodeID)}, sourceLimitKeys(request)...)
+}
+
+// nodeLimitKey - the rate limit key of a node, the only one a successful auth clears
+func nodeLimitKey(nodeID string) string {
+	return "node:" + nodeID
+}
+
+// sourceLimitKeys - the rate limit key of a request's source ip, none when the address can not be split
+func sourceLimitKeys(request *http.Request) []string {
+	if host, _, err := net.SplitHostPort(request.RemoteAddr); err == nil {
+		return []string{"ip:" + host}
+	}
+	return nil
+}
+
+// challengeLimitKeys - rate limit keys of the source of a challenge request, challenges are limited apart
+// from failed authentications so joining nodes do not use up each other's attempts
+func challengeLimitKeys(request *http.Request) []string {
+	var keys []string
+	for _, key := range sourceLimitKeys(request) {
+		keys = append(keys, "challenge:"+key)
+	}
+	return keys
+}
+
 // auth middleware for api calls from nodes where node is has not yet joined the server (register, join)
 func nodeauth(next http.Handler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -122,43 +304,92 @@ func nodeauth(next http.Handler) http.HandlerFunc {
 		var token = ""
 		if len(tokenSplit) < 2 {
 			errorResponse := models.ErrorResponse{
-				Code: http.StatusUnauthorized, Message: "W1R3: You are unauthorized to access this endpoint.",
+				Code: http.StatusUnauthorized, Message: "W1R3: You are unauthorized to access this endpoint.", ErrorCode: models.ERR_MISSING_AUTH_TOKEN,
 			}
+			metrics.RecordAuthFailure("nodeauth", mux.Vars(r)["network"], errorResponse.ErrorCode)
 			returnErrorResponse(w, r, errorResponse)
 			return
 		} else {
 			token = tokenSplit[1]
 		}
-		found := false
-		networks, err := logic.GetNetworks()
-		if err != nil {
-			logger.Log(0, "no networks", err.Error())
-			errorResponse := models.ErrorResponse{
-				Code: http.StatusNotFound, Message: "no networks",
-			}
-			returnErrorResponse(w, r, errorResponse)
+		// only nodeauth may set the verified access key, service account or acting user
+		r.Header.Del("verifiedaccesskey")
+		r.Header.Del("serviceaccount")
+		r.Header.Del("user")
+		if logic.IsServiceAccountToken(token) {
+			authorizeServiceAccount(w, r, "nodeauth", token, next)
 			return
 		}
-		for _, network := range networks {
-			for _, key := range network.AccessKeys {
-				if key.Value == token {
-					found = true
-					break
-				}
+		// asymmetric access keys are presented as <challenge nonce>:<base64 ed25519 signature of nonce>
+		if nonce, signature, isSigned := strings.Cut(token, ":"); isSigned {
+			key, err := logic.VerifyAccessKeyChallenge(mux.Vars(r)["network"], nonce, signature)
+			if err != nil {
+				logger.Log(0, "access key challenge failed:", err.Error())
+				metrics.RecordAuthFailure("nodeauth", mux.Vars(r)["network"], models.ERR_INVALID_ACCESS_KEY)
+				returnErrorResponse(w, r, formatErrorCode(err, "unauthorized", models.ERR_INVALID_ACCESS_KEY))
+				return
 			}
+			r.Header.Set("verifiedaccesskey", key.Value)
+			r.Header.Set("user", "accesskey:"+key.Name)
+			next.ServeHTTP(w, r)
+			return
+		}
+		limitKeys := sourceLimitKeys(r)
+		if logic.IsAuthRateLimited(limitKeys...) {
+			logger.Log(1, "rate limited access key for", r.RemoteAddr)
+			metrics.RecordAuthFailure("nodeauth", mux.Vars(r)["network"], models.ERR_RATE_LIMITED)
+			returnErrorResponse(w, r, formatErrorCode(fmt.Errorf("too many failed authentication attempts, try again later"), "toomanyrequests", models.ERR_RATE_LIMITED))
+			return
 		}
+		key, _, found := logic.FindAccessKey(token)
 		if !found {
 			logger.Log(0, "valid access key not found")
+			logic.RecordAuthFailure(limitKeys...)
 			errorResponse := models.ErrorResponse{
-				Code: http.StatusUnauthorized, Message: "You are unauthorized to access this endpoint.",
+				Code: http.StatusUnauthorized, Message: "You are unauthorized to access this endpoint.", ErrorCode: models.ERR_INVALID_ACCESS_KEY,
 			}
+			metrics.RecordAuthFailure("nodeauth", mux.Vars(r)["network"], errorResponse.ErrorCode)
 			returnErrorResponse(w, r, errorResponse)
 			return
 		}
+		// the source bucket is the only one here, a valid key must not clear it for guesses at other keys
+		r.Header.Set("user", "accesskey:"+key.Name)
 		next.ServeHTTP(w, r)
 	}
 }
 
+// networkAdminForbidden - why a network admin may not make a request, empty when it may, routes without
+// a network are left to the handlers, which only return the nodes of the user's networks
+func networkAdminForbidden(r *http.Request, networks []string) string {
+	params := mux.Vars(r)
+	if params["network"] != "" && !logic.StringSliceContains(networks, params["network"]) {
+		return "Network admins may only manage their own networks."
+	}
+	if params["nodeid"] == "" {
+		return ""
+	}
+	node, err := logic.GetNodeByID(params["nodeid"])
+	if err != nil {
+		// the handler answers for missing nodes
+		return ""
+	}
+	if node.Network != params["network"] {
+		return "Network admins may only manage their own networks."
+	}
+	if node.IsServer == "yes" && r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return "Network admins may not change server nodes."
+	}
+	return ""
+}
+
+// readOnlyScopes - the authNetwork scopes of the node views read-only users may open on every network,
+// node scoped and open routes such as server registration stay closed to them
+var readOnlyScopes = map[string]bool{
+	"network": true,
+	"node":    true,
+	"user":    true,
+}
+
 //The middleware for most requests to the API
 //They all pass  through here first
 //This will validate the JWT (or check for master token)
@@ -174,40 +405,80 @@ func authorize(nodesAllowed, networkCheck bool, authNetwork string, next http.Ha
 
 		var params = mux.Vars(r)
 
-		networkexists, _ := functions.NetworkExists(params["network"])
+		// looked up once here, handlers read it back with requestNetwork
+		var networkexists bool
+		if params["network"] != "" {
+			network, err := logic.GetNetwork(params["network"])
+			if err != nil && !database.IsEmptyRecord(err) {
+				returnErrorResponse(w, r, formatError(err, "internal"))
+				return
+			}
+			if err == nil {
+				networkexists = true
+				r = withRequestNetwork(r, network)
+			}
+		}
 		//check that the request is for a valid network
-		//if (networkCheck && !networkexists) || err != nil {
 		if networkCheck && !networkexists {
 			errorResponse = models.ErrorResponse{
-				Code: http.StatusNotFound, Message: "W1R3: This network does not exist. ",
+				Code: http.StatusNotFound, Message: "W1R3: This network does not exist. ", ErrorCode: models.ERR_NETWORK_NOT_FOUND,
 			}
 			returnErrorResponse(w, r, errorResponse)
 			return
 		} else {
 			w.Header().Set("Content-Type", "application/json")
+			// only authorize may mark a request as the master key's or name the acting user or service account,
+			// the access log reads the user back, so a value sent by the caller must not survive a failed check
+			r.Header.Del("ismasterkey")
+			r.Header.Del("user")
+			r.Header.Del("serviceaccount")
 
 			//get the auth token
 			bearerToken := r.Header.Get("Authorization")
 
 			var tokenSplit = strings.Split(bearerToken, " ")
 
-			//I put this in in case the user doesn't put in a token at all (in which case it's empty)
-			//There's probably a smarter way of handling this.
-			var authToken = "928rt238tghgwe@TY@$Y@#WQAEGB2FC#@HG#@$Hddd"
+			// an empty token never matches the master key, see logic.IsMasterKey
+			var authToken string
 
 			if len(tokenSplit) > 1 {
 				authToken = tokenSplit[1]
 			} else {
 				errorResponse = models.ErrorResponse{
-					Code: http.StatusUnauthorized, Message: "W1R3: Missing Auth Token.",
+					Code: http.StatusUnauthorized, Message: "W1R3: Missing Auth Token.", ErrorCode: models.ERR_MISSING_AUTH_TOKEN,
 				}
+				metrics.RecordAuthFailure("authorize", params["network"], errorResponse.ErrorCode)
 				returnErrorResponse(w, r, errorResponse)
 				return
 			}
+			if logic.IsServiceAccountToken(authToken) {
+				authorizeServiceAccount(w, r, "authorize", authToken, next)
+				return
+			}
 			//check if node instead of user
 			if nodesAllowed {
-				// TODO --- should ensure that node is only operating on itself
-				if _, _, _, err := logic.VerifyToken(authToken); err == nil {
+				// user tokens also verify as node tokens but carry no node id, those are checked as users below
+				if tokenNodeID, _, tokenNetwork, err := logic.VerifyToken(authToken); err == nil && tokenNodeID != "" {
+					// nodes may only operate on themselves, the master key may operate on any node
+					if tokenNodeID != "mastermac" && params["nodeid"] != "" && tokenNodeID != params["nodeid"] {
+						errorResponse = models.ErrorResponse{
+							Code: http.StatusForbidden, Message: "W1R3: Nodes may only operate on themselves.", ErrorCode: models.ERR_FORBIDDEN,
+						}
+						metrics.RecordAuthFailure("authorize", params["network"], errorResponse.ErrorCode)
+						returnErrorResponse(w, r, errorResponse)
+						return
+					}
+					// routes naming only a network, like the peer epoch, are open to the nodes of that network
+					if tokenNodeID != "mastermac" && params["network"] != "" && tokenNetwork != params["network"] {
+						errorResponse = models.ErrorResponse{
+							Code: http.StatusForbidden, Message: "W1R3: Nodes may only operate on their own network.", ErrorCode: models.ERR_FORBIDDEN,
+						}
+						metrics.RecordAuthFailure("authorize", params["network"], errorResponse.ErrorCode)
+						returnErrorResponse(w, r, errorResponse)
+						return
+					}
+					// nodes are audited by id, the header is overwritten so it cannot be supplied by the caller
+					r.Header.Set("user", "node:"+tokenNodeID)
 					next.ServeHTTP(w, r)
 					return
 				}
@@ -215,11 +486,17 @@ func authorize(nodesAllowed, networkCheck bool, authNetwork string, next http.Ha
 
 			var isAuthorized = false
 			var nodeID = ""
-			username, networks, isadmin, errN := logic.VerifyUserToken(authToken)
+			username, networks, isadmin, role, errN := logic.VerifyUserTokenRole(authToken)
 			if errN != nil {
 				errorResponse = models.ErrorResponse{
-					Code: http.StatusUnauthorized, Message: "W1R3: Unauthorized, Invalid Token Processed.",
+					Code: http.StatusUnauthorized, Message: "W1R3: Unauthorized, Invalid Token Processed.", ErrorCode: models.ERR_INVALID_AUTH_TOKEN,
+				}
+				// expired node and user tokens both fail here, clients should authenticate again
+				if errors.Is(errN, logic.ErrTokenExpired) {
+					errorResponse.Message = "W1R3: Unauthorized, Token Expired."
+					errorResponse.ErrorCode = models.ERR_TOKEN_EXPIRED
 				}
+				metrics.RecordAuthFailure("authorize", params["network"], errorResponse.ErrorCode)
 				returnErrorResponse(w, r, errorResponse)
 				return
 			}
@@ -238,6 +515,28 @@ func authorize(nodesAllowed, networkCheck bool, authNetwork string, next http.Ha
 			if nodeID == "mastermac" {
 				isAuthorized = true
 				r.Header.Set("ismasterkey", "yes")
+				// read-only users may view the nodes of every network but not change them
+			} else if role == models.USER_ROLE_READ_ONLY {
+				if r.Method != http.MethodGet && r.Method != http.MethodHead {
+					errorResponse = models.ErrorResponse{
+						Code: http.StatusForbidden, Message: "W1R3: Read-only users may not make changes.", ErrorCode: models.ERR_FORBIDDEN,
+					}
+					metrics.RecordAuthFailure("authorize", params["network"], errorResponse.ErrorCode)
+					returnErrorResponse(w, r, errorResponse)
+					return
+				}
+				isAuthorized = readOnlyScopes[authNetwork]
+				// network admins may do anything on their own networks except change server nodes
+			} else if role == models.USER_ROLE_NETWORK_ADMIN {
+				if reason := networkAdminForbidden(r, networks); reason != "" {
+					errorResponse = models.ErrorResponse{
+						Code: http.StatusForbidden, Message: "W1R3: " + reason, ErrorCode: models.ERR_FORBIDDEN,
+					}
+					metrics.RecordAuthFailure("authorize", params["network"], errorResponse.ErrorCode)
+					returnErrorResponse(w, r, errorResponse)
+					return
+				}
+				isAuthorized = true
 				//for everyone else, there's poor man's RBAC. The "cases" are defined in the routes in the handlers
 				//So each route defines which access network should be allowed to access it
 			} else {
@@ -253,8 +552,9 @@ func authorize(nodesAllowed, networkCheck bool, authNetwork string, next http.Ha
 						node, err := logic.GetNodeByID(nodeID)
 						if err != nil {
 							errorResponse = models.ErrorResponse{
-								Code: http.StatusUnauthorized, Message: "W1R3: Missing Auth Token.",
+								Code: http.StatusUnauthorized, Message: "W1R3: Missing Auth Token.", ErrorCode: models.ERR_UNAUTHORIZED,
 							}
+							metrics.RecordAuthFailure("authorize", params["network"], errorResponse.ErrorCode)
 							returnErrorResponse(w, r, errorResponse)
 							return
 						}
@@ -264,7 +564,7 @@ func authorize(nodesAllowed, networkCheck bool, authNetwork string, next http.Ha
 					if isnetadmin {
 						isAuthorized = true
 					} else {
-						isAuthorized = (nodeID == params["netid"])
+						isAuthorized = (nodeID == params["nodeid"])
 					}
 				case "user":
 					isAuthorized = true
@@ -274,8 +574,9 @@ func authorize(nodesAllowed, networkCheck bool, authNetwork string, next http.Ha
 			}
 			if !isAuthorized {
 				errorResponse = models.ErrorResponse{
-					Code: http.StatusUnauthorized, Message: "W1R3: You are unauthorized to access this endpoint.",
+					Code: http.StatusUnauthorized, Message: "W1R3: You are unauthorized to access this endpoint.", ErrorCode: models.ERR_UNAUTHORIZED,
 				}
+				metrics.RecordAuthFailure("authorize", params["network"], errorResponse.ErrorCode)
 				returnErrorResponse(w, r, errorResponse)
 				return
 			} else {
@@ -290,7 +591,7 @@ func authorize(nodesAllowed, networkCheck bool, authNetwork string, next http.Ha
 	}
 }
 
-//Gets all nodes associated with network, including pending nodes
+//Gets all nodes associated with network, including pending nodes unless filtered by ?status=
 func getNetworkNodes(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
@@ -299,11 +600,24 @@ func getNetworkNodes(w http.ResponseWriter, r *http.Request) {
 	var params = mux.Vars(r)
 	networkName := params["network"]
 
-	nodes, err := logic.GetNetworkNodes(networkName)
+	nodes, err := logic.GetNetworkNodesContext(r.Context(), networkName)
 	if err != nil {
-		returnErrorResponse(w, r, formatError(err, "internal"))
+		if !returnContextError(w, r, err) {
+			returnErrorResponse(w, r, formatError(err, "internal"))
+		}
+		return
+	}
+	nodes, err = filterNodesByStatus(nodes, r.URL.Query().Get("status"))
+	if err != nil {
+		returnErrorResponse(w, r, formatErrorCode(err, "badrequest", models.ERR_INVALID_REQUEST))
+		return
+	}
+	sortBy, order, err := parseNodeSort(r.URL.Query())
+	if err != nil {
+		returnErrorResponse(w, r, formatErrorCode(err, "badrequest", models.ERR_INVALID_REQUEST))
 		return
 	}
+	sortNodes(nodes, sortBy, order)
 
 	//Returns all the nodes in JSON format
 	logger.Log(2, r.Header.Get("user"), "fetched nodes on network", networkName)
@@ -311,213 +625,1252 @@ func getNetworkNodes(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(nodes)
 }
 
-//A separate function to get all nodes, not just nodes for a particular network.
-//Not quite sure if this is necessary. Probably necessary based on front end but may want to review after iteration 1 if it's being used or not
-func getAllNodes(w http.ResponseWriter, r *http.Request) {
+// lists the egress and ingress gateways of a network without the full node objects
+func getNetworkGateways(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	user, err := logic.GetUser(r.Header.Get("user"))
-	if err != nil && r.Header.Get("ismasterkey") != "yes" {
+	var params = mux.Vars(r)
+	gateways, err := logic.GetNetworkGateways(params["network"])
+	if err != nil && !database.IsEmptyRecord(err) {
 		returnErrorResponse(w, r, formatError(err, "internal"))
 		return
 	}
-	var nodes []models.Node
-	if user.IsAdmin || r.Header.Get("ismasterkey") == "yes" {
-		nodes, err = logic.GetAllNodes()
-		if err != nil {
-			returnErrorResponse(w, r, formatError(err, "internal"))
-			return
-		}
-	} else {
-		nodes, err = getUsersNodes(user)
-		if err != nil {
-			returnErrorResponse(w, r, formatError(err, "internal"))
-			return
-		}
-	}
-	//Return all the nodes in JSON format
-	logger.Log(3, r.Header.Get("user"), "fetched all nodes they have access to")
+	logger.Log(2, r.Header.Get("user"), "fetched gateways on network", params["network"])
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(nodes)
+	json.NewEncoder(w).Encode(gateways)
 }
 
-func getUsersNodes(user models.User) ([]models.Node, error) {
-	var nodes []models.Node
-	var err error
-	for _, networkName := range user.Networks {
-		tmpNodes, err := logic.GetNetworkNodes(networkName)
-		if err != nil {
-			continue
-		}
-		nodes = append(nodes, tmpNodes...)
+// getNetworkNodeSummary - lists a network's nodes with only the fields needed to draw a roster
+func getNetworkNodeSummary(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var params = mux.Vars(r)
+	summaries, err := logic.GetNetworkNodeSummaries(params["network"])
+	if err != nil && !database.IsEmptyRecord(err) {
+		returnErrorResponse(w, r, formatError(err, "internal"))
+		return
 	}
-	return nodes, err
+	logger.Log(2, r.Header.Get("user"), "fetched node summary on network", params["network"])
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(summaries)
 }
 
-//Get an individual node. Nothin fancy here folks.
-func getNode(w http.ResponseWriter, r *http.Request) {
-	// set header.
+// getNodeByPublicKey - the node of any network holding a wireguard public key, 409 when nodes of several
+// networks share it; '/' cannot be sent in a path segment, so keys may also be given in url safe base64
+func getNodeByPublicKey(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-
-	var params = mux.Vars(r)
-
-	node, err := logic.GetNodeByID(params["nodeid"])
+	publicKey := strings.NewReplacer("-", "+", "_", "/").Replace(mux.Vars(r)["pubkey"])
+	nodes, err := logic.GetNodesByPublicKey(publicKey)
 	if err != nil {
+		if errors.Is(err, logic.ErrInvalidPublicKey) {
+			returnErrorResponse(w, r, formatErrorCode(err, "badrequest", models.ERR_INVALID_REQUEST))
+			return
+		}
 		returnErrorResponse(w, r, formatError(err, "internal"))
 		return
 	}
+	if len(nodes) == 0 {
+		returnErrorResponse(w, r, formatErrorCode(fmt.Errorf("no node has public key %s", publicKey), "notfound", models.ERR_NODE_NOT_FOUND))
+		return
+	}
+	if len(nodes) > 1 {
+		ids := make([]string, len(nodes))
+		for i := range nodes {
+			ids[i] = nodes[i].ID
+		}
+		returnErrorResponse(w, r, formatErrorCode(fmt.Errorf("public key %s is held by nodes %s", publicKey, strings.Join(ids, ", ")), "conflict", models.ERR_PUBLIC_KEY_IN_USE))
+		return
+	}
+	logger.Log(2, r.Header.Get("user"), "looked up node", nodes[0].ID, "by public key")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(nodes[0])
+}
 
-	peerUpdate, err := logic.GetPeerUpdate(&node)
+// getStaleNodes - nodes of a network that have not checked in for ?threshold= seconds,
+// defaults to the node check in timeout
+func getStaleNodes(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var params = mux.Vars(r)
+	threshold := servercfg.GetNodeCheckInTimeout()
+	if value := r.URL.Query().Get("threshold"); value != "" {
+		var err error
+		if threshold, err = strconv.ParseInt(value, 10, 64); err != nil || threshold <= 0 {
+			returnErrorResponse(w, r, formatErrorCode(fmt.Errorf("invalid threshold %q", value), "badrequest", models.ERR_INVALID_REQUEST))
+			return
+		}
+	}
+	staleNodes, err := logic.GetStaleNodes(params["network"], threshold)
 	if err != nil && !database.IsEmptyRecord(err) {
 		returnErrorResponse(w, r, formatError(err, "internal"))
 		return
 	}
-
-	response := models.NodeGet{
-		Node:         node,
-		Peers:        peerUpdate.Peers,
-		ServerConfig: servercfg.GetServerInfo(),
-	}
-
-	logger.Log(2, r.Header.Get("user"), "fetched node", params["nodeid"])
+	logger.Log(2, r.Header.Get("user"), "fetched stale nodes on network", params["network"])
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(response)
+	json.NewEncoder(w).Encode(staleNodes)
 }
 
-//Get the time that a network of nodes was last modified.
-//TODO: This needs to be refactored
-//Potential way to do this: On UpdateNode, set a new field for "LastModified"
-//If we go with the existing way, we need to at least set network.NodesLastModified on UpdateNode
-func getLastModified(w http.ResponseWriter, r *http.Request) {
-	// set header.
+// getNetworkMetrics - the latest connectivity metrics each node of a network reported of its peers
+func getNetworkMetrics(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-
 	var params = mux.Vars(r)
-	network, err := logic.GetNetwork(params["network"])
+	metrics, err := logic.GetNetworkMetrics(params["network"])
 	if err != nil {
 		returnErrorResponse(w, r, formatError(err, "internal"))
 		return
 	}
-	logger.Log(2, r.Header.Get("user"), "called last modified")
+	logger.Log(2, r.Header.Get("user"), "fetched metrics on network", params["network"])
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(network.NodesLastModified)
+	json.NewEncoder(w).Encode(metrics)
 }
 
-func createNode(w http.ResponseWriter, r *http.Request) {
+// updateNodeMetrics - stores the connectivity metrics a node measured to its peers, replacing its earlier samples
+func updateNodeMetrics(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-
 	var params = mux.Vars(r)
-
-	var errorResponse = models.ErrorResponse{
-		Code: http.StatusInternalServerError, Message: "W1R3: It's not you it's me.",
+	var reported models.Metrics
+	if err := json.NewDecoder(r.Body).Decode(&reported); err != nil {
+		returnErrorResponse(w, r, formatErrorCode(err, "badrequest", models.ERR_INVALID_REQUEST))
+		return
 	}
-	networkName := params["network"]
-	networkexists, err := functions.NetworkExists(networkName)
-
+	node, err := getNetworkNode(params["network"], params["nodeid"])
 	if err != nil {
-		returnErrorResponse(w, r, formatError(err, "internal"))
-		return
-	} else if !networkexists {
-		errorResponse = models.ErrorResponse{
-			Code: http.StatusNotFound, Message: "W1R3: Network does not exist! ",
-		}
-		returnErrorResponse(w, r, errorResponse)
+		returnErrorResponse(w, r, nodeLookupError(err, params["nodeid"]))
 		return
 	}
-
-	var node = models.Node{}
-
-	//get node from body of request
-	err = json.NewDecoder(r.Body).Decode(&node)
+	metrics, err := logic.UpdateNodeMetrics(&node, &reported)
 	if err != nil {
+		if errors.Is(err, logic.ErrInvalidMetrics) {
+			returnErrorResponse(w, r, formatErrorCode(err, "badrequest", models.ERR_INVALID_REQUEST))
+			return
+		}
 		returnErrorResponse(w, r, formatError(err, "internal"))
 		return
 	}
+	logger.Log(3, r.Header.Get("user"), "updated metrics of node", node.ID, "on network", node.Network)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(metrics)
+}
 
-	node.Network = networkName
+// NODE_EVENT_KEEPALIVE - seconds between keepalive comments on an idle event stream
+const NODE_EVENT_KEEPALIVE = 15
 
-	network, err := logic.GetNetworkByNode(&node)
-	if err != nil {
-		returnErrorResponse(w, r, formatError(err, "internal"))
-		return
-	}
-	node.NetworkSettings, err = logic.GetNetworkSettings(node.Network)
-	if err != nil {
-		returnErrorResponse(w, r, formatError(err, "internal"))
+// streamNodeEvents - streams node create, update and delete events for a network as server-sent events
+func streamNodeEvents(w http.ResponseWriter, r *http.Request) {
+	var params = mux.Vars(r)
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		returnErrorResponse(w, r, formatError(errors.New("streaming is not supported"), "internal"))
 		return
 	}
-	validKey := logic.IsKeyValid(networkName, node.AccessKey)
-	if !validKey {
-		// Check to see if network will allow manual sign up
-		// may want to switch this up with the valid key check and avoid a DB call that way.
-		if network.AllowManualSignUp == "yes" {
-			node.IsPending = "yes"
-		} else {
-			errorResponse = models.ErrorResponse{
-				Code: http.StatusUnauthorized, Message: "W1R3: Key invalid, or none provided.",
-			}
-			returnErrorResponse(w, r, errorResponse)
+	events, unsubscribe := logic.SubscribeNodeEvents(params["network"])
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	logger.Log(2, r.Header.Get("user"), "subscribed to node events on network", params["network"])
+
+	keepalive := time.NewTicker(NODE_EVENT_KEEPALIVE * time.Second)
+	defer keepalive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			logger.Log(2, r.Header.Get("user"), "unsubscribed from node events on network", params["network"])
 			return
+		case <-keepalive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+			flusher.Flush()
+		case event := <-events:
+			data, err := json.Marshal(&event)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+			flusher.Flush()
 		}
 	}
-	key, keyErr := logic.RetrievePublicTrafficKey()
-	if keyErr != nil {
-		logger.Log(0, "error retrieving key: ", keyErr.Error())
-		returnErrorResponse(w, r, formatError(err, "internal"))
+}
+
+//A separate function to get all nodes, not just nodes for a particular network.
+//Not quite sure if this is necessary. Probably necessary based on front end but may want to review after iteration 1 if it's being used or not
+func getAllNodes(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	user, err := logic.GetUser(r.Header.Get("user"))
+	if err != nil && r.Header.Get("ismasterkey") != "yes" {
+		returnErrorResponse(w, r, formatErrorCode(err, "internal", models.ERR_USER_LOOKUP_FAILED))
 		return
 	}
-	if key == nil {
-		logger.Log(0, "error: server traffic key is nil")
-		returnErrorResponse(w, r, formatError(err, "internal"))
-		return
+	var nodes []models.Node
+	// read-only users view the nodes of every network like admins do
+	if user.IsAdmin || user.Role == models.USER_ROLE_READ_ONLY || r.Header.Get("ismasterkey") == "yes" {
+		nodes, err = logic.GetAllNodesContext(r.Context())
+	} else {
+		nodes, err = getUsersNodes(r.Context(), user)
 	}
-	if node.TrafficKeys.Mine == nil {
-		logger.Log(0, "error: node traffic key is nil")
-		returnErrorResponse(w, r, formatError(err, "internal"))
+	if err != nil {
+		if !returnContextError(w, r, err) {
+			returnErrorResponse(w, r, formatErrorCode(err, "internal", models.ERR_NODE_LIST_FAILED))
+		}
 		return
 	}
-	node.TrafficKeys = models.TrafficKeys{
-		Mine:   node.TrafficKeys.Mine,
-		Server: key,
+	query, err := parseNodeListQuery(r)
+	if err != nil {
+		returnErrorResponse(w, r, formatError(err, "badrequest"))
+		return
 	}
-
-	err = logic.CreateNode(&node)
+	fields, err := parseNodeFields(r.URL.Query().Get("fields"))
 	if err != nil {
-		returnErrorResponse(w, r, formatError(err, "internal"))
+		returnErrorResponse(w, r, formatErrorCode(err, "badrequest", models.ERR_INVALID_REQUEST))
 		return
 	}
-
-	peerUpdate, err := logic.GetPeerUpdate(&node)
-	if err != nil && !database.IsEmptyRecord(err) {
-		returnErrorResponse(w, r, formatError(err, "internal"))
+	nodes, total := query.apply(nodes)
+	//Return all the nodes in JSON format
+	logger.Log(3, r.Header.Get("user"), "fetched all nodes they have access to")
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	if len(fields) > 0 {
+		projected, err := projectNodes(nodes, fields)
+		if err != nil {
+			returnErrorResponse(w, r, formatError(err, "internal"))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(projected)
 		return
 	}
-
-	response := models.NodeGet{
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(nodes)
+}
+
+// nodeFieldNames - json names of the node fields a ?fields= projection may ask for
+var nodeFieldNames = func() map[string]bool {
+	names := make(map[string]bool)
+	nodeType := reflect.TypeOf(models.Node{})
+	for i := 0; i < nodeType.NumField(); i++ {
+		name, _, _ := strings.Cut(nodeType.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			names[name] = true
+		}
+	}
+	return names
+}()
+
+// parseNodeFields - reads a comma separated ?fields= list of node json names, empty for the whole node
+func parseNodeFields(value string) ([]string, error) {
+	var fields []string
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if !nodeFieldNames[field] {
+			return nil, fmt.Errorf("invalid field %q", field)
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// projectNodes - each node cut down to the requested fields, fields left out of a node's json by omitempty stay out
+func projectNodes(nodes []models.Node, fields []string) ([]map[string]json.RawMessage, error) {
+	var projected = []map[string]json.RawMessage{}
+	for i := range nodes {
+		data, err := json.Marshal(&nodes[i])
+		if err != nil {
+			return nil, err
+		}
+		var all map[string]json.RawMessage
+		if err = json.Unmarshal(data, &all); err != nil {
+			return nil, err
+		}
+		node := make(map[string]json.RawMessage, len(fields))
+		for _, field := range fields {
+			if value, ok := all[field]; ok {
+				node[field] = value
+			}
+		}
+		projected = append(projected, node)
+	}
+	return projected, nil
+}
+
+// nodeListQuery - paging, sorting and filtering options for node listings
+type nodeListQuery struct {
+	limit   int
+	offset  int
+	sort    string
+	order   string
+	network string
+	pending bool
+	tag     string
+}
+
+// parseNodeListQuery - reads the limit, offset, sort, order, network, pending and tag query params
+func parseNodeListQuery(r *http.Request) (nodeListQuery, error) {
+	var query nodeListQuery
+	var err error
+	values := r.URL.Query()
+	if limit := values.Get("limit"); limit != "" {
+		if query.limit, err = strconv.Atoi(limit); err != nil || query.limit < 0 {
+			return query, fmt.Errorf("invalid limit %q", limit)
+		}
+	}
+	if offset := values.Get("offset"); offset != "" {
+		if query.offset, err = strconv.Atoi(offset); err != nil || query.offset < 0 {
+			return query, fmt.Errorf("invalid offset %q", offset)
+		}
+	}
+	if query.sort, query.order, err = parseNodeSort(values); err != nil {
+		return query, err
+	}
+	query.network = values.Get("network")
+	if pending := values.Get("pending"); pending != "" {
+		if query.pending, err = strconv.ParseBool(pending); err != nil {
+			return query, fmt.Errorf("invalid pending %q", pending)
+		}
+	}
+	query.tag = values.Get("tag")
+	return query, nil
+}
+
+// nodeListQuery.apply - filters, sorts and pages nodes, returns the page and the filtered total
+func (query *nodeListQuery) apply(nodes []models.Node) ([]models.Node, int) {
+	var filtered = []models.Node{}
+	for _, node := range nodes {
+		if query.network != "" && node.Network != query.network {
+			continue
+		}
+		if query.pending && node.IsPending != "yes" {
+			continue
+		}
+		if query.tag != "" && !node.HasTag(query.tag) {
+			continue
+		}
+		filtered = append(filtered, node)
+	}
+	sortNodes(filtered, query.sort, query.order)
+	total := len(filtered)
+	if query.offset >= total {
+		return []models.Node{}, total
+	}
+	filtered = filtered[query.offset:]
+	if query.limit > 0 && query.limit < len(filtered) {
+		filtered = filtered[:query.limit]
+	}
+	return filtered, total
+}
+
+// parseNodeSort - reads the sort and order query params, order defaults to asc
+func parseNodeSort(values url.Values) (string, string, error) {
+	sortBy := values.Get("sort")
+	switch sortBy {
+	case "", "name", "lastmodified", "address", "created":
+	default:
+		return "", "", fmt.Errorf("invalid sort %q, must be one of name, lastmodified, address, created", sortBy)
+	}
+	order := values.Get("order")
+	switch order {
+	case "":
+		order = "asc"
+	case "asc", "desc":
+	default:
+		return "", "", fmt.Errorf("invalid order %q, must be asc or desc", order)
+	}
+	return sortBy, order, nil
+}
+
+// sortNodes - sorts nodes in place, nodes created at the same second are ordered by id so the oldest node is stable
+func sortNodes(nodes []models.Node, sortBy, order string) {
+	var less func(i, j int) bool
+	switch sortBy {
+	case "name":
+		less = func(i, j int) bool { return nodes[i].Name < nodes[j].Name }
+	case "lastmodified":
+		less = func(i, j int) bool { return nodes[i].LastModified < nodes[j].LastModified }
+	case "address":
+		less = models.NodesArray(nodes).Less
+	case "created":
+		less = func(i, j int) bool {
+			if nodes[i].CreatedAt != nodes[j].CreatedAt {
+				return nodes[i].CreatedAt < nodes[j].CreatedAt
+			}
+			return nodes[i].ID < nodes[j].ID
+		}
+	default:
+		return
+	}
+	if order == "desc" {
+		sort.SliceStable(nodes, func(i, j int) bool { return less(j, i) })
+		return
+	}
+	sort.SliceStable(nodes, less)
+}
+
+// filterNodesByStatus - keeps only active (approved) or pending nodes, "" and "all" keep every node
+func filterNodesByStatus(nodes []models.Node, status string) ([]models.Node, error) {
+	var pending bool
+	switch status {
+	case "", "all":
+		return nodes, nil
+	case "active":
+		pending = false
+	case "pending":
+		pending = true
+	default:
+		return nil, fmt.Errorf("invalid status %q, must be one of active, pending, all", status)
+	}
+	var filtered = []models.Node{}
+	for _, node := range nodes {
+		if (node.IsPending == "yes") == pending {
+			filtered = append(filtered, node)
+		}
+	}
+	return filtered, nil
+}
+
+func getUsersNodes(ctx context.Context, user models.User) ([]models.Node, error) {
+	var nodes []models.Node
+	var err error
+	for _, networkName := range user.Networks {
+		tmpNodes, err := logic.GetNetworkNodesContext(ctx, networkName)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, err
+			}
+			continue
+		}
+		nodes = append(nodes, tmpNodes...)
+	}
+	return nodes, err
+}
+
+// getNode - the node with its peers, the response carries an etag so polling clients can send
+// If-None-Match and get a 304 while nothing they would receive has changed
+func getNode(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var params = mux.Vars(r)
+
+	node, err := getNetworkNode(params["network"], params["nodeid"])
+	if err != nil {
+		returnErrorResponse(w, r, nodeLookupError(err, params["nodeid"]))
+		return
+	}
+
+	peerUpdate, err := logic.GetPeerUpdateContext(r.Context(), &node)
+	if err != nil && !database.IsEmptyRecord(err) {
+		if !returnContextError(w, r, err) {
+			returnErrorResponse(w, r, formatError(err, "internal"))
+		}
+		return
+	}
+
+	response := models.NodeGet{
+		Node:         node,
+		Peers:        peerUpdate.Peers,
+		ServerConfig: servercfg.GetServerInfo(),
+		Connected:    logic.IsNodeConnected(&node),
+	}
+
+	logger.Log(2, r.Header.Get("user"), "fetched node", params["nodeid"])
+	returnConditionalResponse(w, r, response)
+}
+
+// getNodeDNSRecords - returns the dns records the server writes for a node, empty when dns mode is off
+func getNodeDNSRecords(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var params = mux.Vars(r)
+	node, err := getNetworkNode(params["network"], params["nodeid"])
+	if err != nil {
+		returnErrorResponse(w, r, nodeLookupError(err, params["nodeid"]))
+		return
+	}
+	records := []models.DNSRecord{}
+	if servercfg.IsDNSMode() {
+		if records, err = logic.GetNodeDNSRecords(&node); err != nil {
+			returnErrorResponse(w, r, formatError(err, "internal"))
+			return
+		}
+	}
+	logger.Log(2, r.Header.Get("user"), "fetched dns records of node", node.ID)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(records)
+}
+
+// getNodePeers - returns only the computed peer update of a node,
+// ?explain=true adds why each peer is present and which nodes the acl leaves out
+func getNodePeers(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var params = mux.Vars(r)
+	node, err := getNetworkNode(params["network"], params["nodeid"])
+	if err != nil {
+		returnErrorResponse(w, r, nodeLookupError(err, params["nodeid"]))
+		return
+	}
+	peerUpdate, err := logic.GetPeerUpdateContext(r.Context(), &node)
+	if err != nil && !database.IsEmptyRecord(err) {
+		if !returnContextError(w, r, err) {
+			returnErrorResponse(w, r, formatError(err, "internal"))
+		}
+		return
+	}
+	logger.Log(2, r.Header.Get("user"), "fetched peers of node", node.ID)
+	if r.URL.Query().Get("explain") != "true" {
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(peerUpdate)
+		return
+	}
+	explanation, err := logic.ExplainPeerUpdate(&node, &peerUpdate)
+	if err != nil {
+		returnErrorResponse(w, r, formatError(err, "internal"))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(explanation)
+}
+
+// getNodeConfig - renders a node's join config in the requested format, only wg-quick for now
+func getNodeConfig(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var params = mux.Vars(r)
+	format := r.URL.Query().Get("format")
+	if format != logic.WG_QUICK_FORMAT {
+		returnErrorResponse(w, r, formatErrorCode(fmt.Errorf("unsupported config format %q, use %s", format, logic.WG_QUICK_FORMAT), "badrequest", models.ERR_INVALID_REQUEST))
+		return
+	}
+	node, err := getNetworkNode(params["network"], params["nodeid"])
+	if err != nil {
+		returnErrorResponse(w, r, nodeLookupError(err, params["nodeid"]))
+		return
+	}
+	peerUpdate, err := logic.GetPeerUpdate(&node)
+	if err != nil && !database.IsEmptyRecord(err) {
+		returnErrorResponse(w, r, formatError(err, "internal"))
+		return
+	}
+	logger.Log(2, r.Header.Get("user"), "fetched", format, "config of node", node.ID)
+	returnWGQuickConf(w, r, &node, &peerUpdate)
+}
+
+// returnWGQuickConf - responds with a node's wg-quick config as a file named after its interface
+func returnWGQuickConf(w http.ResponseWriter, r *http.Request, node *models.Node, peerUpdate *models.PeerUpdate) {
+	nameserver := ""
+	if servercfg.IsDNSMode() {
+		nameserver = servercfg.GetCoreDNSAddr()
+	}
+	name := node.Interface
+	if name == "" {
+		name = node.Network
+	}
+	w.Header().Set("Content-Type", "application/config")
+	w.Header().Set("Content-Disposition", "attachment; filename=\""+name+".conf\"")
+	w.WriteHeader(http.StatusOK)
+	if _, err := fmt.Fprint(w, logic.GetNodeWGQuickConf(node, peerUpdate, nameserver)); err != nil {
+		logger.Log(1, "failed to write wg-quick config for node", node.ID, err.Error())
+	}
+}
+
+//Get the time that a network of nodes was last modified.
+// getLastModified - returns when the nodes of a network last changed, also sent as the Last-Modified header,
+// a request whose If-Modified-Since is not older than that is answered 304 without a body
+func getLastModified(w http.ResponseWriter, r *http.Request) {
+	var params = mux.Vars(r)
+	network, err := requestNetwork(r, params["network"])
+	if err != nil {
+		returnErrorResponse(w, r, formatError(err, "internal"))
+		return
+	}
+	logger.Log(2, r.Header.Get("user"), "called last modified")
+	// NodesLastModified is in whole seconds, the precision of http dates
+	w.Header().Set("Last-Modified", time.Unix(network.NodesLastModified, 0).UTC().Format(http.TimeFormat))
+	if since, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && network.NodesLastModified <= since.Unix() {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(network.NodesLastModified)
+}
+
+// getPeerEpoch - the peer epoch of a network, agents whose peers were computed at the same epoch
+// need not fetch or apply them again
+func getPeerEpoch(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	network, err := requestNetwork(r, mux.Vars(r)["network"])
+	if err != nil {
+		if database.IsEmptyRecord(err) {
+			returnErrorResponse(w, r, formatErrorCode(errors.New("network does not exist"), "notfound", models.ERR_NETWORK_NOT_FOUND))
+			return
+		}
+		returnErrorResponse(w, r, formatError(err, "internal"))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.PeerEpoch{Network: network.NetID, PeerEpoch: network.PeerEpoch})
+}
+
+func createNode(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var params = mux.Vars(r)
+
+	var errorResponse = models.ErrorResponse{
+		Code: http.StatusInternalServerError, Message: "W1R3: It's not you it's me.",
+	}
+	networkName := params["network"]
+	network, err := requestNetwork(r, networkName)
+	if err != nil {
+		if database.IsEmptyRecord(err) {
+			errorResponse = models.ErrorResponse{
+				Code: http.StatusNotFound, Message: "W1R3: Network does not exist! ", ErrorCode: models.ERR_NETWORK_NOT_FOUND,
+			}
+			returnErrorResponse(w, r, errorResponse)
+			return
+		}
+		returnErrorResponse(w, r, formatError(err, "internal"))
+		return
+	}
+
+	var node = models.Node{}
+
+	//get node from body of request
+	err = decodeNodeRequest(r, &node)
+	if err != nil {
+		returnErrorResponse(w, r, formatErrorCode(err, "badrequest", models.ERR_INVALID_REQUEST))
+		return
+	}
+
+	// a retried request with the same idempotency key gets the originally created node back
+	idempotencyKey := r.Header.Get("Idempotency-Key")
+	if idempotencyKey != "" {
+		// held until the created node is saved under the key, a concurrent retry waits and replays it
+		unlock := logic.LockIdempotencyKey(networkName, idempotencyKey)
+		defer unlock()
+		if nodeID, ok := logic.GetIdempotentNodeID(networkName, idempotencyKey); ok {
+			createdNode, err := logic.GetNodeByID(nodeID)
+			if err == nil {
+				if createdNode.PublicKey != node.PublicKey {
+					returnErrorResponse(w, r, formatErrorCode(errors.New("idempotency key was already used for a different node"), "badrequest", models.ERR_INVALID_REQUEST))
+					return
+				}
+				peerUpdate, err := logic.GetPeerUpdate(&createdNode)
+				if err != nil && !database.IsEmptyRecord(err) {
+					returnErrorResponse(w, r, formatError(err, "internal"))
+					return
+				}
+				logger.Log(1, "returning node", createdNode.Name, "for repeated idempotency key on network", networkName)
+				if r.URL.Query().Get("format") == logic.WG_QUICK_FORMAT {
+					returnWGQuickConf(w, r, &createdNode, &peerUpdate)
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+				json.NewEncoder(w).Encode(models.NodeGet{
+					Node:         createdNode,
+					Peers:        peerUpdate.Peers,
+					ServerConfig: servercfg.GetServerInfo(),
+					Connected:    logic.IsNodeConnected(&createdNode),
+				})
+				return
+			}
+		}
+	}
+
+	node.Network = networkName
+	// the settings sent to the node are the network without its access keys, as logic.GetNetworkSettings gives them
+	node.NetworkSettings = network
+	node.NetworkSettings.AccessKeys = []models.AccessKey{}
+	// nodes inherit the network MTU and keepalive unless they request their own
+	if node.MTU == 0 {
+		node.MTU = node.NetworkSettings.DefaultMTU
+	}
+	if node.PersistentKeepalive == 0 {
+		node.PersistentKeepalive = node.NetworkSettings.DefaultKeepalive
+	}
+	var validKey bool
+	node.AccessKey, validKey = joinAccessKey(r, &network, node.AccessKey)
+	node.PendingReason = ""
+	// notes are kept by admins, a joining node does not bring its own
+	node.Notes = ""
+	// only the server records which key let a node in, service accounts enroll without one
+	node.AccessKeyHash = ""
+	node.AccessKeyName = ""
+	if validKey && node.AccessKey != "" {
+		node.AccessKeyHash = logic.HashAccessKey(node.AccessKey)
+		node.AccessKeyName = logic.GetAccessKeyName(&network, node.AccessKey)
+	}
+	if !validKey {
+		// Check to see if network will allow manual sign up
+		reason, allowed := signupPendingReason(&network, node.AccessKey)
+		if !allowed {
+			errorResponse = models.ErrorResponse{
+				Code: http.StatusUnauthorized, Message: "W1R3: Key invalid, or none provided.", ErrorCode: models.ERR_INVALID_ACCESS_KEY,
+			}
+			returnErrorResponse(w, r, errorResponse)
+			return
+		}
+		node.IsPending = "yes"
+		node.PendingReason = reason
+	}
+	key, keyErr := logic.RetrievePublicTrafficKey()
+	if keyErr != nil {
+		logger.Log(0, "error retrieving key: ", keyErr.Error())
+		returnErrorResponse(w, r, formatErrorCode(keyErr, "internal", models.ERR_TRAFFIC_KEY_MISSING))
+		return
+	}
+	if key == nil {
+		logger.Log(0, "error: server traffic key is nil")
+		returnErrorResponse(w, r, formatErrorCode(errors.New("server traffic key is nil"), "internal", models.ERR_TRAFFIC_KEY_MISSING))
+		return
+	}
+	if node.TrafficKeys.Mine == nil {
+		logger.Log(0, "error: node traffic key is nil")
+		returnErrorResponse(w, r, formatErrorCode(errors.New("node traffic key is nil"), "internal", models.ERR_TRAFFIC_KEY_MISSING))
+		return
+	}
+	node.TrafficKeys = models.TrafficKeys{
+		Mine:   node.TrafficKeys.Mine,
+		Server: key,
+	}
+
+	err = logic.CreateNode(&node)
+	if err != nil {
+		if errorResponse, ok := nodeNameConflict(err); ok {
+			returnErrorResponse(w, r, errorResponse)
+			return
+		}
+		if errorResponse, ok := publicKeyConflict(err); ok {
+			returnErrorResponse(w, r, errorResponse)
+			return
+		}
+		if errors.Is(err, logic.ErrInvalidPublicKey) {
+			returnErrorResponse(w, r, formatErrorCode(err, "badrequest", models.ERR_INVALID_REQUEST))
+			return
+		}
+		var exhausted *logic.AddressExhaustedError
+		if errors.As(err, &exhausted) {
+			errorResponse := formatErrorCode(err, "conflict", models.ERR_ADDRESS_RANGE_EXHAUSTED)
+			errorResponse.AddressUtilization = &exhausted.Utilization
+			returnErrorResponse(w, r, errorResponse)
+			return
+		}
+		var requestedExhausted *logic.RequestedRangeExhaustedError
+		if errors.As(err, &requestedExhausted) {
+			returnErrorResponse(w, r, formatErrorCode(err, "conflict", models.ERR_ADDRESS_RANGE_EXHAUSTED))
+			return
+		}
+		if errors.Is(err, logic.ErrInvalidNodeName) {
+			returnErrorResponse(w, r, formatErrorCode(err, "badrequest", models.ERR_INVALID_NODE_NAME))
+			return
+		}
+		if errors.Is(err, logic.ErrInvalidAddressRange) {
+			returnErrorResponse(w, r, formatErrorCode(err, "badrequest", models.ERR_INVALID_REQUEST))
+			return
+		}
+		if errors.Is(err, logic.ErrDNSOnlyNode) {
+			returnErrorResponse(w, r, formatErrorCode(err, "badrequest", models.ERR_DNS_ONLY_NODE))
+			return
+		}
+		if errors.Is(err, logic.ErrAccessKeyUnusable) {
+			// another join took the key's last use after it was checked above
+			returnErrorResponse(w, r, formatErrorCode(err, "unauthorized", models.ERR_INVALID_ACCESS_KEY))
+			return
+		}
+		returnErrorResponse(w, r, formatError(err, "internal"))
+		return
+	}
+	if idempotencyKey != "" {
+		if err = logic.SaveIdempotencyKey(networkName, idempotencyKey, node.ID); err != nil {
+			logger.Log(1, "failed to store idempotency key for node", node.ID, err.Error())
+		}
+	}
+
+	peerUpdate, err := logic.GetPeerUpdate(&node)
+	if err != nil && !database.IsEmptyRecord(err) {
+		returnErrorResponse(w, r, formatError(err, "internal"))
+		return
+	}
+
+	response := models.NodeGet{
 		Node:         node,
 		Peers:        peerUpdate.Peers,
 		ServerConfig: servercfg.GetServerInfo(),
+		Connected:    logic.IsNodeConnected(&node),
+	}
+
+	logger.Log(1, r.Header.Get("user"), "created new node", node.Name, "on network", node.Network)
+	recordNodeAudit(r, models.AUDIT_CREATE_NODE, nil, &node)
+	if r.URL.Query().Get("format") == logic.WG_QUICK_FORMAT {
+		returnWGQuickConf(w, r, &node, &peerUpdate)
+	} else {
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(response)
+	}
+	logic.PublishNodeEvent(models.NODE_EVENT_CREATE, &node)
+	runForceServerUpdate(&node)
+}
+
+// joinAccessKey - the access key a joining node is let in with and whether it is valid, service accounts
+// and keys proven with a signed challenge in nodeauth stand in for the key the node sent
+func joinAccessKey(r *http.Request, network *models.Network, accessKey string) (string, bool) {
+	if r.Header.Get("serviceaccount") != "" {
+		// nodeauth already limited the service account to creating nodes on this network
+		return "", true
+	}
+	if network.AsymmetricKeys == "yes" {
+		// nodes joining networks with asymmetric keys proved key ownership with a signed challenge in nodeauth
+		verifiedKey := r.Header.Get("verifiedaccesskey")
+		if verifiedKey == "" {
+			return accessKey, false
+		}
+		return verifiedKey, logic.IsKeyValid(network.NetID, verifiedKey)
+	}
+	return accessKey, logic.IsKeyValid(network.NetID, accessKey)
+}
+
+// signupPendingReason - why a node without a valid access key waits for approval, false when the
+// network does not allow manual sign up and the node is turned away instead
+func signupPendingReason(network *models.Network, accessKey string) (string, bool) {
+	if network.AllowManualSignUp != "yes" {
+		return "", false
+	}
+	if accessKey != "" {
+		// the node expected its key to let it in, so approving it may paper over a misconfigured key
+		return models.PENDING_REASON_INVALID_KEY_GRACE, true
+	}
+	return models.PENDING_REASON_MANUAL_SIGNUP, true
+}
+
+// getSignupPolicy - tells a node about to join whether it will be active right away or held pending
+// for approval, judged on the same credentials the join request would carry
+func getSignupPolicy(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	network, err := requestNetwork(r, mux.Vars(r)["network"])
+	if err != nil {
+		if database.IsEmptyRecord(err) {
+			returnErrorResponse(w, r, formatErrorCode(errors.New("network does not exist"), "notfound", models.ERR_NETWORK_NOT_FOUND))
+			return
+		}
+		returnErrorResponse(w, r, formatError(err, "internal"))
+		return
+	}
+	// joining nodes send the key they authenticate with in the node as well
+	_, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	policy := models.SignupPolicy{
+		Network:           network.NetID,
+		AllowManualSignUp: network.AllowManualSignUp,
+	}
+	accessKey, validKey := joinAccessKey(r, &network, token)
+	if !validKey {
+		policy.PendingReason, policy.Allowed = signupPendingReason(&network, accessKey)
+		policy.RequiresApproval = policy.Allowed
+	} else {
+		policy.Allowed = true
+	}
+	logger.Log(2, r.Header.Get("user"), "fetched sign up policy of network", network.NetID)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(policy)
+}
+
+// validateAccessKey - tells whether a node joining with the access key in the body would be accepted,
+// the key is only looked at so its uses are left as they are
+func validateAccessKey(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var accessKey models.AccessKey
+	if err := json.NewDecoder(r.Body).Decode(&accessKey); err != nil {
+		returnErrorResponse(w, r, formatErrorCode(err, "badrequest", models.ERR_INVALID_REQUEST))
+		return
+	}
+	if accessKey.Value == "" {
+		returnErrorResponse(w, r, formatErrorCode(errors.New("access key value is required"), "badrequest", models.ERR_INVALID_REQUEST))
+		return
+	}
+	network, err := requestNetwork(r, mux.Vars(r)["network"])
+	if err != nil {
+		if database.IsEmptyRecord(err) {
+			returnErrorResponse(w, r, formatErrorCode(errors.New("network does not exist"), "notfound", models.ERR_NETWORK_NOT_FOUND))
+			return
+		}
+		returnErrorResponse(w, r, formatError(err, "internal"))
+		return
+	}
+	validation := logic.CheckNetworkAccessKey(&network, accessKey.Value)
+	logger.Log(2, r.Header.Get("user"), "validated an access key of network", validation.Network)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(validation)
+}
+
+// creates a single use nonce that a joining node signs with its ed25519 access key
+func createAccessKeyChallenge(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var params = mux.Vars(r)
+	if !logic.AllowAuthRequest(challengeLimitKeys(r)...) {
+		logger.Log(1, "rate limited access key challenges for", r.RemoteAddr)
+		returnErrorResponse(w, r, formatErrorCode(errors.New("too many challenges requested, try again later"), "toomanyrequests", models.ERR_RATE_LIMITED))
+		return
+	}
+	network, err := logic.GetParentNetwork(params["network"])
+	if err != nil {
+		returnErrorResponse(w, r, formatErrorCode(err, "notfound", models.ERR_NETWORK_NOT_FOUND))
+		return
+	}
+	if network.AsymmetricKeys != "yes" {
+		returnErrorResponse(w, r, formatErrorCode(fmt.Errorf("network %s does not use asymmetric access keys", network.NetID), "badrequest", models.ERR_ASYMMETRIC_KEYS_DISABLED))
+		return
+	}
+	challenge, err := logic.CreateAccessKeyChallenge(network.NetID)
+	if err != nil {
+		if errors.Is(err, logic.ErrTooManyAccessKeyChallenges) {
+			returnErrorResponse(w, r, formatErrorCode(err, "toomanyrequests", models.ERR_RATE_LIMITED))
+			return
+		}
+		returnErrorResponse(w, r, formatError(err, "internal"))
+		return
+	}
+	logger.Log(2, "created access key challenge on network", network.NetID)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(challenge)
+}
+
+// Takes node out of pending state
+// TODO: May want to use cordon/uncordon terminology instead of "ispending".
+func uncordonNode(w http.ResponseWriter, r *http.Request) {
+	var params = mux.Vars(r)
+	w.Header().Set("Content-Type", "application/json")
+	var nodeid = params["nodeid"]
+	before, err := getNetworkNode(params["network"], nodeid)
+	if err != nil {
+		returnErrorResponse(w, r, nodeLookupError(err, nodeid))
+		return
+	}
+	node, err := logic.UncordonNode(nodeid)
+	if err != nil {
+		returnErrorResponse(w, r, formatError(err, "internal"))
+		return
+	}
+	logger.Log(1, r.Header.Get("user"), "uncordoned node", node.Name)
+	recordNodeAudit(r, models.AUDIT_APPROVE_NODE, &before, &node)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode("SUCCESS")
+
+	runUpdates(&node, false)
+}
+
+// approveNodes - approves a batch of pending nodes, reporting the outcome per node,
+// updates are sent to each approved node but peers are only updated once for the network
+func approveNodes(w http.ResponseWriter, r *http.Request) {
+	var params = mux.Vars(r)
+	w.Header().Set("Content-Type", "application/json")
+	var request models.NodeApprovalRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		returnErrorResponse(w, r, formatErrorCode(err, "badrequest", models.ERR_INVALID_REQUEST))
+		return
+	}
+	if len(request.NodeIDs) == 0 {
+		returnErrorResponse(w, r, formatErrorCode(errors.New("no node ids provided"), "badrequest", models.ERR_INVALID_REQUEST))
+		return
+	}
+	var before = make(map[string]models.Node, len(request.NodeIDs))
+	for _, nodeid := range request.NodeIDs {
+		if node, err := logic.GetNodeByID(nodeid); err == nil {
+			before[nodeid] = node
+		}
+	}
+	results, approved := logic.ApproveNodes(params["network"], request.NodeIDs)
+	logger.Log(1, r.Header.Get("user"), "approved", fmt.Sprint(len(approved)), "of", fmt.Sprint(len(request.NodeIDs)), "nodes on network", params["network"])
+	for i := range approved {
+		pending := before[approved[i].ID]
+		recordNodeAudit(r, models.AUDIT_APPROVE_NODE, &pending, &approved[i])
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(results)
+
+	if len(approved) == 0 {
+		return
+	}
+	for i := range approved {
+		logic.PublishNodeEvent(models.NODE_EVENT_UPDATE, &approved[i])
+	}
+	go func() {
+		for i := range approved {
+			if err := mq.NodeUpdate(&approved[i]); err != nil {
+				logger.Log(1, "error publishing node update to node", approved[i].Name, approved[i].ID, err.Error())
+			}
+		}
+	}()
+	runForceServerUpdate(&approved[0])
+}
+
+func drainNode(w http.ResponseWriter, r *http.Request) {
+	var params = mux.Vars(r)
+	w.Header().Set("Content-Type", "application/json")
+	var nodeid = params["nodeid"]
+	before, err := getNetworkNode(params["network"], nodeid)
+	if err != nil {
+		returnErrorResponse(w, r, nodeLookupError(err, nodeid))
+		return
+	}
+	node, err := logic.DrainNode(nodeid)
+	if err != nil {
+		returnErrorResponse(w, r, formatError(err, "internal"))
+		return
+	}
+	logger.Log(1, r.Header.Get("user"), "draining node", node.Name)
+	recordNodeAudit(r, models.AUDIT_DRAIN_NODE, &before, &node)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(logic.GetNodeDrainStatus(&node))
+
+	runUpdates(&node, true)
+	runForceServerUpdate(&node)
+}
+
+func getNodeDrainStatus(w http.ResponseWriter, r *http.Request) {
+	var params = mux.Vars(r)
+	w.Header().Set("Content-Type", "application/json")
+	node, err := getNetworkNode(params["network"], params["nodeid"])
+	if err != nil {
+		returnErrorResponse(w, r, nodeLookupError(err, params["nodeid"]))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(logic.GetNodeDrainStatus(&node))
+}
+
+// getNodeUpdateStatus - whether the latest update pushed to a node in the background went through,
+// not found until an update was pushed to the node since the server started
+func getNodeUpdateStatus(w http.ResponseWriter, r *http.Request) {
+	var params = mux.Vars(r)
+	w.Header().Set("Content-Type", "application/json")
+	node, err := getNetworkNode(params["network"], params["nodeid"])
+	if err != nil {
+		returnErrorResponse(w, r, nodeLookupError(err, params["nodeid"]))
+		return
+	}
+	status, ok := logic.GetNodeUpdateStatus(node.ID)
+	if !ok {
+		returnErrorResponse(w, r, formatErrorCode(fmt.Errorf("no update was pushed to node %s yet", node.ID), "notfound", models.ERR_NODE_UPDATE_NOT_FOUND))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(status)
+}
+
+// pushPeerUpdate - publishes a peer update to every node of a network asking each to acknowledge it,
+// the returned ack id is polled for which nodes have applied the peers
+func pushPeerUpdate(w http.ResponseWriter, r *http.Request) {
+	var params = mux.Vars(r)
+	w.Header().Set("Content-Type", "application/json")
+	ack, err := mq.PublishPeerUpdateWithAck(params["network"])
+	if err != nil {
+		returnErrorResponse(w, r, updateAckError(err))
+		return
+	}
+	logger.Log(1, r.Header.Get("user"), "pushed peer update", ack.ID, "to", strconv.Itoa(ack.Expected), "nodes on network", params["network"])
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(ack)
+}
+
+// resyncNetworkPeers - republishes the current peers to every node of a network, nodes apply them even when
+// nothing changed, which brings back agents that drifted out of sync; the topology is left as it is
+func resyncNetworkPeers(w http.ResponseWriter, r *http.Request) {
+	var params = mux.Vars(r)
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := requestNetwork(r, params["network"]); err != nil {
+		if database.IsEmptyRecord(err) {
+			returnErrorResponse(w, r, formatErrorCode(errors.New("network does not exist"), "notfound", models.ERR_NETWORK_NOT_FOUND))
+			return
+		}
+		returnErrorResponse(w, r, formatError(err, "internal"))
+		return
+	}
+	resync, err := mq.QueuePeerResync(params["network"])
+	if err != nil {
+		returnErrorResponse(w, r, updateAckError(err))
+		return
+	}
+	logger.Log(1, r.Header.Get("user"), "queued peer resync", resync.ResyncID, "of network", params["network"])
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(resync)
+}
+
+// pushNodeUpdate - publishes a node's current config to it asking it to acknowledge applying it
+func pushNodeUpdate(w http.ResponseWriter, r *http.Request) {
+	var params = mux.Vars(r)
+	w.Header().Set("Content-Type", "application/json")
+	node, err := getNetworkNode(params["network"], params["nodeid"])
+	if err != nil {
+		returnErrorResponse(w, r, nodeLookupError(err, params["nodeid"]))
+		return
+	}
+	// server nodes apply their updates locally, there is nobody to acknowledge them
+	if node.IsServer == "yes" {
+		returnErrorResponse(w, r, formatErrorCode(fmt.Errorf("server node %s cannot acknowledge updates", node.ID), "badrequest", models.ERR_NODE_IS_SERVER))
+		return
+	}
+	ack, err := mq.NodeUpdateWithAck(&node)
+	if err != nil {
+		returnErrorResponse(w, r, updateAckError(err))
+		return
+	}
+	logger.Log(1, r.Header.Get("user"), "pushed node update", ack.ID, "to node", node.ID)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(ack)
+}
+
+// getUpdateAck - which nodes confirmed applying an acknowledged update pushed to the network
+func getUpdateAck(w http.ResponseWriter, r *http.Request) {
+	var params = mux.Vars(r)
+	w.Header().Set("Content-Type", "application/json")
+	ack, err := logic.GetUpdateAck(params["ackid"])
+	if err == nil && ack.Network != params["network"] {
+		err = fmt.Errorf("%w: %s", logic.ErrUpdateAckNotFound, params["ackid"])
+	}
+	if err != nil {
+		returnErrorResponse(w, r, updateAckError(err))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(ack)
+}
+
+// updateAckError - 404 for unknown acknowledged updates, 503 when the message queue is off, 500 otherwise
+func updateAckError(err error) models.ErrorResponse {
+	if errors.Is(err, logic.ErrUpdateAckNotFound) {
+		return formatErrorCode(err, "notfound", models.ERR_UPDATE_ACK_NOT_FOUND)
 	}
+	if errors.Is(err, mq.ErrMessageQueueOff) {
+		return formatErrorCode(err, "unavailable", models.ERR_MESSAGE_QUEUE_OFF)
+	}
+	return formatError(err, "internal")
+}
 
-	logger.Log(1, r.Header.Get("user"), "created new node", node.Name, "on network", node.Network)
+func reassignNodeIP(w http.ResponseWriter, r *http.Request) {
+	var params = mux.Vars(r)
+	w.Header().Set("Content-Type", "application/json")
+	var request models.IPReassignRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		returnErrorResponse(w, r, formatErrorCode(err, "badrequest", models.ERR_INVALID_REQUEST))
+		return
+	}
+	if _, err := getNetworkNode(params["network"], params["nodeid"]); err != nil {
+		returnErrorResponse(w, r, nodeLookupError(err, params["nodeid"]))
+		return
+	}
+	oldNode, node, err := logic.ReassignNodeAddress(params["nodeid"], request)
+	if err != nil {
+		if errors.Is(err, logic.ErrStaticAddress) {
+			returnErrorResponse(w, r, formatErrorCode(err, "conflict", models.ERR_STATIC_ADDRESS))
+			return
+		}
+		var conflict *logic.AddressConflictError
+		if errors.As(err, &conflict) {
+			errorResponse := formatErrorCode(err, "conflict", models.ERR_ADDRESS_IN_USE)
+			errorResponse.ConflictingNodeID = conflict.OwnerID
+			returnErrorResponse(w, r, errorResponse)
+			return
+		}
+		returnErrorResponse(w, r, formatErrorCode(err, "badrequest", models.ERR_INVALID_REQUEST))
+		return
+	}
+	if oldNode.IsRelayed == "yes" {
+		if err = updateRelay(&oldNode, &node); err != nil {
+			logger.Log(1, err.Error())
+		}
+	}
+	if servercfg.IsDNSMode() {
+		logic.SetDNS()
+	}
+	logger.Log(1, r.Header.Get("user"), "reassigned address of node", node.ID, "on network", node.Network)
+	recordNodeAudit(r, models.AUDIT_REASSIGN_ADDRESS, &oldNode, &node)
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(response)
+	json.NewEncoder(w).Encode(node)
+
+	runUpdates(&node, true)
 	runForceServerUpdate(&node)
 }
 
-// Takes node out of pending state
-// TODO: May want to use cordon/uncordon terminology instead of "ispending".
-func uncordonNode(w http.ResponseWriter, r *http.Request) {
+// moveNode - moves a node to another network without it having to rejoin, so it keeps its keys
+func moveNode(w http.ResponseWriter, r *http.Request) {
 	var params = mux.Vars(r)
 	w.Header().Set("Content-Type", "application/json")
-	var nodeid = params["nodeid"]
-	node, err := logic.UncordonNode(nodeid)
+	var request models.NodeMoveRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		returnErrorResponse(w, r, formatErrorCode(err, "badrequest", models.ERR_INVALID_REQUEST))
+		return
+	}
+	if request.Network == "" {
+		returnErrorResponse(w, r, formatErrorCode(errors.New("network must be provided"), "badrequest", models.ERR_INVALID_REQUEST))
+		return
+	}
+	node, err := getNetworkNode(params["network"], params["nodeid"])
 	if err != nil {
+		returnErrorResponse(w, r, nodeLookupError(err, params["nodeid"]))
+		return
+	}
+	if isServer(&node) {
+		returnErrorResponse(w, r, formatErrorCode(logic.ErrMoveServerNode, "badrequest", models.ERR_NODE_IS_SERVER))
+		return
+	}
+	if _, err = requestNetwork(r, request.Network); err != nil {
+		if database.IsEmptyRecord(err) {
+			returnErrorResponse(w, r, formatErrorCode(fmt.Errorf("network %s not found", request.Network), "notfound", models.ERR_NETWORK_NOT_FOUND))
+			return
+		}
 		returnErrorResponse(w, r, formatError(err, "internal"))
 		return
 	}
-	logger.Log(1, r.Header.Get("user"), "uncordoned node", node.Name)
+	oldNode, node, err := logic.MoveNode(node.ID, request.Network)
+	if err != nil {
+		if nameConflict, isNameConflict := nodeNameConflict(err); isNameConflict {
+			returnErrorResponse(w, r, nameConflict)
+			return
+		}
+		if errors.Is(err, logic.ErrNodeAlreadyInNetwork) {
+			returnErrorResponse(w, r, formatErrorCode(err, "badrequest", models.ERR_INVALID_REQUEST))
+			return
+		}
+		if errors.Is(err, logic.ErrStaticAddress) {
+			returnErrorResponse(w, r, formatErrorCode(err, "conflict", models.ERR_STATIC_ADDRESS))
+			return
+		}
+		returnErrorResponse(w, r, formatError(err, "internal"))
+		return
+	}
+	logger.Log(1, r.Header.Get("user"), "moved node", node.ID, "from network", oldNode.Network, "to", node.Network)
+	recordNodeAudit(r, models.AUDIT_MOVE_NODE, &oldNode, &node)
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode("SUCCESS")
+	json.NewEncoder(w).Encode(node)
+
+	logic.PublishNodeEvent(models.NODE_EVENT_UPDATE, &node)
+	go func() {
+		if err := mq.NodeMoved(&node, oldNode.Network); err != nil {
+			logger.Log(1, "error publishing move to node", node.Name, node.ID, err.Error())
+		}
+	}()
+	runForceServerUpdate(&oldNode)
+	runForceServerUpdate(&node)
+}
+
+// rotateNodeKeys - asks a node to replace its traffic keys, its old key is rejected once the node sends the new one
+func rotateNodeKeys(w http.ResponseWriter, r *http.Request) {
+	var params = mux.Vars(r)
+	w.Header().Set("Content-Type", "application/json")
+	node, err := getNetworkNode(params["network"], params["nodeid"])
+	if err != nil {
+		returnErrorResponse(w, r, nodeLookupError(err, params["nodeid"]))
+		return
+	}
+	before := node
+	node, err = logic.RotateNodeTrafficKeys(node.ID)
+	if err != nil {
+		if errors.Is(err, logic.ErrServerTrafficKeys) {
+			returnErrorResponse(w, r, formatErrorCode(err, "badrequest", models.ERR_NODE_IS_SERVER))
+			return
+		}
+		returnErrorResponse(w, r, formatError(err, "internal"))
+		return
+	}
+	logger.Log(1, r.Header.Get("user"), "requested traffic key rotation for node", node.ID, "on network", node.Network)
+	recordNodeAudit(r, models.AUDIT_ROTATE_KEYS, &before, &node)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(node)
 
 	runUpdates(&node, false)
 }
@@ -530,18 +1883,31 @@ func createEgressGateway(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	err := json.NewDecoder(r.Body).Decode(&gateway)
 	if err != nil {
-		returnErrorResponse(w, r, formatError(err, "internal"))
+		returnErrorResponse(w, r, formatErrorCode(err, "badrequest", models.ERR_INVALID_REQUEST))
 		return
 	}
 	gateway.NetID = params["network"]
 	gateway.NodeID = params["nodeid"]
+	// overlapping ranges are rejected unless the admin asks for them explicitly
+	gateway.Force = r.URL.Query().Get("force") == "true"
+	if r.URL.Query().Get("dryrun") == "true" {
+		node, err := logic.ComputeEgressGateway(gateway)
+		if err != nil {
+			returnErrorResponse(w, r, egressGatewayError(err))
+			return
+		}
+		returnGatewayDryRun(w, r, &node)
+		return
+	}
+	before, _ := logic.GetNodeByID(gateway.NodeID)
 	node, err := logic.CreateEgressGateway(gateway)
 	if err != nil {
-		returnErrorResponse(w, r, formatError(err, "internal"))
+		returnErrorResponse(w, r, egressGatewayError(err))
 		return
 	}
 
 	logger.Log(1, r.Header.Get("user"), "created egress gateway on node", gateway.NodeID, "on network", gateway.NetID)
+	recordNodeAudit(r, models.AUDIT_CREATE_EGRESS, &before, &node)
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(node)
 
@@ -553,6 +1919,7 @@ func deleteEgressGateway(w http.ResponseWriter, r *http.Request) {
 	var params = mux.Vars(r)
 	nodeid := params["nodeid"]
 	netid := params["network"]
+	before, _ := logic.GetNodeByID(nodeid)
 	node, err := logic.DeleteEgressGateway(netid, nodeid)
 	if err != nil {
 		returnErrorResponse(w, r, formatError(err, "internal"))
@@ -560,6 +1927,7 @@ func deleteEgressGateway(w http.ResponseWriter, r *http.Request) {
 	}
 
 	logger.Log(1, r.Header.Get("user"), "deleted egress gateway", nodeid, "on network", netid)
+	recordNodeAudit(r, models.AUDIT_DELETE_EGRESS, &before, &node)
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(node)
 
@@ -573,23 +1941,95 @@ func createIngressGateway(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	nodeid := params["nodeid"]
 	netid := params["network"]
-	node, err := logic.CreateIngressGateway(netid, nodeid)
+	// the body is optional, without one the node keeps its listen port
+	var request models.IngressGatewayRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil && !errors.Is(err, io.EOF) {
+		returnErrorResponse(w, r, formatErrorCode(err, "badrequest", models.ERR_INVALID_REQUEST))
+		return
+	}
+	if r.URL.Query().Get("dryrun") == "true" {
+		node, err := logic.ComputeIngressGateway(netid, nodeid, request)
+		if err != nil {
+			returnErrorResponse(w, r, ingressGatewayError(err))
+			return
+		}
+		returnGatewayDryRun(w, r, &node)
+		return
+	}
+	before, _ := logic.GetNodeByID(nodeid)
+	node, err := logic.CreateIngressGateway(netid, nodeid, request)
 	if err != nil {
-		returnErrorResponse(w, r, formatError(err, "internal"))
+		returnErrorResponse(w, r, ingressGatewayError(err))
 		return
 	}
 
 	logger.Log(1, r.Header.Get("user"), "created ingress gateway on node", nodeid, "on network", netid)
+	recordNodeAudit(r, models.AUDIT_CREATE_INGRESS, &before, &node)
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(node)
 
 	runUpdates(&node, true)
 }
 
+// egressGatewayError - 409 for a range overlapping another gateway or a pending or dns only node, 400 for a malformed range or target, otherwise 500
+func egressGatewayError(err error) models.ErrorResponse {
+	var conflict *logic.EgressRangeConflictError
+	if errors.As(err, &conflict) {
+		errorResponse := formatErrorCode(err, "conflict", models.ERR_EGRESS_RANGE_OVERLAP)
+		errorResponse.ConflictingNodeID = conflict.OwnerID
+		return errorResponse
+	}
+	if errors.Is(err, logic.ErrGatewayNodePending) {
+		return formatErrorCode(err, "conflict", models.ERR_NODE_PENDING)
+	}
+	if errors.Is(err, logic.ErrDNSOnlyNode) {
+		return formatErrorCode(err, "conflict", models.ERR_DNS_ONLY_NODE)
+	}
+	if errors.Is(err, logic.ErrInvalidEgressRange) || errors.Is(err, logic.ErrInvalidEgressTarget) || errors.Is(err, logic.ErrUnresolvedEgressTarget) || errors.Is(err, logic.ErrInvalidEgressMetric) ||
+		errors.Is(err, logic.ErrInvalidEgressInterface) || errors.Is(err, logic.ErrUnknownEgressInterface) ||
+		errors.Is(err, logic.ErrInvalidEgressNATRule) || errors.Is(err, logic.ErrEgressNATConflict) {
+		return formatErrorCode(err, "badrequest", models.ERR_INVALID_REQUEST)
+	}
+	return formatError(err, "internal")
+}
+
+// ingressGatewayError - 409 with the owning node for port collisions, 409 for a pending or dns only node, 400 for bad ports or client cidrs, 500 otherwise
+func ingressGatewayError(err error) models.ErrorResponse {
+	var conflict *logic.PortConflictError
+	if errors.As(err, &conflict) {
+		errorResponse := formatErrorCode(err, "conflict", models.ERR_PORT_IN_USE)
+		errorResponse.ConflictingNodeID = conflict.OwnerID
+		return errorResponse
+	}
+	if errors.Is(err, logic.ErrGatewayNodePending) {
+		return formatErrorCode(err, "conflict", models.ERR_NODE_PENDING)
+	}
+	if errors.Is(err, logic.ErrDNSOnlyNode) {
+		return formatErrorCode(err, "conflict", models.ERR_DNS_ONLY_NODE)
+	}
+	if errors.Is(err, logic.ErrInvalidIngressPort) || errors.Is(err, logic.ErrInvalidAddressRange) || errors.Is(err, logic.ErrExtClientOutsideCIDR) {
+		return formatErrorCode(err, "badrequest", models.ERR_INVALID_REQUEST)
+	}
+	return formatError(err, "internal")
+}
+
+// returnGatewayDryRun - responds with a gateway preview, nothing is saved and no updates are published
+func returnGatewayDryRun(w http.ResponseWriter, r *http.Request, node *models.Node) {
+	dryrun, err := logic.GetGatewayDryRun(node)
+	if err != nil {
+		returnErrorResponse(w, r, formatError(err, "internal"))
+		return
+	}
+	logger.Log(2, r.Header.Get("user"), "previewed gateway on node", node.ID, "on network", node.Network)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(dryrun)
+}
+
 func deleteIngressGateway(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	var params = mux.Vars(r)
 	nodeid := params["nodeid"]
+	before, _ := logic.GetNodeByID(nodeid)
 	node, err := logic.DeleteIngressGateway(params["network"], nodeid)
 	if err != nil {
 		returnErrorResponse(w, r, formatError(err, "internal"))
@@ -597,12 +2037,59 @@ func deleteIngressGateway(w http.ResponseWriter, r *http.Request) {
 	}
 
 	logger.Log(1, r.Header.Get("user"), "deleted ingress gateway", nodeid)
+	recordNodeAudit(r, models.AUDIT_DELETE_INGRESS, &before, &node)
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(node)
 
 	runUpdates(&node, true)
 }
 
+// getIngressClients - renders the configs of every ext client of an ingress gateway, ?format=zip bundles them as <clientid>.conf files
+func getIngressClients(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var params = mux.Vars(r)
+	node, err := getNetworkNode(params["network"], params["nodeid"])
+	if err != nil {
+		returnErrorResponse(w, r, nodeLookupError(err, params["nodeid"]))
+		return
+	}
+	if node.IsIngressGateway != "yes" {
+		returnErrorResponse(w, r, formatErrorCode(fmt.Errorf("node %s is not an ingress gateway", node.ID), "badrequest", models.ERR_INVALID_REQUEST))
+		return
+	}
+	confs, err := logic.GetIngressClientConfs(&node)
+	if err != nil && !database.IsEmptyRecord(err) {
+		returnErrorResponse(w, r, formatError(err, "internal"))
+		return
+	}
+	logger.Log(2, r.Header.Get("user"), "fetched ext client configs of ingress gateway", node.ID)
+	if r.URL.Query().Get("format") != "zip" {
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(confs)
+		return
+	}
+	var bundle bytes.Buffer
+	archive := zip.NewWriter(&bundle)
+	for _, conf := range confs {
+		file, err := archive.Create(conf.ClientID + ".conf")
+		if err == nil {
+			_, err = file.Write([]byte(conf.Config))
+		}
+		if err != nil {
+			returnErrorResponse(w, r, formatError(err, "internal"))
+			return
+		}
+	}
+	if err = archive.Close(); err != nil {
+		returnErrorResponse(w, r, formatError(err, "internal"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", "attachment; filename=\""+node.Name+"-clients.zip\"")
+	w.WriteHeader(http.StatusOK)
+	w.Write(bundle.Bytes())
+}
+
 func updateNode(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
@@ -610,17 +2097,85 @@ func updateNode(w http.ResponseWriter, r *http.Request) {
 
 	var node models.Node
 	//start here
-	node, err := logic.GetNodeByID(params["nodeid"])
+	node, err := getNetworkNode(params["network"], params["nodeid"])
 	if err != nil {
-		returnErrorResponse(w, r, formatError(err, "internal"))
+		returnErrorResponse(w, r, nodeLookupError(err, params["nodeid"]))
 		return
 	}
 
 	var newNode models.Node
+	// the body is kept to tell notes sent empty apart from notes left out
+	var body bytes.Buffer
+	r.Body = io.NopCloser(io.TeeReader(r.Body, &body))
 	// we decode our body request params
-	err = json.NewDecoder(r.Body).Decode(&newNode)
+	err = decodeNodeRequest(r, &newNode)
 	if err != nil {
-		returnErrorResponse(w, r, formatError(err, "badrequest"))
+		returnErrorResponse(w, r, formatErrorCode(err, "badrequest", models.ERR_INVALID_REQUEST))
+		return
+	}
+	newNode.NotesSet = hasJSONField(body.Bytes(), "notes")
+	applyNodeUpdate(w, r, node, newNode)
+}
+
+// patchNode - updates only the fields of a node given in a json merge patch (RFC 7386), the patch is
+// applied to the node as read here and carries its resource version, so a write in between is a conflict
+// rather than being clobbered
+func patchNode(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var params = mux.Vars(r)
+	node, err := getNetworkNode(params["network"], params["nodeid"])
+	if err != nil {
+		returnErrorResponse(w, r, nodeLookupError(err, params["nodeid"]))
+		return
+	}
+	patch, err := io.ReadAll(r.Body)
+	if err != nil {
+		returnErrorResponse(w, r, formatErrorCode(err, "badrequest", models.ERR_INVALID_REQUEST))
+		return
+	}
+	newNode, err := logic.PatchNode(&node, patch)
+	if err != nil {
+		if errors.Is(err, logic.ErrInvalidNodePatch) {
+			returnErrorResponse(w, r, formatErrorCode(err, "badrequest", models.ERR_INVALID_REQUEST))
+			return
+		}
+		returnErrorResponse(w, r, formatError(err, "internal"))
+		return
+	}
+	newNode.NotesSet = hasJSONField(patch, "notes")
+	applyNodeUpdate(w, r, node, newNode)
+}
+
+// hasJSONField - whether a json object has a member with the given name, whatever its value
+func hasJSONField(data []byte, field string) bool {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return false
+	}
+	_, ok := fields[field]
+	return ok
+}
+
+// invalidNodeFields - 400 listing each field of a node update that failed validation, 500 for any other error
+func invalidNodeFields(err error) models.ErrorResponse {
+	var invalid *logic.InvalidNodeFieldsError
+	if !errors.As(err, &invalid) {
+		return formatError(err, "internal")
+	}
+	errorResponse := formatErrorCode(err, "badrequest", models.ERR_INVALID_NODE_FIELDS)
+	errorResponse.InvalidFields = invalid.Fields
+	return errorResponse
+}
+
+// applyNodeUpdate - validates and stores the update of a node, then sends it out to the node and its peers
+func applyNodeUpdate(w http.ResponseWriter, r *http.Request, node, newNode models.Node) {
+	var err error
+	if err = logic.ValidateEndpointOverride(newNode.EndpointOverride); err != nil {
+		returnErrorResponse(w, r, formatErrorCode(err, "badrequest", models.ERR_INVALID_REQUEST))
+		return
+	}
+	if err = logic.ValidateNodeUpdate(&node, &newNode); err != nil {
+		returnErrorResponse(w, r, invalidNodeFields(err))
 		return
 	}
 	relayupdate := false
@@ -635,6 +2190,12 @@ func updateNode(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 	}
+	if relayupdate {
+		if err = logic.ValidateRelayAddrs(node.Network, node.ID, newNode.RelayAddrs); err != nil {
+			returnRelayAddrsError(w, r, err)
+			return
+		}
+	}
 	relayedUpdate := false
 	if node.IsRelayed == "yes" && (node.Address != newNode.Address || node.Address6 != newNode.Address6) {
 		relayedUpdate = true
@@ -647,36 +2208,94 @@ func updateNode(w http.ResponseWriter, r *http.Request) {
 
 	ifaceDelta := logic.IfaceDelta(&node, &newNode)
 
-	err = logic.UpdateNode(&node, &newNode)
+	err = logic.UpdateNodeWithVersion(&node, &newNode, newNode.ResourceVersion)
+	if errors.Is(err, logic.ErrNodeVersionConflict) {
+		returnErrorResponse(w, r, formatErrorCode(err, "conflict", models.ERR_NODE_VERSION_CONFLICT))
+		return
+	}
+	if errors.Is(err, logic.ErrStaticAddress) {
+		returnErrorResponse(w, r, formatErrorCode(err, "conflict", models.ERR_STATIC_ADDRESS))
+		return
+	}
+	if errorResponse, ok := nodeNameConflict(err); ok {
+		returnErrorResponse(w, r, errorResponse)
+		return
+	}
 	if err != nil {
 		returnErrorResponse(w, r, formatError(err, "internal"))
 		return
 	}
+	// each step registers how to undo itself before it runs, a failure part way undoes them all
+	var undo = []func() error{func() error { return logic.RevertNodeUpdate(&node) }}
+	var updatenodes []models.Node
 	if relayupdate {
-		updatenodes := logic.UpdateRelay(node.Network, node.RelayAddrs, newNode.RelayAddrs)
-		if err = logic.NetworkNodesUpdatePullChanges(node.Network); err != nil {
-			logger.Log(1, "error setting relay updates:", err.Error())
-		}
-		if len(updatenodes) > 0 {
-			for _, relayedNode := range updatenodes {
-				runUpdates(&relayedNode, false)
-			}
+		undo = append(undo, func() error {
+			_, err := logic.UpdateRelay(node.Network, newNode.RelayAddrs, node.RelayAddrs)
+			return err
+		})
+		if updatenodes, err = updateRelayedNodes(node.Network, node.RelayAddrs, newNode.RelayAddrs); err != nil {
+			rollbackNodeUpdate(w, r, &node, undo, err)
+			return
 		}
 	}
 	if relayedUpdate {
-		updateRelay(&node, &newNode)
+		if relay := logic.FindRelay(&node); relay != nil {
+			originalRelay := *relay
+			undo = append(undo, func() error { return logic.RevertNodeUpdate(&originalRelay) })
+		}
+		if err = updateRelay(&node, &newNode); err != nil {
+			rollbackNodeUpdate(w, r, &node, undo, err)
+			return
+		}
 	}
 	if servercfg.IsDNSMode() {
-		logic.SetDNS()
+		if err = logic.SetDNS(); err != nil {
+			rollbackNodeUpdate(w, r, &node, undo, err)
+			return
+		}
+	}
+	// bumped here rather than in logic.UpdateNode, which also runs on every node check in
+	if err = logic.SetNetworkNodesLastModified(node.Network); err != nil {
+		logger.Log(1, "failed to set nodes last modified on network", node.Network, err.Error())
+	}
+	if relayupdate {
+		if err = logic.NetworkNodesUpdatePullChanges(node.Network); err != nil {
+			logger.Log(1, "error setting relay updates:", err.Error())
+		}
+		for _, relayedNode := range updatenodes {
+			runUpdates(&relayedNode, false)
+		}
 	}
 
 	logger.Log(1, r.Header.Get("user"), "updated node", node.ID, "on network", node.Network)
+	recordNodeAudit(r, models.AUDIT_UPDATE_NODE, &node, &newNode)
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(newNode)
 
 	runUpdates(&newNode, ifaceDelta)
 }
 
+// updateRelayedNodes - moves the relayed flag from the nodes at a relay's old addresses to those at its new ones, replaced in tests
+var updateRelayedNodes = logic.UpdateRelay
+
+// rollbackNodeUpdate - undoes the steps of a node update already taken, newest first, and answers 500 with the
+// error that stopped the update; a failing undo is logged and the steps before it are still undone
+func rollbackNodeUpdate(w http.ResponseWriter, r *http.Request, node *models.Node, undo []func() error, err error) {
+	logger.Log(0, "rolling back update of node", node.ID, "on network", node.Network, err.Error())
+	for i := len(undo) - 1; i >= 0; i-- {
+		if undoErr := undo[i](); undoErr != nil {
+			logger.Log(0, "failed to roll back update of node", node.ID, undoErr.Error())
+		}
+	}
+	// the hosts file is written from the nodes as they are stored again
+	if servercfg.IsDNSMode() {
+		if dnsErr := logic.SetDNS(); dnsErr != nil {
+			logger.Log(0, "failed to restore dns after rolling back node", node.ID, dnsErr.Error())
+		}
+	}
+	returnErrorResponse(w, r, formatError(err, "internal"))
+}
+
 func deleteNode(w http.ResponseWriter, r *http.Request) {
 	// Set header
 	w.Header().Set("Content-Type", "application/json")
@@ -684,13 +2303,17 @@ func deleteNode(w http.ResponseWriter, r *http.Request) {
 	// get params
 	var params = mux.Vars(r)
 	var nodeid = params["nodeid"]
-	var node, err = logic.GetNodeByID(nodeid)
+	var node, err = getNetworkNode(params["network"], nodeid)
 	if err != nil {
-		returnErrorResponse(w, r, formatError(err, "badrequest"))
+		returnErrorResponse(w, r, nodeLookupError(err, nodeid))
 		return
 	}
 	if isServer(&node) {
-		returnErrorResponse(w, r, formatError(fmt.Errorf("cannot delete server node"), "badrequest"))
+		returnErrorResponse(w, r, formatErrorCode(fmt.Errorf("cannot delete server node"), "badrequest", models.ERR_NODE_IS_SERVER))
+		return
+	}
+	if drain := logic.GetNodeDrainStatus(&node); drain.Draining && !drain.Complete {
+		returnErrorResponse(w, r, formatErrorCode(fmt.Errorf("node is draining until %d", drain.Ends), "conflict", models.ERR_NODE_DRAINING))
 		return
 	}
 	//send update to node to be deleted before deleting on server otherwise message cannot be sent
@@ -704,16 +2327,114 @@ func deleteNode(w http.ResponseWriter, r *http.Request) {
 	returnSuccessResponse(w, r, nodeid+" deleted.")
 
 	logger.Log(1, r.Header.Get("user"), "Deleted node", nodeid, "from network", params["network"])
-	runUpdates(&node, false)
+	recordNodeAudit(r, models.AUDIT_DELETE_NODE, &node, nil)
+	logic.PublishNodeEvent(models.NODE_EVENT_DELETE, &node)
+	// DeleteNodeByID paused the node, which keeps its config so a restore can bring it back,
+	// it is only told to leave its network once the recovery window elapses
+	runForceServerUpdate(&node)
+}
+
+func restoreNode(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var params = mux.Vars(r)
+	var nodeid = params["nodeid"]
+	deleted, err := logic.GetDeletedNodeByID(nodeid)
+	if err == nil && deleted.Network != params["network"] {
+		err = errors.New(database.NO_RECORD)
+	}
+	if err != nil {
+		returnErrorResponse(w, r, nodeLookupError(err, nodeid))
+		return
+	}
+	node, err := logic.RestoreNode(nodeid)
+	if err != nil {
+		var conflict *logic.AddressConflictError
+		nameConflict, isNameConflict := nodeNameConflict(err)
+		switch {
+		case isNameConflict:
+			returnErrorResponse(w, r, nameConflict)
+		case errors.As(err, &conflict):
+			errorResponse := formatErrorCode(err, "conflict", models.ERR_ADDRESS_IN_USE)
+			errorResponse.ConflictingNodeID = conflict.OwnerID
+			returnErrorResponse(w, r, errorResponse)
+		case errors.Is(err, logic.ErrNodeRecoveryExpired):
+			returnErrorResponse(w, r, formatErrorCode(err, "conflict", models.ERR_NODE_RECOVERY_EXPIRED))
+		default:
+			returnErrorResponse(w, r, formatError(err, "internal"))
+		}
+		return
+	}
+	logger.Log(1, r.Header.Get("user"), "restored node", nodeid, "on network", node.Network)
+	recordNodeAudit(r, models.AUDIT_RESTORE_NODE, &deleted, &node)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(node)
+	logic.PublishNodeEvent(models.NODE_EVENT_CREATE, &node)
+
+	// the node paused when it was deleted, forcing the update brings its interface back up
+	update := node
+	update.Action = models.NODE_FORCE_UPDATE
+	runUpdates(&update, true)
 	runForceServerUpdate(&node)
 }
 
+// nodeNameConflict - 409 carrying the id of the node already using the name
+func nodeNameConflict(err error) (models.ErrorResponse, bool) {
+	var conflict *logic.NodeNameConflictError
+	if !errors.As(err, &conflict) {
+		return models.ErrorResponse{}, false
+	}
+	errorResponse := formatErrorCode(err, "conflict", models.ERR_NODE_NAME_IN_USE)
+	errorResponse.ConflictingNodeID = conflict.OwnerID
+	return errorResponse, true
+}
+
+// publicKeyConflict - 409 carrying the id of the node already using the public key
+func publicKeyConflict(err error) (models.ErrorResponse, bool) {
+	var conflict *logic.PublicKeyConflictError
+	if !errors.As(err, &conflict) {
+		return models.ErrorResponse{}, false
+	}
+	errorResponse := formatErrorCode(err, "conflict", models.ERR_PUBLIC_KEY_IN_USE)
+	errorResponse.ConflictingNodeID = conflict.OwnerID
+	return errorResponse, true
+}
+
+// decodeNodeRequest - decodes a node from the request body, a field the server does not know is an error
+// naming the field so a misspelled field is not silently dropped
+func decodeNodeRequest(r *http.Request, node *models.Node) error {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(node)
+}
+
+// nodeLookupError - 404 when the node does not exist, 500 for any other lookup failure
+func nodeLookupError(err error, nodeid string) models.ErrorResponse {
+	if database.IsEmptyRecord(err) {
+		return formatErrorCode(fmt.Errorf("node %s not found", nodeid), "notfound", models.ERR_NODE_NOT_FOUND)
+	}
+	return formatError(err, "internal")
+}
+
+// getNetworkNode - the node with the given id, a node of another network is reported as not found
+func getNetworkNode(network, nodeid string) (models.Node, error) {
+	node, err := logic.GetNodeByID(nodeid)
+	if err == nil && node.Network != network {
+		return models.Node{}, errors.New(database.NO_RECORD)
+	}
+	return node, err
+}
+
 func runUpdates(node *models.Node, ifaceDelta bool) {
+	logic.PublishNodeEvent(models.NODE_EVENT_UPDATE, node)
 	go func() { // don't block http response
 		// publish node update if not server
-		if err := mq.NodeUpdate(node); err != nil {
+		err := mq.NodeUpdate(node)
+		if err != nil {
 			logger.Log(1, "error publishing node update to node", node.Name, node.ID, err.Error())
 		}
+		if !isServer(node) {
+			logic.RecordNodeUpdate(node, err)
+		}
 
 		if err := runServerUpdate(node, ifaceDelta); err != nil {
 			logger.Log(1, "error running server update", err.Error())
@@ -734,12 +2455,12 @@ func runServerUpdate(node *models.Node, ifaceDelta bool) error {
 	}
 
 	if ifaceDelta && logic.IsLeader(&currentServerNode) {
-		if err := mq.PublishPeerUpdate(&currentServerNode); err != nil {
-			logger.Log(1, "failed to publish peer update "+err.Error())
-		}
+		mq.QueuePeerUpdate(currentServerNode.Network)
 	}
 
-	if err := logic.ServerUpdate(&currentServerNode, ifaceDelta); err != nil {
+	err = logic.ServerUpdate(&currentServerNode, ifaceDelta)
+	logic.RecordNodeUpdate(&currentServerNode, err)
+	if err != nil {
 		logger.Log(1, "server node:", currentServerNode.ID, "failed update")
 		return err
 	}
@@ -747,14 +2468,13 @@ func runServerUpdate(node *models.Node, ifaceDelta bool) error {
 }
 
 func runForceServerUpdate(node *models.Node) {
+	mq.QueuePeerUpdate(node.Network)
 	go func() {
-		if err := mq.PublishPeerUpdate(node); err != nil {
-			logger.Log(1, "failed a peer update after creation of node", node.Name)
-		}
-
 		var currentServerNode, getErr = logic.GetNetworkServerLeader(node.Network)
 		if getErr == nil {
-			if err := logic.ServerUpdate(&currentServerNode, false); err != nil {
+			err := logic.ServerUpdate(&currentServerNode, false)
+			logic.RecordNodeUpdate(&currentServerNode, err)
+			if err != nil {
 				logger.Log(1, "server node:", currentServerNode.ID, "failed update")
 			}
 		}
@@ -765,26 +2485,35 @@ func isServer(node *models.Node) bool {
 	return node.IsServer == "yes"
 }
 
-func updateRelay(oldnode, newnode *models.Node) {
+func updateRelay(oldnode, newnode *models.Node) error {
 	relay := logic.FindRelay(oldnode)
-	newrelay := relay
-	//check if node's address has been updated and if so, update the relayAddrs of the relay node with the updated address of the relayed node
-	if oldnode.Address != newnode.Address {
-		for i, ip := range newrelay.RelayAddrs {
-			if ip == oldnode.Address {
-				newrelay.RelayAddrs = append(newrelay.RelayAddrs[:i], relay.RelayAddrs[i+1:]...)
-				newrelay.RelayAddrs = append(newrelay.RelayAddrs, newnode.Address)
-			}
-		}
+	if relay == nil {
+		return nil
 	}
-	//check if node's address(v6) has been updated and if so, update the relayAddrs of the relay node with the updated address(v6) of the relayed node
-	if oldnode.Address6 != newnode.Address6 {
-		for i, ip := range newrelay.RelayAddrs {
-			if ip == oldnode.Address {
-				newrelay.RelayAddrs = append(newrelay.RelayAddrs[:i], newrelay.RelayAddrs[i+1:]...)
-				newrelay.RelayAddrs = append(newrelay.RelayAddrs, newnode.Address6)
-			}
+	newrelay := *relay
+	//update the relayAddrs of the relay node with the updated address and address(v6) of the relayed node
+	newrelay.RelayAddrs = replaceRelayAddr(relay.RelayAddrs, oldnode.Address, newnode.Address)
+	newrelay.RelayAddrs = replaceRelayAddr(newrelay.RelayAddrs, oldnode.Address6, newnode.Address6)
+	if err := logic.UpdateNode(relay, &newrelay); err != nil {
+		return fmt.Errorf("error updating relay %s for relayed node %s: %w", relay.ID, newnode.ID, err)
+	}
+	return nil
+}
+
+// replaceRelayAddr - swaps a relayed node's old address for its new one in a relay's addresses,
+// either address may be empty when the node is single stack
+func replaceRelayAddr(relayAddrs []string, oldaddr, newaddr string) []string {
+	if oldaddr == newaddr {
+		return relayAddrs
+	}
+	var updated = []string{}
+	for _, ip := range relayAddrs {
+		if ip != oldaddr || ip == "" {
+			updated = append(updated, ip)
 		}
 	}
-	logic.UpdateNode(relay, newrelay)
+	if newaddr != "" {
+		updated = append(updated, newaddr)
+	}
+	return updated
 }
@@ -1,14 +1,34 @@
 package controller
 
 import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/gorilla/mux"
 	"github.com/gravitl/netmaker/database"
 	"github.com/gravitl/netmaker/logic"
 	"github.com/gravitl/netmaker/logic/acls"
 	"github.com/gravitl/netmaker/logic/acls/nodeacls"
 	"github.com/gravitl/netmaker/models"
+	"github.com/gravitl/netmaker/netclient/ncutils"
+	"github.com/gravitl/netmaker/servercfg"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 )
 
 func TestCreateEgressGateway(t *testing.T) {
@@ -33,6 +53,21 @@ func TestCreateEgressGateway(t *testing.T) {
 		assert.Equal(t, models.Node{}, node)
 		assert.EqualError(t, err, "windows is unsupported for egress gateways")
 	})
+	t.Run("DryRun", func(t *testing.T) {
+		deleteAllNodes()
+		testnode := createTestNode()
+		gateway.NodeID = testnode.ID
+
+		node, err := logic.ComputeEgressGateway(gateway)
+		assert.Nil(t, err)
+		assert.Equal(t, "yes", node.IsEgressGateway)
+		dryrun, err := logic.GetGatewayDryRun(&node)
+		assert.Nil(t, err)
+		assert.True(t, dryrun.DryRun)
+		stored, err := logic.GetNodeByID(testnode.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, "no", stored.IsEgressGateway)
+	})
 	t.Run("Success", func(t *testing.T) {
 		deleteAllNodes()
 		testnode := createTestNode()
@@ -104,7 +139,50 @@ func TestGetNetworkNodes(t *testing.T) {
 		assert.Nil(t, err)
 		assert.NotEqual(t, []models.Node(nil), node)
 	})
-
+	t.Run("SortByCreated", func(t *testing.T) {
+		deleteAllNodes()
+		oldest := createTestNode()
+		assert.NotZero(t, oldest.CreatedAt)
+		newest := models.Node{PublicKey: "DM5qhLAE20FG7BbfBCger+Ac9D2NDOwCtY1rbYDXf14=", Name: "newest", Endpoint: "10.0.0.2", MacAddress: "01:02:03:04:05:07", Password: "password", Network: "skynet", OS: "linux"}
+		assert.Nil(t, logic.CreateNode(&newest))
+		// nodes created before the field existed have no creation time and sort first
+		legacy := models.Node{PublicKey: "yPKd5Gp8Tj8Z8qWfJ4Fz3Rr6cYb2Ly0zQ7Gx1kHhV2M=", Name: "legacy", Endpoint: "10.0.0.3", MacAddress: "01:02:03:04:05:08", Password: "password", Network: "skynet", OS: "linux"}
+		assert.Nil(t, logic.CreateNode(&legacy))
+		for node, createdAt := range map[*models.Node]int64{oldest: 100, &newest: 200, &legacy: 0} {
+			node.CreatedAt = createdAt
+			data, err := json.Marshal(node)
+			assert.Nil(t, err)
+			assert.Nil(t, database.Insert(node.ID, string(data), database.NODES_TABLE_NAME))
+		}
+		list := func(query string) (int, []string) {
+			req := httptest.NewRequest(http.MethodGet, "/api/nodes/skynet?"+query, nil)
+			req = mux.SetURLVars(req, map[string]string{"network": "skynet"})
+			w := httptest.NewRecorder()
+			getNetworkNodes(w, req)
+			var nodes []models.Node
+			json.NewDecoder(w.Body).Decode(&nodes)
+			var names []string
+			for _, node := range nodes {
+				names = append(names, node.Name)
+			}
+			return w.Code, names
+		}
+		code, names := list("sort=created")
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, []string{"legacy", "testnode", "newest"}, names)
+		_, names = list("sort=created&order=desc")
+		assert.Equal(t, []string{"newest", "testnode", "legacy"}, names)
+		code, _ = list("sort=created&order=sideways")
+		assert.Equal(t, http.StatusBadRequest, code)
+		stored, err := logic.GetNodeByID(oldest.ID)
+		assert.Nil(t, err)
+		stored.Name = "renamed"
+		update := stored
+		update.CreatedAt = 0
+		assert.Nil(t, logic.UpdateNode(&stored, &update))
+		assert.Equal(t, int64(100), update.CreatedAt)
+	})
+	deleteAllNodes()
 }
 func TestUncordonNode(t *testing.T) {
 	database.InitializeDatabase()
@@ -133,9 +211,39 @@ func TestValidateEgressGateway(t *testing.T) {
 	})
 	t.Run("EmptyInterface", func(t *testing.T) {
 		gateway.Interface = ""
+		gateway.Ranges = []string{"10.100.100.0/24"}
 		err := logic.ValidateEgressGateway(gateway)
-		assert.NotNil(t, err)
-		assert.Equal(t, "interface cannot be empty", err.Error())
+		assert.Nil(t, err)
+	})
+	t.Run("InvalidInterface", func(t *testing.T) {
+		gateway.Ranges = []string{"10.100.100.0/24"}
+		for _, name := range []string{"eth0 -j ACCEPT", "eth0;reboot", "averyveryverylongname", ".."} {
+			gateway.Interface = name
+			err := logic.ValidateEgressGateway(gateway)
+			assert.ErrorIs(t, err, logic.ErrInvalidEgressInterface)
+		}
+	})
+	t.Run("InvalidRange", func(t *testing.T) {
+		gateway.Interface = "eth0"
+		gateway.Ranges = []string{"10.100.100.0"}
+		err := logic.ValidateEgressGateway(gateway)
+		assert.ErrorIs(t, err, logic.ErrInvalidEgressRange)
+	})
+	t.Run("InvalidTarget", func(t *testing.T) {
+		gateway.Interface = "eth0"
+		gateway.Ranges = []string{}
+		gateway.Targets = []string{"10.100.100.1"}
+		err := logic.ValidateEgressGateway(gateway)
+		assert.ErrorIs(t, err, logic.ErrInvalidEgressTarget)
+		gateway.Targets = nil
+	})
+	t.Run("TargetOnly", func(t *testing.T) {
+		gateway.Interface = "eth0"
+		gateway.Ranges = []string{}
+		gateway.Targets = []string{"lb.example.com"}
+		err := logic.ValidateEgressGateway(gateway)
+		assert.Nil(t, err)
+		gateway.Targets = nil
 	})
 	t.Run("Success", func(t *testing.T) {
 		gateway.Interface = "eth0"
@@ -145,10 +253,283 @@ func TestValidateEgressGateway(t *testing.T) {
 	})
 }
 
+func TestEgressGatewayInterface(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	createNet()
+	deleteAllNodes()
+	node := createTestNode()
+	request := models.EgressGatewayRequest{NodeID: node.ID, NetID: "skynet", Ranges: []string{"10.100.0.0/16"}}
+	t.Run("AutoDetect", func(t *testing.T) {
+		gateway, err := logic.ComputeEgressGateway(request)
+		assert.Nil(t, err)
+		assert.Contains(t, gateway.PostUp, "iptables -t nat -A POSTROUTING ! -o "+gateway.Interface+" -j MASQUERADE")
+		assert.Contains(t, gateway.PostDown, "iptables -t nat -D POSTROUTING ! -o "+gateway.Interface+" -j MASQUERADE")
+		assert.Empty(t, gateway.EgressGatewayInterface)
+	})
+	t.Run("Interface", func(t *testing.T) {
+		request.Interface = "eth1"
+		gateway, err := logic.ComputeEgressGateway(request)
+		assert.Nil(t, err)
+		assert.Contains(t, gateway.PostUp, "iptables -t nat -A POSTROUTING -o eth1 -j MASQUERADE")
+		assert.Equal(t, "eth1", gateway.EgressGatewayInterface)
+	})
+	t.Run("InvalidInterface", func(t *testing.T) {
+		body, err := json.Marshal(models.EgressGatewayRequest{Ranges: []string{"10.100.0.0/16"}, Interface: "eth1;reboot"})
+		assert.Nil(t, err)
+		req := httptest.NewRequest(http.MethodPost, "/api/nodes/skynet/"+node.ID+"/creategateway?dryrun=true", bytes.NewReader(body))
+		req = mux.SetURLVars(req, map[string]string{"network": "skynet", "nodeid": node.ID})
+		w := httptest.NewRecorder()
+		createEgressGateway(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+	stored, err := logic.GetNodeByID(node.ID)
+	assert.Nil(t, err)
+	reported := stored
+	reported.LocalInterfaces = []string{"lo", "eth0"}
+	assert.Nil(t, logic.UpdateNode(&stored, &reported))
+	t.Run("UnknownInterface", func(t *testing.T) {
+		request.Interface = "eth1"
+		_, err := logic.ComputeEgressGateway(request)
+		assert.ErrorIs(t, err, logic.ErrUnknownEgressInterface)
+	})
+	t.Run("InterfaceRemoved", func(t *testing.T) {
+		request.Interface = "eth0"
+		gateway, err := logic.CreateEgressGateway(request)
+		assert.Nil(t, err)
+		assert.Empty(t, gateway.EgressGatewayStatus)
+		update := gateway
+		update.LocalInterfaces = []string{"lo"}
+		assert.Nil(t, logic.UpdateNode(&gateway, &update))
+		stored, err := logic.GetNodeByID(node.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, "egress interface eth0 does not exist on the node", stored.EgressGatewayStatus)
+		removed, err := logic.DeleteEgressGateway("skynet", node.ID)
+		assert.Nil(t, err)
+		assert.Empty(t, removed.EgressGatewayInterface)
+		assert.Empty(t, removed.EgressGatewayStatus)
+	})
+	deleteAllNodes()
+}
+
+func TestEgressGatewayAddressFamilies(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	createNet()
+	deleteAllNodes()
+	node := createTestNode()
+	compute := func(ranges ...string) (models.Node, error) {
+		return logic.ComputeEgressGateway(models.EgressGatewayRequest{NodeID: node.ID, NetID: "skynet", Interface: "eth0", Ranges: ranges})
+	}
+	t.Run("IPv4", func(t *testing.T) {
+		gateway, err := compute("10.100.0.0/16")
+		assert.Nil(t, err)
+		assert.Contains(t, gateway.PostUp, "iptables -t nat -A POSTROUTING -o eth0 -j MASQUERADE")
+		assert.NotContains(t, gateway.PostUp, "ip6tables")
+		assert.NotContains(t, gateway.PostDown, "ip6tables")
+	})
+	t.Run("IPv6", func(t *testing.T) {
+		gateway, err := compute("fd00:100::/64")
+		assert.Nil(t, err)
+		assert.Contains(t, gateway.PostUp, "ip6tables -A FORWARD -i "+gateway.Interface+" -j ACCEPT")
+		assert.Contains(t, gateway.PostUp, "ip6tables -t nat -A POSTROUTING -o eth0 -j MASQUERADE")
+		assert.Contains(t, gateway.PostDown, "ip6tables -t nat -D POSTROUTING -o eth0 -j MASQUERADE")
+		assert.NotContains(t, gateway.PostUp, "iptables")
+		assert.NotContains(t, gateway.PostDown, "iptables")
+	})
+	t.Run("Mixed", func(t *testing.T) {
+		gateway, err := compute("10.100.0.0/16", "fd00:100::/64")
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"10.100.0.0/16", "fd00:100::/64"}, gateway.EgressGatewayRanges)
+		for _, iptables := range []string{"iptables", "ip6tables"} {
+			assert.Contains(t, gateway.PostUp, iptables+" -A FORWARD -o "+gateway.Interface+" -j ACCEPT")
+			assert.Contains(t, gateway.PostUp, iptables+" -t nat -A POSTROUTING -o eth0 -j MASQUERADE")
+			assert.Contains(t, gateway.PostDown, iptables+" -D FORWARD -o "+gateway.Interface+" -j ACCEPT")
+			assert.Contains(t, gateway.PostDown, iptables+" -t nat -D POSTROUTING -o eth0 -j MASQUERADE")
+		}
+	})
+	t.Run("InvalidRange", func(t *testing.T) {
+		for _, egressRange := range []string{"10.100.0.0/33", "fd00::/129", "fd00::", "garbage"} {
+			_, err := compute("10.100.0.0/16", egressRange)
+			assert.ErrorIs(t, err, logic.ErrInvalidEgressRange, egressRange)
+			assert.ErrorContains(t, err, egressRange)
+		}
+	})
+	deleteAllNodes()
+}
+
+func TestEgressGatewayNATRules(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	createNet()
+	deleteAllNodes()
+	node := createTestNode()
+	compute := func(natRules ...models.EgressNATRule) (models.Node, error) {
+		return logic.ComputeEgressGateway(models.EgressGatewayRequest{NodeID: node.ID, NetID: "skynet", Interface: "eth0", Ranges: []string{"10.100.0.0/16", "fd00:100::/64"}, NATRules: natRules})
+	}
+	t.Run("PerSource", func(t *testing.T) {
+		gateway, err := compute(
+			models.EgressNATRule{Source: "10.20.0.0/16", NAT: false},
+			models.EgressNATRule{Source: "10.20.5.0/24", NAT: true},
+			models.EgressNATRule{Source: "fd00:20::/64", NAT: false},
+		)
+		assert.Nil(t, err)
+		assert.Equal(t, []models.EgressNATRule{{Source: "fd00:20::/64", NAT: false}, {Source: "10.20.5.0/24", NAT: true}, {Source: "10.20.0.0/16", NAT: false}}, gateway.EgressGatewayNATRules)
+		assert.Contains(t, gateway.PostUp, "iptables -t nat -A POSTROUTING -s 10.20.5.0/24 -o eth0 -j MASQUERADE ; iptables -t nat -A POSTROUTING -s 10.20.0.0/16 -o eth0 -j RETURN ; iptables -t nat -A POSTROUTING -o eth0 -j MASQUERADE")
+		assert.Contains(t, gateway.PostUp, "ip6tables -t nat -A POSTROUTING -s fd00:20::/64 -o eth0 -j RETURN ; ip6tables -t nat -A POSTROUTING -o eth0 -j MASQUERADE")
+		assert.Contains(t, gateway.PostDown, "iptables -t nat -D POSTROUTING -s 10.20.0.0/16 -o eth0 -j RETURN")
+		assert.Contains(t, gateway.PostDown, "ip6tables -t nat -D POSTROUTING -s fd00:20::/64 -o eth0 -j RETURN")
+		assert.NotContains(t, gateway.PostUp, "iptables -t nat -A POSTROUTING -s fd00")
+		assert.NotContains(t, gateway.PostUp, "ip6tables -t nat -A POSTROUTING -s 10.")
+	})
+	t.Run("Duplicate", func(t *testing.T) {
+		gateway, err := compute(models.EgressNATRule{Source: "10.20.0.1/16", NAT: false}, models.EgressNATRule{Source: "10.20.0.0/16", NAT: false})
+		assert.Nil(t, err)
+		assert.Equal(t, []models.EgressNATRule{{Source: "10.20.0.0/16", NAT: false}}, gateway.EgressGatewayNATRules)
+	})
+	t.Run("Contradictory", func(t *testing.T) {
+		_, err := compute(models.EgressNATRule{Source: "10.20.0.0/16", NAT: false}, models.EgressNATRule{Source: "10.20.0.1/16", NAT: true})
+		assert.ErrorIs(t, err, logic.ErrEgressNATConflict)
+		assert.Equal(t, http.StatusBadRequest, egressGatewayError(err).Code)
+	})
+	t.Run("InvalidSource", func(t *testing.T) {
+		for _, source := range []string{"", "10.20.0.0", "10.20.0.0/33", "tenant-a"} {
+			_, err := compute(models.EgressNATRule{Source: source, NAT: true})
+			assert.ErrorIs(t, err, logic.ErrInvalidEgressNATRule, source)
+		}
+	})
+	deleteAllNodes()
+}
+
+func TestGatewayPendingNode(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	deleteAllNodes()
+	createNet()
+	pending := models.Node{PublicKey: "DM5qhLAE20PG9BbfBCger+Ac9D2NDOwCtY1rbYDLf34=", Name: "pendingnode", Endpoint: "10.0.0.2", MacAddress: "01:02:03:04:05:06", Password: "password", Network: "skynet", OS: "linux", IsPending: "yes"}
+	assert.Nil(t, logic.CreateNode(&pending))
+	egress := models.EgressGatewayRequest{NodeID: pending.ID, NetID: "skynet", Interface: "eth0", Ranges: []string{"10.100.0.0/16"}}
+	t.Run("Egress", func(t *testing.T) {
+		_, err := logic.CreateEgressGateway(egress)
+		assert.ErrorIs(t, err, logic.ErrGatewayNodePending)
+		errorResponse := egressGatewayError(err)
+		assert.Equal(t, http.StatusConflict, errorResponse.Code)
+		assert.Equal(t, models.ERR_NODE_PENDING, errorResponse.ErrorCode)
+		node, err := logic.GetNodeByID(pending.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, "no", node.IsEgressGateway)
+	})
+	t.Run("Ingress", func(t *testing.T) {
+		_, err := logic.CreateIngressGateway("skynet", pending.ID, models.IngressGatewayRequest{})
+		assert.ErrorIs(t, err, logic.ErrGatewayNodePending)
+		errorResponse := ingressGatewayError(err)
+		assert.Equal(t, http.StatusConflict, errorResponse.Code)
+		assert.Equal(t, models.ERR_NODE_PENDING, errorResponse.ErrorCode)
+	})
+	t.Run("Approved", func(t *testing.T) {
+		_, err := logic.UncordonNode(pending.ID)
+		assert.Nil(t, err)
+		node, err := logic.CreateEgressGateway(egress)
+		assert.Nil(t, err)
+		assert.Equal(t, "yes", node.IsEgressGateway)
+	})
+	deleteAllNodes()
+}
+
+func TestEgressRangeOverlap(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	createNet()
+	deleteAllNodes()
+	node := createTestNode()
+	peer := models.Node{PublicKey: "DM5qhLAE20PG9BbfBCger+Ac9D2NDOwCtY1rbYDLg35=", Name: "peernode", Endpoint: "10.0.0.2", MacAddress: "01:02:03:04:05:07", Password: "password", Network: "skynet", OS: "linux"}
+	err := logic.CreateNode(&peer)
+	assert.Nil(t, err)
+	_, err = logic.CreateEgressGateway(models.EgressGatewayRequest{NodeID: node.ID, NetID: "skynet", Interface: "eth0", Ranges: []string{"10.100.0.0/16"}})
+	assert.Nil(t, err)
+	t.Run("Overlap", func(t *testing.T) {
+		_, err := logic.CreateEgressGateway(models.EgressGatewayRequest{NodeID: peer.ID, NetID: "skynet", Interface: "eth0", Ranges: []string{"10.100.5.0/24"}})
+		var conflict *logic.EgressRangeConflictError
+		assert.ErrorAs(t, err, &conflict)
+		assert.Equal(t, node.ID, conflict.OwnerID)
+		assert.Equal(t, "10.100.0.0/16", conflict.OwnerRange)
+		errorResponse := egressGatewayError(err)
+		assert.Equal(t, http.StatusConflict, errorResponse.Code)
+		assert.Equal(t, models.ERR_EGRESS_RANGE_OVERLAP, errorResponse.ErrorCode)
+		assert.Equal(t, node.ID, errorResponse.ConflictingNodeID)
+	})
+	t.Run("SameGateway", func(t *testing.T) {
+		_, err := logic.CreateEgressGateway(models.EgressGatewayRequest{NodeID: node.ID, NetID: "skynet", Interface: "eth0", Ranges: []string{"10.100.0.0/16", "10.100.1.0/24"}})
+		assert.Nil(t, err)
+	})
+	t.Run("Disjoint", func(t *testing.T) {
+		_, err := logic.CreateEgressGateway(models.EgressGatewayRequest{NodeID: peer.ID, NetID: "skynet", Interface: "eth0", Ranges: []string{"10.200.0.0/24"}})
+		assert.Nil(t, err)
+	})
+	t.Run("Force", func(t *testing.T) {
+		gateway, err := logic.CreateEgressGateway(models.EgressGatewayRequest{NodeID: peer.ID, NetID: "skynet", Interface: "eth0", Ranges: []string{"10.0.0.0/8"}, Force: true})
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"10.0.0.0/8"}, gateway.EgressGatewayRanges)
+	})
+}
+
+func TestEgressGatewayMetric(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	createNet()
+	deleteAllNodes()
+	primary := createTestNode()
+	backup := models.Node{PublicKey: "DM5qhLAE20FG7BbfBCger+Ac9D2NDOwCtY1rbYDXf14=", Name: "backup", Endpoint: "10.0.0.2", MacAddress: "01:02:03:04:05:07", Password: "password", Network: "skynet", OS: "linux"}
+	assert.Nil(t, logic.CreateNode(&backup))
+	client := models.Node{PublicKey: "yPKd5Gp8Tj8Z8qWfJ4Fz3Rr6cYb2Ly0zQ7Gx1kHhV2M=", Name: "client", Endpoint: "10.0.0.3", MacAddress: "01:02:03:04:05:08", Password: "password", Network: "skynet", OS: "linux"}
+	assert.Nil(t, logic.CreateNode(&client))
+	routes := func(gatewayID string) []string {
+		gateway, err := logic.GetNodeByID(gatewayID)
+		assert.Nil(t, err)
+		networkNodes, err := logic.GetNetworkNodes("skynet")
+		assert.Nil(t, err)
+		var allowedips []string
+		for _, ipnet := range logic.GetAllowedIPs(&client, &gateway, networkNodes) {
+			allowedips = append(allowedips, ipnet.String())
+		}
+		return allowedips
+	}
+	t.Run("NegativeMetric", func(t *testing.T) {
+		_, err := logic.CreateEgressGateway(models.EgressGatewayRequest{NodeID: primary.ID, NetID: "skynet", Interface: "eth0", Ranges: []string{"10.100.0.0/16"}, Metric: -1})
+		assert.ErrorIs(t, err, logic.ErrInvalidEgressMetric)
+		assert.Equal(t, http.StatusBadRequest, egressGatewayError(err).Code)
+	})
+	gateway, err := logic.CreateEgressGateway(models.EgressGatewayRequest{NodeID: primary.ID, NetID: "skynet", Interface: "eth0", Ranges: []string{"10.100.0.0/16"}, Metric: 10})
+	assert.Nil(t, err)
+	assert.Equal(t, int32(10), gateway.EgressGatewayMetric)
+	t.Run("SameMetricConflicts", func(t *testing.T) {
+		_, err := logic.CreateEgressGateway(models.EgressGatewayRequest{NodeID: backup.ID, NetID: "skynet", Interface: "eth0", Ranges: []string{"10.100.0.0/16"}, Metric: 10})
+		var conflict *logic.EgressRangeConflictError
+		assert.ErrorAs(t, err, &conflict)
+	})
+	_, err = logic.CreateEgressGateway(models.EgressGatewayRequest{NodeID: backup.ID, NetID: "skynet", Interface: "eth0", Ranges: []string{"10.100.0.0/16", "10.100.5.0/24", "10.200.0.0/24"}, Metric: 20})
+	assert.Nil(t, err)
+	t.Run("LowerMetricWins", func(t *testing.T) {
+		assert.Contains(t, routes(primary.ID), "10.100.0.0/16")
+		backupRoutes := routes(backup.ID)
+		assert.NotContains(t, backupRoutes, "10.100.0.0/16")
+		assert.NotContains(t, backupRoutes, "10.100.5.0/24")
+		assert.Contains(t, backupRoutes, "10.200.0.0/24")
+	})
+	t.Run("BackupTakesOver", func(t *testing.T) {
+		_, err := logic.DeleteEgressGateway("skynet", primary.ID)
+		assert.Nil(t, err)
+		backupRoutes := routes(backup.ID)
+		assert.Contains(t, backupRoutes, "10.100.0.0/16")
+		assert.Contains(t, backupRoutes, "10.100.5.0/24")
+	})
+	deleteAllNodes()
+}
+
 func TestNodeACLs(t *testing.T) {
 	deleteAllNodes()
 	node1 := models.Node{PublicKey: "DM5qhLAE20PG9BbfBCger+Ac9D2NDOwCtY1rbYDLf34=", Name: "testnode", Endpoint: "10.0.0.50", MacAddress: "01:02:03:04:05:06", Password: "password", Network: "skynet", OS: "linux"}
-	node2 := models.Node{PublicKey: "DM5qhLAE20FG7BbfBCger+Ac9D2NDOwCtY1rbYDXf14=", Name: "testnode", Endpoint: "10.0.0.100", MacAddress: "01:02:03:04:05:07", Password: "password", Network: "skynet", OS: "linux"}
+	node2 := models.Node{PublicKey: "DM5qhLAE20FG7BbfBCger+Ac9D2NDOwCtY1rbYDXf14=", Name: "testnode2", Endpoint: "10.0.0.100", MacAddress: "01:02:03:04:05:07", Password: "password", Network: "skynet", OS: "linux"}
 	logic.CreateNode(&node1)
 	logic.CreateNode(&node2)
 	t.Run("acls not present", func(t *testing.T) {
@@ -211,12 +592,3726 @@ func TestNodeACLs(t *testing.T) {
 	deleteAllNodes()
 }
 
-func deleteAllNodes() {
-	database.DeleteAllRecords(database.NODES_TABLE_NAME)
+func TestNodeListQuery(t *testing.T) {
+	nodes := []models.Node{
+		{Name: "charlie", Address: "10.0.0.3", Network: "skynet", IsPending: "no", LastModified: 3, Tags: []string{"edge", "db"}},
+		{Name: "alpha", Address: "10.0.0.1", Network: "skynet", IsPending: "yes", LastModified: 2, Tags: []string{"ci"}},
+		{Name: "bravo", Address: "10.0.0.2", Network: "other", IsPending: "yes", LastModified: 1},
+	}
+	t.Run("InvalidParams", func(t *testing.T) {
+		for _, q := range []string{"limit=-1", "offset=abc", "sort=id", "pending=maybe"} {
+			req := httptest.NewRequest(http.MethodGet, "/api/nodes?"+q, nil)
+			_, err := parseNodeListQuery(req)
+			assert.NotNil(t, err, q)
+		}
+	})
+	t.Run("SortAndPage", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/nodes?sort=name&limit=2&offset=1", nil)
+		query, err := parseNodeListQuery(req)
+		assert.Nil(t, err)
+		page, total := query.apply(nodes)
+		assert.Equal(t, 3, total)
+		assert.Equal(t, 2, len(page))
+		assert.Equal(t, "bravo", page[0].Name)
+		assert.Equal(t, "charlie", page[1].Name)
+	})
+	t.Run("Filters", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/nodes?network=skynet&pending=true", nil)
+		query, err := parseNodeListQuery(req)
+		assert.Nil(t, err)
+		page, total := query.apply(nodes)
+		assert.Equal(t, 1, total)
+		assert.Equal(t, "alpha", page[0].Name)
+	})
+	t.Run("TagFilter", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/nodes?tag=edge", nil)
+		query, err := parseNodeListQuery(req)
+		assert.Nil(t, err)
+		page, total := query.apply(nodes)
+		assert.Equal(t, 1, total)
+		assert.Equal(t, "charlie", page[0].Name)
+	})
+	t.Run("OffsetPastEnd", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/nodes?offset=10", nil)
+		query, err := parseNodeListQuery(req)
+		assert.Nil(t, err)
+		page, total := query.apply(nodes)
+		assert.Equal(t, 3, total)
+		assert.Equal(t, 0, len(page))
+	})
 }
 
-func createTestNode() *models.Node {
-	createnode := models.Node{PublicKey: "DM5qhLAE20PG9BbfBCger+Ac9D2NDOwCtY1rbYDLf34=", Name: "testnode", Endpoint: "10.0.0.1", MacAddress: "01:02:03:04:05:06", Password: "password", Network: "skynet", OS: "linux"}
-	logic.CreateNode(&createnode)
-	return &createnode
+func TestNodeFieldMask(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	createNet()
+	deleteAllNodes()
+	os.Setenv("MASTER_KEY", "secretkey")
+	defer os.Unsetenv("MASTER_KEY")
+	node := createTestNode()
+	r := mux.NewRouter()
+	nodeHandlers(r)
+	list := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/nodes?"+query, nil)
+		req.Header.Set("Authorization", "Bearer secretkey")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	t.Run("Projected", func(t *testing.T) {
+		w := list("fields=name,address,network")
+		assert.Equal(t, http.StatusOK, w.Code)
+		var nodes []map[string]interface{}
+		assert.Nil(t, json.NewDecoder(w.Body).Decode(&nodes))
+		assert.Equal(t, []map[string]interface{}{{"name": node.Name, "address": node.Address, "network": "skynet"}}, nodes)
+	})
+	t.Run("WithPaging", func(t *testing.T) {
+		w := list("fields=id&offset=1")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "1", w.Header().Get("X-Total-Count"))
+		assert.Equal(t, "[]\n", w.Body.String())
+	})
+	t.Run("WholeNode", func(t *testing.T) {
+		w := list("fields=")
+		assert.Equal(t, http.StatusOK, w.Code)
+		var nodes []models.Node
+		assert.Nil(t, json.NewDecoder(w.Body).Decode(&nodes))
+		assert.Equal(t, node.PublicKey, nodes[0].PublicKey)
+	})
+	t.Run("UnknownField", func(t *testing.T) {
+		for _, query := range []string{"fields=name,adress", "fields=Name", "fields=-"} {
+			w := list(query)
+			assert.Equal(t, http.StatusBadRequest, w.Code, query)
+		}
+	})
+	deleteAllNodes()
+}
+
+func TestFilterNodesByStatus(t *testing.T) {
+	nodes := []models.Node{
+		{Name: "active", IsPending: "no"},
+		{Name: "pending", IsPending: "yes"},
+		{Name: "unset"},
+	}
+	t.Run("All", func(t *testing.T) {
+		filtered, err := filterNodesByStatus(nodes, "")
+		assert.Nil(t, err)
+		assert.Len(t, filtered, 3)
+		filtered, err = filterNodesByStatus(nodes, "all")
+		assert.Nil(t, err)
+		assert.Len(t, filtered, 3)
+	})
+	t.Run("Active", func(t *testing.T) {
+		filtered, err := filterNodesByStatus(nodes, "active")
+		assert.Nil(t, err)
+		assert.Len(t, filtered, 2)
+		assert.Equal(t, "active", filtered[0].Name)
+		assert.Equal(t, "unset", filtered[1].Name)
+	})
+	t.Run("Pending", func(t *testing.T) {
+		filtered, err := filterNodesByStatus(nodes, "pending")
+		assert.Nil(t, err)
+		assert.Len(t, filtered, 1)
+		assert.Equal(t, "pending", filtered[0].Name)
+	})
+	t.Run("Invalid", func(t *testing.T) {
+		_, err := filterNodesByStatus(nodes, "approved")
+		assert.NotNil(t, err)
+	})
+}
+
+func TestIdempotencyKeys(t *testing.T) {
+	database.InitializeDatabase()
+	database.DeleteAllRecords(database.IDEMPOTENCY_KEYS_TABLE_NAME)
+	t.Run("UnknownKey", func(t *testing.T) {
+		_, ok := logic.GetIdempotentNodeID("skynet", "unknown")
+		assert.False(t, ok)
+	})
+	t.Run("Saved", func(t *testing.T) {
+		err := logic.SaveIdempotencyKey("skynet", "retry-1", "node-id")
+		assert.Nil(t, err)
+		nodeID, ok := logic.GetIdempotentNodeID("skynet", "retry-1")
+		assert.True(t, ok)
+		assert.Equal(t, "node-id", nodeID)
+		_, ok = logic.GetIdempotentNodeID("othernet", "retry-1")
+		assert.False(t, ok)
+	})
+	t.Run("ConcurrentRetries", func(t *testing.T) {
+		deleteAllNetworks()
+		createNet()
+		network, err := logic.GetNetwork("skynet")
+		assert.Nil(t, err)
+		key, err := logic.CreateAccessKey(models.AccessKey{Name: "retries", Uses: 10}, network)
+		assert.Nil(t, err)
+		wgKey, err := wgtypes.GeneratePrivateKey()
+		assert.Nil(t, err)
+		body, err := json.Marshal(&models.Node{Name: "retried", PublicKey: wgKey.PublicKey().String(), Endpoint: "192.0.2.10", MacAddress: "02:00:00:00:02:01", Password: "password", Network: "skynet", OS: "linux",
+			AccessKey: key.Value, TrafficKeys: models.TrafficKeys{Mine: []byte("node-traffic-key")}})
+		assert.Nil(t, err)
+		r := mux.NewRouter()
+		nodeHandlers(r)
+		var wg sync.WaitGroup
+		responses := make([]*httptest.ResponseRecorder, 3)
+		for i := range responses {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				req := httptest.NewRequest(http.MethodPost, "/api/nodes/skynet", bytes.NewReader(body))
+				req.Header.Set("Authorization", "Bearer "+key.Value)
+				req.Header.Set("Idempotency-Key", "retry-2")
+				responses[i] = httptest.NewRecorder()
+				r.ServeHTTP(responses[i], req)
+			}(i)
+		}
+		wg.Wait()
+		ids := map[string]bool{}
+		for _, w := range responses {
+			assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+			var created models.NodeGet
+			assert.Nil(t, json.NewDecoder(w.Body).Decode(&created))
+			ids[created.Node.ID] = true
+		}
+		assert.Len(t, ids, 1)
+		nodes, err := logic.GetNetworkNodes("skynet")
+		assert.Nil(t, err)
+		assert.Len(t, nodes, 1)
+		deleteAllNetworks()
+	})
+}
+
+func TestDrainNode(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	createNet()
+	node := createTestNode()
+	t.Run("NotDraining", func(t *testing.T) {
+		status := logic.GetNodeDrainStatus(node)
+		assert.False(t, status.Draining)
+		assert.False(t, status.Complete)
+	})
+	t.Run("BadID", func(t *testing.T) {
+		_, err := logic.DrainNode("blahblah")
+		assert.EqualError(t, err, "no result found")
+	})
+	t.Run("Draining", func(t *testing.T) {
+		drained, err := logic.DrainNode(node.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, "yes", drained.IsDraining)
+		status := logic.GetNodeDrainStatus(&drained)
+		assert.True(t, status.Draining)
+		assert.False(t, status.Complete)
+		assert.Equal(t, drained.DrainStarted+servercfg.GetNodeDrainGracePeriod(), status.Ends)
+	})
+	t.Run("GracePeriodOver", func(t *testing.T) {
+		drained, err := logic.GetNodeByID(node.ID)
+		assert.Nil(t, err)
+		drained.DrainStarted -= servercfg.GetNodeDrainGracePeriod()
+		assert.True(t, logic.GetNodeDrainStatus(&drained).Complete)
+	})
+}
+
+func TestUpdateNodeWithVersion(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	createNet()
+	node := createTestNode()
+	current, err := logic.GetNodeByID(node.ID)
+	assert.Nil(t, err)
+	version := current.ResourceVersion
+	t.Run("Success", func(t *testing.T) {
+		newNode := current
+		newNode.Name = "updated"
+		err := logic.UpdateNodeWithVersion(&current, &newNode, version)
+		assert.Nil(t, err)
+		assert.Equal(t, version+1, newNode.ResourceVersion)
+	})
+	t.Run("StaleVersion", func(t *testing.T) {
+		newNode := current
+		newNode.Name = "stale"
+		err := logic.UpdateNodeWithVersion(&current, &newNode, version)
+		assert.ErrorIs(t, err, logic.ErrNodeVersionConflict)
+		stored, err := logic.GetNodeByID(node.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, "updated", stored.Name)
+	})
+}
+
+func TestCreateNodeIPv6Only(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	var network models.Network
+	network.NetID = "ipv6only"
+	network.AddressRange6 = "fde6:be04:fa5e:d077::/64"
+	network.IsIPv4 = "no"
+	network.IsIPv6 = "yes"
+	_, err := logic.CreateNetwork(network)
+	assert.Nil(t, err)
+	node := models.Node{PublicKey: "DM5qhLAE20PG9BbfBCger+Ac9D2NDOwCtY1rbYDLf34=", Name: "testnode", Endpoint: "10.0.0.1", MacAddress: "01:02:03:04:05:06", Password: "password", Network: "ipv6only", OS: "linux"}
+	err = logic.CreateNode(&node)
+	assert.Nil(t, err)
+	assert.Equal(t, "", node.Address)
+	assert.NotEqual(t, "", node.Address6)
+	assert.Equal(t, node.Address6, node.PrimaryAddress())
+}
+
+func TestReplaceRelayAddr(t *testing.T) {
+	t.Run("IPv4", func(t *testing.T) {
+		addrs := replaceRelayAddr([]string{"10.0.0.2", "10.0.0.3"}, "10.0.0.2", "10.0.0.4")
+		assert.Equal(t, []string{"10.0.0.3", "10.0.0.4"}, addrs)
+	})
+	t.Run("IPv6", func(t *testing.T) {
+		addrs := replaceRelayAddr([]string{"10.0.0.3", "fd00::2"}, "fd00::2", "fd00::4")
+		assert.Equal(t, []string{"10.0.0.3", "fd00::4"}, addrs)
+	})
+	t.Run("Unchanged", func(t *testing.T) {
+		addrs := replaceRelayAddr([]string{"fd00::2"}, "", "")
+		assert.Equal(t, []string{"fd00::2"}, addrs)
+	})
+	t.Run("AddressRemoved", func(t *testing.T) {
+		addrs := replaceRelayAddr([]string{"10.0.0.2", "fd00::2"}, "10.0.0.2", "")
+		assert.Equal(t, []string{"fd00::2"}, addrs)
+	})
+}
+
+func TestUpdateRelayIPv6Change(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	createNetDualStack()
+	relay := models.Node{PublicKey: "DM5qhLAE20PG9BbfBCger+Ac9D2NDOwCtY1rbYDLf34=", Name: "relay", Endpoint: "10.0.0.1", MacAddress: "01:02:03:04:05:06", Password: "password", Network: "skynet6", OS: "linux"}
+	err := logic.CreateNode(&relay)
+	assert.Nil(t, err)
+	relayed := models.Node{PublicKey: "DM5qhLAE20PG9BbfBCger+Ac9D2NDOwCtY1rbYDLg35=", Name: "relayed", Endpoint: "10.0.0.2", MacAddress: "01:02:03:04:05:07", Password: "password", Network: "skynet6", OS: "linux"}
+	err = logic.CreateNode(&relayed)
+	assert.Nil(t, err)
+	_, _, err = logic.CreateRelay(models.RelayRequest{NodeID: relay.ID, NetID: "skynet6", RelayAddrs: []string{relayed.Address, relayed.Address6}})
+	assert.Nil(t, err)
+	relayed, err = logic.GetNodeByID(relayed.ID)
+	assert.Nil(t, err)
+
+	newRelayed := relayed
+	newRelayed.Address6 = "fde6:be04:fa5e:d076::99"
+	assert.Nil(t, updateRelay(&relayed, &newRelayed))
+
+	updatedRelay, err := logic.GetNodeByID(relay.ID)
+	assert.Nil(t, err)
+	assert.Contains(t, updatedRelay.RelayAddrs, relayed.Address)
+	assert.Contains(t, updatedRelay.RelayAddrs, "fde6:be04:fa5e:d076::99")
+	assert.NotContains(t, updatedRelay.RelayAddrs, relayed.Address6)
+	assert.Len(t, updatedRelay.RelayAddrs, 2)
+}
+
+func TestReassignNodeAddress(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	createNet()
+	node := createTestNode()
+	other := models.Node{PublicKey: "DM5qhLAE20PG9BbfBCger+Ac9D2NDOwCtY1rbYDLg35=", Name: "othernode", Endpoint: "10.0.0.2", MacAddress: "01:02:03:04:05:07", Password: "password", Network: "skynet", OS: "linux"}
+	err := logic.CreateNode(&other)
+	assert.Nil(t, err)
+	t.Run("NoAddress", func(t *testing.T) {
+		_, _, err := logic.ReassignNodeAddress(node.ID, models.IPReassignRequest{})
+		assert.EqualError(t, err, "address or address6 must be provided")
+	})
+	t.Run("OutOfRange", func(t *testing.T) {
+		_, _, err := logic.ReassignNodeAddress(node.ID, models.IPReassignRequest{Address: "10.10.10.10"})
+		assert.NotNil(t, err)
+	})
+	t.Run("Conflict", func(t *testing.T) {
+		_, _, err := logic.ReassignNodeAddress(node.ID, models.IPReassignRequest{Address: other.Address})
+		var conflict *logic.AddressConflictError
+		assert.ErrorAs(t, err, &conflict)
+		assert.Equal(t, other.ID, conflict.OwnerID)
+	})
+	t.Run("Success", func(t *testing.T) {
+		oldNode, newNode, err := logic.ReassignNodeAddress(node.ID, models.IPReassignRequest{Address: "10.0.0.200"})
+		assert.Nil(t, err)
+		assert.Equal(t, node.Address, oldNode.Address)
+		assert.Equal(t, "10.0.0.200", newNode.Address)
+		stored, err := logic.GetNodeByID(node.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, "10.0.0.200", stored.Address)
+	})
+}
+
+func TestMoveNode(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	deleteAllNodes()
+	createNet()
+	_, err := logic.CreateNetwork(models.Network{NetID: "prodnet", AddressRange: "10.0.20.0/24", DefaultACL: "no"})
+	assert.Nil(t, err)
+	node := createTestNode()
+	_, err = logic.CreateEgressGateway(models.EgressGatewayRequest{NodeID: node.ID, NetID: "skynet", Interface: "eth0", Ranges: []string{"10.100.0.0/16"}})
+	assert.Nil(t, err)
+	move := func(network, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/nodes/"+network+"/"+node.ID+"/move", strings.NewReader(body))
+		req = mux.SetURLVars(req, map[string]string{"network": network, "nodeid": node.ID})
+		w := httptest.NewRecorder()
+		moveNode(w, req)
+		return w
+	}
+	t.Run("UnknownNetwork", func(t *testing.T) {
+		w := move("skynet", `{"network":"missingnet"}`)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+	t.Run("SameNetwork", func(t *testing.T) {
+		w := move("skynet", `{"network":"skynet"}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+	t.Run("Success", func(t *testing.T) {
+		w := move("skynet", `{"network":"prodnet"}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		stored, err := logic.GetNodeByID(node.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, "prodnet", stored.Network)
+		assert.True(t, logic.IsAddressInCIDR(stored.Address, "10.0.20.0/24"))
+		assert.Equal(t, node.PublicKey, stored.PublicKey)
+		assert.Equal(t, "no", stored.IsEgressGateway)
+		assert.Empty(t, stored.EgressGatewayRanges)
+		nodeACL, err := nodeacls.FetchNodeACL(nodeacls.NetworkID("prodnet"), nodeacls.NodeID(node.ID))
+		assert.Nil(t, err)
+		assert.NotNil(t, nodeACL)
+	})
+	t.Run("WrongNetwork", func(t *testing.T) {
+		w := move("skynet", `{"network":"skynet"}`)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+	t.Run("ServerNode", func(t *testing.T) {
+		server := *node
+		server.ID = "server-node"
+		server.IsServer = "yes"
+		data, err := json.Marshal(&server)
+		assert.Nil(t, err)
+		assert.Nil(t, database.Insert(server.ID, string(data), database.NODES_TABLE_NAME))
+		_, _, err = logic.MoveNode(server.ID, "skynet")
+		assert.ErrorIs(t, err, logic.ErrMoveServerNode)
+	})
+	deleteAllNodes()
+	deleteAllNetworks()
+}
+
+func TestNodeTags(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	createNet()
+	t.Run("InvalidTag", func(t *testing.T) {
+		for _, tag := range []string{"Edge", "has space", "", "abcdefghijklmnopqrstuvwxyz0123456789"} {
+			node := models.Node{PublicKey: "DM5qhLAE20PG9BbfBCger+Ac9D2NDOwCtY1rbYDLf34=", Name: "testnode", Endpoint: "10.0.0.1", MacAddress: "01:02:03:04:05:06", Password: "password", Network: "skynet", OS: "linux", Tags: []string{tag}}
+			err := logic.CreateNode(&node)
+			assert.NotNil(t, err, tag)
+		}
+	})
+	t.Run("Deduplicated", func(t *testing.T) {
+		node := models.Node{PublicKey: "DM5qhLAE20PG9BbfBCger+Ac9D2NDOwCtY1rbYDLf34=", Name: "testnode", Endpoint: "10.0.0.1", MacAddress: "01:02:03:04:05:06", Password: "password", Network: "skynet", OS: "linux", Tags: []string{"edge", "db", "edge"}}
+		err := logic.CreateNode(&node)
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"edge", "db"}, node.Tags)
+		newNode := node
+		newNode.Tags = []string{"ci", "ci"}
+		err = logic.UpdateNode(&node, &newNode)
+		assert.Nil(t, err)
+		stored, err := logic.GetNodeByID(node.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"ci"}, stored.Tags)
+	})
+}
+
+func TestNodeDescription(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	deleteAllNodes()
+	createNet()
+	t.Run("Invalid", func(t *testing.T) {
+		for _, description := range []string{strings.Repeat("a", 65), "two\nlines", "tab\there"} {
+			node := models.Node{PublicKey: "DM5qhLAE20PG9BbfBCger+Ac9D2NDOwCtY1rbYDLf34=", Name: "testnode", Endpoint: "10.0.0.1", MacAddress: "01:02:03:04:05:06", Password: "password", Network: "skynet", OS: "linux", Description: description}
+			err := logic.CreateNode(&node)
+			assert.NotNil(t, err, description)
+		}
+	})
+	node1 := models.Node{PublicKey: "DM5qhLAE20PG9BbfBCger+Ac9D2NDOwCtY1rbYDLf34=", Name: "testnode", Endpoint: "10.0.0.50", MacAddress: "01:02:03:04:05:06", Password: "password", Network: "skynet", OS: "linux", Description: "office router"}
+	// a key of its own, keys differing only in their padding bits decode to the same peer
+	key, err := wgtypes.GeneratePrivateKey()
+	assert.Nil(t, err)
+	node2 := models.Node{PublicKey: key.PublicKey().String(), Name: "testnode2", Endpoint: "10.0.0.100", MacAddress: "01:02:03:04:05:07", Password: "password", Network: "skynet", OS: "linux"}
+	assert.Nil(t, logic.CreateNode(&node1))
+	assert.Nil(t, logic.CreateNode(&node2))
+	t.Run("PeerLabels", func(t *testing.T) {
+		peerUpdate, err := logic.GetPeerUpdate(&node2)
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]string{node1.PublicKey: "office router"}, peerUpdate.PeerLabels)
+		peerUpdate, err = logic.GetPeerUpdate(&node1)
+		assert.Nil(t, err)
+		assert.Nil(t, peerUpdate.PeerLabels)
+	})
+	t.Run("Update", func(t *testing.T) {
+		newNode := node1
+		newNode.Description = ""
+		assert.Nil(t, logic.UpdateNode(&node1, &newNode))
+		stored, err := logic.GetNodeByID(node1.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, "office router", stored.Description)
+		newNode = stored
+		newNode.Description = "too\nlong"
+		assert.NotNil(t, logic.UpdateNode(&stored, &newNode))
+	})
+	deleteAllNodes()
+	deleteAllNetworks()
+}
+
+func TestNetworkMTU(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	createNet()
+	network, err := logic.GetNetwork("skynet")
+	assert.Nil(t, err)
+	t.Run("InvalidNetworkMTU", func(t *testing.T) {
+		for _, mtu := range []int32{575, 9001} {
+			newNetwork := network
+			newNetwork.DefaultMTU = mtu
+			_, _, _, _, err := logic.UpdateNetwork(&network, &newNetwork)
+			assert.NotNil(t, err, mtu)
+		}
+	})
+	t.Run("Inherited", func(t *testing.T) {
+		newNetwork := network
+		newNetwork.DefaultMTU = 1400
+		_, _, _, _, err := logic.UpdateNetwork(&network, &newNetwork)
+		assert.Nil(t, err)
+		node := createTestNode()
+		assert.Equal(t, int32(1400), node.MTU)
+	})
+	t.Run("NodeOverride", func(t *testing.T) {
+		deleteAllNodes()
+		node := createTestNode()
+		newNode := *node
+		newNode.MTU = 100
+		err := logic.UpdateNode(node, &newNode)
+		assert.NotNil(t, err)
+		newNode.MTU = 9000
+		err = logic.UpdateNode(node, &newNode)
+		assert.Nil(t, err)
+		stored, err := logic.GetNodeByID(node.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, int32(9000), stored.MTU)
+	})
+}
+
+func TestNetworkKeepalive(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	deleteAllNodes()
+	createNet()
+	network, err := logic.GetNetwork("skynet")
+	assert.Nil(t, err)
+	t.Run("InvalidNetworkKeepalive", func(t *testing.T) {
+		for _, keepalive := range []int32{-1, 1001} {
+			newNetwork := network
+			newNetwork.DefaultKeepalive = keepalive
+			_, _, _, _, err := logic.UpdateNetwork(&network, &newNetwork)
+			assert.NotNil(t, err, keepalive)
+		}
+	})
+	newNetwork := network
+	newNetwork.DefaultKeepalive = 45
+	_, _, _, _, err = logic.UpdateNetwork(&network, &newNetwork)
+	assert.Nil(t, err)
+	t.Run("Inherited", func(t *testing.T) {
+		node := createTestNode()
+		assert.Equal(t, int32(45), node.PersistentKeepalive)
+	})
+	t.Run("PeerUpdate", func(t *testing.T) {
+		key, err := wgtypes.GeneratePrivateKey()
+		assert.Nil(t, err)
+		peer := models.Node{PublicKey: key.PublicKey().String(), Name: "peernode", Endpoint: "10.0.0.2", MacAddress: "01:02:03:04:05:07", Password: "password", Network: "skynet", OS: "linux", PersistentKeepalive: 10}
+		assert.Nil(t, logic.CreateNode(&peer))
+		peerUpdate, err := logic.GetPeerUpdate(&peer)
+		assert.Nil(t, err)
+		assert.Len(t, peerUpdate.Peers, 1)
+		assert.Equal(t, 10*time.Second, *peerUpdate.Peers[0].PersistentKeepaliveInterval)
+		// nodes without a keepalive of their own, such as ones that joined before it was defaulted, use the network's
+		peer.PersistentKeepalive = 0
+		data, err := json.Marshal(&peer)
+		assert.Nil(t, err)
+		assert.Nil(t, database.Insert(peer.ID, string(data), database.NODES_TABLE_NAME))
+		peerUpdate, err = logic.GetPeerUpdate(&peer)
+		assert.Nil(t, err)
+		assert.Len(t, peerUpdate.Peers, 1)
+		assert.Equal(t, 45*time.Second, *peerUpdate.Peers[0].PersistentKeepaliveInterval)
+	})
+	deleteAllNodes()
+}
+
+func TestRestoreNode(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	createNet()
+	deleteAllNodes()
+	// DeleteNodeByID hands the node to the zombie manager
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go logic.ManageZombies(ctx)
+	paused := make(chan models.Node, 1)
+	defer func(hook func(*models.Node) bool) { logic.NodeDeleted = hook }(logic.NodeDeleted)
+	logic.NodeDeleted = func(node *models.Node) bool {
+		paused <- *node
+		return true
+	}
+	node := createTestNode()
+	err := logic.DeleteNodeByID(node, false)
+	assert.Nil(t, err)
+	t.Run("PausedOnDelete", func(t *testing.T) {
+		select {
+		case pausedNode := <-paused:
+			assert.Equal(t, node.ID, pausedNode.ID)
+		case <-time.After(time.Second):
+			t.Fatal("deleted node was not told to pause")
+		}
+	})
+	t.Run("AddressReserved", func(t *testing.T) {
+		_, err := logic.GetNodeByID(node.ID)
+		assert.NotNil(t, err)
+		address, err := logic.UniqueAddress("skynet", false)
+		assert.Nil(t, err)
+		assert.NotEqual(t, node.Address, address)
+	})
+	t.Run("Restore", func(t *testing.T) {
+		restored, err := logic.RestoreNode(node.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(0), restored.DeletedAt)
+		stored, err := logic.GetNodeByID(node.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, node.Address, stored.Address)
+		assert.Equal(t, node.PublicKey, stored.PublicKey)
+		assert.Equal(t, node.Password, stored.Password)
+		_, err = logic.GetDeletedNodeByID(node.ID)
+		assert.NotNil(t, err)
+	})
+	t.Run("Expired", func(t *testing.T) {
+		stored, err := logic.GetNodeByID(node.ID)
+		assert.Nil(t, err)
+		err = logic.DeleteNodeByID(&stored, false)
+		assert.Nil(t, err)
+		stored.DeletedAt -= servercfg.GetNodeRecoveryWindow()
+		data, err := json.Marshal(&stored)
+		assert.Nil(t, err)
+		err = database.Insert(stored.ID, string(data), database.DELETED_NODES_TABLE_NAME)
+		assert.Nil(t, err)
+		_, err = logic.RestoreNode(node.ID)
+		assert.ErrorIs(t, err, logic.ErrNodeRecoveryExpired)
+		var reaped []string
+		defer func(hook func(*models.Node) bool) { logic.NodeReaped = hook }(logic.NodeReaped)
+		logic.NodeReaped = func(node *models.Node) bool {
+			reaped = append(reaped, node.ID)
+			return logic.AckNodeDelete(node.ID)
+		}
+		logic.ReapDeletedNodes()
+		assert.Equal(t, []string{node.ID}, reaped)
+		_, err = logic.GetDeletedNodeByID(node.ID)
+		assert.NotNil(t, err)
+		address, err := logic.UniqueAddress("skynet", false)
+		assert.Nil(t, err)
+		assert.Equal(t, node.Address, address)
+	})
+}
+
+func TestGetNetworkNodeSummaries(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	createNet()
+	deleteAllNodes()
+	node1 := models.Node{PublicKey: "DM5qhLAE20PG9BbfBCger+Ac9D2NDOwCtY1rbYDLf34=", Name: "summary1", Endpoint: "10.0.0.50", MacAddress: "01:02:03:04:05:06", Password: "password", Network: "skynet", OS: "linux"}
+	node2 := models.Node{PublicKey: "DM5qhLAE20FG7BbfBCger+Ac9D2NDOwCtY1rbYDXf14=", Name: "summary2", Endpoint: "10.0.0.100", MacAddress: "01:02:03:04:05:07", Password: "password", Network: "skynet", OS: "linux"}
+	logic.CreateNode(&node1)
+	logic.CreateNode(&node2)
+	t.Run("Peers", func(t *testing.T) {
+		summaries, err := logic.GetNetworkNodeSummaries("skynet")
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(summaries))
+		for _, summary := range summaries {
+			assert.Equal(t, 1, summary.PeerCount)
+			assert.False(t, summary.IsEgressGateway)
+		}
+	})
+	t.Run("ACLDisallowed", func(t *testing.T) {
+		currentACL, err := nodeacls.DisallowNodes(nodeacls.NetworkID("skynet"), nodeacls.NodeID(node1.ID), nodeacls.NodeID(node2.ID))
+		assert.Nil(t, err)
+		currentACL.Save(acls.ContainerID("skynet"))
+		summaries, err := logic.GetNetworkNodeSummaries("skynet")
+		assert.Nil(t, err)
+		for _, summary := range summaries {
+			assert.Equal(t, 0, summary.PeerCount)
+		}
+	})
+}
+
+func TestNodeNameUniqueness(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	createNet()
+	deleteAllNodes()
+	alpha := models.Node{PublicKey: "DM5qhLAE20PG9BbfBCger+Ac9D2NDOwCtY1rbYDLf34=", Name: "Alpha", Endpoint: "10.0.0.50", MacAddress: "01:02:03:04:05:06", Password: "password", Network: "skynet", OS: "linux"}
+	err := logic.CreateNode(&alpha)
+	assert.Nil(t, err)
+	t.Run("CreateDuplicate", func(t *testing.T) {
+		node := models.Node{PublicKey: "DM5qhLAE20FG7BbfBCger+Ac9D2NDOwCtY1rbYDXf14=", Name: "alpha", Endpoint: "10.0.0.100", MacAddress: "01:02:03:04:05:07", Password: "password", Network: "skynet", OS: "linux"}
+		err := logic.CreateNode(&node)
+		var conflict *logic.NodeNameConflictError
+		assert.ErrorAs(t, err, &conflict)
+		assert.Equal(t, alpha.ID, conflict.OwnerID)
+		errorResponse, ok := nodeNameConflict(err)
+		assert.True(t, ok)
+		assert.Equal(t, http.StatusConflict, errorResponse.Code)
+		assert.Equal(t, models.ERR_NODE_NAME_IN_USE, errorResponse.ErrorCode)
+		assert.Equal(t, alpha.ID, errorResponse.ConflictingNodeID)
+	})
+	t.Run("RenameToDuplicate", func(t *testing.T) {
+		beta := models.Node{PublicKey: "DM5qhLAE20FG7BbfBCger+Ac9D2NDOwCtY1rbYDXf14=", Name: "beta", Endpoint: "10.0.0.100", MacAddress: "01:02:03:04:05:07", Password: "password", Network: "skynet", OS: "linux"}
+		err := logic.CreateNode(&beta)
+		assert.Nil(t, err)
+		newNode := beta
+		newNode.Name = "ALPHA"
+		err = logic.UpdateNode(&beta, &newNode)
+		var conflict *logic.NodeNameConflictError
+		assert.ErrorAs(t, err, &conflict)
+	})
+	t.Run("SameEffectiveName", func(t *testing.T) {
+		newNode := alpha
+		newNode.Name = "alpha"
+		err := logic.UpdateNode(&alpha, &newNode)
+		assert.Nil(t, err)
+	})
+	t.Run("InvalidName", func(t *testing.T) {
+		node := models.Node{PublicKey: "DM5qhLAE20FG7BbfBCger+Ac9D2NDOwCtY1rbYDXg15=", Name: "bad_name!", Endpoint: "10.0.0.101", MacAddress: "01:02:03:04:05:08", Password: "password", Network: "skynet", OS: "linux"}
+		err := logic.CreateNode(&node)
+		assert.ErrorIs(t, err, logic.ErrInvalidNodeName)
+	})
+	t.Run("GeneratedName", func(t *testing.T) {
+		node := models.Node{PublicKey: "DM5qhLAE20FG7BbfBCger+Ac9D2NDOwCtY1rbYDXh16=", Endpoint: "10.0.0.102", MacAddress: "01:02:03:04:05:09", Password: "password", Network: "skynet", OS: "linux"}
+		err := logic.CreateNode(&node)
+		assert.Nil(t, err)
+		assert.NotEmpty(t, node.Name)
+		assert.NotEqual(t, strings.ToLower(alpha.Name), strings.ToLower(node.Name))
+		assert.NotEqual(t, "beta", strings.ToLower(node.Name))
+	})
+}
+
+func TestNodePublicKeyUniqueness(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	deleteAllNodes()
+	createNet()
+	// an existing wireguard keypair brought over from a deployment outside netmaker
+	key, err := wgtypes.GeneratePrivateKey()
+	assert.Nil(t, err)
+	adopted := models.Node{PublicKey: key.PublicKey().String(), Name: "adopted", Endpoint: "10.0.0.50", MacAddress: "01:02:03:04:05:06", Password: "password", Network: "skynet", OS: "linux"}
+	assert.Nil(t, logic.CreateNode(&adopted))
+	assert.Equal(t, key.PublicKey().String(), adopted.PublicKey)
+	t.Run("Duplicate", func(t *testing.T) {
+		node := models.Node{PublicKey: key.PublicKey().String(), Name: "copy", Endpoint: "10.0.0.100", MacAddress: "01:02:03:04:05:07", Password: "password", Network: "skynet", OS: "linux"}
+		err := logic.CreateNode(&node)
+		var conflict *logic.PublicKeyConflictError
+		assert.ErrorAs(t, err, &conflict)
+		assert.Equal(t, adopted.ID, conflict.OwnerID)
+		errorResponse, ok := publicKeyConflict(err)
+		assert.True(t, ok)
+		assert.Equal(t, http.StatusConflict, errorResponse.Code)
+		assert.Equal(t, models.ERR_PUBLIC_KEY_IN_USE, errorResponse.ErrorCode)
+		assert.Equal(t, adopted.ID, errorResponse.ConflictingNodeID)
+	})
+	t.Run("SameDecodedKey", func(t *testing.T) {
+		// differs only in the unused low bits of the last character, wireguard reads it as the same key
+		node := models.Node{PublicKey: "DM5qhLAE20PG9BbfBCger+Ac9D2NDOwCtY1rbYDLf35=", Name: "first", Endpoint: "10.0.0.101", MacAddress: "01:02:03:04:05:08", Password: "password", Network: "skynet", OS: "linux"}
+		assert.Nil(t, logic.CreateNode(&node))
+		node = models.Node{PublicKey: "DM5qhLAE20PG9BbfBCger+Ac9D2NDOwCtY1rbYDLf34=", Name: "second", Endpoint: "10.0.0.102", MacAddress: "01:02:03:04:05:09", Password: "password", Network: "skynet", OS: "linux"}
+		var conflict *logic.PublicKeyConflictError
+		assert.ErrorAs(t, logic.CreateNode(&node), &conflict)
+	})
+	t.Run("OtherNetwork", func(t *testing.T) {
+		_, err := logic.CreateNetwork(models.Network{NetID: "othernet", AddressRange: "10.0.54.0/24"})
+		assert.Nil(t, err)
+		node := models.Node{PublicKey: key.PublicKey().String(), Name: "adopted", Endpoint: "10.0.0.50", MacAddress: "01:02:03:04:05:0a", Password: "password", Network: "othernet", OS: "linux"}
+		assert.Nil(t, logic.CreateNode(&node))
+	})
+	t.Run("InvalidKey", func(t *testing.T) {
+		node := models.Node{PublicKey: "c2hvcnQ=", Name: "short", Endpoint: "10.0.0.103", MacAddress: "01:02:03:04:05:0b", Password: "password", Network: "skynet", OS: "linux"}
+		assert.ErrorIs(t, logic.CreateNode(&node), logic.ErrInvalidPublicKey)
+	})
+	deleteAllNodes()
+	deleteAllNetworks()
+}
+
+func TestStreamNodeEvents(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	createNet()
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest(http.MethodGet, "/api/nodes/skynet/events", nil).WithContext(ctx)
+	req = mux.SetURLVars(req, map[string]string{"network": "skynet"})
+	w := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		streamNodeEvents(w, req)
+		close(done)
+	}()
+	node := models.Node{ID: "event-node", Name: "eventnode", Network: "skynet", Address: "10.0.0.9"}
+	other := models.Node{ID: "other-node", Name: "othernode", Network: "othernet"}
+	// keep publishing until the handler has subscribed
+	for i := 0; i < 20; i++ {
+		logic.PublishNodeEvent(models.NODE_EVENT_UPDATE, &node)
+		logic.PublishNodeEvent(models.NODE_EVENT_UPDATE, &other)
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("event stream did not stop after the client disconnected")
+	}
+	assert.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+	body := w.Body.String()
+	assert.Contains(t, body, "event: update\ndata: ")
+	assert.Contains(t, body, `"nodeid":"event-node"`)
+	assert.NotContains(t, body, "other-node")
+}
+
+func TestNodesLastModified(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	createNet()
+	deleteAllNodes()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go logic.ManageZombies(ctx)
+	lastModified := func() int64 {
+		network, err := logic.GetNetwork("skynet")
+		assert.Nil(t, err)
+		return network.NodesLastModified
+	}
+	before := lastModified()
+	node := createTestNode()
+	t.Run("Create", func(t *testing.T) {
+		after := lastModified()
+		assert.Greater(t, after, before)
+		before = after
+	})
+	t.Run("Update", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPut, "/api/nodes/skynet/"+node.ID, strings.NewReader(`{"name":"renamed"}`))
+		req = mux.SetURLVars(req, map[string]string{"network": "skynet", "nodeid": node.ID})
+		w := httptest.NewRecorder()
+		updateNode(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		after := lastModified()
+		assert.Greater(t, after, before)
+		before = after
+	})
+	t.Run("Delete", func(t *testing.T) {
+		err := logic.DeleteNodeByID(node, false)
+		assert.Nil(t, err)
+		assert.Greater(t, lastModified(), before)
+	})
+}
+
+func TestPeerEpoch(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	deleteAllNodes()
+	createNet()
+	epoch := func() int64 {
+		network, err := logic.GetNetwork("skynet")
+		assert.Nil(t, err)
+		return network.PeerEpoch
+	}
+	before := epoch()
+	node := createTestNode()
+	peer := models.Node{PublicKey: "DM5qhLAE20PG9BbfBCger+Ac9D2NDOwCtY1rbYDLg35=", Name: "peernode", Endpoint: "10.0.0.2", MacAddress: "01:02:03:04:05:07", Password: "password", Network: "skynet", OS: "linux"}
+	assert.Nil(t, logic.CreateNode(&peer))
+	t.Run("Create", func(t *testing.T) {
+		after := epoch()
+		assert.Equal(t, before+2, after)
+		before = after
+		peerUpdate, err := logic.GetPeerUpdate(node)
+		assert.Nil(t, err)
+		assert.Equal(t, after, peerUpdate.PeerEpoch)
+	})
+	t.Run("Relay", func(t *testing.T) {
+		_, _, err := logic.CreateRelay(models.RelayRequest{NodeID: node.ID, NetID: "skynet", RelayAddrs: []string{peer.Address}})
+		assert.Nil(t, err)
+		assert.Greater(t, epoch(), before)
+		before = epoch()
+		_, _, err = logic.DeleteRelay("skynet", node.ID)
+		assert.Nil(t, err)
+		assert.Greater(t, epoch(), before)
+		before = epoch()
+	})
+	t.Run("NetworkUpdateKeepsEpoch", func(t *testing.T) {
+		network, err := logic.GetNetwork("skynet")
+		assert.Nil(t, err)
+		newNetwork := network
+		newNetwork.PeerEpoch = 0
+		_, _, _, _, err = logic.UpdateNetwork(&network, &newNetwork)
+		assert.Nil(t, err)
+		assert.Equal(t, before, epoch())
+	})
+	t.Run("Route", func(t *testing.T) {
+		os.Setenv("MASTER_KEY", "secretkey")
+		defer os.Unsetenv("MASTER_KEY")
+		router := mux.NewRouter()
+		nodeHandlers(router)
+		req := httptest.NewRequest(http.MethodGet, "/api/nodes/skynet/epoch", nil)
+		req.Header.Set("Authorization", "Bearer secretkey")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var peerEpoch models.PeerEpoch
+		assert.Nil(t, json.NewDecoder(w.Body).Decode(&peerEpoch))
+		assert.Equal(t, models.PeerEpoch{Network: "skynet", PeerEpoch: before}, peerEpoch)
+	})
+	t.Run("NodeTokens", func(t *testing.T) {
+		_, err := logic.CreateNetwork(models.Network{NetID: "othernet", AddressRange: "10.0.52.0/24"})
+		assert.Nil(t, err)
+		logic.SetJWTSecret()
+		router := mux.NewRouter()
+		nodeHandlers(router)
+		epochWith := func(network string) int {
+			token, err := logic.CreateJWT(node.ID, node.MacAddress, network, time.Minute)
+			assert.Nil(t, err)
+			req := httptest.NewRequest(http.MethodGet, "/api/nodes/othernet/epoch", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			return w.Code
+		}
+		assert.Equal(t, http.StatusForbidden, epochWith("skynet"))
+		assert.Equal(t, http.StatusOK, epochWith("othernet"))
+	})
+	deleteAllNodes()
+	deleteAllNetworks()
+}
+
+func TestPeerUpdateOrder(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	deleteAllNodes()
+	createNet()
+	node := createTestNode()
+	for i := 0; i < 5; i++ {
+		key, err := wgtypes.GeneratePrivateKey()
+		assert.Nil(t, err)
+		peer := models.Node{PublicKey: key.PublicKey().String(), Name: fmt.Sprintf("peer%d", i), Endpoint: fmt.Sprintf("10.0.1.%d", i+1), MacAddress: fmt.Sprintf("01:02:03:04:05:%02d", i+10), Password: "password", Network: "skynet", OS: "linux"}
+		assert.Nil(t, logic.CreateNode(&peer))
+	}
+	peerUpdate, err := logic.GetPeerUpdate(node)
+	assert.Nil(t, err)
+	assert.Len(t, peerUpdate.Peers, 5)
+	assert.True(t, sort.SliceIsSorted(peerUpdate.Peers, func(i, j int) bool {
+		return peerUpdate.Peers[i].PublicKey.String() < peerUpdate.Peers[j].PublicKey.String()
+	}))
+	for i := 0; i < 5; i++ {
+		again, err := logic.GetPeerUpdate(node)
+		assert.Nil(t, err)
+		assert.Equal(t, peerUpdate.Peers, again.Peers)
+		assert.Equal(t, peerUpdate.ServerAddrs, again.ServerAddrs)
+	}
+	deleteAllNodes()
+}
+
+func TestStaleNodes(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	deleteAllNodes()
+	createNet()
+	os.Setenv("MASTER_KEY", "secretkey")
+	defer os.Unsetenv("MASTER_KEY")
+	now := time.Now().Unix()
+	// name -> created at, last check in
+	times := map[string][2]int64{
+		"fresh":  {0, 0},
+		"zombie": {now - 3600, now - 3600},
+		"stale":  {now - 7200, now - 3600},
+		"active": {now - 7200, now},
+	}
+	var i int
+	for name, stamps := range times {
+		key, err := wgtypes.GeneratePrivateKey()
+		assert.Nil(t, err)
+		node := models.Node{PublicKey: key.PublicKey().String(), Name: name, Endpoint: fmt.Sprintf("10.0.1.%d", i+1), MacAddress: fmt.Sprintf("01:02:03:04:05:%02d", i+10), Password: "password", Network: "skynet", OS: "linux"}
+		i++
+		assert.Nil(t, logic.CreateNode(&node))
+		if name == "fresh" {
+			continue
+		}
+		node.CreatedAt, node.LastCheckIn = stamps[0], stamps[1]
+		data, err := json.Marshal(&node)
+		assert.Nil(t, err)
+		assert.Nil(t, database.Insert(node.ID, string(data), database.NODES_TABLE_NAME))
+	}
+	router := mux.NewRouter()
+	nodeHandlers(router)
+	get := func(threshold string) (int, models.StaleNodes) {
+		req := httptest.NewRequest(http.MethodGet, "/api/nodes/skynet/stale?threshold="+threshold, nil)
+		req.Header.Set("Authorization", "Bearer secretkey")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var staleNodes models.StaleNodes
+		if w.Code == http.StatusOK {
+			assert.Nil(t, json.NewDecoder(w.Body).Decode(&staleNodes))
+		}
+		return w.Code, staleNodes
+	}
+	names := func(nodes []models.StaleNode) []string {
+		var list = []string{}
+		for _, node := range nodes {
+			list = append(list, node.Name)
+		}
+		return list
+	}
+	t.Run("Threshold", func(t *testing.T) {
+		code, staleNodes := get("600")
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, int64(600), staleNodes.Threshold)
+		assert.Equal(t, []string{"stale"}, names(staleNodes.Stale))
+		assert.Equal(t, []string{"zombie"}, names(staleNodes.NeverCheckedIn))
+	})
+	t.Run("LongThreshold", func(t *testing.T) {
+		code, staleNodes := get("5400")
+		assert.Equal(t, http.StatusOK, code)
+		assert.Empty(t, staleNodes.Stale)
+		assert.Empty(t, staleNodes.NeverCheckedIn)
+	})
+	t.Run("InvalidThreshold", func(t *testing.T) {
+		for _, threshold := range []string{"abc", "0", "-5"} {
+			code, _ := get(threshold)
+			assert.Equal(t, http.StatusBadRequest, code, threshold)
+		}
+	})
+	deleteAllNodes()
+}
+
+func TestResyncNetworkPeers(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	deleteAllNodes()
+	deleteAllUsers()
+	createNet()
+	logic.SetJWTSecret()
+	createTestNode()
+	os.Setenv("MASTER_KEY", "secretkey")
+	defer os.Unsetenv("MASTER_KEY")
+	// keep the batched pass from publishing while the test runs
+	os.Setenv("PEER_UPDATE_BATCH_WINDOW", "60000")
+	defer os.Unsetenv("PEER_UPDATE_BATCH_WINDOW")
+	router := mux.NewRouter()
+	nodeHandlers(router)
+	resync := func(network, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/nodes/"+network+"/resync", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	t.Run("MessageQueueOff", func(t *testing.T) {
+		os.Setenv("MESSAGEQUEUE_BACKEND", "off")
+		defer os.Unsetenv("MESSAGEQUEUE_BACKEND")
+		w := resync("skynet", "secretkey")
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		var response models.ErrorResponse
+		assert.Nil(t, json.NewDecoder(w.Body).Decode(&response))
+		assert.Equal(t, models.ERR_MESSAGE_QUEUE_OFF, response.ErrorCode)
+	})
+	t.Run("Coalesced", func(t *testing.T) {
+		var first, second models.PeerResync
+		w := resync("skynet", "secretkey")
+		assert.Equal(t, http.StatusAccepted, w.Code)
+		assert.Nil(t, json.NewDecoder(w.Body).Decode(&first))
+		assert.Equal(t, "skynet", first.Network)
+		assert.NotEmpty(t, first.ResyncID)
+		w = resync("skynet", "secretkey")
+		assert.Equal(t, http.StatusAccepted, w.Code)
+		assert.Nil(t, json.NewDecoder(w.Body).Decode(&second))
+		assert.Equal(t, first, second)
+	})
+	t.Run("MissingNetwork", func(t *testing.T) {
+		w := resync("nonet", "secretkey")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+	t.Run("AdminOnly", func(t *testing.T) {
+		_, err := logic.CreateUser(models.User{UserName: "resyncer", Password: "password", Networks: []string{"skynet"}})
+		assert.Nil(t, err)
+		token, err := logic.CreateUserJWT("resyncer", []string{"skynet"}, false)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusUnauthorized, resync("skynet", token).Code)
+	})
+	deleteAllUsers()
+	deleteAllNodes()
+}
+
+func TestNodeByPublicKey(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	deleteAllNodes()
+	deleteAllUsers()
+	createNet()
+	logic.SetJWTSecret()
+	os.Setenv("MASTER_KEY", "secretkey")
+	defer os.Unsetenv("MASTER_KEY")
+	node := createTestNode()
+	router := mux.NewRouter()
+	nodeHandlers(router)
+	lookup := func(publicKey, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/nodes/bykey/"+publicKey, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	// '/' cannot travel in a path segment
+	urlSafe := strings.NewReplacer("+", "-", "/", "_").Replace
+	t.Run("Found", func(t *testing.T) {
+		w := lookup(urlSafe(node.PublicKey), "secretkey")
+		assert.Equal(t, http.StatusOK, w.Code)
+		var found models.Node
+		assert.Nil(t, json.NewDecoder(w.Body).Decode(&found))
+		assert.Equal(t, node.ID, found.ID)
+	})
+	t.Run("KeyChanged", func(t *testing.T) {
+		oldKey := node.PublicKey
+		key, err := wgtypes.GeneratePrivateKey()
+		assert.Nil(t, err)
+		newNode := *node
+		newNode.PublicKey = key.PublicKey().String()
+		assert.Nil(t, logic.UpdateNode(node, &newNode))
+		assert.Equal(t, http.StatusNotFound, lookup(urlSafe(oldKey), "secretkey").Code)
+		w := lookup(urlSafe(newNode.PublicKey), "secretkey")
+		assert.Equal(t, http.StatusOK, w.Code)
+		var found models.Node
+		assert.Nil(t, json.NewDecoder(w.Body).Decode(&found))
+		assert.Equal(t, node.ID, found.ID)
+		node = &newNode
+	})
+	t.Run("SharedAcrossNetworks", func(t *testing.T) {
+		_, err := logic.CreateNetwork(models.Network{NetID: "othernet", AddressRange: "10.0.60.0/24"})
+		assert.Nil(t, err)
+		other := models.Node{PublicKey: node.PublicKey, Name: "other", Endpoint: "10.0.1.2", MacAddress: "01:02:03:04:05:20", Password: "password", Network: "othernet", OS: "linux"}
+		assert.Nil(t, logic.CreateNode(&other))
+		w := lookup(urlSafe(node.PublicKey), "secretkey")
+		assert.Equal(t, http.StatusConflict, w.Code)
+		var response models.ErrorResponse
+		assert.Nil(t, json.NewDecoder(w.Body).Decode(&response))
+		assert.Equal(t, models.ERR_PUBLIC_KEY_IN_USE, response.ErrorCode)
+		assert.Nil(t, database.DeleteRecord(database.NODES_TABLE_NAME, other.ID))
+		assert.Equal(t, http.StatusOK, lookup(urlSafe(node.PublicKey), "secretkey").Code)
+	})
+	t.Run("InvalidKey", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, lookup("notakey", "secretkey").Code)
+	})
+	t.Run("AdminOnly", func(t *testing.T) {
+		_, err := logic.CreateUser(models.User{UserName: "keylookup", Password: "password", Networks: []string{"skynet"}})
+		assert.Nil(t, err)
+		token, err := logic.CreateUserJWT("keylookup", []string{"skynet"}, false)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusUnauthorized, lookup(urlSafe(node.PublicKey), token).Code)
+	})
+	deleteAllUsers()
+	deleteAllNodes()
+}
+
+func TestRollbackNodeUpdate(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	deleteAllNodes()
+	createNet()
+	os.Setenv("MASTER_KEY", "secretkey")
+	defer os.Unsetenv("MASTER_KEY")
+	var nodes []models.Node
+	for i, name := range []string{"relay", "first", "second"} {
+		key, err := wgtypes.GeneratePrivateKey()
+		assert.Nil(t, err)
+		node := models.Node{PublicKey: key.PublicKey().String(), Name: name, Endpoint: fmt.Sprintf("10.0.1.%d", i+1), MacAddress: fmt.Sprintf("01:02:03:04:05:%02d", i+10), Password: "password", Network: "skynet", OS: "linux"}
+		assert.Nil(t, logic.CreateNode(&node))
+		nodes = append(nodes, node)
+	}
+	relay, first, second := nodes[0], nodes[1], nodes[2]
+	_, _, err := logic.CreateRelay(models.RelayRequest{NodeID: relay.ID, NetID: "skynet", RelayAddrs: []string{first.Address}})
+	assert.Nil(t, err)
+	before, err := logic.GetNodeByID(relay.ID)
+	assert.Nil(t, err)
+	// builds the public key index so the rollback has to restore its entry
+	_, err = logic.GetNodesByPublicKey(before.PublicKey)
+	assert.Nil(t, err)
+	newKey, err := wgtypes.GeneratePrivateKey()
+	assert.Nil(t, err)
+	// fails after the old relayed node was already unset
+	updateRelayedNodes = func(network string, oldAddrs, newAddrs []string) ([]models.Node, error) {
+		if _, err := logic.SetRelayedNodes(false, network, oldAddrs); err != nil {
+			return nil, err
+		}
+		return nil, errors.New("relayed nodes could not be set")
+	}
+	defer func() { updateRelayedNodes = logic.UpdateRelay }()
+	router := mux.NewRouter()
+	nodeHandlers(router)
+	req := httptest.NewRequest(http.MethodPut, "/api/nodes/skynet/"+relay.ID, strings.NewReader(fmt.Sprintf(`{"relayaddrs":[%q],"description":"moved","publickey":%q}`, second.Address, newKey.PublicKey().String())))
+	req.Header.Set("Authorization", "Bearer secretkey")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	after, err := logic.GetNodeByID(relay.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, before.RelayAddrs, after.RelayAddrs)
+	assert.Equal(t, before.Description, after.Description)
+	assert.Equal(t, before.PublicKey, after.PublicKey)
+	assert.Greater(t, after.ResourceVersion, before.ResourceVersion)
+	keyNodes, err := logic.GetNodesByPublicKey(before.PublicKey)
+	assert.Nil(t, err)
+	if assert.Len(t, keyNodes, 1) {
+		assert.Equal(t, relay.ID, keyNodes[0].ID)
+	}
+	keyNodes, err = logic.GetNodesByPublicKey(newKey.PublicKey().String())
+	assert.Nil(t, err)
+	assert.Empty(t, keyNodes)
+	first, err = logic.GetNodeByID(first.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "yes", first.IsRelayed)
+	second, err = logic.GetNodeByID(second.ID)
+	assert.Nil(t, err)
+	assert.NotEqual(t, "yes", second.IsRelayed)
+	deleteAllNodes()
+}
+
+func TestRequestNetwork(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	deleteAllNodes()
+	createNet()
+	os.Setenv("MASTER_KEY", "secretkey")
+	defer os.Unsetenv("MASTER_KEY")
+	network, err := logic.GetNetwork("skynet")
+	assert.Nil(t, err)
+	key, err := logic.CreateAccessKey(models.AccessKey{Name: "lookups", Uses: 10}, network)
+	assert.Nil(t, err)
+	// counts the reads of the networks table, failing them when told to
+	fetchAll := database.SQLITE_FUNCTIONS[database.FETCH_ALL].(func(string) (map[string]string, error))
+	var networkFetches int
+	var failNetworkFetches bool
+	database.SQLITE_FUNCTIONS[database.FETCH_ALL] = func(table string) (map[string]string, error) {
+		if table == database.NETWORKS_TABLE_NAME {
+			networkFetches++
+			if failNetworkFetches {
+				return nil, errors.New("disk I/O error")
+			}
+		}
+		return fetchAll(table)
+	}
+	defer func() { database.SQLITE_FUNCTIONS[database.FETCH_ALL] = fetchAll }()
+	// reads the network back and reports how many reads that took
+	var handlerFetches int
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		before := networkFetches
+		network, err := requestNetwork(r, mux.Vars(r)["network"])
+		assert.Nil(t, err)
+		assert.Equal(t, "skynet", network.NetID)
+		handlerFetches = networkFetches - before
+	})
+	router := mux.NewRouter()
+	router.Handle("/authorize/{network}", authorize(false, true, "network", handler))
+	router.Handle("/nodeauth/{network}", nodeauth(requireNetwork(handler)))
+	serve := func(path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	t.Run("Authorize", func(t *testing.T) {
+		handlerFetches = -1
+		assert.Equal(t, http.StatusOK, serve("/authorize/skynet", "secretkey").Code)
+		assert.Equal(t, 0, handlerFetches)
+		assert.Equal(t, http.StatusNotFound, serve("/authorize/nonet", "secretkey").Code)
+	})
+	t.Run("ReadError", func(t *testing.T) {
+		failNetworkFetches = true
+		defer func() { failNetworkFetches = false }()
+		assert.Equal(t, http.StatusInternalServerError, serve("/authorize/skynet", "secretkey").Code)
+	})
+	t.Run("Handlers", func(t *testing.T) {
+		nodeRouter := mux.NewRouter()
+		nodeHandlers(nodeRouter)
+		for _, req := range []*http.Request{
+			httptest.NewRequest(http.MethodGet, "/api/nodes/skynet/epoch", nil),
+			httptest.NewRequest(http.MethodPost, "/api/nodes/skynet/validatekey", strings.NewReader(`{"value":"`+key.Value+`"}`)),
+		} {
+			req.Header.Set("Authorization", "Bearer secretkey")
+			before := networkFetches
+			w := httptest.NewRecorder()
+			nodeRouter.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusOK, w.Code, req.URL.Path)
+			// only authorize reads the network
+			assert.Equal(t, 1, networkFetches-before, req.URL.Path)
+		}
+	})
+	t.Run("NodeAuth", func(t *testing.T) {
+		handlerFetches = -1
+		assert.Equal(t, http.StatusOK, serve("/nodeauth/skynet", key.Value).Code)
+		assert.Equal(t, 0, handlerFetches)
+		w := serve("/nodeauth/nonet", key.Value)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		var response models.ErrorResponse
+		assert.Nil(t, json.NewDecoder(w.Body).Decode(&response))
+		assert.Equal(t, models.ERR_NETWORK_NOT_FOUND, response.ErrorCode)
+	})
+	t.Run("Create", func(t *testing.T) {
+		createRouter := mux.NewRouter()
+		nodeHandlers(createRouter)
+		body := `{"accesskey":"` + key.Value + `","publickey":"DM5qhLAE20PG9BbfBCger+Ac9D2NDOwCtY1rbYDLf34=","name":"lookups","endpoint":"10.0.0.50","macaddress":"01:02:03:04:05:06","password":"password","os":"linux","traffickeys":{"mine":"AQID"}}`
+		req := httptest.NewRequest(http.MethodPost, "/api/nodes/skynet", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+key.Value)
+		w := httptest.NewRecorder()
+		createRouter.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var nodeGet models.NodeGet
+		assert.Nil(t, json.NewDecoder(w.Body).Decode(&nodeGet))
+		assert.Equal(t, "skynet", nodeGet.Node.NetworkSettings.NetID)
+		assert.Empty(t, nodeGet.Node.NetworkSettings.AccessKeys)
+	})
+	deleteAllNodes()
+}
+
+func TestDNSOnlyNode(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	deleteAllNodes()
+	createNet()
+	node := createTestNode()
+	key, err := wgtypes.GeneratePrivateKey()
+	assert.Nil(t, err)
+	dnsNode := models.Node{PublicKey: key.PublicKey().String(), Name: "dnsanchor", Endpoint: "10.0.1.1", MacAddress: "01:02:03:04:05:10", Password: "password", Network: "skynet", OS: "linux", IsDNSOnly: "yes"}
+	assert.Nil(t, logic.CreateNode(&dnsNode))
+	t.Run("LeftOutOfPeers", func(t *testing.T) {
+		peerUpdate, err := logic.GetPeerUpdate(node)
+		assert.Nil(t, err)
+		for _, peer := range peerUpdate.Peers {
+			assert.NotEqual(t, dnsNode.PublicKey, peer.PublicKey.String())
+		}
+		peerUpdate, err = logic.GetPeerUpdate(&dnsNode)
+		assert.Nil(t, err)
+		assert.Empty(t, peerUpdate.Peers)
+	})
+	t.Run("KeepsDNSRecords", func(t *testing.T) {
+		entries, err := logic.GetNodeDNS("skynet")
+		assert.Nil(t, err)
+		var found bool
+		for _, entry := range entries {
+			if entry.Name == "dnsanchor" && entry.Address == dnsNode.Address {
+				found = true
+			}
+		}
+		assert.True(t, found)
+	})
+	t.Run("CreateWithRole", func(t *testing.T) {
+		key, err := wgtypes.GeneratePrivateKey()
+		assert.Nil(t, err)
+		relay := models.Node{PublicKey: key.PublicKey().String(), Name: "dnsrelay", Endpoint: "10.0.1.2", MacAddress: "01:02:03:04:05:11", Password: "password", Network: "skynet", OS: "linux", IsDNSOnly: "yes", IsRelay: "yes"}
+		err = logic.CreateNode(&relay)
+		assert.ErrorIs(t, err, logic.ErrDNSOnlyNode)
+	})
+	t.Run("UpdateWithRole", func(t *testing.T) {
+		err := logic.ValidateNodeUpdate(&dnsNode, &models.Node{IsIngressGateway: "yes"})
+		var invalid *logic.InvalidNodeFieldsError
+		assert.True(t, errors.As(err, &invalid))
+		assert.Equal(t, []models.FieldError{{Field: "isdnsonly", Reason: "cannot be combined with gateway or relay roles"}}, invalid.Fields)
+		assert.Nil(t, logic.ValidateNodeUpdate(&dnsNode, &models.Node{IsDNSOnly: "no", IsIngressGateway: "yes"}))
+	})
+	t.Run("Gateway", func(t *testing.T) {
+		_, err := logic.CreateEgressGateway(models.EgressGatewayRequest{NodeID: dnsNode.ID, NetID: "skynet", Ranges: []string{"10.100.0.0/16"}})
+		assert.ErrorIs(t, err, logic.ErrDNSOnlyNode)
+		err = logic.ValidateRelayAddrs("skynet", node.ID, []string{dnsNode.Address})
+		assert.ErrorIs(t, err, logic.ErrDNSOnlyNode)
+	})
+	deleteAllNodes()
+}
+
+func TestNodeUnknownFields(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	deleteAllNodes()
+	createNet()
+	node := createTestNode()
+	t.Run("Create", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/api/nodes/skynet", strings.NewReader(`{"name":"typo","adress":"10.0.0.50"}`))
+		req = mux.SetURLVars(req, map[string]string{"network": "skynet"})
+		w := httptest.NewRecorder()
+		createNode(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "adress")
+		nodes, err := logic.GetNetworkNodes("skynet")
+		assert.Nil(t, err)
+		assert.Len(t, nodes, 1)
+	})
+	t.Run("Update", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPut, "/api/nodes/skynet/"+node.ID, strings.NewReader(`{"name":"renamed","adress":"10.0.0.50"}`))
+		req = mux.SetURLVars(req, map[string]string{"network": "skynet", "nodeid": node.ID})
+		w := httptest.NewRecorder()
+		updateNode(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "adress")
+		stored, err := logic.GetNodeByID(node.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, "testnode", stored.Name)
+	})
+	deleteAllNodes()
+	deleteAllNetworks()
+}
+
+func TestPatchNode(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	deleteAllNodes()
+	createNet()
+	node := createTestNode()
+	patch := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPatch, "/api/nodes/skynet/"+node.ID, strings.NewReader(body))
+		req = mux.SetURLVars(req, map[string]string{"network": "skynet", "nodeid": node.ID})
+		w := httptest.NewRecorder()
+		patchNode(w, req)
+		return w
+	}
+	t.Run("SingleField", func(t *testing.T) {
+		before, err := logic.GetNodeByID(node.ID)
+		assert.Nil(t, err)
+		w := patch(`{"isstatic":"yes"}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		stored, err := logic.GetNodeByID(node.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, "yes", stored.IsStatic)
+		assert.Equal(t, before.Name, stored.Name)
+		assert.Equal(t, before.Address, stored.Address)
+		assert.Equal(t, before.PersistentKeepalive, stored.PersistentKeepalive)
+		assert.Equal(t, before.ResourceVersion+1, stored.ResourceVersion)
+	})
+	t.Run("StaleVersion", func(t *testing.T) {
+		w := patch(`{"name":"stale","resourceversion":1}`)
+		assert.Equal(t, http.StatusConflict, w.Code)
+		stored, err := logic.GetNodeByID(node.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, "testnode", stored.Name)
+	})
+	t.Run("Invalid", func(t *testing.T) {
+		for _, body := range []string{`{"name":null}`, `{"nmae":"typo"}`, `"name"`} {
+			w := patch(body)
+			assert.Equal(t, http.StatusBadRequest, w.Code, body)
+		}
+	})
+	t.Run("MissingNode", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPatch, "/api/nodes/skynet/missing", strings.NewReader(`{"isstatic":"yes"}`))
+		req = mux.SetURLVars(req, map[string]string{"network": "skynet", "nodeid": "missing"})
+		w := httptest.NewRecorder()
+		patchNode(w, req)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+	deleteAllNodes()
+	deleteAllNetworks()
+}
+
+func TestCreateIngressGatewayPort(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	createNet()
+	// both nodes sit behind the same public endpoint
+	node1 := models.Node{PublicKey: "DM5qhLAE20PG9BbfBCger+Ac9D2NDOwCtY1rbYDLf34=", Name: "ingress1", Endpoint: "10.0.0.50", MacAddress: "01:02:03:04:05:06", Password: "password", Network: "skynet", OS: "linux"}
+	node2 := models.Node{PublicKey: "DM5qhLAE20FG7BbfBCger+Ac9D2NDOwCtY1rbYDXf14=", Name: "ingress2", Endpoint: "10.0.0.50", MacAddress: "01:02:03:04:05:07", Password: "password", Network: "skynet", OS: "linux"}
+	logic.CreateNode(&node1)
+	logic.CreateNode(&node2)
+	t.Run("CustomPort", func(t *testing.T) {
+		node, err := logic.CreateIngressGateway("skynet", node1.ID, models.IngressGatewayRequest{Port: 51900})
+		assert.Nil(t, err)
+		assert.Equal(t, int32(51900), node.ListenPort)
+		stored, err := logic.GetNodeByID(node1.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, int32(51900), stored.ListenPort)
+	})
+	t.Run("InvalidPort", func(t *testing.T) {
+		_, err := logic.ComputeIngressGateway("skynet", node2.ID, models.IngressGatewayRequest{Port: 70000})
+		assert.ErrorIs(t, err, logic.ErrInvalidIngressPort)
+	})
+	t.Run("PortInUse", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/api/nodes/skynet/"+node2.ID+"/createingress", strings.NewReader(`{"port":51900}`))
+		req = mux.SetURLVars(req, map[string]string{"network": "skynet", "nodeid": node2.ID})
+		w := httptest.NewRecorder()
+		createIngressGateway(w, req)
+		assert.Equal(t, http.StatusConflict, w.Code)
+		var response models.ErrorResponse
+		err := json.NewDecoder(w.Body).Decode(&response)
+		assert.Nil(t, err)
+		assert.Equal(t, models.ERR_PORT_IN_USE, response.ErrorCode)
+		assert.Equal(t, node1.ID, response.ConflictingNodeID)
+	})
+	t.Run("DefaultPort", func(t *testing.T) {
+		node, err := logic.ComputeIngressGateway("skynet", node2.ID, models.IngressGatewayRequest{})
+		assert.Nil(t, err)
+		assert.Equal(t, node2.ListenPort, node.ListenPort)
+	})
+}
+
+func TestIngressClientCIDR(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	createNet()
+	deleteAllNodes()
+	database.DeleteAllRecords(database.EXT_CLIENT_TABLE_NAME)
+	node := createTestNode()
+	create := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/extclients/skynet/"+node.ID, strings.NewReader(body))
+		req = mux.SetURLVars(req, map[string]string{"network": "skynet", "nodeid": node.ID})
+		w := httptest.NewRecorder()
+		createExtClient(w, req)
+		return w
+	}
+	t.Run("OutsideNetwork", func(t *testing.T) {
+		_, err := logic.ComputeIngressGateway("skynet", node.ID, models.IngressGatewayRequest{ClientCIDR: "10.1.0.0/28"})
+		assert.ErrorIs(t, err, logic.ErrInvalidAddressRange)
+	})
+	t.Run("Create", func(t *testing.T) {
+		gateway, err := logic.CreateIngressGateway("skynet", node.ID, models.IngressGatewayRequest{ClientCIDR: "10.0.0.130/30"})
+		assert.Nil(t, err)
+		assert.Equal(t, "10.0.0.128/30", gateway.IngressClientCIDR)
+	})
+	t.Run("AssignedFromCIDR", func(t *testing.T) {
+		client := models.ExtClient{ClientID: "client-a", Network: "skynet", IngressGatewayID: node.ID}
+		assert.Nil(t, logic.CreateExtClient(&client))
+		assert.Equal(t, "10.0.0.128", client.Address)
+	})
+	t.Run("RequestedInCIDR", func(t *testing.T) {
+		client := models.ExtClient{ClientID: "client-b", Network: "skynet", IngressGatewayID: node.ID, Address: "10.0.0.130"}
+		assert.Nil(t, logic.CreateExtClient(&client))
+		assert.Equal(t, "10.0.0.130", client.Address)
+	})
+	t.Run("RequestedOutsideCIDR", func(t *testing.T) {
+		w := create(`{"address":"10.0.0.20"}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		var response models.ErrorResponse
+		assert.Nil(t, json.NewDecoder(w.Body).Decode(&response))
+		assert.Equal(t, models.ERR_INVALID_REQUEST, response.ErrorCode)
+	})
+	t.Run("RequestedInUse", func(t *testing.T) {
+		w := create(`{"address":"10.0.0.130"}`)
+		assert.Equal(t, http.StatusConflict, w.Code)
+		var response models.ErrorResponse
+		assert.Nil(t, json.NewDecoder(w.Body).Decode(&response))
+		assert.Equal(t, models.ERR_ADDRESS_IN_USE, response.ErrorCode)
+		assert.Equal(t, "client-b", response.ConflictingNodeID)
+	})
+	t.Run("Exhausted", func(t *testing.T) {
+		client := models.ExtClient{ClientID: "client-c", Network: "skynet", IngressGatewayID: node.ID}
+		assert.Nil(t, logic.CreateExtClient(&client))
+		assert.Equal(t, "10.0.0.129", client.Address)
+		client = models.ExtClient{ClientID: "client-d", Network: "skynet", IngressGatewayID: node.ID}
+		assert.Nil(t, logic.CreateExtClient(&client))
+		w := create("")
+		assert.Equal(t, http.StatusConflict, w.Code)
+		var response models.ErrorResponse
+		assert.Nil(t, json.NewDecoder(w.Body).Decode(&response))
+		assert.Equal(t, models.ERR_ADDRESS_RANGE_EXHAUSTED, response.ErrorCode)
+	})
+	t.Run("ExistingClientsOutside", func(t *testing.T) {
+		_, err := logic.ComputeIngressGateway("skynet", node.ID, models.IngressGatewayRequest{ClientCIDR: "10.0.0.128/31"})
+		assert.ErrorIs(t, err, logic.ErrExtClientOutsideCIDR)
+	})
+	database.DeleteAllRecords(database.EXT_CLIENT_TABLE_NAME)
+}
+
+func TestGetIngressClients(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	createNet()
+	deleteAllNodes()
+	database.DeleteAllRecords(database.EXT_CLIENT_TABLE_NAME)
+	node := createTestNode()
+	gateway, err := logic.CreateIngressGateway("skynet", node.ID, models.IngressGatewayRequest{Port: 51900})
+	assert.Nil(t, err)
+	for _, clientid := range []string{"client-b", "client-a"} {
+		client := models.ExtClient{ClientID: clientid, Network: "skynet", IngressGatewayID: node.ID, IngressGatewayEndpoint: node.Endpoint}
+		assert.Nil(t, logic.CreateExtClient(&client))
+	}
+	get := func(nodeid, query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/nodes/skynet/"+nodeid+"/ingressclients"+query, nil)
+		req = mux.SetURLVars(req, map[string]string{"network": "skynet", "nodeid": nodeid})
+		w := httptest.NewRecorder()
+		getIngressClients(w, req)
+		return w
+	}
+	t.Run("Configs", func(t *testing.T) {
+		w := get(node.ID, "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		var confs []models.ExtClientConf
+		assert.Nil(t, json.NewDecoder(w.Body).Decode(&confs))
+		assert.Len(t, confs, 2)
+		assert.Equal(t, "client-a", confs[0].ClientID)
+		assert.Contains(t, confs[0].Config, "Endpoint = "+gateway.Endpoint+":51900")
+		assert.Contains(t, confs[0].Config, "PublicKey = "+gateway.PublicKey)
+	})
+	t.Run("Zip", func(t *testing.T) {
+		w := get(node.ID, "?format=zip")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/zip", w.Header().Get("Content-Type"))
+		archive, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+		assert.Nil(t, err)
+		var names []string
+		for _, file := range archive.File {
+			names = append(names, file.Name)
+		}
+		assert.Equal(t, []string{"client-a.conf", "client-b.conf"}, names)
+	})
+	t.Run("NotIngress", func(t *testing.T) {
+		other := models.Node{PublicKey: "DM5qhLAE20FG7BbfBCger+Ac9D2NDOwCtY1rbYDXf14=", Name: "othernode", Endpoint: "10.0.0.100", MacAddress: "01:02:03:04:05:07", Password: "password", Network: "skynet", OS: "linux"}
+		assert.Nil(t, logic.CreateNode(&other))
+		w := get(other.ID, "")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+	database.DeleteAllRecords(database.EXT_CLIENT_TABLE_NAME)
+}
+
+func TestNodeNotFound(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	createNet()
+	createTestNode()
+	for name, handler := range map[string]http.HandlerFunc{"getNode": getNode, "updateNode": updateNode, "deleteNode": deleteNode} {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/nodes/skynet/missing", nil)
+			req = mux.SetURLVars(req, map[string]string{"network": "skynet", "nodeid": "missing"})
+			w := httptest.NewRecorder()
+			handler(w, req)
+			assert.Equal(t, http.StatusNotFound, w.Code)
+			var response models.ErrorResponse
+			err := json.NewDecoder(w.Body).Decode(&response)
+			assert.Nil(t, err)
+			assert.Equal(t, models.ERR_NODE_NOT_FOUND, response.ErrorCode)
+		})
+	}
+}
+
+func TestAuthorizeExpiredToken(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	createNet()
+	logic.SetJWTSecret()
+	token, err := logic.CreateJWT("node-id", "01:02:03:04:05:06", "skynet", -time.Minute)
+	assert.Nil(t, err)
+	for _, nodesAllowed := range []bool{true, false} {
+		req := httptest.NewRequest(http.MethodGet, "/api/nodes/skynet", nil)
+		req = mux.SetURLVars(req, map[string]string{"network": "skynet"})
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		authorize(nodesAllowed, true, "network", http.HandlerFunc(getNetworkNodes))(w, req)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		var response models.ErrorResponse
+		err := json.NewDecoder(w.Body).Decode(&response)
+		assert.Nil(t, err)
+		assert.Equal(t, models.ERR_TOKEN_EXPIRED, response.ErrorCode)
+	}
+}
+
+func TestAuthorizeMasterKey(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	createNet()
+	deleteAllNodes()
+	deleteAllUsers()
+	logic.SetJWTSecret()
+	createTestNode()
+	t.Run("Unset", func(t *testing.T) {
+		os.Unsetenv("MASTER_KEY")
+		assert.False(t, logic.IsMasterKey(""))
+		assert.False(t, logic.IsMasterKey("secretkey"))
+	})
+	os.Setenv("MASTER_KEY", "secretkey")
+	defer os.Unsetenv("MASTER_KEY")
+	t.Run("Compare", func(t *testing.T) {
+		assert.True(t, logic.IsMasterKey("secretkey"))
+		for _, token := range []string{"", "secretke", "secretkey2", "SECRETKEY"} {
+			assert.False(t, logic.IsMasterKey(token), token)
+		}
+	})
+	_, err := logic.CreateUser(models.User{UserName: "networkless", Password: "password"})
+	assert.Nil(t, err)
+	token, err := logic.CreateUserJWT("networkless", nil, false)
+	assert.Nil(t, err)
+	router := mux.NewRouter()
+	nodeHandlers(router)
+	t.Run("SpoofedHeaders", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/nodes", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("ismasterkey", "yes")
+		req.Header.Set("user", "masteradministrator")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var nodes []models.Node
+		assert.Nil(t, json.NewDecoder(w.Body).Decode(&nodes))
+		assert.Empty(t, nodes)
+	})
+	t.Run("NotLogged", func(t *testing.T) {
+		var output bytes.Buffer
+		accessLogOutput = &output
+		defer func() { accessLogOutput = os.Stdout }()
+		os.Setenv("STRUCTURED_LOGGING", "on")
+		defer os.Unsetenv("STRUCTURED_LOGGING")
+		for _, auth := range []string{"Bearer secretkey", "Bearer wrongkey", "secretkey"} {
+			req := httptest.NewRequest(http.MethodGet, "/api/nodes/skynet", nil)
+			req.Header.Set("Authorization", auth)
+			req.Header.Set("user", "secretkey")
+			w := httptest.NewRecorder()
+			logRequests(router).ServeHTTP(w, req)
+			assert.NotContains(t, w.Body.String(), "secretkey", auth)
+		}
+		assert.NotEmpty(t, output.String())
+		assert.NotContains(t, output.String(), "secretkey")
+	})
+	deleteAllUsers()
+	deleteAllNodes()
+}
+
+func TestAuthorizeNodeOwnership(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	createNet()
+	logic.SetJWTSecret()
+	token, err := logic.CreateJWT("node-id", "01:02:03:04:05:06", "skynet", time.Minute)
+	assert.Nil(t, err)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	put := func(nodeid, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/api/nodes/skynet/"+nodeid, strings.NewReader("{}"))
+		req = mux.SetURLVars(req, map[string]string{"network": "skynet", "nodeid": nodeid})
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		authorize(true, true, "node", handler)(w, req)
+		return w
+	}
+	t.Run("PeerConfig", func(t *testing.T) {
+		w := put("peer-id", token)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		var response models.ErrorResponse
+		err := json.NewDecoder(w.Body).Decode(&response)
+		assert.Nil(t, err)
+		assert.Equal(t, models.ERR_FORBIDDEN, response.ErrorCode)
+	})
+	t.Run("OwnConfig", func(t *testing.T) {
+		w := put("node-id", token)
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+	t.Run("MasterKey", func(t *testing.T) {
+		os.Setenv("MASTER_KEY", "secretkey")
+		defer os.Unsetenv("MASTER_KEY")
+		w := put("peer-id", "secretkey")
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+}
+
+func TestAuthorizeGetNode(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	createNet()
+	deleteAllNodes()
+	logic.SetJWTSecret()
+	node := createTestNode()
+	peer := models.Node{PublicKey: "DM5qhLAE20PG9BbfBCger+Ac9D2NDOwCtY1rbYDLg35=", Name: "peernode", Endpoint: "10.0.0.2", MacAddress: "01:02:03:04:05:07", Password: "password", Network: "skynet", OS: "linux"}
+	err := logic.CreateNode(&peer)
+	assert.Nil(t, err)
+	token, err := logic.CreateJWT(node.ID, node.MacAddress, node.Network, time.Minute)
+	assert.Nil(t, err)
+	r := mux.NewRouter()
+	nodeHandlers(r)
+	get := func(nodeid string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/nodes/skynet/"+nodeid, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	getAsUser := func(nodeid string, networks []string) *httptest.ResponseRecorder {
+		userToken, err := logic.CreateUserJWT("nodeviewer", networks, false)
+		assert.Nil(t, err)
+		req := httptest.NewRequest(http.MethodGet, "/api/nodes/skynet/"+nodeid, nil)
+		req.Header.Set("Authorization", "Bearer "+userToken)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	t.Run("OwnNode", func(t *testing.T) {
+		w := get(node.ID)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var nodeGet models.NodeGet
+		err := json.NewDecoder(w.Body).Decode(&nodeGet)
+		assert.Nil(t, err)
+		assert.Equal(t, node.ID, nodeGet.Node.ID)
+	})
+	t.Run("OtherNode", func(t *testing.T) {
+		w := get(peer.ID)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+	deleteAllUsers()
+	_, err = logic.CreateUser(models.User{UserName: "nodeviewer", Password: "password", Networks: []string{"skynet"}})
+	assert.Nil(t, err)
+	t.Run("UserWithoutNetwork", func(t *testing.T) {
+		w := getAsUser(node.ID, []string{})
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+	t.Run("NetworkUser", func(t *testing.T) {
+		w := getAsUser(node.ID, []string{"skynet"})
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+	deleteAllUsers()
+}
+
+func TestNetworkAdmin(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	createNet()
+	deleteAllNodes()
+	deleteAllUsers()
+	logic.SetJWTSecret()
+	_, err := logic.CreateNetwork(models.Network{NetID: "othernet", AddressRange: "10.0.30.0/24"})
+	assert.Nil(t, err)
+	node := createTestNode()
+	createNode := func(name, network string) models.Node {
+		key, err := wgtypes.GeneratePrivateKey()
+		assert.Nil(t, err)
+		created := models.Node{PublicKey: key.PublicKey().String(), Name: name, Endpoint: "10.0.0.60", MacAddress: "01:02:03:04:05:60", Password: "password", Network: network, OS: "linux"}
+		assert.Nil(t, logic.CreateNode(&created))
+		return created
+	}
+	server := createNode("serverish", "skynet")
+	server.IsServer = "yes"
+	data, err := json.Marshal(&server)
+	assert.Nil(t, err)
+	assert.Nil(t, database.Insert(server.ID, string(data), database.NODES_TABLE_NAME))
+	other := createNode("othernode", "othernet")
+	t.Run("AdminRole", func(t *testing.T) {
+		_, err := logic.CreateUser(models.User{UserName: "badnetadmin", Password: "password", IsAdmin: true, Role: models.USER_ROLE_NETWORK_ADMIN})
+		assert.NotNil(t, err)
+	})
+	_, err = logic.CreateUser(models.User{UserName: "netop", Password: "password", Networks: []string{"skynet"}, Role: models.USER_ROLE_NETWORK_ADMIN})
+	assert.Nil(t, err)
+	token, err := logic.CreateUserJWT("netop", []string{"skynet"}, false)
+	assert.Nil(t, err)
+	r := mux.NewRouter()
+	nodeHandlers(r)
+	networkHandlers(r)
+	call := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString("{}"))
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	t.Run("OwnNetwork", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, call(http.MethodGet, "/api/nodes/skynet").Code)
+		assert.Equal(t, http.StatusOK, call(http.MethodGet, "/api/nodes/skynet/"+node.ID).Code)
+		assert.Equal(t, http.StatusOK, call(http.MethodPut, "/api/nodes/skynet/"+node.ID).Code)
+		assert.Equal(t, http.StatusOK, call(http.MethodGet, "/api/networks/skynet/keys").Code)
+	})
+	t.Run("AllNodes", func(t *testing.T) {
+		w := call(http.MethodGet, "/api/nodes")
+		assert.Equal(t, http.StatusOK, w.Code)
+		var nodes []models.Node
+		assert.Nil(t, json.NewDecoder(w.Body).Decode(&nodes))
+		assert.Len(t, nodes, 2)
+		for _, listed := range nodes {
+			assert.Equal(t, "skynet", listed.Network)
+		}
+	})
+	t.Run("ServerNode", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, call(http.MethodGet, "/api/nodes/skynet/"+server.ID).Code)
+		for _, request := range [][2]string{
+			{http.MethodPut, "/api/nodes/skynet/" + server.ID},
+			{http.MethodDelete, "/api/nodes/skynet/" + server.ID},
+			{http.MethodPost, "/api/nodes/skynet/" + server.ID + "/creategateway"},
+		} {
+			w := call(request[0], request[1])
+			assert.Equal(t, http.StatusForbidden, w.Code, request)
+			var response models.ErrorResponse
+			assert.Nil(t, json.NewDecoder(w.Body).Decode(&response))
+			assert.Equal(t, models.ERR_FORBIDDEN, response.ErrorCode)
+		}
+		_, err := logic.GetNodeByID(server.ID)
+		assert.Nil(t, err)
+	})
+	t.Run("OtherNetwork", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, call(http.MethodGet, "/api/nodes/othernet").Code)
+		assert.Equal(t, http.StatusForbidden, call(http.MethodPut, "/api/nodes/othernet/"+other.ID).Code)
+		// a node of another network addressed through the admin's own network
+		assert.Equal(t, http.StatusForbidden, call(http.MethodGet, "/api/nodes/skynet/"+other.ID).Code)
+		assert.Equal(t, http.StatusForbidden, call(http.MethodDelete, "/api/nodes/skynet/"+other.ID).Code)
+		assert.Equal(t, http.StatusUnauthorized, call(http.MethodGet, "/api/networks/othernet/keys").Code)
+		assert.Equal(t, http.StatusUnauthorized, call(http.MethodPost, "/api/networks/othernet/keys").Code)
+	})
+	deleteAllUsers()
+	deleteAllNodes()
+	deleteAllNetworks()
+}
+
+func TestReadOnlyUser(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	createNet()
+	deleteAllNodes()
+	deleteAllUsers()
+	logic.SetJWTSecret()
+	node := createTestNode()
+	r := mux.NewRouter()
+	nodeHandlers(r)
+	_, err := logic.CreateUser(models.User{UserName: "nocviewer", Password: "password", Role: models.USER_ROLE_READ_ONLY})
+	assert.Nil(t, err)
+	token, err := logic.CreateUserJWT("nocviewer", nil, false)
+	assert.Nil(t, err)
+	call := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString("{}"))
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	t.Run("InvalidRole", func(t *testing.T) {
+		_, err := logic.CreateUser(models.User{UserName: "badrole", Password: "password", Role: "superuser"})
+		assert.NotNil(t, err)
+	})
+	t.Run("ReadOnlyAdmin", func(t *testing.T) {
+		_, err := logic.CreateUser(models.User{UserName: "badadmin", Password: "password", IsAdmin: true, Role: models.USER_ROLE_READ_ONLY})
+		assert.NotNil(t, err)
+	})
+	t.Run("Get", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, call(http.MethodGet, "/api/nodes/skynet").Code)
+		assert.Equal(t, http.StatusOK, call(http.MethodGet, "/api/nodes/skynet/"+node.ID).Code)
+	})
+	t.Run("AllNodes", func(t *testing.T) {
+		_, err := logic.CreateNetwork(models.Network{NetID: "nocnet", AddressRange: "10.0.53.0/24"})
+		assert.Nil(t, err)
+		other := models.Node{PublicKey: "DM5qhLAE20FG7BbfBCger+Ac9D2NDOwCtY1rbYDXf14=", Name: "othernode", Endpoint: "10.0.0.53", MacAddress: "01:02:03:04:05:53", Password: "password", Network: "nocnet", OS: "linux"}
+		assert.Nil(t, logic.CreateNode(&other))
+		w := call(http.MethodGet, "/api/nodes")
+		assert.Equal(t, http.StatusOK, w.Code)
+		var nodes []models.Node
+		assert.Nil(t, json.NewDecoder(w.Body).Decode(&nodes))
+		ids := []string{}
+		for _, listed := range nodes {
+			ids = append(ids, listed.ID)
+		}
+		assert.ElementsMatch(t, []string{node.ID, other.ID}, ids)
+	})
+	t.Run("OutOfScope", func(t *testing.T) {
+		scoped := mux.NewRouter()
+		scoped.Handle("/scoped/{network}", authorize(false, false, "nodes", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})))
+		req := httptest.NewRequest(http.MethodGet, "/scoped/skynet", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		scoped.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+	t.Run("Mutate", func(t *testing.T) {
+		for _, method := range []string{http.MethodPut, http.MethodDelete} {
+			w := call(method, "/api/nodes/skynet/"+node.ID)
+			assert.Equal(t, http.StatusForbidden, w.Code)
+			var response models.ErrorResponse
+			assert.Nil(t, json.NewDecoder(w.Body).Decode(&response))
+			assert.Equal(t, models.ERR_FORBIDDEN, response.ErrorCode)
+		}
+		assert.Equal(t, http.StatusForbidden, call(http.MethodPost, "/api/nodes/skynet/"+node.ID+"/approve").Code)
+		_, err := logic.GetNodeByID(node.ID)
+		assert.Nil(t, err)
+	})
+	deleteAllUsers()
+	deleteAllNodes()
+	deleteAllNetworks()
+}
+
+func TestGetNodeDNSRecords(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllDNS(t)
+	deleteAllNetworks()
+	createNet()
+	deleteAllNodes()
+	node := createTestNode()
+	node.IsIngressGateway = "yes"
+	node.IsEgressGateway = "yes"
+	node.EgressGatewayRanges = []string{"192.168.50.0/24"}
+	data, err := json.Marshal(node)
+	assert.Nil(t, err)
+	assert.Nil(t, database.Insert(node.ID, string(data), database.NODES_TABLE_NAME))
+	extclient := models.ExtClient{ClientID: "laptop", Network: "skynet", Address: "10.0.0.200", IngressGatewayID: node.ID}
+	data, err = json.Marshal(&extclient)
+	assert.Nil(t, err)
+	assert.Nil(t, database.Insert("laptop###skynet", string(data), database.EXT_CLIENT_TABLE_NAME))
+	defer database.DeleteRecord(database.EXT_CLIENT_TABLE_NAME, "laptop###skynet")
+	for _, entry := range []models.DNSEntry{
+		{Address: node.Address, Name: "alias", Network: "skynet"},
+		{Address: "10.0.0.200", Name: "laptop", Network: "skynet"},
+		{Address: "192.168.50.10", Name: "printer", Network: "skynet"},
+		{Address: "10.0.0.250", Name: "elsewhere", Network: "skynet"},
+	} {
+		_, err := CreateDNS(entry)
+		assert.Nil(t, err)
+	}
+	r := mux.NewRouter()
+	nodeHandlers(r)
+	os.Setenv("MASTER_KEY", "secretkey")
+	defer os.Unsetenv("MASTER_KEY")
+	get := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/nodes/skynet/"+node.ID+"/dns", nil)
+		req.Header.Set("Authorization", "Bearer secretkey")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	t.Run("Records", func(t *testing.T) {
+		w := get()
+		assert.Equal(t, http.StatusOK, w.Code)
+		var records []models.DNSRecord
+		assert.Nil(t, json.NewDecoder(w.Body).Decode(&records))
+		assert.ElementsMatch(t, []models.DNSRecord{
+			{Name: "testnode.skynet", Type: "A", Address: node.Address, Source: models.DNS_SOURCE_NODE},
+			{Name: "alias.skynet", Type: "A", Address: node.Address, Source: models.DNS_SOURCE_CUSTOM},
+			{Name: "laptop.skynet", Type: "A", Address: "10.0.0.200", Source: models.DNS_SOURCE_EXT_CLIENT},
+			{Name: "printer.skynet", Type: "A", Address: "192.168.50.10", Source: models.DNS_SOURCE_EGRESS},
+		}, records)
+	})
+	t.Run("DNSModeOff", func(t *testing.T) {
+		os.Setenv("DNS_MODE", "off")
+		defer os.Unsetenv("DNS_MODE")
+		w := get()
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "[]\n", w.Body.String())
+	})
+	deleteAllDNS(t)
+}
+
+func TestConcurrentNodeAddresses(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	deleteAllNodes()
+	os.Setenv("DNS_MODE", "off")
+	defer os.Unsetenv("DNS_MODE")
+	// a /27 hands out 30 addresses, more nodes join than fit
+	_, err := logic.CreateNetwork(models.Network{NetID: "burstnet", AddressRange: "10.0.80.0/27"})
+	assert.Nil(t, err)
+	const joins = 40
+	var wg sync.WaitGroup
+	nodes := make([]models.Node, joins)
+	errs := make([]error, joins)
+	for i := 0; i < joins; i++ {
+		key, err := wgtypes.GeneratePrivateKey()
+		assert.Nil(t, err)
+		nodes[i] = models.Node{PublicKey: key.PublicKey().String(), Name: fmt.Sprintf("burst%d", i), Endpoint: "10.100.0.1", MacAddress: fmt.Sprintf("02:00:00:00:00:%02x", i), Password: "password", Network: "burstnet", OS: "linux"}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = logic.CreateNode(&nodes[i])
+		}(i)
+	}
+	wg.Wait()
+	addresses := make(map[string]string)
+	created := 0
+	for i := range nodes {
+		if errs[i] != nil {
+			var exhausted *logic.AddressExhaustedError
+			assert.True(t, errors.As(errs[i], &exhausted), errs[i].Error())
+			continue
+		}
+		created++
+		owner, taken := addresses[nodes[i].Address]
+		assert.False(t, taken, "%s was assigned to %s and %s", nodes[i].Address, owner, nodes[i].Name)
+		addresses[nodes[i].Address] = nodes[i].Name
+	}
+	assert.Equal(t, 30, created)
+	stored, err := logic.GetNetworkNodes("burstnet")
+	assert.Nil(t, err)
+	assert.Len(t, stored, 30)
+	deleteAllNodes()
+	deleteAllNetworks()
+}
+
+func TestGetLastModified(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	createNet()
+	assert.Nil(t, logic.SetNetworkNodesLastModified("skynet"))
+	r := mux.NewRouter()
+	nodeHandlers(r)
+	os.Setenv("MASTER_KEY", "secretkey")
+	defer os.Unsetenv("MASTER_KEY")
+	get := func(since string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/nodes/adm/skynet/lastmodified", nil)
+		req.Header.Set("Authorization", "Bearer secretkey")
+		if since != "" {
+			req.Header.Set("If-Modified-Since", since)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	w := get("")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var lastModified int64
+	assert.Nil(t, json.NewDecoder(w.Body).Decode(&lastModified))
+	header := w.Header().Get("Last-Modified")
+	assert.Equal(t, time.Unix(lastModified, 0).UTC().Format(http.TimeFormat), header)
+	t.Run("NotModified", func(t *testing.T) {
+		w := get(header)
+		assert.Equal(t, http.StatusNotModified, w.Code)
+		assert.Empty(t, w.Body.String())
+		assert.Equal(t, header, w.Header().Get("Last-Modified"))
+	})
+	t.Run("Older", func(t *testing.T) {
+		w := get(time.Unix(lastModified-60, 0).UTC().Format(http.TimeFormat))
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+	t.Run("Invalid", func(t *testing.T) {
+		w := get("yesterday")
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+	t.Run("Changed", func(t *testing.T) {
+		assert.Nil(t, logic.SetNetworkNodesLastModified("skynet"))
+		w := get(header)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.NotEqual(t, header, w.Header().Get("Last-Modified"))
+	})
+}
+
+func TestRotateNodeTrafficKeys(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	createNet()
+	deleteAllNodes()
+	node := createTestNode()
+	oldKey := []byte("old-traffic-key")
+	newKey := []byte("new-traffic-key")
+	node.TrafficKeys.Mine = oldKey
+	err := logic.UpdateNode(node, node)
+	assert.Nil(t, err)
+	t.Run("NotPending", func(t *testing.T) {
+		rotated, err := logic.CompleteTrafficKeyRotation(node, newKey)
+		assert.Nil(t, err)
+		assert.False(t, rotated)
+	})
+	t.Run("Rotate", func(t *testing.T) {
+		rotating, err := logic.RotateNodeTrafficKeys(node.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, models.NODE_ROTATE_TRAFFIC_KEYS, rotating.Action)
+		serverKey, err := logic.RetrievePublicTrafficKey()
+		assert.Nil(t, err)
+		assert.Equal(t, serverKey, rotating.TrafficKeys.Server)
+		assert.Equal(t, oldKey, rotating.TrafficKeys.Mine)
+		rotated, err := logic.CompleteTrafficKeyRotation(&rotating, newKey)
+		assert.Nil(t, err)
+		assert.True(t, rotated)
+		stored, err := logic.GetNodeByID(node.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, newKey, stored.TrafficKeys.Mine)
+		assert.Equal(t, models.NODE_NOOP, stored.Action)
+	})
+	t.Run("OnlyOnce", func(t *testing.T) {
+		stored, err := logic.GetNodeByID(node.ID)
+		assert.Nil(t, err)
+		rotated, err := logic.CompleteTrafficKeyRotation(&stored, oldKey)
+		assert.Nil(t, err)
+		assert.False(t, rotated)
+	})
+}
+
+func TestGetNodeConfig(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	createNet()
+	deleteAllNodes()
+	node := createTestNode()
+	get := func(format string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/nodes/skynet/"+node.ID+"/config?format="+format, nil)
+		req = mux.SetURLVars(req, map[string]string{"network": "skynet", "nodeid": node.ID})
+		w := httptest.NewRecorder()
+		getNodeConfig(w, req)
+		return w
+	}
+	t.Run("WGQuick", func(t *testing.T) {
+		w := get(logic.WG_QUICK_FORMAT)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/config", w.Header().Get("Content-Type"))
+		assert.Contains(t, w.Header().Get("Content-Disposition"), node.Interface+".conf")
+		assert.Contains(t, w.Body.String(), "Address = "+node.Address)
+	})
+	t.Run("UnsupportedFormat", func(t *testing.T) {
+		w := get("yaml")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestCancelledNodeRequests(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	createNet()
+	deleteAllNodes()
+	node := createTestNode()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	call := func(handler http.HandlerFunc, path string, vars map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil).WithContext(ctx)
+		req = mux.SetURLVars(req, vars)
+		req.Header.Set("ismasterkey", "yes")
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w
+	}
+	t.Run("Logic", func(t *testing.T) {
+		_, err := logic.GetAllNodesContext(ctx)
+		assert.ErrorIs(t, err, context.Canceled)
+		peerUpdate, err := logic.GetPeerUpdateContext(ctx, node)
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Equal(t, "skynet", peerUpdate.Network)
+		assert.NotNil(t, peerUpdate.Peers)
+		nodes, err := logic.GetAllNodesContext(context.Background())
+		assert.Nil(t, err)
+		assert.Len(t, nodes, 1)
+	})
+	for name, w := range map[string]*httptest.ResponseRecorder{
+		"AllNodes":     call(getAllNodes, "/api/nodes", nil),
+		"NetworkNodes": call(getNetworkNodes, "/api/nodes/skynet", map[string]string{"network": "skynet"}),
+		"Node":         call(getNode, "/api/nodes/skynet/"+node.ID, map[string]string{"network": "skynet", "nodeid": node.ID}),
+		"NodePeers":    call(getNodePeers, "/api/nodes/skynet/"+node.ID+"/peers", map[string]string{"network": "skynet", "nodeid": node.ID}),
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+			var response models.ErrorResponse
+			assert.Nil(t, json.NewDecoder(w.Body).Decode(&response))
+			assert.Equal(t, models.ERR_REQUEST_CANCELLED, response.ErrorCode)
+		})
+	}
+	deleteAllNodes()
+}
+
+func TestGetNodeETag(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	createNet()
+	deleteAllNodes()
+	node := createTestNode()
+	get := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/nodes/skynet/"+node.ID, nil)
+		req = mux.SetURLVars(req, map[string]string{"network": "skynet", "nodeid": node.ID})
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		getNode(w, req)
+		return w
+	}
+	w := get("")
+	assert.Equal(t, http.StatusOK, w.Code)
+	etag := w.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+	t.Run("NotModified", func(t *testing.T) {
+		for _, ifNoneMatch := range []string{etag, "W/" + etag, `"other", ` + etag, "*"} {
+			w := get(ifNoneMatch)
+			assert.Equal(t, http.StatusNotModified, w.Code)
+			assert.Empty(t, w.Body.String())
+			assert.Equal(t, etag, w.Header().Get("ETag"))
+		}
+	})
+	t.Run("StaleETag", func(t *testing.T) {
+		w := get(`"other"`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), node.ID)
+	})
+	t.Run("PeerChanged", func(t *testing.T) {
+		peer := models.Node{PublicKey: "DM5qhLAE20FG7BbfBCger+Ac9D2NDOwCtY1rbYDXf14=", Name: "peer", Endpoint: "10.0.0.2", MacAddress: "01:02:03:04:05:07", Password: "password", Network: "skynet", OS: "linux"}
+		assert.Nil(t, logic.CreateNode(&peer))
+		w := get(etag)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.NotEqual(t, etag, w.Header().Get("ETag"))
+		etag = w.Header().Get("ETag")
+		assert.Equal(t, etag, get("").Header().Get("ETag"))
+	})
+	t.Run("NodeChanged", func(t *testing.T) {
+		current, err := logic.GetNodeByID(node.ID)
+		assert.Nil(t, err)
+		newNode := current
+		newNode.Name = "renamed"
+		assert.Nil(t, logic.UpdateNode(&current, &newNode))
+		w := get(etag)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.NotEqual(t, etag, w.Header().Get("ETag"))
+	})
+	deleteAllNodes()
+}
+
+func TestFirstNodePeerUpdate(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	deleteAllNodes()
+	createNet()
+	node := createTestNode()
+	t.Run("FirstNode", func(t *testing.T) {
+		peerUpdate, err := logic.GetPeerUpdate(node)
+		assert.Nil(t, err)
+		assert.NotNil(t, peerUpdate.Peers)
+		assert.Empty(t, peerUpdate.Peers)
+		req := httptest.NewRequest(http.MethodGet, "/api/nodes/skynet/"+node.ID, nil)
+		req = mux.SetURLVars(req, map[string]string{"network": "skynet", "nodeid": node.ID})
+		w := httptest.NewRecorder()
+		getNode(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"peers":[]`)
+	})
+	t.Run("EmptyRecord", func(t *testing.T) {
+		missing := *node
+		missing.Network = "missingnet"
+		peerUpdate, err := logic.GetPeerUpdate(&missing)
+		assert.True(t, database.IsEmptyRecord(err))
+		assert.NotNil(t, peerUpdate.Peers)
+		assert.NotNil(t, peerUpdate.ServerAddrs)
+		assert.Equal(t, "missingnet", peerUpdate.Network)
+	})
+}
+
+func TestGetNodePeers(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	createNet()
+	deleteAllNodes()
+	node := createTestNode()
+	peer := models.Node{PublicKey: "DM5qhLAE20FG7BbfBCger+Ac9D2NDOwCtY1rbYDXf14=", Name: "peernode", Endpoint: "10.0.0.100", MacAddress: "01:02:03:04:05:07", Password: "password", Network: "skynet", OS: "linux"}
+	assert.Nil(t, logic.CreateNode(&peer))
+	get := func(network, query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/nodes/"+network+"/"+node.ID+"/peers"+query, nil)
+		req = mux.SetURLVars(req, map[string]string{"network": network, "nodeid": node.ID})
+		w := httptest.NewRecorder()
+		getNodePeers(w, req)
+		return w
+	}
+	t.Run("Peers", func(t *testing.T) {
+		w := get("skynet", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		var peerUpdate models.PeerUpdate
+		assert.Nil(t, json.NewDecoder(w.Body).Decode(&peerUpdate))
+		assert.Len(t, peerUpdate.Peers, 1)
+	})
+	t.Run("Explain", func(t *testing.T) {
+		w := get("skynet", "?explain=true")
+		assert.Equal(t, http.StatusOK, w.Code)
+		var explanation models.PeerUpdateExplanation
+		assert.Nil(t, json.NewDecoder(w.Body).Decode(&explanation))
+		assert.Equal(t, []models.PeerExplanation{
+			{PublicKey: peer.PublicKey, NodeID: peer.ID, Name: peer.Name, Reason: models.PEER_REASON_NETWORK},
+		}, explanation.Peers)
+		assert.Empty(t, explanation.ExcludedByACL)
+	})
+	t.Run("ExcludedByACL", func(t *testing.T) {
+		currentACL, err := nodeacls.DisallowNodes(nodeacls.NetworkID("skynet"), nodeacls.NodeID(node.ID), nodeacls.NodeID(peer.ID))
+		assert.Nil(t, err)
+		_, err = currentACL.Save(acls.ContainerID("skynet"))
+		assert.Nil(t, err)
+		w := get("skynet", "?explain=true")
+		assert.Equal(t, http.StatusOK, w.Code)
+		var explanation models.PeerUpdateExplanation
+		assert.Nil(t, json.NewDecoder(w.Body).Decode(&explanation))
+		assert.Empty(t, explanation.Peers)
+		assert.Equal(t, []models.PeerACLDecision{
+			{NodeID: peer.ID, Name: peer.Name, Allowed: false, Reason: models.PEER_ACL_DENIED_BY_NODE},
+		}, explanation.ExcludedByACL)
+	})
+	t.Run("WrongNetwork", func(t *testing.T) {
+		w := get("othernet", "")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
+
+func TestPeerUpdateACLDecisions(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	deleteAllNodes()
+	network := models.Network{NetID: "denynet", AddressRange: "10.0.10.0/24", DefaultACL: "no"}
+	_, err := logic.CreateNetwork(network)
+	assert.Nil(t, err)
+	node1 := models.Node{PublicKey: "DM5qhLAE20PG9BbfBCger+Ac9D2NDOwCtY1rbYDLf34=", Name: "testnode", Endpoint: "10.0.0.50", MacAddress: "01:02:03:04:05:06", Password: "password", Network: "denynet", OS: "linux"}
+	node2 := models.Node{PublicKey: "DM5qhLAE20PG9BbfBCger+Ac9D2NDOwCtY1rbYDLg35=", Name: "testnode2", Endpoint: "10.0.0.100", MacAddress: "01:02:03:04:05:07", Password: "password", Network: "denynet", OS: "linux"}
+	assert.Nil(t, logic.CreateNode(&node1))
+	assert.Nil(t, logic.CreateNode(&node2))
+	t.Run("DefaultDeny", func(t *testing.T) {
+		peerUpdate, err := logic.GetPeerUpdate(&node2)
+		assert.Nil(t, err)
+		assert.Empty(t, peerUpdate.Peers)
+		assert.Equal(t, "no", peerUpdate.DefaultACL)
+		assert.Equal(t, []models.PeerACLDecision{
+			{NodeID: node1.ID, Name: node1.Name, Allowed: false, Reason: models.PEER_ACL_DENIED_BY_NODE},
+		}, peerUpdate.ACLDecisions)
+	})
+	t.Run("ExplicitlyAllowed", func(t *testing.T) {
+		currentACL, err := nodeacls.AllowNodes(nodeacls.NetworkID("denynet"), nodeacls.NodeID(node1.ID), nodeacls.NodeID(node2.ID))
+		assert.Nil(t, err)
+		_, err = currentACL.Save(acls.ContainerID("denynet"))
+		assert.Nil(t, err)
+		peerUpdate, err := logic.GetPeerUpdate(&node2)
+		assert.Nil(t, err)
+		assert.Len(t, peerUpdate.Peers, 1)
+		assert.Equal(t, []models.PeerACLDecision{
+			{NodeID: node1.ID, Name: node1.Name, Allowed: true, Reason: models.PEER_ACL_ALLOWED},
+		}, peerUpdate.ACLDecisions)
+	})
+	deleteAllNodes()
+	deleteAllNetworks()
+}
+
+func TestEndpointOverride(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	deleteAllNodes()
+	createNet()
+	// both nodes sit behind the same carrier grade nat
+	node1 := models.Node{PublicKey: "DM5qhLAE20PG9BbfBCger+Ac9D2NDOwCtY1rbYDLf34=", Name: "cgnat1", Endpoint: "10.0.0.50", MacAddress: "01:02:03:04:05:06", Password: "password", Network: "skynet", OS: "linux"}
+	node2 := models.Node{PublicKey: "DM5qhLAE20PG9BbfBCger+Ac9D2NDOwCtY1rbYDLg35=", Name: "cgnat2", Endpoint: "10.0.0.50", MacAddress: "01:02:03:04:05:07", Password: "password", Network: "skynet", OS: "linux"}
+	assert.Nil(t, logic.CreateNode(&node1))
+	assert.Nil(t, logic.CreateNode(&node2))
+	update := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/api/nodes/skynet/"+node1.ID, strings.NewReader(body))
+		req = mux.SetURLVars(req, map[string]string{"network": "skynet", "nodeid": node1.ID})
+		w := httptest.NewRecorder()
+		updateNode(w, req)
+		return w
+	}
+	peerEndpoint := func() string {
+		peerUpdate, err := logic.GetPeerUpdate(&node2)
+		assert.Nil(t, err)
+		if len(peerUpdate.Peers) != 1 || peerUpdate.Peers[0].Endpoint == nil {
+			return ""
+		}
+		return peerUpdate.Peers[0].Endpoint.String()
+	}
+	t.Run("Discovered", func(t *testing.T) {
+		assert.Empty(t, peerEndpoint())
+	})
+	t.Run("Invalid", func(t *testing.T) {
+		for _, override := range []string{"203.0.113.5", "203.0.113.5:0", ":51821", "203.0.113.5:port"} {
+			w := update(fmt.Sprintf(`{"endpointoverride":%q}`, override))
+			assert.Equal(t, http.StatusBadRequest, w.Code, override)
+		}
+	})
+	t.Run("Set", func(t *testing.T) {
+		w := update(`{"endpointoverride":"203.0.113.5:51821"}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "203.0.113.5:51821", peerEndpoint())
+	})
+	t.Run("KeptOnAgentUpdate", func(t *testing.T) {
+		current, err := logic.GetNodeByID(node1.ID)
+		assert.Nil(t, err)
+		checkin := current
+		checkin.EndpointOverride = ""
+		checkin.Endpoint = "10.0.0.51"
+		assert.Nil(t, logic.UpdateNode(&current, &checkin))
+		assert.Equal(t, "203.0.113.5:51821", peerEndpoint())
+	})
+	t.Run("Removed", func(t *testing.T) {
+		w := update(`{"endpointoverride":"none"}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		stored, err := logic.GetNodeByID(node1.ID)
+		assert.Nil(t, err)
+		assert.Empty(t, stored.EndpointOverride)
+		assert.Equal(t, "10.0.0.51:"+strconv.Itoa(int(stored.ListenPort)), peerEndpoint())
+	})
+	deleteAllNodes()
+}
+
+func TestPeerUpdatePresharedKeys(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	deleteAllNodes()
+	_, err := logic.CreateNetwork(models.Network{NetID: "psknet", AddressRange: "10.0.30.0/24", PresharedKeys: "yes"})
+	assert.Nil(t, err)
+	node1 := models.Node{PublicKey: "DM5qhLAE20PG9BbfBCger+Ac9D2NDOwCtY1rbYDLf34=", Name: "pskone", Endpoint: "10.0.0.50", MacAddress: "01:02:03:04:05:06", Password: "password", Network: "psknet", OS: "linux", PresharedKeySupport: "yes"}
+	node2 := models.Node{PublicKey: "DM5qhLAE20FG7BbfBCger+Ac9D2NDOwCtY1rbYDXf14=", Name: "psktwo", Endpoint: "10.0.0.100", MacAddress: "01:02:03:04:05:07", Password: "password", Network: "psknet", OS: "linux", PresharedKeySupport: "yes"}
+	legacy := models.Node{PublicKey: "yPKd5Gp8Tj8Z8qWfJ4Fz3Rr6cYb2Ly0zQ7Gx1kHhV2M=", Name: "legacy", Endpoint: "10.0.0.150", MacAddress: "01:02:03:04:05:08", Password: "password", Network: "psknet", OS: "linux"}
+	assert.Nil(t, logic.CreateNode(&node1))
+	assert.Nil(t, logic.CreateNode(&node2))
+	assert.Nil(t, logic.CreateNode(&legacy))
+	peerKey := func(node *models.Node, peer *models.Node) string {
+		peerUpdate, err := logic.GetPeerUpdate(node)
+		assert.Nil(t, err)
+		for _, peerConfig := range peerUpdate.Peers {
+			if peerConfig.PublicKey.String() == peer.PublicKey {
+				if peerConfig.PresharedKey == nil {
+					return ""
+				}
+				return peerConfig.PresharedKey.String()
+			}
+		}
+		t.Fatalf("peer %s missing from peer update of %s", peer.Name, node.Name)
+		return ""
+	}
+	first := peerKey(&node1, &node2)
+	t.Run("PairAgrees", func(t *testing.T) {
+		assert.NotEmpty(t, first)
+		assert.Equal(t, first, peerKey(&node2, &node1))
+	})
+	t.Run("UnsupportedPeer", func(t *testing.T) {
+		assert.Empty(t, peerKey(&node1, &legacy))
+		assert.Empty(t, peerKey(&legacy, &node1))
+	})
+	t.Run("Rotate", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/api/networks/psknet/rotatepsk", nil)
+		req = mux.SetURLVars(req, map[string]string{"networkname": "psknet"})
+		w := httptest.NewRecorder()
+		rotatePresharedKeys(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.NotContains(t, w.Body.String(), first)
+		rotated := peerKey(&node1, &node2)
+		assert.NotEmpty(t, rotated)
+		assert.NotEqual(t, first, rotated)
+		assert.Equal(t, rotated, peerKey(&node2, &node1))
+	})
+	t.Run("RotateMissingNetwork", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/api/networks/missingnet/rotatepsk", nil)
+		req = mux.SetURLVars(req, map[string]string{"networkname": "missingnet"})
+		w := httptest.NewRecorder()
+		rotatePresharedKeys(w, req)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+	deleteAllNodes()
+	deleteAllNetworks()
+}
+
+func TestNodeTokenChallenge(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	deleteAllNodes()
+	createNet()
+	privateKey, err := wgtypes.GeneratePrivateKey()
+	assert.Nil(t, err)
+	node := models.Node{PublicKey: privateKey.PublicKey().String(), Name: "keyauth", Endpoint: "10.0.0.50", MacAddress: "01:02:03:04:05:07", Password: "password", Network: "skynet", OS: "linux"}
+	assert.Nil(t, logic.CreateNode(&node))
+	router := mux.NewRouter()
+	nodeHandlers(router)
+	call := func(path string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	getChallenge := func(t *testing.T) models.NodeTokenChallenge {
+		w := call("/api/nodes/skynet/"+node.ID+"/tokenchallenge", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		var challenge models.NodeTokenChallenge
+		assert.Nil(t, json.NewDecoder(w.Body).Decode(&challenge))
+		assert.Equal(t, node.ID, challenge.NodeID)
+		return challenge
+	}
+	seal := func(t *testing.T, challenge models.NodeTokenChallenge, key wgtypes.Key) string {
+		serverKey, err := ncutils.ConvertBytesToKey(challenge.ServerKey)
+		assert.Nil(t, err)
+		keyBytes := [32]byte(key)
+		sealed, err := ncutils.BoxEncrypt([]byte(challenge.Nonce), serverKey, &keyBytes)
+		assert.Nil(t, err)
+		return `{"nonce":"` + challenge.Nonce + `","signature":"` + base64.StdEncoding.EncodeToString(sealed) + `"}`
+	}
+	t.Run("Success", func(t *testing.T) {
+		body := seal(t, getChallenge(t), privateKey)
+		w := call("/api/nodes/skynet/"+node.ID+"/token", body)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response models.SuccessResponse
+		assert.Nil(t, json.NewDecoder(w.Body).Decode(&response))
+		token := response.Response.(map[string]interface{})["AuthToken"].(string)
+		nodeID, _, _, err := logic.VerifyToken(token)
+		assert.Nil(t, err)
+		assert.Equal(t, node.ID, nodeID)
+		// challenges are single use
+		w = call("/api/nodes/skynet/"+node.ID+"/token", body)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+	t.Run("WrongKey", func(t *testing.T) {
+		otherKey, err := wgtypes.GeneratePrivateKey()
+		assert.Nil(t, err)
+		w := call("/api/nodes/skynet/"+node.ID+"/token", seal(t, getChallenge(t), otherKey))
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Body.String(), models.ERR_INVALID_CREDENTIALS)
+	})
+	t.Run("OtherNode", func(t *testing.T) {
+		other := createTestNode()
+		body := seal(t, getChallenge(t), privateKey)
+		w := call("/api/nodes/skynet/"+other.ID+"/token", body)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+	t.Run("WrongNetwork", func(t *testing.T) {
+		w := call("/api/nodes/othernet/"+node.ID+"/tokenchallenge", "")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+	t.Run("Reissued", func(t *testing.T) {
+		// the earlier subtests used up the challenges of the test source
+		logic.ResetAuthFailures("challenge:ip:192.0.2.1")
+		replaced := getChallenge(t)
+		current := getChallenge(t)
+		w := call("/api/nodes/skynet/"+node.ID+"/token", seal(t, replaced, privateKey))
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		w = call("/api/nodes/skynet/"+node.ID+"/token", seal(t, current, privateKey))
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+	t.Run("RateLimited", func(t *testing.T) {
+		os.Setenv("AUTH_RATE_LIMIT_ATTEMPTS", "2")
+		defer os.Unsetenv("AUTH_RATE_LIMIT_ATTEMPTS")
+		defer logic.ResetAuthFailures("challenge:ip:192.0.2.90")
+		challenge := func() int {
+			req := httptest.NewRequest(http.MethodPost, "/api/nodes/skynet/"+node.ID+"/tokenchallenge", nil)
+			req.RemoteAddr = "192.0.2.90:1234"
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			return w.Code
+		}
+		assert.Equal(t, http.StatusOK, challenge())
+		assert.Equal(t, http.StatusOK, challenge())
+		assert.Equal(t, http.StatusTooManyRequests, challenge())
+	})
+	deleteAllNodes()
+	deleteAllNetworks()
+}
+
+func TestApproveNodes(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	createNet()
+	deleteAllNodes()
+	approved := createTestNode()
+	pending := models.Node{PublicKey: "DM5qhLAE20PG9BbfBCger+Ac9D2NDOwCtY1rbYDLg35=", Name: "pendingnode", Endpoint: "10.0.0.2", MacAddress: "01:02:03:04:05:07", Password: "password", Network: "skynet", OS: "linux", IsPending: "yes"}
+	err := logic.CreateNode(&pending)
+	assert.Nil(t, err)
+	t.Run("Batch", func(t *testing.T) {
+		results, nodes := logic.ApproveNodes("skynet", []string{pending.ID, approved.ID, "missing-node"})
+		assert.Equal(t, []models.NodeApprovalResult{
+			{NodeID: pending.ID, Status: models.NODE_APPROVAL_APPROVED},
+			{NodeID: approved.ID, Status: models.NODE_APPROVAL_SKIPPED},
+			{NodeID: "missing-node", Status: models.NODE_APPROVAL_FAILED, Error: "no result found"},
+		}, results)
+		assert.Len(t, nodes, 1)
+		node, err := logic.GetNodeByID(pending.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, "no", node.IsPending)
+	})
+	t.Run("OtherNetwork", func(t *testing.T) {
+		results, nodes := logic.ApproveNodes("othernet", []string{pending.ID})
+		assert.Equal(t, models.NODE_APPROVAL_FAILED, results[0].Status)
+		assert.Empty(t, nodes)
+	})
+	t.Run("EmptyRequest", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/api/nodes/skynet/approve", strings.NewReader(`{"nodeids":[]}`))
+		req = mux.SetURLVars(req, map[string]string{"network": "skynet"})
+		w := httptest.NewRecorder()
+		approveNodes(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestRequestedAddressRange(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	deleteAllNodes()
+	_, err := logic.CreateNetwork(models.Network{NetID: "dmznet", AddressRange: "10.0.60.0/24", AddressRange6: "fd00:60::/64", IsIPv6: "yes", AllowManualSignUp: "yes"})
+	assert.Nil(t, err)
+	joined := 0
+	join := func(addressRange string) *httptest.ResponseRecorder {
+		joined++
+		key, err := wgtypes.GeneratePrivateKey()
+		assert.Nil(t, err)
+		body, err := json.Marshal(map[string]interface{}{
+			"publickey":    key.PublicKey().String(),
+			"name":         fmt.Sprintf("dmz%d", joined),
+			"endpoint":     fmt.Sprintf("10.0.0.%d", joined),
+			"macaddress":   fmt.Sprintf("01:02:03:04:06:%02d", joined),
+			"password":     "password",
+			"os":           "linux",
+			"traffickeys":  map[string]string{"mine": "AQID"},
+			"addressrange": addressRange,
+		})
+		assert.Nil(t, err)
+		req := httptest.NewRequest(http.MethodPost, "/api/nodes/dmznet", bytes.NewReader(body))
+		req = mux.SetURLVars(req, map[string]string{"network": "dmznet"})
+		w := httptest.NewRecorder()
+		createNode(w, req)
+		return w
+	}
+	address := func(w *httptest.ResponseRecorder) models.Node {
+		assert.Equal(t, http.StatusOK, w.Code)
+		var nodeGet models.NodeGet
+		assert.Nil(t, json.NewDecoder(w.Body).Decode(&nodeGet))
+		return nodeGet.Node
+	}
+	t.Run("IPv4", func(t *testing.T) {
+		for _, expected := range []string{"10.0.60.200", "10.0.60.201", "10.0.60.202", "10.0.60.203"} {
+			node := address(join("10.0.60.200/30"))
+			assert.Equal(t, expected, node.Address)
+			assert.Equal(t, "10.0.60.200/30", node.AddressRange)
+		}
+	})
+	t.Run("Exhausted", func(t *testing.T) {
+		w := join("10.0.60.200/30")
+		assert.Equal(t, http.StatusConflict, w.Code)
+		var response models.ErrorResponse
+		assert.Nil(t, json.NewDecoder(w.Body).Decode(&response))
+		assert.Equal(t, models.ERR_ADDRESS_RANGE_EXHAUSTED, response.ErrorCode)
+	})
+	t.Run("IPv6", func(t *testing.T) {
+		node := address(join("fd00:60::100/126"))
+		assert.Equal(t, "fd00:60::100", node.Address6)
+		// the ipv4 address is assigned from the whole network
+		assert.Equal(t, "10.0.60.1", node.Address)
+	})
+	t.Run("OutsideNetwork", func(t *testing.T) {
+		for _, addressRange := range []string{"10.0.61.0/28", "10.0.0.0/16", "fd00:61::/64", "notacidr"} {
+			w := join(addressRange)
+			assert.Equal(t, http.StatusBadRequest, w.Code, addressRange)
+		}
+	})
+	deleteAllNodes()
+	deleteAllNetworks()
+}
+
+func TestServerCapabilities(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	deleteAllNodes()
+	_, err := logic.CreateNetwork(models.Network{NetID: "capnet", AddressRange: "10.0.70.0/24", AllowManualSignUp: "yes"})
+	assert.Nil(t, err)
+	key, err := wgtypes.GeneratePrivateKey()
+	assert.Nil(t, err)
+	body, err := json.Marshal(map[string]interface{}{
+		"publickey":   key.PublicKey().String(),
+		"name":        "capable",
+		"endpoint":    "10.0.70.9",
+		"macaddress":  "01:02:03:04:07:01",
+		"password":    "password",
+		"os":          "linux",
+		"traffickeys": map[string]string{"mine": "AQID"},
+	})
+	assert.Nil(t, err)
+	req := httptest.NewRequest(http.MethodPost, "/api/nodes/capnet", bytes.NewReader(body))
+	req = mux.SetURLVars(req, map[string]string{"network": "capnet"})
+	w := httptest.NewRecorder()
+	createNode(w, req)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var nodeGet models.NodeGet
+	assert.Nil(t, json.NewDecoder(w.Body).Decode(&nodeGet))
+	assert.Equal(t, servercfg.GetCapabilities(), nodeGet.ServerConfig.Capabilities)
+	assert.True(t, nodeGet.ServerConfig.Capabilities[models.CAPABILITY_PRESHARED_KEYS])
+	assert.True(t, nodeGet.ServerConfig.Capabilities[models.CAPABILITY_CHAINED_RELAYS])
+	assert.False(t, nodeGet.ServerConfig.Capabilities["unknown"])
+	deleteAllNodes()
+	deleteAllNetworks()
+}
+
+func TestSignupPolicy(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	deleteAllNodes()
+	network, err := logic.CreateNetwork(models.Network{NetID: "signupnet", AddressRange: "10.0.51.0/24", AllowManualSignUp: "yes"})
+	assert.Nil(t, err)
+	key, err := logic.CreateAccessKey(models.AccessKey{Name: "signupkey", Uses: 10}, network)
+	assert.Nil(t, err)
+	get := func(network, token string) (int, models.SignupPolicy) {
+		req := httptest.NewRequest(http.MethodGet, "/api/nodes/"+network+"/signup", nil)
+		req = mux.SetURLVars(req, map[string]string{"network": network})
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		getSignupPolicy(w, req)
+		var policy models.SignupPolicy
+		if w.Code == http.StatusOK {
+			assert.Nil(t, json.NewDecoder(w.Body).Decode(&policy))
+		}
+		return w.Code, policy
+	}
+	t.Run("ValidKey", func(t *testing.T) {
+		code, policy := get("signupnet", key.Value)
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, "yes", policy.AllowManualSignUp)
+		assert.True(t, policy.Allowed)
+		assert.False(t, policy.RequiresApproval)
+		assert.Empty(t, policy.PendingReason)
+	})
+	t.Run("InvalidKey", func(t *testing.T) {
+		code, policy := get("signupnet", "notakey")
+		assert.Equal(t, http.StatusOK, code)
+		assert.True(t, policy.Allowed)
+		assert.True(t, policy.RequiresApproval)
+		assert.Equal(t, models.PENDING_REASON_INVALID_KEY_GRACE, policy.PendingReason)
+	})
+	t.Run("NoManualSignUp", func(t *testing.T) {
+		_, err := logic.CreateNetwork(models.Network{NetID: "closednet", AddressRange: "10.0.52.0/24"})
+		assert.Nil(t, err)
+		code, policy := get("closednet", "notakey")
+		assert.Equal(t, http.StatusOK, code)
+		assert.False(t, policy.Allowed)
+		assert.False(t, policy.RequiresApproval)
+	})
+	t.Run("MissingNetwork", func(t *testing.T) {
+		code, _ := get("nonet", key.Value)
+		assert.Equal(t, http.StatusNotFound, code)
+	})
+	t.Run("Route", func(t *testing.T) {
+		router := mux.NewRouter()
+		nodeHandlers(router)
+		req := httptest.NewRequest(http.MethodGet, "/api/nodes/signupnet/signup", nil)
+		req.Header.Set("Authorization", "Bearer "+key.Value)
+		req.RemoteAddr = "192.0.2.71:1234"
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+	deleteAllNetworks()
+}
+
+func TestValidateAccessKey(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	network, err := logic.CreateNetwork(models.Network{NetID: "keynet", AddressRange: "10.0.53.0/24"})
+	assert.Nil(t, err)
+	key, err := logic.CreateAccessKey(models.AccessKey{Name: "singleuse", Uses: 1}, network)
+	assert.Nil(t, err)
+	// keys that can no longer be used are only kept until the next join, store them directly
+	network, err = logic.GetNetwork("keynet")
+	assert.Nil(t, err)
+	network.AccessKeys = append(network.AccessKeys,
+		models.AccessKey{Name: "expired", Value: "expiredkey", Uses: 5, Expiration: time.Now().Add(-time.Minute).Unix()},
+		models.AccessKey{Name: "usedup", Value: "usedupkey", Uses: 0})
+	data, err := json.Marshal(&network)
+	assert.Nil(t, err)
+	assert.Nil(t, database.Insert(network.NetID, string(data), database.NETWORKS_TABLE_NAME))
+	validate := func(network, body string) (int, models.AccessKeyValidation) {
+		req := httptest.NewRequest(http.MethodPost, "/api/nodes/"+network+"/validatekey", strings.NewReader(body))
+		req = mux.SetURLVars(req, map[string]string{"network": network})
+		w := httptest.NewRecorder()
+		validateAccessKey(w, req)
+		var validation models.AccessKeyValidation
+		if w.Code == http.StatusOK {
+			assert.Nil(t, json.NewDecoder(w.Body).Decode(&validation))
+		}
+		return w.Code, validation
+	}
+	t.Run("Valid", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			code, validation := validate("keynet", `{"value":"`+key.Value+`"}`)
+			assert.Equal(t, http.StatusOK, code)
+			assert.Equal(t, models.AccessKeyValidation{Network: "keynet", Valid: true}, validation)
+		}
+		keys, err := logic.GetKeys("keynet")
+		assert.Nil(t, err)
+		assert.Equal(t, 1, keys[0].Uses)
+	})
+	t.Run("Invalid", func(t *testing.T) {
+		for value, reason := range map[string]string{
+			"notakey":    models.ACCESS_KEY_NOT_FOUND,
+			"expiredkey": models.ACCESS_KEY_EXPIRED,
+			"usedupkey":  models.ACCESS_KEY_USED_UP,
+		} {
+			code, validation := validate("keynet", `{"value":"`+value+`"}`)
+			assert.Equal(t, http.StatusOK, code)
+			assert.False(t, validation.Valid, value)
+			assert.Equal(t, reason, validation.Reason, value)
+		}
+	})
+	t.Run("MissingValue", func(t *testing.T) {
+		code, _ := validate("keynet", `{}`)
+		assert.Equal(t, http.StatusBadRequest, code)
+	})
+	t.Run("MissingNetwork", func(t *testing.T) {
+		code, _ := validate("nonet", `{"value":"`+key.Value+`"}`)
+		assert.Equal(t, http.StatusNotFound, code)
+	})
+	t.Run("Route", func(t *testing.T) {
+		os.Setenv("MASTER_KEY", "secretkey")
+		defer os.Unsetenv("MASTER_KEY")
+		router := mux.NewRouter()
+		nodeHandlers(router)
+		req := httptest.NewRequest(http.MethodPost, "/api/nodes/keynet/validatekey", strings.NewReader(`{"value":"`+key.Value+`"}`))
+		req.Header.Set("Authorization", "Bearer secretkey")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.True(t, logic.IsKeyValid("keynet", key.Value))
+	})
+	deleteAllNetworks()
+}
+
+func TestNodeUpdateStatus(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	deleteAllNodes()
+	createNet()
+	node := createTestNode()
+	request := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/nodes/skynet/"+node.ID+"/updatestatus", nil)
+		req = mux.SetURLVars(req, map[string]string{"network": "skynet", "nodeid": node.ID})
+		w := httptest.NewRecorder()
+		getNodeUpdateStatus(w, req)
+		return w
+	}
+	get := func() (int, models.NodeUpdateStatus) {
+		w := request()
+		var status models.NodeUpdateStatus
+		if w.Code == http.StatusOK {
+			assert.Nil(t, json.NewDecoder(w.Body).Decode(&status))
+		}
+		return w.Code, status
+	}
+	t.Run("NoUpdate", func(t *testing.T) {
+		w := request()
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		var errResp models.ErrorResponse
+		assert.Nil(t, json.NewDecoder(w.Body).Decode(&errResp))
+		assert.Equal(t, models.ERR_NODE_UPDATE_NOT_FOUND, errResp.ErrorCode)
+	})
+	t.Run("Succeeded", func(t *testing.T) {
+		// without a broker there is nothing to publish to, which counts as delivered
+		os.Setenv("MESSAGEQUEUE_BACKEND", "off")
+		defer os.Unsetenv("MESSAGEQUEUE_BACKEND")
+		runUpdates(node, false)
+		assert.Eventually(t, func() bool {
+			code, _ := get()
+			return code == http.StatusOK
+		}, time.Second, 10*time.Millisecond)
+		_, status := get()
+		assert.True(t, status.Succeeded)
+		assert.Equal(t, "skynet", status.Network)
+		assert.NotZero(t, status.LastSucceeded)
+	})
+	t.Run("Failed", func(t *testing.T) {
+		_, before := get()
+		logic.RecordNodeUpdate(node, errors.New("broker unreachable"))
+		logic.RecordNodeUpdate(node, errors.New("broker unreachable"))
+		code, status := get()
+		assert.Equal(t, http.StatusOK, code)
+		assert.False(t, status.Succeeded)
+		assert.Equal(t, "broker unreachable", status.Error)
+		assert.Equal(t, 2, status.Failures)
+		assert.Equal(t, before.LastSucceeded, status.LastSucceeded)
+		logic.RecordNodeUpdate(node, nil)
+		_, status = get()
+		assert.True(t, status.Succeeded)
+		assert.Empty(t, status.Error)
+		assert.Zero(t, status.Failures)
+	})
+	deleteAllNodes()
+}
+
+func TestNodeMetrics(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	deleteAllNodes()
+	database.DeleteAllRecords(database.METRICS_TABLE_NAME)
+	createNet()
+	node := createTestNode()
+	peer := models.Node{PublicKey: "DM5qhLAE20FG7BbfBCger+Ac9D2NDOwCtY1rbYDXf14=", Name: "peernode", Endpoint: "10.0.0.2", MacAddress: "01:02:03:04:05:07", Password: "password", Network: "skynet", OS: "linux"}
+	assert.Nil(t, logic.CreateNode(&peer))
+	post := func(nodeid, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/nodes/skynet/"+nodeid+"/metrics", strings.NewReader(body))
+		req = mux.SetURLVars(req, map[string]string{"network": "skynet", "nodeid": nodeid})
+		w := httptest.NewRecorder()
+		updateNodeMetrics(w, req)
+		return w
+	}
+	list := func() []models.Metrics {
+		req := httptest.NewRequest(http.MethodGet, "/api/nodes/skynet/metrics", nil)
+		req = mux.SetURLVars(req, map[string]string{"network": "skynet"})
+		w := httptest.NewRecorder()
+		getNetworkMetrics(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var metrics []models.Metrics
+		assert.Nil(t, json.NewDecoder(w.Body).Decode(&metrics))
+		return metrics
+	}
+	t.Run("Empty", func(t *testing.T) {
+		assert.Empty(t, list())
+	})
+	t.Run("Store", func(t *testing.T) {
+		body := fmt.Sprintf(`{"connectivity":{%q:{"latency":12,"throughput":1000,"connected":true,"collected":100},"unknown":{"latency":1}}}`, peer.ID)
+		w := post(node.ID, body)
+		assert.Equal(t, http.StatusOK, w.Code)
+		metrics := list()
+		assert.Len(t, metrics, 1)
+		assert.Equal(t, node.ID, metrics[0].NodeID)
+		assert.Len(t, metrics[0].Connectivity, 1)
+		assert.Equal(t, int64(12), metrics[0].Connectivity[peer.ID].Latency)
+	})
+	t.Run("LatestSampleKept", func(t *testing.T) {
+		w := post(node.ID, fmt.Sprintf(`{"connectivity":{%q:{"latency":50,"collected":50}}}`, peer.ID))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, int64(12), list()[0].Connectivity[peer.ID].Latency)
+		w = post(node.ID, fmt.Sprintf(`{"connectivity":{%q:{"latency":20,"collected":200}}}`, peer.ID))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, int64(20), list()[0].Connectivity[peer.ID].Latency)
+	})
+	t.Run("Invalid", func(t *testing.T) {
+		w := post(node.ID, fmt.Sprintf(`{"connectivity":{%q:{"packetloss":150}}}`, peer.ID))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		w = post("missingnode", `{"connectivity":{}}`)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+	t.Run("PeerDeleted", func(t *testing.T) {
+		w := post(peer.ID, fmt.Sprintf(`{"connectivity":{%q:{"latency":5}}}`, node.ID))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Len(t, list(), 2)
+		assert.Nil(t, database.DeleteRecord(database.NODES_TABLE_NAME, peer.ID))
+		metrics := list()
+		assert.Len(t, metrics, 1)
+		assert.Empty(t, metrics[0].Connectivity)
+	})
+	deleteAllNodes()
+}
+
+func TestPendingReason(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	deleteAllNodes()
+	_, err := logic.CreateNetwork(models.Network{NetID: "signupnet", AddressRange: "10.0.50.0/24", AllowManualSignUp: "yes"})
+	assert.Nil(t, err)
+	join := func(body string) models.Node {
+		req := httptest.NewRequest(http.MethodPost, "/api/nodes/signupnet", strings.NewReader(body))
+		req = mux.SetURLVars(req, map[string]string{"network": "signupnet"})
+		w := httptest.NewRecorder()
+		createNode(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var nodeGet models.NodeGet
+		assert.Nil(t, json.NewDecoder(w.Body).Decode(&nodeGet))
+		return nodeGet.Node
+	}
+	manual := join(`{"publickey":"DM5qhLAE20PG9BbfBCger+Ac9D2NDOwCtY1rbYDLf34=","name":"manual","endpoint":"10.0.0.50","macaddress":"01:02:03:04:05:06","password":"password","os":"linux","traffickeys":{"mine":"AQID"},"pendingreason":"spoofed"}`)
+	badKey := join(`{"publickey":"DM5qhLAE20FG7BbfBCger+Ac9D2NDOwCtY1rbYDXf14=","name":"badkey","endpoint":"10.0.0.100","macaddress":"01:02:03:04:05:07","password":"password","os":"linux","traffickeys":{"mine":"AQID"},"accesskey":"notakey"}`)
+	t.Run("Reasons", func(t *testing.T) {
+		assert.Equal(t, "yes", manual.IsPending)
+		assert.Equal(t, models.PENDING_REASON_MANUAL_SIGNUP, manual.PendingReason)
+		assert.Equal(t, "yes", badKey.IsPending)
+		assert.Equal(t, models.PENDING_REASON_INVALID_KEY_GRACE, badKey.PendingReason)
+	})
+	t.Run("NetworkNodes", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/nodes/signupnet", nil)
+		req = mux.SetURLVars(req, map[string]string{"network": "signupnet"})
+		w := httptest.NewRecorder()
+		getNetworkNodes(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var nodes []models.Node
+		assert.Nil(t, json.NewDecoder(w.Body).Decode(&nodes))
+		reasons := map[string]string{}
+		for _, node := range nodes {
+			reasons[node.ID] = node.PendingReason
+		}
+		assert.Equal(t, map[string]string{manual.ID: models.PENDING_REASON_MANUAL_SIGNUP, badKey.ID: models.PENDING_REASON_INVALID_KEY_GRACE}, reasons)
+	})
+	t.Run("Approved", func(t *testing.T) {
+		_, err := logic.UncordonNode(manual.ID)
+		assert.Nil(t, err)
+		node, err := logic.GetNodeByID(manual.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, "no", node.IsPending)
+		assert.Empty(t, node.PendingReason)
+	})
+	deleteAllNodes()
+	deleteAllNetworks()
+}
+
+func TestNodePasswordRehash(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	deleteAllNodes()
+	createNet()
+	node := createTestNode()
+	stored := func() int {
+		current, err := logic.GetNodeByID(node.ID)
+		assert.Nil(t, err)
+		cost, err := bcrypt.Cost([]byte(current.Password))
+		assert.Nil(t, err)
+		assert.Nil(t, bcrypt.CompareHashAndPassword([]byte(current.Password), []byte("password")))
+		return cost
+	}
+	auth := func(password string) int {
+		body := fmt.Sprintf(`{"id":%q,"macaddress":%q,"password":%q}`, node.ID, node.MacAddress, password)
+		req := httptest.NewRequest(http.MethodPost, "/api/nodes/adm/skynet/authenticate", strings.NewReader(body))
+		req.RemoteAddr = "192.0.2.70:1234"
+		w := httptest.NewRecorder()
+		authenticate(w, req)
+		return w.Code
+	}
+	assert.Equal(t, servercfg.GetNodePasswordCost(), stored())
+	os.Setenv("NODE_PASSWORD_COST", "6")
+	defer os.Unsetenv("NODE_PASSWORD_COST")
+	t.Run("WrongPassword", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, auth("wrong"))
+		assert.Equal(t, 5, stored())
+	})
+	t.Run("Rehashed", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, auth("password"))
+		assert.Equal(t, 6, stored())
+	})
+	t.Run("NotLowered", func(t *testing.T) {
+		os.Setenv("NODE_PASSWORD_COST", "4")
+		assert.Equal(t, http.StatusOK, auth("password"))
+		assert.Equal(t, 6, stored())
+	})
+	t.Run("Updated", func(t *testing.T) {
+		os.Setenv("NODE_PASSWORD_COST", "7")
+		current, err := logic.GetNodeByID(node.ID)
+		assert.Nil(t, err)
+		update := current
+		update.Password = "newpassword"
+		assert.Nil(t, logic.UpdateNode(&current, &update))
+		updated, err := logic.GetNodeByID(node.ID)
+		assert.Nil(t, err)
+		cost, err := bcrypt.Cost([]byte(updated.Password))
+		assert.Nil(t, err)
+		assert.Equal(t, 7, cost)
+		assert.Nil(t, bcrypt.CompareHashAndPassword([]byte(updated.Password), []byte("newpassword")))
+	})
+	t.Run("ChangedSinceAuth", func(t *testing.T) {
+		os.Setenv("NODE_PASSWORD_COST", "8")
+		current, err := logic.GetNodeByID(node.ID)
+		assert.Nil(t, err)
+		// authenticated before an update changed the description and the password
+		authenticated := current
+		update := current
+		update.Description = "changed meanwhile"
+		update.Password = "otherpassword"
+		assert.Nil(t, logic.UpdateNode(&current, &update))
+		assert.Nil(t, logic.RehashNodePassword(&authenticated, "newpassword"))
+		stored, err := logic.GetNodeByID(node.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, "changed meanwhile", stored.Description)
+		assert.Nil(t, bcrypt.CompareHashAndPassword([]byte(stored.Password), []byte("otherpassword")))
+	})
+	t.Run("OnlyHash", func(t *testing.T) {
+		current, err := logic.GetNodeByID(node.ID)
+		assert.Nil(t, err)
+		authenticated := current
+		update := current
+		update.Description = "changed after auth"
+		assert.Nil(t, logic.UpdateNode(&current, &update))
+		assert.Nil(t, logic.RehashNodePassword(&authenticated, "otherpassword"))
+		stored, err := logic.GetNodeByID(node.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, "changed after auth", stored.Description)
+		cost, err := bcrypt.Cost([]byte(stored.Password))
+		assert.Nil(t, err)
+		assert.Equal(t, 8, cost)
+	})
+	t.Run("SourceBudgetKept", func(t *testing.T) {
+		defer logic.ResetAuthFailures("ip:192.0.2.71")
+		for i := int64(1); i < servercfg.GetAuthRateLimitAttempts(); i++ {
+			logic.RecordAuthFailure("ip:192.0.2.71")
+		}
+		body := fmt.Sprintf(`{"id":%q,"macaddress":%q,"password":"otherpassword"}`, node.ID, node.MacAddress)
+		req := httptest.NewRequest(http.MethodPost, "/api/nodes/adm/skynet/authenticate", strings.NewReader(body))
+		req.RemoteAddr = "192.0.2.71:1234"
+		w := httptest.NewRecorder()
+		authenticate(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		// a valid credential must not buy the source more guesses
+		logic.RecordAuthFailure("ip:192.0.2.71")
+		assert.True(t, logic.IsAuthRateLimited("ip:192.0.2.71"))
+	})
+	deleteAllNodes()
+}
+
+func TestAuthenticateContentType(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	deleteAllNodes()
+	createNet()
+	node := createTestNode()
+	auth := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/nodes/adm/skynet/authenticate", strings.NewReader(body))
+		req.RemoteAddr = "192.0.2.72:1234"
+		w := httptest.NewRecorder()
+		authenticate(w, req)
+		return w
+	}
+	for name, test := range map[string]struct {
+		body   string
+		status int
+	}{
+		"Success":       {fmt.Sprintf(`{"id":%q,"password":"password"}`, node.ID), http.StatusOK},
+		"WrongPassword": {fmt.Sprintf(`{"id":%q,"password":"wrong"}`, node.ID), http.StatusBadRequest},
+		"MissingID":     {`{"password":"password"}`, http.StatusBadRequest},
+		"InvalidJSON":   {`{`, http.StatusBadRequest},
+	} {
+		t.Run(name, func(t *testing.T) {
+			w := auth(test.body)
+			assert.Equal(t, test.status, w.Code)
+			assert.Equal(t, "application/json", w.Result().Header.Get("Content-Type"))
+		})
+	}
+	t.Run("GetNodeNotFound", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/nodes/skynet/missingnode", nil)
+		req = mux.SetURLVars(req, map[string]string{"network": "skynet", "nodeid": "missingnode"})
+		w := httptest.NewRecorder()
+		getNode(w, req)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Equal(t, "application/json", w.Result().Header.Get("Content-Type"))
+	})
+	deleteAllNodes()
+}
+
+func TestNodeAuthAccessKey(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	createNet()
+	network, err := logic.GetNetwork("skynet")
+	assert.Nil(t, err)
+	key, err := logic.CreateAccessKey(models.AccessKey{Name: "joinkey", Uses: 10}, network)
+	assert.Nil(t, err)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.True(t, strings.HasPrefix(r.Header.Get("user"), "accesskey:joinkey"))
+		w.WriteHeader(http.StatusOK)
+	})
+	call := func(token, remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/nodes/skynet", nil)
+		req = mux.SetURLVars(req, map[string]string{"network": "skynet"})
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		nodeauth(handler)(w, req)
+		return w
+	}
+	t.Run("ValidKey", func(t *testing.T) {
+		w := call(key.Value, "192.0.2.60:1234")
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+	t.Run("NewKey", func(t *testing.T) {
+		network, err := logic.GetNetwork("skynet")
+		assert.Nil(t, err)
+		newKey, err := logic.CreateAccessKey(models.AccessKey{Name: "joinkey2", Uses: 1}, network)
+		assert.Nil(t, err)
+		w := call(newKey.Value, "192.0.2.60:1234")
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+	t.Run("RateLimited", func(t *testing.T) {
+		defer logic.ResetAuthFailures("ip:192.0.2.61")
+		for i := int64(0); i < servercfg.GetAuthRateLimitAttempts(); i++ {
+			w := call("wrongkey", "192.0.2.61:1234")
+			assert.Equal(t, http.StatusUnauthorized, w.Code)
+		}
+		w := call(key.Value, "192.0.2.61:1234")
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		// other sources are not held up
+		w = call(key.Value, "192.0.2.62:1234")
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+	t.Run("SourceBudgetKept", func(t *testing.T) {
+		defer logic.ResetAuthFailures("ip:192.0.2.63")
+		for i := int64(1); i < servercfg.GetAuthRateLimitAttempts(); i++ {
+			w := call("wrongkey", "192.0.2.63:1234")
+			assert.Equal(t, http.StatusUnauthorized, w.Code)
+		}
+		w := call(key.Value, "192.0.2.63:1234")
+		assert.Equal(t, http.StatusOK, w.Code)
+		w = call("wrongkey", "192.0.2.63:1234")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		w = call(key.Value, "192.0.2.63:1234")
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	})
+	deleteAllNetworks()
+}
+
+func TestGetNetworkGateways(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	createNet()
+	node := createTestNode()
+	createnode := models.Node{PublicKey: "DM5qhLAE20PG9BbfBCger+Ac9D2NDOwCtY1rbYDLg35=", Name: "plainnode", Endpoint: "10.0.0.2", MacAddress: "01:02:03:04:05:07", Password: "password", Network: "skynet", OS: "linux"}
+	err := logic.CreateNode(&createnode)
+	assert.Nil(t, err)
+	t.Run("NoGateways", func(t *testing.T) {
+		gateways, err := logic.GetNetworkGateways("skynet")
+		assert.Nil(t, err)
+		assert.Empty(t, gateways)
+	})
+	t.Run("EgressGateway", func(t *testing.T) {
+		_, err := logic.CreateEgressGateway(models.EgressGatewayRequest{NodeID: node.ID, NetID: "skynet", Interface: "eth0", Ranges: []string{"10.100.100.0/24"}})
+		assert.Nil(t, err)
+		gateways, err := logic.GetNetworkGateways("skynet")
+		assert.Nil(t, err)
+		assert.Len(t, gateways, 1)
+		assert.Equal(t, node.ID, gateways[0].NodeID)
+		assert.Equal(t, []string{"10.100.100.0/24"}, gateways[0].EgressGatewayRanges)
+	})
+}
+
+func TestCreateRelayUnknownAddrs(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	createNet()
+	relay := createTestNode()
+	relayed := models.Node{PublicKey: "DM5qhLAE20PG9BbfBCger+Ac9D2NDOwCtY1rbYDLg35=", Name: "relayed", Endpoint: "10.0.0.2", MacAddress: "01:02:03:04:05:07", Password: "password", Network: "skynet", OS: "linux"}
+	err := logic.CreateNode(&relayed)
+	assert.Nil(t, err)
+	t.Run("UnknownAddr", func(t *testing.T) {
+		_, _, err := logic.CreateRelay(models.RelayRequest{NodeID: relay.ID, NetID: "skynet", RelayAddrs: []string{relayed.Address, "10.0.0.250"}})
+		var unknown *logic.UnknownRelayAddrsError
+		assert.ErrorAs(t, err, &unknown)
+		assert.Equal(t, []string{"10.0.0.250"}, unknown.Addrs)
+		stored, err := logic.GetNodeByID(relay.ID)
+		assert.Nil(t, err)
+		assert.NotEqual(t, "yes", stored.IsRelay)
+	})
+	t.Run("SelfAddr", func(t *testing.T) {
+		_, _, err := logic.CreateRelay(models.RelayRequest{NodeID: relay.ID, NetID: "skynet", RelayAddrs: []string{relay.Address}})
+		var unknown *logic.UnknownRelayAddrsError
+		assert.ErrorAs(t, err, &unknown)
+	})
+	t.Run("Success", func(t *testing.T) {
+		relayedNodes, node, err := logic.CreateRelay(models.RelayRequest{NodeID: relay.ID, NetID: "skynet", RelayAddrs: []string{relayed.Address}})
+		assert.Nil(t, err)
+		assert.Equal(t, "yes", node.IsRelay)
+		assert.Len(t, relayedNodes, 1)
+	})
+	t.Run("BadBody", func(t *testing.T) {
+		for _, handler := range []http.HandlerFunc{createRelay, createEgressGateway} {
+			req := httptest.NewRequest(http.MethodPost, "/api/nodes/skynet/"+relay.ID, strings.NewReader(`{"relayaddrs":`))
+			req = mux.SetURLVars(req, map[string]string{"network": "skynet", "nodeid": relay.ID})
+			w := httptest.NewRecorder()
+			handler(w, req)
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			var response models.ErrorResponse
+			assert.Nil(t, json.NewDecoder(w.Body).Decode(&response))
+			assert.Equal(t, models.ERR_INVALID_REQUEST, response.ErrorCode)
+		}
+	})
+}
+
+func TestChainedRelays(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	deleteAllNodes()
+	_, err := logic.CreateNetwork(models.Network{NetID: "relaynet", AddressRange: "10.0.40.0/24"})
+	assert.Nil(t, err)
+	hub := models.Node{PublicKey: "DM5qhLAE20PG9BbfBCger+Ac9D2NDOwCtY1rbYDLf34=", Name: "hub", Endpoint: "10.0.0.50", MacAddress: "01:02:03:04:05:06", Password: "password", Network: "relaynet", OS: "linux"}
+	spoke := models.Node{PublicKey: "DM5qhLAE20FG7BbfBCger+Ac9D2NDOwCtY1rbYDXf14=", Name: "spoke", Endpoint: "10.0.0.100", MacAddress: "01:02:03:04:05:07", Password: "password", Network: "relaynet", OS: "linux"}
+	subspoke := models.Node{PublicKey: "yPKd5Gp8Tj8Z8qWfJ4Fz3Rr6cYb2Ly0zQ7Gx1kHhV2M=", Name: "subspoke", Endpoint: "10.0.0.150", MacAddress: "01:02:03:04:05:08", Password: "password", Network: "relaynet", OS: "linux"}
+	other := models.Node{PublicKey: "bxs2IquiIeXVqeYAt7VNroXeZcNyzMLwIjCVKlFO8gM=", Name: "other", Endpoint: "10.0.0.200", MacAddress: "01:02:03:04:05:09", Password: "password", Network: "relaynet", OS: "linux"}
+	for _, node := range []*models.Node{&hub, &spoke, &subspoke, &other} {
+		assert.Nil(t, logic.CreateNode(node))
+	}
+	_, _, err = logic.CreateRelay(models.RelayRequest{NodeID: hub.ID, NetID: "relaynet", RelayAddrs: []string{spoke.Address}})
+	assert.Nil(t, err)
+	_, _, err = logic.CreateRelay(models.RelayRequest{NodeID: spoke.ID, NetID: "relaynet", RelayAddrs: []string{subspoke.Address}})
+	assert.Nil(t, err)
+	allowedIPs := func(node *models.Node, peer *models.Node) []string {
+		stored, err := logic.GetNodeByID(node.ID)
+		assert.Nil(t, err)
+		peerUpdate, err := logic.GetPeerUpdate(&stored)
+		assert.Nil(t, err)
+		for _, peerConfig := range peerUpdate.Peers {
+			if peerConfig.PublicKey.String() == peer.PublicKey {
+				var ips []string
+				for _, ip := range peerConfig.AllowedIPs {
+					ips = append(ips, ip.IP.String())
+				}
+				return ips
+			}
+		}
+		return nil
+	}
+	t.Run("Loop", func(t *testing.T) {
+		_, _, err := logic.CreateRelay(models.RelayRequest{NodeID: subspoke.ID, NetID: "relaynet", RelayAddrs: []string{hub.Address}})
+		var loop *logic.RelayLoopError
+		assert.ErrorAs(t, err, &loop)
+		assert.Equal(t, []string{"subspoke", "hub", "spoke", "subspoke"}, loop.Path)
+		stored, err := logic.GetNodeByID(subspoke.ID)
+		assert.Nil(t, err)
+		assert.NotEqual(t, "yes", stored.IsRelay)
+	})
+	t.Run("LoopRequest", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/api/nodes/relaynet/"+spoke.ID+"/createrelay", strings.NewReader(`{"relayaddrs":["`+hub.Address+`"]}`))
+		req = mux.SetURLVars(req, map[string]string{"network": "relaynet", "nodeid": spoke.ID})
+		w := httptest.NewRecorder()
+		createRelay(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), models.ERR_RELAY_LOOP)
+	})
+	t.Run("OtherPeer", func(t *testing.T) {
+		ips := allowedIPs(&other, &hub)
+		assert.ElementsMatch(t, []string{hub.Address, spoke.Address, subspoke.Address}, ips)
+		assert.Nil(t, allowedIPs(&other, &spoke))
+		assert.Nil(t, allowedIPs(&other, &subspoke))
+	})
+	t.Run("MiddleRelay", func(t *testing.T) {
+		ips := allowedIPs(&spoke, &hub)
+		assert.Contains(t, ips, hub.Address)
+		assert.Contains(t, ips, other.Address)
+		assert.NotContains(t, ips, spoke.Address)
+		assert.NotContains(t, ips, subspoke.Address)
+		assert.Equal(t, []string{subspoke.Address}, allowedIPs(&spoke, &subspoke))
+		assert.Nil(t, allowedIPs(&spoke, &other))
+	})
+	t.Run("LastHop", func(t *testing.T) {
+		ips := allowedIPs(&subspoke, &spoke)
+		assert.ElementsMatch(t, []string{spoke.Address, hub.Address, other.Address}, ips)
+		assert.Nil(t, allowedIPs(&subspoke, &hub))
+	})
+	deleteAllNodes()
+	deleteAllNetworks()
+}
+
+func deleteAllNodes() {
+	database.DeleteAllRecords(database.NODES_TABLE_NAME)
+	// soft deleted nodes still reserve their addresses
+	database.DeleteAllRecords(database.DELETED_NODES_TABLE_NAME)
+}
+
+func createTestNode() *models.Node {
+	createnode := models.Node{PublicKey: "DM5qhLAE20PG9BbfBCger+Ac9D2NDOwCtY1rbYDLf34=", Name: "testnode", Endpoint: "10.0.0.1", MacAddress: "01:02:03:04:05:06", Password: "password", Network: "skynet", OS: "linux"}
+	logic.CreateNode(&createnode)
+	return &createnode
+}
+
+func TestNodeNotes(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	createNet()
+	deleteAllNodes()
+	logic.SetJWTSecret()
+	os.Setenv("MASTER_KEY", "secretkey")
+	defer os.Unsetenv("MASTER_KEY")
+	node := createTestNode()
+	nodeToken, err := logic.CreateJWT(node.ID, node.MacAddress, node.Network, time.Minute)
+	assert.Nil(t, err)
+	r := mux.NewRouter()
+	nodeHandlers(r)
+	call := func(method, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/nodes/skynet/"+node.ID, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	t.Run("Admin", func(t *testing.T) {
+		w := call(http.MethodPut, "secretkey", `{"notes":"rack 4, replace disk in march"}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		w = call(http.MethodGet, "secretkey", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		var nodeGet models.NodeGet
+		assert.Nil(t, json.NewDecoder(w.Body).Decode(&nodeGet))
+		assert.Equal(t, "rack 4, replace disk in march", nodeGet.Node.Notes)
+	})
+	t.Run("TooLong", func(t *testing.T) {
+		w := call(http.MethodPut, "secretkey", `{"notes":"`+strings.Repeat("a", 1025)+`"}`)
+		assert.NotEqual(t, http.StatusOK, w.Code)
+		stored, err := logic.GetNodeByID(node.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, "rack 4, replace disk in march", stored.Notes)
+	})
+	t.Run("NodeCannotChange", func(t *testing.T) {
+		w := call(http.MethodPut, nodeToken, `{"notes":"changed by the node"}`)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		stored, err := logic.GetNodeByID(node.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, "rack 4, replace disk in march", stored.Notes)
+	})
+	t.Run("LeftOut", func(t *testing.T) {
+		w := call(http.MethodPut, "secretkey", `{"isstatic":"yes"}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		stored, err := logic.GetNodeByID(node.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, "rack 4, replace disk in march", stored.Notes)
+	})
+	t.Run("ClearPut", func(t *testing.T) {
+		w := call(http.MethodPut, "secretkey", `{"notes":""}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		stored, err := logic.GetNodeByID(node.ID)
+		assert.Nil(t, err)
+		assert.Empty(t, stored.Notes)
+	})
+	t.Run("ClearPatch", func(t *testing.T) {
+		for _, body := range []string{`{"notes":null}`, `{"notes":""}`} {
+			w := call(http.MethodPut, "secretkey", `{"notes":"spare psu"}`)
+			assert.Equal(t, http.StatusOK, w.Code)
+			w = call(http.MethodPatch, "secretkey", body)
+			assert.Equal(t, http.StatusOK, w.Code, body)
+			stored, err := logic.GetNodeByID(node.ID)
+			assert.Nil(t, err)
+			assert.Empty(t, stored.Notes, body)
+			assert.Equal(t, "yes", stored.IsStatic, body)
+		}
+	})
+	t.Run("Join", func(t *testing.T) {
+		_, err := logic.CreateNetwork(models.Network{NetID: "notesnet", AddressRange: "10.0.51.0/24", AllowManualSignUp: "yes"})
+		assert.Nil(t, err)
+		req := httptest.NewRequest(http.MethodPost, "/api/nodes/notesnet", strings.NewReader(`{"publickey":"DM5qhLAE20FG7BbfBCger+Ac9D2NDOwCtY1rbYDXf14=","name":"joiner","endpoint":"10.0.0.51","macaddress":"01:02:03:04:05:07","password":"password","os":"linux","traffickeys":{"mine":"AQID"},"notes":"set by the node"}`))
+		req = mux.SetURLVars(req, map[string]string{"network": "notesnet"})
+		w := httptest.NewRecorder()
+		createNode(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var nodeGet models.NodeGet
+		assert.Nil(t, json.NewDecoder(w.Body).Decode(&nodeGet))
+		stored, err := logic.GetNodeByID(nodeGet.Node.ID)
+		assert.Nil(t, err)
+		assert.Empty(t, stored.Notes)
+	})
+	deleteAllNodes()
+	deleteAllNetworks()
+}
+
+func TestNodeUpdateValidation(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	createNet()
+	deleteAllNodes()
+	node := createTestNode()
+	update := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/api/nodes/skynet/"+node.ID, strings.NewReader(body))
+		req = mux.SetURLVars(req, map[string]string{"network": "skynet", "nodeid": node.ID})
+		w := httptest.NewRecorder()
+		updateNode(w, req)
+		return w
+	}
+	t.Run("InvalidFields", func(t *testing.T) {
+		w := update(`{"address":"10.99.0.5","endpoint":"not-an-ip","mtu":100,"localrange":"10.0.0.0/33","allowedips":["10.5.0.0/16","bogus"],"dnson":"maybe"}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		var response models.ErrorResponse
+		assert.Nil(t, json.NewDecoder(w.Body).Decode(&response))
+		assert.Equal(t, models.ERR_INVALID_NODE_FIELDS, response.ErrorCode)
+		reasons := make(map[string]string)
+		for _, field := range response.InvalidFields {
+			reasons[field.Field] = field.Reason
+		}
+		assert.Equal(t, map[string]string{
+			"address":    "must be within the network range 10.0.0.1/24",
+			"endpoint":   "must be an ip address",
+			"mtu":        "must be at least 576",
+			"localrange": "must be in CIDR notation",
+			"allowedips": "bogus is not an ip address or in CIDR notation",
+			"dnson":      `must be "yes" or "no"`,
+		}, reasons)
+		for field := range reasons {
+			assert.Contains(t, response.Message, field)
+		}
+		stored, err := logic.GetNodeByID(node.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, node.Endpoint, stored.Endpoint)
+	})
+	t.Run("Valid", func(t *testing.T) {
+		w := update(`{"mtu":1400,"localrange":"192.168.1.0/24"}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		stored, err := logic.GetNodeByID(node.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, int32(1400), stored.MTU)
+	})
+	deleteAllNodes()
+}
+
+func TestStaticAddress(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	createNet()
+	deleteAllNodes()
+	node := models.Node{PublicKey: "DM5qhLAE20PG9BbfBCger+Ac9D2NDOwCtY1rbYDLf34=", Name: "pinned", Endpoint: "10.0.0.1", Address: "10.0.0.20", MacAddress: "01:02:03:04:05:06", Password: "password", Network: "skynet", OS: "linux", IsStaticAddress: "yes"}
+	assert.Nil(t, logic.CreateNode(&node))
+	// a key of its own, keys differing only in their padding bits decode to the same peer
+	key, err := wgtypes.GeneratePrivateKey()
+	assert.Nil(t, err)
+	other := models.Node{PublicKey: key.PublicKey().String(), Name: "other", Endpoint: "10.0.0.2", MacAddress: "01:02:03:04:05:07", Password: "password", Network: "skynet", OS: "linux"}
+	assert.Nil(t, logic.CreateNode(&other))
+	call := func(handler http.HandlerFunc, method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req = mux.SetURLVars(req, map[string]string{"network": "skynet", "nodeid": node.ID})
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w
+	}
+	assertStatic := func(t *testing.T, w *httptest.ResponseRecorder) {
+		assert.Equal(t, http.StatusConflict, w.Code)
+		var response models.ErrorResponse
+		assert.Nil(t, json.NewDecoder(w.Body).Decode(&response))
+		assert.Equal(t, models.ERR_STATIC_ADDRESS, response.ErrorCode)
+		stored, err := logic.GetNodeByID(node.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, "10.0.0.20", stored.Address)
+	}
+	t.Run("Update", func(t *testing.T) {
+		assertStatic(t, call(updateNode, http.MethodPut, "/api/nodes/skynet/"+node.ID, `{"address":"10.0.0.30"}`))
+		w := call(updateNode, http.MethodPut, "/api/nodes/skynet/"+node.ID, `{"address":"10.0.0.20","name":"pinned-renamed"}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+	t.Run("Reassign", func(t *testing.T) {
+		assertStatic(t, call(reassignNodeIP, http.MethodPost, "/api/nodes/skynet/"+node.ID+"/reassignip", `{"address":"10.0.0.30"}`))
+	})
+	t.Run("Move", func(t *testing.T) {
+		createNetDualStack()
+		assertStatic(t, call(moveNode, http.MethodPost, "/api/nodes/skynet/"+node.ID+"/move", `{"network":"skynet6"}`))
+	})
+	t.Run("NetworkRange", func(t *testing.T) {
+		network, err := logic.GetNetwork("skynet")
+		assert.Nil(t, err)
+		newNetwork := network
+		newNetwork.AddressRange = "10.1.0.0/24"
+		_, _, _, _, err = logic.UpdateNetwork(&network, &newNetwork)
+		assert.ErrorIs(t, err, logic.ErrStaticAddress)
+		newNetwork.AddressRange = "10.0.0.0/16"
+		rangeupdate4, _, _, _, err := logic.UpdateNetwork(&network, &newNetwork)
+		assert.Nil(t, err)
+		assert.True(t, rangeupdate4)
+		assert.Nil(t, logic.UpdateNetworkNodeAddresses("skynet"))
+		stored, err := logic.GetNodeByID(node.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, "10.0.0.20", stored.Address)
+		renumbered, err := logic.GetNodeByID(other.ID)
+		assert.Nil(t, err)
+		assert.NotEqual(t, "10.0.0.20", renumbered.Address)
+	})
+	t.Run("Unpinned", func(t *testing.T) {
+		w := call(updateNode, http.MethodPut, "/api/nodes/skynet/"+node.ID, `{"isstaticaddress":"no"}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		w = call(reassignNodeIP, http.MethodPost, "/api/nodes/skynet/"+node.ID+"/reassignip", `{"address":"10.0.0.30"}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+	deleteAllNodes()
+	deleteAllNetworks()
+}
+
+func TestUpdateAck(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	createNet()
+	deleteAllNodes()
+	os.Setenv("MASTER_KEY", "secretkey")
+	defer os.Unsetenv("MASTER_KEY")
+	node := createTestNode()
+	// a key of its own, keys differing only in their padding bits decode to the same peer
+	key, err := wgtypes.GeneratePrivateKey()
+	assert.Nil(t, err)
+	peer := models.Node{PublicKey: key.PublicKey().String(), Name: "peernode", Endpoint: "10.0.0.2", MacAddress: "01:02:03:04:05:07", Password: "password", Network: "skynet", OS: "linux"}
+	assert.Nil(t, logic.CreateNode(&peer))
+	r := mux.NewRouter()
+	nodeHandlers(r)
+	call := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer secretkey")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	ack := logic.RequestUpdateAck("skynet", models.UPDATE_ACK_PEERS, []models.Node{*node, peer})
+	t.Run("Confirm", func(t *testing.T) {
+		assert.Nil(t, logic.ConfirmUpdateAck(ack.ID, peer.ID))
+		assert.Nil(t, logic.ConfirmUpdateAck(ack.ID, peer.ID))
+		assert.ErrorIs(t, logic.ConfirmUpdateAck(ack.ID, "unknown-node"), logic.ErrUpdateAckNotExpected)
+		assert.ErrorIs(t, logic.ConfirmUpdateAck("unknown-ack", peer.ID), logic.ErrUpdateAckNotFound)
+	})
+	t.Run("State", func(t *testing.T) {
+		w := call(http.MethodGet, "/api/nodes/skynet/acks/"+ack.ID)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var state models.UpdateAck
+		assert.Nil(t, json.NewDecoder(w.Body).Decode(&state))
+		assert.Equal(t, 2, state.Expected)
+		assert.Equal(t, 1, state.Confirmed)
+		assert.Equal(t, []string{node.ID}, state.Pending)
+		assert.Contains(t, state.Confirmations, peer.ID)
+	})
+	t.Run("NotFound", func(t *testing.T) {
+		other := logic.RequestUpdateAck("othernet", models.UPDATE_ACK_NODE, []models.Node{peer})
+		for _, ackID := range []string{"unknown-ack", other.ID} {
+			w := call(http.MethodGet, "/api/nodes/skynet/acks/"+ackID)
+			assert.Equal(t, http.StatusNotFound, w.Code, ackID)
+			var response models.ErrorResponse
+			assert.Nil(t, json.NewDecoder(w.Body).Decode(&response))
+			assert.Equal(t, models.ERR_UPDATE_ACK_NOT_FOUND, response.ErrorCode)
+		}
+	})
+	t.Run("MessageQueueOff", func(t *testing.T) {
+		os.Setenv("MESSAGEQUEUE_BACKEND", "off")
+		defer os.Unsetenv("MESSAGEQUEUE_BACKEND")
+		for _, path := range []string{"/api/nodes/skynet/peerupdate", "/api/nodes/skynet/" + node.ID + "/push"} {
+			w := call(http.MethodPost, path)
+			assert.Equal(t, http.StatusServiceUnavailable, w.Code, path)
+			var response models.ErrorResponse
+			assert.Nil(t, json.NewDecoder(w.Body).Decode(&response))
+			assert.Equal(t, models.ERR_MESSAGE_QUEUE_OFF, response.ErrorCode)
+		}
+	})
+	deleteAllNodes()
+	deleteAllNetworks()
+}
+
+func TestAccessKeyChallengeLimit(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	_, err := logic.CreateNetwork(models.Network{NetID: "signednet", AddressRange: "10.0.54.0/24", AsymmetricKeys: "yes"})
+	assert.Nil(t, err)
+	os.Setenv("AUTH_RATE_LIMIT_ATTEMPTS", "3")
+	defer os.Unsetenv("AUTH_RATE_LIMIT_ATTEMPTS")
+	r := mux.NewRouter()
+	nodeHandlers(r)
+	challenge := func(remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/nodes/signednet/challenge", nil)
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	defer logic.ResetAuthFailures("challenge:ip:192.0.2.80", "challenge:ip:192.0.2.81")
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusOK, challenge("192.0.2.80:1234").Code)
+	}
+	w := challenge("192.0.2.80:1234")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	var response models.ErrorResponse
+	assert.Nil(t, json.NewDecoder(w.Body).Decode(&response))
+	assert.Equal(t, models.ERR_RATE_LIMITED, response.ErrorCode)
+	assert.Equal(t, http.StatusOK, challenge("192.0.2.81:1234").Code)
+	t.Run("SymmetricNetwork", func(t *testing.T) {
+		createNet()
+		defer logic.ResetAuthFailures("challenge:ip:192.0.2.82")
+		req := httptest.NewRequest(http.MethodPost, "/api/nodes/skynet/challenge", nil)
+		req.RemoteAddr = "192.0.2.82:1234"
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		var response models.ErrorResponse
+		assert.Nil(t, json.NewDecoder(w.Body).Decode(&response))
+		assert.Equal(t, models.ERR_ASYMMETRIC_KEYS_DISABLED, response.ErrorCode)
+	})
+	deleteAllNetworks()
+}
+
+func TestNodeOfOtherNetwork(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	createNet()
+	_, err := logic.CreateNetwork(models.Network{NetID: "othernet", AddressRange: "10.0.55.0/24"})
+	assert.Nil(t, err)
+	os.Setenv("MASTER_KEY", "secretkey")
+	defer os.Unsetenv("MASTER_KEY")
+	node := createTestNode()
+	r := mux.NewRouter()
+	nodeHandlers(r)
+	for _, route := range []struct {
+		method string
+		path   string
+		body   string
+	}{
+		{http.MethodGet, "", ""},
+		{http.MethodPut, "", `{"name":"renamed"}`},
+		{http.MethodPatch, "", `{"name":"renamed"}`},
+		{http.MethodDelete, "", ""},
+		{http.MethodGet, "/updatestatus", ""},
+		{http.MethodPost, "/push", ""},
+		{http.MethodPost, "/drain", ""},
+		{http.MethodGet, "/drain", ""},
+		{http.MethodPost, "/approve", ""},
+		{http.MethodPost, "/reassignip", `{}`},
+	} {
+		t.Run(route.method+route.path, func(t *testing.T) {
+			req := httptest.NewRequest(route.method, "/api/nodes/othernet/"+node.ID+route.path, strings.NewReader(route.body))
+			req.Header.Set("Authorization", "Bearer secretkey")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusNotFound, w.Code, w.Body.String())
+		})
+	}
+	stored, err := logic.GetNodeByID(node.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "testnode", stored.Name)
+	assert.NotEqual(t, "yes", stored.IsDraining)
+	deleteAllNetworks()
 }
@@ -2,6 +2,7 @@ package controller
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	"github.com/gorilla/mux"
@@ -17,17 +18,19 @@ func createRelay(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	err := json.NewDecoder(r.Body).Decode(&relay)
 	if err != nil {
-		returnErrorResponse(w, r, formatError(err, "internal"))
+		returnErrorResponse(w, r, formatErrorCode(err, "badrequest", models.ERR_INVALID_REQUEST))
 		return
 	}
 	relay.NetID = params["network"]
 	relay.NodeID = params["nodeid"]
+	before, _ := logic.GetNodeByID(relay.NodeID)
 	updatenodes, node, err := logic.CreateRelay(relay)
 	if err != nil {
-		returnErrorResponse(w, r, formatError(err, "internal"))
+		returnRelayAddrsError(w, r, err)
 		return
 	}
 	logger.Log(1, r.Header.Get("user"), "created relay on node", relay.NodeID, "on network", relay.NetID)
+	recordNodeAudit(r, models.AUDIT_CREATE_RELAY, &before, &node)
 	for _, relayedNode := range updatenodes {
 		err = mq.NodeUpdate(&relayedNode)
 		if err != nil {
@@ -39,17 +42,35 @@ func createRelay(w http.ResponseWriter, r *http.Request) {
 	runUpdates(&node, true)
 }
 
+// returnRelayAddrsError - relay addresses that are unknown or would form a relay loop are the caller's mistake
+func returnRelayAddrsError(w http.ResponseWriter, r *http.Request, err error) {
+	var unknownAddrs *logic.UnknownRelayAddrsError
+	var relayLoop *logic.RelayLoopError
+	switch {
+	case errors.As(err, &unknownAddrs):
+		returnErrorResponse(w, r, formatErrorCode(err, "badrequest", models.ERR_UNKNOWN_RELAY_ADDRS))
+	case errors.As(err, &relayLoop):
+		returnErrorResponse(w, r, formatErrorCode(err, "badrequest", models.ERR_RELAY_LOOP))
+	case errors.Is(err, logic.ErrDNSOnlyNode):
+		returnErrorResponse(w, r, formatErrorCode(err, "conflict", models.ERR_DNS_ONLY_NODE))
+	default:
+		returnErrorResponse(w, r, formatError(err, "internal"))
+	}
+}
+
 func deleteRelay(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	var params = mux.Vars(r)
 	nodeid := params["nodeid"]
 	netid := params["network"]
+	before, _ := logic.GetNodeByID(nodeid)
 	updatenodes, node, err := logic.DeleteRelay(netid, nodeid)
 	if err != nil {
 		returnErrorResponse(w, r, formatError(err, "internal"))
 		return
 	}
 	logger.Log(1, r.Header.Get("user"), "deleted relay server", nodeid, "on network", netid)
+	recordNodeAudit(r, models.AUDIT_DELETE_RELAY, &before, &node)
 	for _, relayedNode := range updatenodes {
 		err = mq.NodeUpdate(&relayedNode)
 		if err != nil {
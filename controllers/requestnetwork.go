@@ -0,0 +1,46 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/gravitl/netmaker/database"
+	"github.com/gravitl/netmaker/logic"
+	"github.com/gravitl/netmaker/models"
+)
+
+// requestNetworkKey - request context key of the network the auth middleware looked up for a request
+type requestNetworkKey struct{}
+
+// withRequestNetwork - hands the network named in the request on to the handlers, so it is read once per request
+func withRequestNetwork(r *http.Request, network models.Network) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), requestNetworkKey{}, network))
+}
+
+// requestNetwork - the network named in the request as the middleware looked it up, read from the
+// database when no middleware did, e.g. for handlers called directly
+func requestNetwork(r *http.Request, netname string) (models.Network, error) {
+	if network, ok := r.Context().Value(requestNetworkKey{}).(models.Network); ok && network.NetID == netname {
+		return network, nil
+	}
+	return logic.GetNetwork(netname)
+}
+
+// requireNetwork - middleware answering 404 for requests naming a network that does not exist,
+// for routes authenticated by nodeauth, authorize looks the network up itself
+func requireNetwork(next http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		network, err := logic.GetNetwork(mux.Vars(r)["network"])
+		if err != nil {
+			if database.IsEmptyRecord(err) {
+				returnErrorResponse(w, r, formatErrorCode(errors.New("network does not exist"), "notfound", models.ERR_NETWORK_NOT_FOUND))
+				return
+			}
+			returnErrorResponse(w, r, formatError(err, "internal"))
+			return
+		}
+		next.ServeHTTP(w, withRequestNetwork(r, network))
+	}
+}
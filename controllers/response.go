@@ -1,8 +1,13 @@
 package controller
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strings"
 
 	"github.com/gravitl/netmaker/logger"
 	"github.com/gravitl/netmaker/models"
@@ -22,6 +27,12 @@ func formatError(err error, errType string) models.ErrorResponse {
 		status = http.StatusUnauthorized
 	case "forbidden":
 		status = http.StatusForbidden
+	case "conflict":
+		status = http.StatusConflict
+	case "toomanyrequests":
+		status = http.StatusTooManyRequests
+	case "unavailable":
+		status = http.StatusServiceUnavailable
 	default:
 		status = http.StatusInternalServerError
 	}
@@ -33,6 +44,75 @@ func formatError(err error, errType string) models.ErrorResponse {
 	return response
 }
 
+// formatErrorCode - formats an error response with a specific machine readable error code
+func formatErrorCode(err error, errType string, errCode string) models.ErrorResponse {
+	var response = formatError(err, errType)
+	response.ErrorCode = errCode
+	return response
+}
+
+// errorCodeFromStatus - default machine readable error code for an http status
+func errorCodeFromStatus(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return models.ERR_BAD_REQUEST
+	case http.StatusUnauthorized:
+		return models.ERR_UNAUTHORIZED
+	case http.StatusForbidden:
+		return models.ERR_FORBIDDEN
+	case http.StatusNotFound:
+		return models.ERR_NOT_FOUND
+	case http.StatusConflict:
+		return models.ERR_CONFLICT
+	case http.StatusTooManyRequests:
+		return models.ERR_RATE_LIMITED
+	default:
+		return models.ERR_INTERNAL
+	}
+}
+
+// returnContextError - answers a logic error caused by the request's context ending with a 503,
+// the client went away or the request passed its deadline; false for any other error
+func returnContextError(response http.ResponseWriter, request *http.Request, err error) bool {
+	if !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	logger.Log(2, "gave up on", request.Method, request.URL.Path, err.Error())
+	returnErrorResponse(response, request, formatErrorCode(err, "unavailable", models.ERR_REQUEST_CANCELLED))
+	return true
+}
+
+// returnConditionalResponse - writes a json response with a strong etag of its content, a request
+// whose If-None-Match already holds the etag is answered 304 without a body
+func returnConditionalResponse(response http.ResponseWriter, request *http.Request, body interface{}) {
+	jsonResponse, err := json.Marshal(body)
+	if err != nil {
+		returnErrorResponse(response, request, formatError(err, "internal"))
+		return
+	}
+	sum := sha256.Sum256(jsonResponse)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	response.Header().Set("ETag", etag)
+	if etagMatches(request.Header.Get("If-None-Match"), etag) {
+		response.WriteHeader(http.StatusNotModified)
+		return
+	}
+	response.Header().Set("Content-Type", "application/json")
+	response.WriteHeader(http.StatusOK)
+	response.Write(jsonResponse)
+}
+
+// etagMatches - checks an If-None-Match header against an etag, weak tags compare by their value
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
 func returnSuccessResponse(response http.ResponseWriter, request *http.Request, message string) {
 	var httpResponse models.SuccessResponse
 	httpResponse.Code = http.StatusOK
@@ -43,12 +123,16 @@ func returnSuccessResponse(response http.ResponseWriter, request *http.Request,
 }
 
 func returnErrorResponse(response http.ResponseWriter, request *http.Request, errorMessage models.ErrorResponse) {
-	httpResponse := &models.ErrorResponse{Code: errorMessage.Code, Message: errorMessage.Message}
+	httpResponse := &errorMessage
+	if httpResponse.ErrorCode == "" {
+		httpResponse.ErrorCode = errorCodeFromStatus(errorMessage.Code)
+	}
 	jsonResponse, err := json.Marshal(httpResponse)
 	if err != nil {
 		panic(err)
 	}
 	logger.Log(1, "processed request error:", errorMessage.Message)
+	setAccessLogErrorCode(request, httpResponse.ErrorCode)
 	response.Header().Set("Content-Type", "application/json")
 	response.WriteHeader(errorMessage.Code)
 	response.Write(jsonResponse)
@@ -17,6 +17,14 @@ func TestFormatError(t *testing.T) {
 	assert.Equal(t, "this is a sample error", response.Message)
 }
 
+func TestFormatErrorCode(t *testing.T) {
+	response := formatErrorCode(errors.New("key invalid"), "unauthorized", models.ERR_INVALID_ACCESS_KEY)
+	assert.Equal(t, http.StatusUnauthorized, response.Code)
+	assert.Equal(t, models.ERR_INVALID_ACCESS_KEY, response.ErrorCode)
+	assert.Equal(t, models.ERR_NOT_FOUND, errorCodeFromStatus(http.StatusNotFound))
+	assert.Equal(t, models.ERR_INTERNAL, errorCodeFromStatus(http.StatusTeapot))
+}
+
 func TestReturnSuccessResponse(t *testing.T) {
 	var response models.SuccessResponse
 	handler := func(rw http.ResponseWriter, r *http.Request) {
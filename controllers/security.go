@@ -69,7 +69,7 @@ func SecurityCheck(reqAdmin bool, netname string, token string) (error, []string
 	isMasterAuthenticated := authenticateMaster(authToken)
 	username := ""
 	if !hasBearer || !isMasterAuthenticated {
-		userName, networks, isadmin, err := logic.VerifyUserToken(authToken)
+		userName, networks, isadmin, role, err := logic.VerifyUserTokenRole(authToken)
 		username = userName
 		if err != nil {
 			return errors.New("error verifying user token"), nil, username
@@ -77,6 +77,10 @@ func SecurityCheck(reqAdmin bool, netname string, token string) (error, []string
 		if !isadmin && reqAdmin {
 			return errors.New("you are unauthorized to access this endpoint"), nil, username
 		}
+		// network admins manage the keys of their own networks only
+		if role == models.USER_ROLE_NETWORK_ADMIN && netname != "" && !logic.StringSliceContains(networks, netname) {
+			return errors.New("you are unauthorized to access this endpoint"), nil, username
+		}
 		userNetworks = networks
 		if isadmin {
 			userNetworks = []string{ALL_NETWORK_ACCESS}
@@ -100,7 +104,7 @@ func SecurityCheck(reqAdmin bool, netname string, token string) (error, []string
 
 // Consider a more secure way of setting master key
 func authenticateMaster(tokenString string) bool {
-	return tokenString == servercfg.GetMasterKey() && servercfg.GetMasterKey() != ""
+	return logic.IsMasterKey(tokenString)
 }
 
 //Consider a more secure way of setting master key
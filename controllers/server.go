@@ -5,14 +5,18 @@ import (
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/gorilla/mux"
+	"github.com/gravitl/netmaker/database"
 	"github.com/gravitl/netmaker/logger"
 	"github.com/gravitl/netmaker/logic"
 	"github.com/gravitl/netmaker/models"
+	"github.com/gravitl/netmaker/mq"
 	"github.com/gravitl/netmaker/netclient/config"
 	"github.com/gravitl/netmaker/servercfg"
 	"github.com/gravitl/netmaker/tls"
@@ -24,6 +28,9 @@ func serverHandlers(r *mux.Router) {
 	r.HandleFunc("/api/server/removenetwork/{network}", securityCheckServer(true, http.HandlerFunc(removeNetwork))).Methods("DELETE")
 	r.HandleFunc("/api/server/register", authorize(true, false, "node", http.HandlerFunc(register))).Methods("POST")
 	r.HandleFunc("/api/server/getserverinfo", authorize(true, false, "node", http.HandlerFunc(getServerInfo))).Methods("GET")
+	r.HandleFunc("/api/server/health", http.HandlerFunc(getServerHealth)).Methods("GET")
+	r.HandleFunc("/api/server/maintenance", securityCheckServer(false, http.HandlerFunc(getMaintenanceMode))).Methods("GET")
+	r.HandleFunc("/api/server/maintenance", securityCheckServer(true, http.HandlerFunc(setMaintenanceMode))).Methods("PUT")
 }
 
 //Security check is middleware for every function and just checks to make sure that its the master calling
@@ -92,6 +99,69 @@ func getServerInfo(w http.ResponseWriter, r *http.Request) {
 	//w.WriteHeader(http.StatusOK)
 }
 
+// getMaintenanceMode - whether node changes are currently paused
+func getMaintenanceMode(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	mode, err := logic.GetMaintenanceMode()
+	if err != nil {
+		returnErrorResponse(w, r, formatError(err, "internal"))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(mode)
+}
+
+// setMaintenanceMode - turns maintenance mode on or off, while it is on node create, update and delete answer 503
+func setMaintenanceMode(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var mode models.MaintenanceMode
+	if err := json.NewDecoder(r.Body).Decode(&mode); err != nil {
+		returnErrorResponse(w, r, formatErrorCode(err, "badrequest", models.ERR_INVALID_REQUEST))
+		return
+	}
+	mode, err := logic.SetMaintenanceMode(mode)
+	if errors.Is(err, logic.ErrInvalidMaintenanceMode) {
+		returnErrorResponse(w, r, formatErrorCode(err, "badrequest", models.ERR_INVALID_REQUEST))
+		return
+	}
+	if err != nil {
+		returnErrorResponse(w, r, formatError(err, "internal"))
+		return
+	}
+	logger.Log(0, r.Header.Get("user"), "set maintenance mode enabled:", strconv.FormatBool(mode.Enabled), mode.Reason)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(mode)
+}
+
+// getServerHealth - reports whether the database and message queue are reachable, unauthenticated so it can back load balancer and orchestrator probes
+func getServerHealth(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	health := models.ServerHealth{
+		Status:   models.HEALTH_OK,
+		Database: dependencyHealth(database.Ping()),
+		MQ:       models.DependencyHealth{Status: models.HEALTH_DISABLED},
+	}
+	if servercfg.IsMessageQueueBackend() {
+		health.MQ = dependencyHealth(mq.CheckConnection())
+	}
+	code := http.StatusOK
+	if health.Database.Status == models.HEALTH_ERROR || health.MQ.Status == models.HEALTH_ERROR {
+		health.Status = models.HEALTH_DEGRADED
+		code = http.StatusServiceUnavailable
+		logger.Log(1, "health check failed, database:", health.Database.Status, "mq:", health.MQ.Status)
+	}
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(health)
+}
+
+func dependencyHealth(err error) models.DependencyHealth {
+	if err != nil {
+		return models.DependencyHealth{Status: models.HEALTH_ERROR, Error: err.Error()}
+	}
+	return models.DependencyHealth{Status: models.HEALTH_OK}
+}
+
 func getConfig(w http.ResponseWriter, r *http.Request) {
 	// Set header
 	w.Header().Set("Content-Type", "application/json")
@@ -0,0 +1,138 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/gravitl/netmaker/database"
+	"github.com/gravitl/netmaker/logic"
+	"github.com/gravitl/netmaker/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServerHealth(t *testing.T) {
+	database.InitializeDatabase()
+	r := mux.NewRouter()
+	serverHandlers(r)
+	t.Run("Healthy", func(t *testing.T) {
+		os.Setenv("MESSAGEQUEUE_BACKEND", "off")
+		defer os.Unsetenv("MESSAGEQUEUE_BACKEND")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/server/health", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+		var health models.ServerHealth
+		assert.Nil(t, json.NewDecoder(w.Body).Decode(&health))
+		assert.Equal(t, models.HEALTH_OK, health.Status)
+		assert.Equal(t, models.HEALTH_OK, health.Database.Status)
+		assert.Equal(t, models.HEALTH_DISABLED, health.MQ.Status)
+	})
+	t.Run("BrokerUnreachable", func(t *testing.T) {
+		os.Setenv("MESSAGEQUEUE_BACKEND", "on")
+		os.Setenv("MQ_HOST", "127.0.0.1")
+		os.Setenv("MQ_SERVER_PORT", "1")
+		defer os.Unsetenv("MESSAGEQUEUE_BACKEND")
+		defer os.Unsetenv("MQ_HOST")
+		defer os.Unsetenv("MQ_SERVER_PORT")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/server/health", nil))
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		var health models.ServerHealth
+		assert.Nil(t, json.NewDecoder(w.Body).Decode(&health))
+		assert.Equal(t, models.HEALTH_DEGRADED, health.Status)
+		assert.Equal(t, models.HEALTH_OK, health.Database.Status)
+		assert.Equal(t, models.HEALTH_ERROR, health.MQ.Status)
+		assert.NotEmpty(t, health.MQ.Error)
+	})
+}
+
+func TestMaintenanceMode(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	deleteAllNodes()
+	createNet()
+	os.Setenv("MASTER_KEY", "secretkey")
+	defer os.Unsetenv("MASTER_KEY")
+	defer logic.SetMaintenanceMode(models.MaintenanceMode{})
+	node := createTestNode()
+	r := mux.NewRouter()
+	serverHandlers(r)
+	nodeHandlers(r)
+	call := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer secretkey")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	t.Run("InvalidRetryAfter", func(t *testing.T) {
+		w := call(http.MethodPut, "/api/server/maintenance", `{"enabled":true,"retryafter":-1}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+	t.Run("Enable", func(t *testing.T) {
+		w := call(http.MethodPut, "/api/server/maintenance", `{"enabled":true,"reason":"database upgrade","retryafter":60}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		w = call(http.MethodGet, "/api/server/maintenance", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		var mode models.MaintenanceMode
+		assert.Nil(t, json.NewDecoder(w.Body).Decode(&mode))
+		assert.True(t, mode.Enabled)
+		assert.Equal(t, 60, mode.RetryAfter)
+		assert.NotZero(t, mode.Started)
+	})
+	t.Run("ChangesBlocked", func(t *testing.T) {
+		for _, method := range []string{http.MethodPut, http.MethodPatch, http.MethodDelete} {
+			w := call(method, "/api/nodes/skynet/"+node.ID, `{"name":"renamed"}`)
+			assert.Equal(t, http.StatusServiceUnavailable, w.Code, method)
+			assert.Equal(t, "60", w.Header().Get("Retry-After"), method)
+			var response models.ErrorResponse
+			assert.Nil(t, json.NewDecoder(w.Body).Decode(&response))
+			assert.Equal(t, models.ERR_MAINTENANCE, response.ErrorCode)
+			assert.Contains(t, response.Message, "database upgrade")
+		}
+		stored, err := logic.GetNodeByID(node.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, node.Name, stored.Name)
+	})
+	t.Run("NodeOperationsBlocked", func(t *testing.T) {
+		for _, route := range []struct{ method, path string }{
+			{http.MethodPost, "/api/nodes/skynet/approve"},
+			{http.MethodPost, "/api/nodes/skynet/" + node.ID + "/createrelay"},
+			{http.MethodDelete, "/api/nodes/skynet/" + node.ID + "/deleterelay"},
+			{http.MethodPost, "/api/nodes/skynet/" + node.ID + "/creategateway"},
+			{http.MethodDelete, "/api/nodes/skynet/" + node.ID + "/deletegateway"},
+			{http.MethodPost, "/api/nodes/skynet/" + node.ID + "/createingress"},
+			{http.MethodDelete, "/api/nodes/skynet/" + node.ID + "/deleteingress"},
+			{http.MethodPost, "/api/nodes/skynet/" + node.ID + "/drain"},
+			{http.MethodPost, "/api/nodes/skynet/" + node.ID + "/reassignip"},
+			{http.MethodPost, "/api/nodes/skynet/" + node.ID + "/move"},
+			{http.MethodPost, "/api/nodes/skynet/" + node.ID + "/rotatekeys"},
+			{http.MethodPost, "/api/nodes/skynet/" + node.ID + "/approve"},
+		} {
+			w := call(route.method, route.path, `{}`)
+			assert.Equal(t, http.StatusServiceUnavailable, w.Code, route.path)
+		}
+		stored, err := logic.GetNodeByID(node.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, node.Address, stored.Address)
+		assert.Equal(t, node.IsRelay, stored.IsRelay)
+	})
+	t.Run("ReadsAllowed", func(t *testing.T) {
+		for _, path := range []string{"/api/nodes", "/api/nodes/skynet", "/api/nodes/skynet/" + node.ID} {
+			w := call(http.MethodGet, path, "")
+			assert.Equal(t, http.StatusOK, w.Code, path)
+		}
+	})
+	t.Run("Disable", func(t *testing.T) {
+		w := call(http.MethodPut, "/api/server/maintenance", `{"enabled":false}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		w = call(http.MethodPut, "/api/nodes/skynet/"+node.ID, `{"name":"renamed"}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+	deleteAllNodes()
+	deleteAllNetworks()
+}
@@ -0,0 +1,122 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/gravitl/netmaker/database"
+	"github.com/gravitl/netmaker/logger"
+	"github.com/gravitl/netmaker/logic"
+	"github.com/gravitl/netmaker/logic/metrics"
+	"github.com/gravitl/netmaker/models"
+)
+
+// serviceAccountRoutes - the node routes a service account may call, keyed by method and path template
+var serviceAccountRoutes = map[string]string{
+	"GET /api/nodes/{network}":             models.SERVICE_ACCOUNT_READ_NODES,
+	"GET /api/nodes/{network}/{nodeid}":    models.SERVICE_ACCOUNT_READ_NODES,
+	"POST /api/nodes/{network}":            models.SERVICE_ACCOUNT_CREATE_NODES,
+	"PUT /api/nodes/{network}/{nodeid}":    models.SERVICE_ACCOUNT_UPDATE_NODES,
+	"PATCH /api/nodes/{network}/{nodeid}":  models.SERVICE_ACCOUNT_UPDATE_NODES,
+	"DELETE /api/nodes/{network}/{nodeid}": models.SERVICE_ACCOUNT_DELETE_NODES,
+}
+
+func serviceAccountHandlers(r *mux.Router) {
+	r.HandleFunc("/api/serviceaccounts", securityCheck(true, http.HandlerFunc(getServiceAccounts))).Methods("GET")
+	r.HandleFunc("/api/serviceaccounts", securityCheck(true, http.HandlerFunc(createServiceAccount))).Methods("POST")
+	r.HandleFunc("/api/serviceaccounts/{id}", securityCheck(true, http.HandlerFunc(deleteServiceAccount))).Methods("DELETE")
+}
+
+// authorizeServiceAccount - passes a service account token through when the route is one of
+// the account's operations on the account's network
+func authorizeServiceAccount(w http.ResponseWriter, r *http.Request, source, token string, next http.Handler) {
+	network := mux.Vars(r)["network"]
+	account, err := logic.VerifyServiceAccountToken(token)
+	if err != nil {
+		errorResponse := models.ErrorResponse{
+			Code: http.StatusUnauthorized, Message: "W1R3: Unauthorized, Invalid Token Processed.", ErrorCode: models.ERR_INVALID_AUTH_TOKEN,
+		}
+		metrics.RecordAuthFailure(source, network, errorResponse.ErrorCode)
+		returnErrorResponse(w, r, errorResponse)
+		return
+	}
+	if !logic.ServiceAccountAllows(&account, network, serviceAccountOperation(r)) {
+		errorResponse := models.ErrorResponse{
+			Code: http.StatusForbidden, Message: "W1R3: Service account may not perform this operation.", ErrorCode: models.ERR_FORBIDDEN,
+		}
+		metrics.RecordAuthFailure(source, network, errorResponse.ErrorCode)
+		returnErrorResponse(w, r, errorResponse)
+		return
+	}
+	r.Header.Set("user", "serviceaccount:"+account.Name)
+	r.Header.Set("serviceaccount", account.ID)
+	next.ServeHTTP(w, r)
+}
+
+// serviceAccountOperation - the service account operation of the matched route, empty if service accounts may not call it
+func serviceAccountOperation(r *http.Request) string {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return ""
+	}
+	template, err := route.GetPathTemplate()
+	if err != nil {
+		return ""
+	}
+	return serviceAccountRoutes[r.Method+" "+template]
+}
+
+func getServiceAccounts(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	accounts, err := logic.GetServiceAccounts()
+	if err != nil {
+		returnErrorResponse(w, r, formatError(err, "internal"))
+		return
+	}
+	logger.Log(2, r.Header.Get("user"), "fetched service accounts")
+	json.NewEncoder(w).Encode(accounts)
+}
+
+func createServiceAccount(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var account models.ServiceAccount
+	if err := json.NewDecoder(r.Body).Decode(&account); err != nil {
+		returnErrorResponse(w, r, formatErrorCode(err, "badrequest", models.ERR_INVALID_REQUEST))
+		return
+	}
+	created, err := logic.CreateServiceAccount(account)
+	if err != nil {
+		if database.IsEmptyRecord(err) {
+			returnErrorResponse(w, r, formatErrorCode(errors.New("network does not exist"), "notfound", models.ERR_NETWORK_NOT_FOUND))
+			return
+		}
+		if errors.Is(err, logic.ErrInvalidServiceAccount) {
+			returnErrorResponse(w, r, formatErrorCode(err, "badrequest", models.ERR_BAD_REQUEST))
+			return
+		}
+		returnErrorResponse(w, r, formatError(err, "internal"))
+		return
+	}
+	logger.Log(1, r.Header.Get("user"), "created service account", created.Name, created.ID, "on network", created.Network)
+	json.NewEncoder(w).Encode(created)
+}
+
+func deleteServiceAccount(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id := mux.Vars(r)["id"]
+	if err := logic.DeleteServiceAccount(id); err != nil {
+		if database.IsEmptyRecord(err) {
+			returnErrorResponse(w, r, formatErrorCode(errors.New("service account does not exist"), "notfound", models.ERR_NOT_FOUND))
+			return
+		}
+		returnErrorResponse(w, r, formatError(err, "internal"))
+		return
+	}
+	logger.Log(1, r.Header.Get("user"), "revoked service account", id)
+	returnSuccessResponse(w, r, id+" deleted.")
+}
@@ -0,0 +1,87 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/gravitl/netmaker/database"
+	"github.com/gravitl/netmaker/logic"
+	"github.com/gravitl/netmaker/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServiceAccounts(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	deleteAllNodes()
+	createNet()
+	_, err := logic.CreateNetwork(models.Network{NetID: "prodnet", AddressRange: "10.0.20.0/24"})
+	assert.Nil(t, err)
+	node := createTestNode()
+	router := mux.NewRouter()
+	nodeHandlers(router)
+	call := func(method, path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader("{}"))
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Invalid", func(t *testing.T) {
+		_, err := logic.CreateServiceAccount(models.ServiceAccount{Name: "ci", Network: "skynet"})
+		assert.ErrorIs(t, err, logic.ErrInvalidServiceAccount)
+		_, err = logic.CreateServiceAccount(models.ServiceAccount{Name: "ci", Network: "skynet", Operations: []string{"deletenetworks"}})
+		assert.ErrorIs(t, err, logic.ErrInvalidServiceAccount)
+		_, err = logic.CreateServiceAccount(models.ServiceAccount{Name: "ci", Network: "missingnet", Operations: []string{models.SERVICE_ACCOUNT_READ_NODES}})
+		assert.True(t, database.IsEmptyRecord(err))
+	})
+	account, err := logic.CreateServiceAccount(models.ServiceAccount{
+		Name:       "ci",
+		Network:    "skynet",
+		Operations: []string{models.SERVICE_ACCOUNT_READ_NODES, models.SERVICE_ACCOUNT_DELETE_NODES, models.SERVICE_ACCOUNT_READ_NODES},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{models.SERVICE_ACCOUNT_READ_NODES, models.SERVICE_ACCOUNT_DELETE_NODES}, account.Operations)
+	assert.Empty(t, account.TokenHash)
+	t.Run("List", func(t *testing.T) {
+		accounts, err := logic.GetServiceAccounts()
+		assert.Nil(t, err)
+		assert.Len(t, accounts, 1)
+		assert.Equal(t, account.ID, accounts[0].ID)
+		assert.Empty(t, accounts[0].TokenHash)
+	})
+	t.Run("AllowedOperation", func(t *testing.T) {
+		w := call(http.MethodGet, "/api/nodes/skynet", account.Token)
+		assert.Equal(t, http.StatusOK, w.Code)
+		w = call(http.MethodGet, "/api/nodes/skynet/"+node.ID, account.Token)
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+	t.Run("OtherNetwork", func(t *testing.T) {
+		w := call(http.MethodGet, "/api/nodes/prodnet", account.Token)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+	t.Run("OtherOperation", func(t *testing.T) {
+		w := call(http.MethodPut, "/api/nodes/skynet/"+node.ID, account.Token)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		w = call(http.MethodPost, "/api/nodes/skynet", account.Token)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		w = call(http.MethodGet, "/api/nodes", account.Token)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+	t.Run("WrongSecret", func(t *testing.T) {
+		w := call(http.MethodGet, "/api/nodes/skynet", account.Token[:len(account.Token)-1]+"x")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+	t.Run("Revoked", func(t *testing.T) {
+		assert.Nil(t, logic.DeleteServiceAccount(account.ID))
+		w := call(http.MethodGet, "/api/nodes/skynet", account.Token)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.True(t, database.IsEmptyRecord(logic.DeleteServiceAccount(account.ID)))
+	})
+	deleteAllNodes()
+	deleteAllNetworks()
+}
@@ -1,6 +1,7 @@
 package database
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/json"
 	"errors"
@@ -53,6 +54,21 @@ const GENERATED_TABLE_NAME = "generated"
 // NODE_ACLS_TABLE_NAME - stores the node ACL rules
 const NODE_ACLS_TABLE_NAME = "nodeacls"
 
+// IDEMPOTENCY_KEYS_TABLE_NAME - stores client supplied idempotency keys for node creation
+const IDEMPOTENCY_KEYS_TABLE_NAME = "idempotencykeys"
+
+// SERVICE_ACCOUNTS_TABLE_NAME - stores the network scoped service accounts
+const SERVICE_ACCOUNTS_TABLE_NAME = "serviceaccounts"
+
+// AUDIT_TABLE_NAME - stores the audit trail of node operations
+const AUDIT_TABLE_NAME = "audit"
+
+// PRESHARED_KEYS_TABLE_NAME - stores the secrets network preshared keys are derived from
+const PRESHARED_KEYS_TABLE_NAME = "presharedkeys"
+
+// METRICS_TABLE_NAME - stores the latest connectivity metrics each node reported of its peers
+const METRICS_TABLE_NAME = "metrics"
+
 // == ERROR CONSTS ==
 
 // NO_RECORD - no singular result found
@@ -84,9 +100,18 @@ const DELETE_ALL = "deleteall"
 // FETCH_ALL - fetch table contents const
 const FETCH_ALL = "fetchall"
 
+// FETCH_ALL_CONTEXT - fetch table contents, giving up when the context ends
+const FETCH_ALL_CONTEXT = "fetchallcontext"
+
 // CLOSE_DB - graceful close of db const
 const CLOSE_DB = "closedb"
 
+// PING - check db connectivity const
+const PING = "ping"
+
+// PING_TIMEOUT - seconds to wait for the db to answer a ping
+const PING_TIMEOUT = 5
+
 func getCurrentDB() map[string]interface{} {
 	switch servercfg.GetDB() {
 	case "rqlite":
@@ -131,12 +156,22 @@ func createTables() {
 	createTable(SERVER_UUID_TABLE_NAME)
 	createTable(GENERATED_TABLE_NAME)
 	createTable(NODE_ACLS_TABLE_NAME)
+	createTable(IDEMPOTENCY_KEYS_TABLE_NAME)
+	createTable(SERVICE_ACCOUNTS_TABLE_NAME)
+	createTable(AUDIT_TABLE_NAME)
+	createTable(PRESHARED_KEYS_TABLE_NAME)
+	createTable(METRICS_TABLE_NAME)
 }
 
 func createTable(tableName string) error {
 	return getCurrentDB()[CREATE_TABLE].(func(string) error)(tableName)
 }
 
+// Ping - checks that the database is reachable
+func Ping() error {
+	return getCurrentDB()[PING].(func() error)()
+}
+
 // IsJSONString - checks if valid json
 func IsJSONString(value string) bool {
 	var jsonInt interface{}
@@ -197,6 +232,11 @@ func FetchRecords(tableName string) (map[string]string, error) {
 	return getCurrentDB()[FETCH_ALL].(func(string) (map[string]string, error))(tableName)
 }
 
+// FetchRecordsContext - fetches all records in given table, returning the context's error once it is cancelled or times out
+func FetchRecordsContext(ctx context.Context, tableName string) (map[string]string, error) {
+	return getCurrentDB()[FETCH_ALL_CONTEXT].(func(context.Context, string) (map[string]string, error))(ctx, tableName)
+}
+
 // initializeUUID - create a UUID record for server if none exists
 func initializeUUID() error {
 	records, err := FetchRecords(SERVER_UUID_TABLE_NAME)
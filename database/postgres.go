@@ -1,9 +1,11 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/gravitl/netmaker/servercfg"
 	_ "github.com/lib/pq"
@@ -14,14 +16,16 @@ var PGDB *sql.DB
 
 // PG_FUNCTIONS - map of db functions for PostGreSQL
 var PG_FUNCTIONS = map[string]interface{}{
-	INIT_DB:      initPGDB,
-	CREATE_TABLE: pgCreateTable,
-	INSERT:       pgInsert,
-	INSERT_PEER:  pgInsertPeer,
-	DELETE:       pgDeleteRecord,
-	DELETE_ALL:   pgDeleteAllRecords,
-	FETCH_ALL:    pgFetchRecords,
-	CLOSE_DB:     pgCloseDB,
+	INIT_DB:           initPGDB,
+	CREATE_TABLE:      pgCreateTable,
+	INSERT:            pgInsert,
+	INSERT_PEER:       pgInsertPeer,
+	DELETE:            pgDeleteRecord,
+	DELETE_ALL:        pgDeleteAllRecords,
+	FETCH_ALL:         pgFetchRecords,
+	FETCH_ALL_CONTEXT: pgFetchRecordsContext,
+	CLOSE_DB:          pgCloseDB,
+	PING:              pgPing,
 }
 
 func getPGConnString() string {
@@ -114,7 +118,11 @@ func pgDeleteAllRecords(tableName string) error {
 }
 
 func pgFetchRecords(tableName string) (map[string]string, error) {
-	row, err := PGDB.Query("SELECT * FROM " + tableName + " ORDER BY key")
+	return pgFetchRecordsContext(context.Background(), tableName)
+}
+
+func pgFetchRecordsContext(ctx context.Context, tableName string) (map[string]string, error) {
+	row, err := PGDB.QueryContext(ctx, "SELECT * FROM "+tableName+" ORDER BY key")
 	if err != nil {
 		return nil, err
 	}
@@ -126,6 +134,10 @@ func pgFetchRecords(tableName string) (map[string]string, error) {
 		row.Scan(&key, &value)
 		records[key] = value
 	}
+	// a cancelled context ends the iteration early
+	if err = row.Err(); err != nil {
+		return nil, err
+	}
 	if len(records) == 0 {
 		return nil, errors.New(NO_RECORDS)
 	}
@@ -135,3 +147,9 @@ func pgFetchRecords(tableName string) (map[string]string, error) {
 func pgCloseDB() {
 	PGDB.Close()
 }
+
+func pgPing() error {
+	ctx, cancel := context.WithTimeout(context.Background(), PING_TIMEOUT*time.Second)
+	defer cancel()
+	return PGDB.PingContext(ctx)
+}
@@ -1,6 +1,7 @@
 package database
 
 import (
+	"context"
 	"errors"
 
 	"github.com/gravitl/netmaker/servercfg"
@@ -12,14 +13,16 @@ var RQliteDatabase gorqlite.Connection
 
 // RQLITE_FUNCTIONS - all the functions to run with rqlite
 var RQLITE_FUNCTIONS = map[string]interface{}{
-	INIT_DB:      initRqliteDatabase,
-	CREATE_TABLE: rqliteCreateTable,
-	INSERT:       rqliteInsert,
-	INSERT_PEER:  rqliteInsertPeer,
-	DELETE:       rqliteDeleteRecord,
-	DELETE_ALL:   rqliteDeleteAllRecords,
-	FETCH_ALL:    rqliteFetchRecords,
-	CLOSE_DB:     rqliteCloseDB,
+	INIT_DB:           initRqliteDatabase,
+	CREATE_TABLE:      rqliteCreateTable,
+	INSERT:            rqliteInsert,
+	INSERT_PEER:       rqliteInsertPeer,
+	DELETE:            rqliteDeleteRecord,
+	DELETE_ALL:        rqliteDeleteAllRecords,
+	FETCH_ALL:         rqliteFetchRecords,
+	FETCH_ALL_CONTEXT: rqliteFetchRecordsContext,
+	CLOSE_DB:          rqliteCloseDB,
+	PING:              rqlitePing,
 }
 
 func initRqliteDatabase() error {
@@ -94,6 +97,18 @@ func rqliteFetchRecord(tableName string, key string) (string, error) {
 	return results[key], nil
 }
 
+// rqliteFetchRecordsContext - gorqlite can not cancel a query, so the context is only checked around it
+func rqliteFetchRecordsContext(ctx context.Context, tableName string) (map[string]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	records, err := rqliteFetchRecords(tableName)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, ctxErr
+	}
+	return records, err
+}
+
 func rqliteFetchRecords(tableName string) (map[string]string, error) {
 	row, err := RQliteDatabase.QueryOne("SELECT * FROM " + tableName + " ORDER BY key")
 	if err != nil {
@@ -115,3 +130,11 @@ func rqliteFetchRecords(tableName string) (map[string]string, error) {
 func rqliteCloseDB() {
 	RQliteDatabase.Close()
 }
+
+func rqlitePing() error {
+	result, err := RQliteDatabase.QueryOne("SELECT 1")
+	if err != nil {
+		return err
+	}
+	return result.Err
+}
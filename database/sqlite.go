@@ -1,10 +1,12 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"os"
 	"path/filepath"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3" // need to blank import this package
 )
@@ -17,14 +19,16 @@ var SqliteDB *sql.DB
 
 // SQLITE_FUNCTIONS - contains a map of the functions for sqlite
 var SQLITE_FUNCTIONS = map[string]interface{}{
-	INIT_DB:      initSqliteDB,
-	CREATE_TABLE: sqliteCreateTable,
-	INSERT:       sqliteInsert,
-	INSERT_PEER:  sqliteInsertPeer,
-	DELETE:       sqliteDeleteRecord,
-	DELETE_ALL:   sqliteDeleteAllRecords,
-	FETCH_ALL:    sqliteFetchRecords,
-	CLOSE_DB:     sqliteCloseDB,
+	INIT_DB:           initSqliteDB,
+	CREATE_TABLE:      sqliteCreateTable,
+	INSERT:            sqliteInsert,
+	INSERT_PEER:       sqliteInsertPeer,
+	DELETE:            sqliteDeleteRecord,
+	DELETE_ALL:        sqliteDeleteAllRecords,
+	FETCH_ALL:         sqliteFetchRecords,
+	FETCH_ALL_CONTEXT: sqliteFetchRecordsContext,
+	CLOSE_DB:          sqliteCloseDB,
+	PING:              sqlitePing,
 }
 
 func initSqliteDB() error {
@@ -114,7 +118,11 @@ func sqliteDeleteAllRecords(tableName string) error {
 }
 
 func sqliteFetchRecords(tableName string) (map[string]string, error) {
-	row, err := SqliteDB.Query("SELECT * FROM " + tableName + " ORDER BY key")
+	return sqliteFetchRecordsContext(context.Background(), tableName)
+}
+
+func sqliteFetchRecordsContext(ctx context.Context, tableName string) (map[string]string, error) {
+	row, err := SqliteDB.QueryContext(ctx, "SELECT * FROM "+tableName+" ORDER BY key")
 	if err != nil {
 		return nil, err
 	}
@@ -126,6 +134,10 @@ func sqliteFetchRecords(tableName string) (map[string]string, error) {
 		row.Scan(&key, &value)
 		records[key] = value
 	}
+	// a cancelled context ends the iteration early
+	if err = row.Err(); err != nil {
+		return nil, err
+	}
 	if len(records) == 0 {
 		return nil, errors.New(NO_RECORDS)
 	}
@@ -135,3 +147,9 @@ func sqliteFetchRecords(tableName string) (map[string]string, error) {
 func sqliteCloseDB() {
 	SqliteDB.Close()
 }
+
+func sqlitePing() error {
+	ctx, cancel := context.WithTimeout(context.Background(), PING_TIMEOUT*time.Second)
+	defer cancel()
+	return SqliteDB.PingContext(ctx)
+}
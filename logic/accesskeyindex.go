@@ -0,0 +1,90 @@
+package logic
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"sync"
+	"time"
+
+	"github.com/gravitl/netmaker/database"
+	"github.com/gravitl/netmaker/models"
+)
+
+// ACCESS_KEY_INDEX_REFRESH - least seconds between rebuilds of the access key index on a miss,
+// keys created by another server are found after at most this long
+const ACCESS_KEY_INDEX_REFRESH = 10
+
+var (
+	// accessKeyIndex - the network of every access key by the sha256 of its value, nil until built
+	accessKeyIndex      map[[sha256.Size]byte]string
+	accessKeyIndexBuilt time.Time
+	accessKeyIndexMutex sync.Mutex
+)
+
+// FindAccessKey - the usable access key with the given value and its network, the index only points
+// at a network, the key itself is compared in constant time against the stored network
+func FindAccessKey(value string) (models.AccessKey, string, bool) {
+	hash := sha256.Sum256([]byte(value))
+	network, ok := lookupAccessKeyIndex(hash)
+	if !ok {
+		return models.AccessKey{}, "", false
+	}
+	parent, err := GetParentNetwork(network)
+	if err != nil {
+		return models.AccessKey{}, "", false
+	}
+	for _, key := range parent.AccessKeys {
+		keyHash := sha256.Sum256([]byte(key.Value))
+		if subtle.ConstantTimeCompare(keyHash[:], hash[:]) == 1 && key.IsUsable() {
+			return key, parent.NetID, true
+		}
+	}
+	return models.AccessKey{}, "", false
+}
+
+// invalidateAccessKeyIndex - drops the index so the next lookup rebuilds it, called whenever keys are added
+func invalidateAccessKeyIndex() {
+	accessKeyIndexMutex.Lock()
+	defer accessKeyIndexMutex.Unlock()
+	accessKeyIndex = nil
+}
+
+// lookupAccessKeyIndex - the network holding a key hash, misses rebuild a stale index at most once per
+// ACCESS_KEY_INDEX_REFRESH so unknown keys cannot force a scan of every network
+func lookupAccessKeyIndex(hash [sha256.Size]byte) (string, bool) {
+	accessKeyIndexMutex.Lock()
+	defer accessKeyIndexMutex.Unlock()
+	if accessKeyIndex != nil {
+		if network, ok := accessKeyIndex[hash]; ok {
+			return network, true
+		}
+		if time.Since(accessKeyIndexBuilt) < ACCESS_KEY_INDEX_REFRESH*time.Second {
+			return "", false
+		}
+	}
+	index, err := buildAccessKeyIndex()
+	if err != nil {
+		return "", false
+	}
+	accessKeyIndex = index
+	accessKeyIndexBuilt = time.Now()
+	network, ok := accessKeyIndex[hash]
+	return network, ok
+}
+
+func buildAccessKeyIndex() (map[[sha256.Size]byte]string, error) {
+	index := make(map[[sha256.Size]byte]string)
+	networks, err := GetNetworks()
+	if err != nil {
+		if database.IsEmptyRecord(err) {
+			return index, nil
+		}
+		return nil, err
+	}
+	for _, network := range networks {
+		for _, key := range network.AccessKeys {
+			index[sha256.Sum256([]byte(key.Value))] = network.NetID
+		}
+	}
+	return index, nil
+}
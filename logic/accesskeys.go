@@ -2,9 +2,12 @@ package logic
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"math/big"
 	"strings"
 	"sync"
@@ -20,6 +23,12 @@ const (
 	charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
 )
 
+// ErrAccessKeyNotFound - the network has no access key with the given name
+var ErrAccessKeyNotFound = errors.New("access key not found")
+
+// ErrAccessKeyUnusable - the access key is missing, expired or used up by the time a use is taken from it
+var ErrAccessKeyUnusable = errors.New("access key can not be used")
+
 // CreateAccessKey - create access key
 func CreateAccessKey(accesskey models.AccessKey, network models.Network) (models.AccessKey, error) {
 
@@ -33,6 +42,16 @@ func CreateAccessKey(accesskey models.AccessKey, network models.Network) (models
 	if accesskey.Uses == 0 {
 		accesskey.Uses = 1
 	}
+	if accesskey.IsExpired() {
+		return models.AccessKey{}, errors.New("access key expiration must be in the future")
+	}
+	if accesskey.PublicKey != "" {
+		if _, err := parseAccessKeyPublicKey(accesskey.PublicKey); err != nil {
+			return models.AccessKey{}, err
+		}
+	} else if network.AsymmetricKeys == "yes" {
+		return models.AccessKey{}, errors.New("network " + network.NetID + " requires access keys with an ed25519 public key")
+	}
 
 	checkkeys, err := GetKeys(network.NetID)
 	if err != nil {
@@ -83,10 +102,59 @@ func CreateAccessKey(accesskey models.AccessKey, network models.Network) (models
 	if err = database.Insert(network.NetID, string(data), database.NETWORKS_TABLE_NAME); err != nil {
 		return models.AccessKey{}, err
 	}
+	invalidateAccessKeyIndex()
 
 	return accesskey, nil
 }
 
+// HashAccessKey - hex sha256 of an access key value, nodes keep it in place of the key they enrolled with
+func HashAccessKey(value string) string {
+	hash := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(hash[:])
+}
+
+// GetAccessKeyName - name of the access key with the given value, the earliest of the keys sharing the
+// value as CheckNetworkAccessKey decides by it, empty when the network has no such key
+func GetAccessKeyName(network *models.Network, keyvalue string) string {
+	for _, key := range network.AccessKeys {
+		if key.Value == keyvalue {
+			return key.Name
+		}
+	}
+	return ""
+}
+
+// GetAccessKeyNodes - nodes of a network that enrolled with the named access key, matched on the key name and
+// hash stored on each node so keys that were used up or deleted can still be audited; while the key exists
+// nodes of an earlier key of the same name are left out
+func GetAccessKeyNodes(netname, keyname string) ([]models.Node, error) {
+	network, err := GetParentNetwork(netname)
+	if err != nil {
+		return nil, err
+	}
+	var keyHash string
+	for _, key := range network.AccessKeys {
+		if key.Name == keyname {
+			keyHash = HashAccessKey(key.Value)
+			break
+		}
+	}
+	nodes, err := GetNetworkNodes(netname)
+	if err != nil {
+		return nil, err
+	}
+	var enrolled = []models.Node{}
+	for _, node := range nodes {
+		if node.AccessKeyName == keyname && (keyHash == "" || node.AccessKeyHash == keyHash) {
+			enrolled = append(enrolled, node)
+		}
+	}
+	if len(enrolled) == 0 && keyHash == "" {
+		return nil, fmt.Errorf("%w: %s", ErrAccessKeyNotFound, keyname)
+	}
+	return enrolled, nil
+}
+
 // DeleteKey - deletes a key
 func DeleteKey(keyname, netname string) error {
 	network, err := GetParentNetwork(netname)
@@ -133,14 +201,20 @@ func GetKeys(net string) ([]models.AccessKey, error) {
 	return network.AccessKeys, nil
 }
 
-// DecrimentKey - decriments key uses
-func DecrimentKey(networkName string, keyvalue string) {
+// DecrimentKey - decriments key uses, exhausted and expired keys are removed, fails without taking a use
+// when the key is no longer valid, an empty key only removes the expired ones
+func DecrimentKey(networkName string, keyvalue string) error {
 
 	var network models.Network
 
 	network, err := GetParentNetwork(networkName)
 	if err != nil {
-		return
+		return err
+	}
+	if keyvalue != "" {
+		if validation := CheckNetworkAccessKey(&network, keyvalue); !validation.Valid {
+			return fmt.Errorf("%w: %s", ErrAccessKeyUnusable, strings.ToLower(validation.Reason))
+		}
 	}
 
 	for i := len(network.AccessKeys) - 1; i >= 0; i-- {
@@ -155,41 +229,58 @@ func DecrimentKey(networkName string, keyvalue string) {
 			}
 		}
 	}
+	var unexpired = []models.AccessKey{}
+	for _, key := range network.AccessKeys {
+		if !key.IsExpired() {
+			unexpired = append(unexpired, key)
+		}
+	}
+	network.AccessKeys = unexpired
 
-	if newNetworkData, err := json.Marshal(&network); err != nil {
+	newNetworkData, err := json.Marshal(&network)
+	if err != nil {
 		logger.Log(2, "failed to decrement key")
-		return
-	} else {
-		database.Insert(network.NetID, string(newNetworkData), database.NETWORKS_TABLE_NAME)
+		return err
 	}
+	return database.Insert(network.NetID, string(newNetworkData), database.NETWORKS_TABLE_NAME)
 }
 
 // IsKeyValid - check if key is valid
 func IsKeyValid(networkname string, keyvalue string) bool {
+	validation, err := CheckAccessKey(networkname, keyvalue)
+	return err == nil && validation.Valid
+}
 
+// CheckAccessKey - whether a node joining a network with the key would be accepted, without using the key up
+func CheckAccessKey(networkname string, keyvalue string) (models.AccessKeyValidation, error) {
 	network, err := GetParentNetwork(networkname)
 	if err != nil {
-		return false
+		return models.AccessKeyValidation{}, err
 	}
-	accesskeys := network.AccessKeys
-
-	var key models.AccessKey
-	foundkey := false
-	isvalid := false
+	return CheckNetworkAccessKey(&network, keyvalue), nil
+}
 
+// CheckNetworkAccessKey - CheckAccessKey for a network the caller already read
+func CheckNetworkAccessKey(network *models.Network, keyvalue string) models.AccessKeyValidation {
+	validation := models.AccessKeyValidation{Network: network.NetID, Reason: models.ACCESS_KEY_NOT_FOUND}
+	accesskeys := network.AccessKeys
 	for i := len(accesskeys) - 1; i >= 0; i-- {
-		currentkey := accesskeys[i]
-		if currentkey.Value == keyvalue {
-			key = currentkey
-			foundkey = true
+		key := accesskeys[i]
+		if key.Value != keyvalue {
+			continue
 		}
-	}
-	if foundkey {
-		if key.Uses > 0 {
-			isvalid = true
+		// the earliest of the keys sharing the value decides
+		switch {
+		case key.IsExpired():
+			validation.Reason = models.ACCESS_KEY_EXPIRED
+		case !key.IsUsable():
+			validation.Reason = models.ACCESS_KEY_USED_UP
+		default:
+			validation.Valid = true
+			validation.Reason = ""
 		}
 	}
-	return isvalid
+	return validation
 }
 
 // RemoveKeySensitiveInfo - remove sensitive key info
@@ -0,0 +1,215 @@
+package logic
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"sync"
+
+	"github.com/c-robinson/iplib"
+	"github.com/gravitl/netmaker/database"
+	"github.com/gravitl/netmaker/models"
+)
+
+// AddressExhaustedError - returned when every address of a network's range is taken
+type AddressExhaustedError struct {
+	Utilization models.AddressUtilization
+	IPv6        bool
+}
+
+// AddressExhaustedError.Error - names the full range and how many addresses it holds
+func (e *AddressExhaustedError) Error() string {
+	if e.IPv6 {
+		return fmt.Sprintf("network %s is full, all %s addresses of %s are in use", e.Utilization.Network, e.Utilization.Total6, e.Utilization.AddressRange6)
+	}
+	return fmt.Sprintf("network %s is full, all %d addresses of %s are in use", e.Utilization.Network, e.Utilization.Total, e.Utilization.AddressRange)
+}
+
+// ErrInvalidAddressRange - returned when a requested address range is not a sub range of the network
+var ErrInvalidAddressRange = errors.New("address range must be a CIDR within the network's address range")
+
+// RequestedRangeExhaustedError - returned when every address of the sub range a node asked for is taken
+type RequestedRangeExhaustedError struct {
+	Network      string
+	AddressRange string
+}
+
+// RequestedRangeExhaustedError.Error - names the exhausted sub range
+func (e *RequestedRangeExhaustedError) Error() string {
+	return fmt.Sprintf("all addresses of %s on network %s are in use", e.AddressRange, e.Network)
+}
+
+var (
+	// networkAddressLocks - one lock per network, held from picking a free address until it is saved
+	// so concurrent joins cannot be handed the same address
+	networkAddressLocks      = make(map[string]*sync.Mutex)
+	networkAddressLocksMutex sync.Mutex
+)
+
+// lockNetworkAddresses - takes the address lock of a network, the returned func releases it
+func lockNetworkAddresses(network string) func() {
+	networkAddressLocksMutex.Lock()
+	lock, ok := networkAddressLocks[network]
+	if !ok {
+		lock = &sync.Mutex{}
+		networkAddressLocks[network] = lock
+	}
+	networkAddressLocksMutex.Unlock()
+	lock.Lock()
+	return lock.Unlock
+}
+
+// GetAddressUtilization - counts the assignable addresses of a network's ranges and how many of them are held
+func GetAddressUtilization(networkName string) (models.AddressUtilization, error) {
+	network, err := GetParentNetwork(networkName)
+	if err != nil {
+		return models.AddressUtilization{}, err
+	}
+	utilization := models.AddressUtilization{
+		Network:       network.NetID,
+		AddressRange:  network.AddressRange,
+		AddressRange6: network.AddressRange6,
+	}
+	var used4, used6 map[string]bool
+	if _, _, err := net.ParseCIDR(network.AddressRange); err == nil {
+		net4 := iplib.Net4FromStr(network.AddressRange)
+		utilization.Total = uint64(net4.Count())
+		used4 = getUsedAddresses(network.NetID, net4.FirstAddress(), net4.LastAddress(), false)
+	}
+	if _, _, err := net.ParseCIDR(network.AddressRange6); err == nil {
+		net6 := iplib.Net6FromStr(network.AddressRange6)
+		utilization.Total6 = net6.Count().String()
+		used6 = getUsedAddresses(network.NetID, net6.FirstAddress(), net6.LastAddress(), true)
+	}
+	utilization.Used = len(used4)
+	utilization.Used6 = len(used6)
+	return utilization, nil
+}
+
+// checkAddressCapacity - errors with the network's utilization when a range a new node needs an address from is full
+func checkAddressCapacity(networkName string, needsIPv4, needsIPv6 bool) error {
+	if !needsIPv4 && !needsIPv6 {
+		return nil
+	}
+	utilization, err := GetAddressUtilization(networkName)
+	if err != nil {
+		return err
+	}
+	if needsIPv4 && utilization.AddressRange != "" && uint64(utilization.Used) >= utilization.Total {
+		return &AddressExhaustedError{Utilization: utilization}
+	}
+	if needsIPv6 && utilization.Total6 != "" {
+		total6, ok := new(big.Int).SetString(utilization.Total6, 10)
+		if ok && big.NewInt(int64(utilization.Used6)).Cmp(total6) >= 0 {
+			return &AddressExhaustedError{Utilization: utilization, IPv6: true}
+		}
+	}
+	return nil
+}
+
+// addressExhausted - the error returned once address assignment has tried every address of a range
+func addressExhausted(networkName string, ipv6 bool) error {
+	utilization, err := GetAddressUtilization(networkName)
+	if err != nil {
+		return err
+	}
+	return &AddressExhaustedError{Utilization: utilization, IPv6: ipv6}
+}
+
+// getUsedAddresses - the distinct addresses between first and last held by the nodes, deleted nodes and ext clients of a network
+func getUsedAddresses(network string, first, last net.IP, isIpv6 bool) map[string]bool {
+	used := make(map[string]bool)
+	for _, table := range []string{database.NODES_TABLE_NAME, database.DELETED_NODES_TABLE_NAME, database.EXT_CLIENT_TABLE_NAME} {
+		collection, err := database.FetchRecords(table)
+		if err != nil {
+			continue
+		}
+		for _, value := range collection {
+			// ext clients share the network and address fields of nodes
+			var node models.Node
+			if err = json.Unmarshal([]byte(value), &node); err != nil || node.Network != network {
+				continue
+			}
+			address := node.Address
+			if isIpv6 {
+				address = node.Address6
+			}
+			ip := net.ParseIP(address)
+			if ip == nil || iplib.CompareIPs(ip, first) < 0 || iplib.CompareIPs(ip, last) > 0 {
+				continue
+			}
+			used[ip.String()] = true
+		}
+	}
+	return used
+}
+
+// parseRequestedAddressRange - the sub range a node asked for, returned as the ipv4 or the ipv6 range
+// depending on its family, it must lie within the network's range of that family
+func parseRequestedAddressRange(network *models.Network, addressRange string) (*net.IPNet, *net.IPNet, error) {
+	if addressRange == "" {
+		return nil, nil, nil
+	}
+	_, requested, err := net.ParseCIDR(addressRange)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %s", ErrInvalidAddressRange, addressRange)
+	}
+	isIpv6 := requested.IP.To4() == nil
+	networkRange := network.AddressRange
+	if isIpv6 {
+		networkRange = network.AddressRange6
+	}
+	_, parent, err := net.ParseCIDR(networkRange)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %s", ErrInvalidAddressRange, addressRange)
+	}
+	parentOnes, parentBits := parent.Mask.Size()
+	ones, bits := requested.Mask.Size()
+	if bits != parentBits || ones < parentOnes || !parent.Contains(requested.IP) {
+		return nil, nil, fmt.Errorf("%w: %s is not within %s", ErrInvalidAddressRange, addressRange, networkRange)
+	}
+	if isIpv6 {
+		return nil, requested, nil
+	}
+	return requested, nil, nil
+}
+
+// uniqueAddressInRange - the first free address of a requested sub range, limited to the addresses
+// the network's range hands out
+func uniqueAddressInRange(network *models.Network, requested *net.IPNet, isIpv6 bool) (string, error) {
+	var first, last net.IP
+	if isIpv6 {
+		net6 := iplib.Net6FromStr(network.AddressRange6)
+		first, last = net6.FirstAddress(), net6.LastAddress()
+	} else {
+		net4 := iplib.Net4FromStr(network.AddressRange)
+		first, last = net4.FirstAddress(), net4.LastAddress()
+	}
+	start := requested.IP
+	end := make(net.IP, len(requested.IP))
+	for i := range requested.IP {
+		end[i] = requested.IP[i] | ^requested.Mask[i]
+	}
+	if iplib.CompareIPs(start, first) < 0 {
+		start = first
+	}
+	if iplib.CompareIPs(end, last) > 0 {
+		end = last
+	}
+	exhausted := &RequestedRangeExhaustedError{Network: network.NetID, AddressRange: requested.String()}
+	if iplib.CompareIPs(start, end) > 0 {
+		return "", exhausted
+	}
+	used := getUsedAddresses(network.NetID, start, end, isIpv6)
+	for ip := start; ; ip = iplib.NextIP(ip) {
+		if !used[ip.String()] {
+			return ip.String(), nil
+		}
+		// stop at the end rather than past it, the next address of the last ip wraps around
+		if ip.Equal(end) {
+			return "", exhausted
+		}
+	}
+}
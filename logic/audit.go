@@ -0,0 +1,145 @@
+package logic
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gravitl/netmaker/database"
+	"github.com/gravitl/netmaker/logger"
+	"github.com/gravitl/netmaker/models"
+)
+
+// auditIgnoredFields - node fields left out of audit diffs, they are secret or change on every check in
+var auditIgnoredFields = map[string]bool{
+	"password":        true,
+	"accesskey":       true,
+	"accesskeyhash":   true,
+	"lastmodified":    true,
+	"lastcheckin":     true,
+	"lastpeerupdate":  true,
+	"resourceversion": true,
+}
+
+// RecordNodeAudit - records a node operation in the background so the request is never held up,
+// before is nil for created nodes and after is nil for deleted nodes
+func RecordNodeAudit(user, action string, before, after *models.Node) {
+	entry, err := newNodeAuditEntry(user, action, before, after)
+	if err != nil {
+		logger.Log(0, "failed to build audit entry", action, "by", user, err.Error())
+		return
+	}
+	go func() {
+		if err := saveAuditEntry(&entry); err != nil {
+			logger.Log(0, "failed to record audit entry", entry.Action, "by", entry.User, "on node", entry.NodeID, err.Error())
+		}
+	}()
+}
+
+// GetAuditEntries - the audit trail in the order it was written, optionally limited to a network,
+// a node and the entries at or after since
+func GetAuditEntries(network, nodeid string, since int64) ([]models.AuditEntry, error) {
+	entries := []models.AuditEntry{}
+	collection, err := database.FetchRecords(database.AUDIT_TABLE_NAME)
+	if err != nil {
+		if database.IsEmptyRecord(err) {
+			return entries, nil
+		}
+		return entries, err
+	}
+	for _, value := range collection {
+		var entry models.AuditEntry
+		if err := json.Unmarshal([]byte(value), &entry); err != nil {
+			continue
+		}
+		if (network != "" && entry.Network != network) || (nodeid != "" && entry.NodeID != nodeid) || entry.Timestamp < since {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ID < entries[j].ID
+	})
+	return entries, nil
+}
+
+// == private ==
+
+func newNodeAuditEntry(user, action string, before, after *models.Node) (models.AuditEntry, error) {
+	node := after
+	if node == nil {
+		node = before
+	}
+	if user == "" {
+		user = "(user not found)"
+	}
+	changes, err := diffAuditNodes(before, after)
+	if err != nil {
+		return models.AuditEntry{}, err
+	}
+	now := time.Now()
+	return models.AuditEntry{
+		// ids sort in the order entries were made
+		ID:        fmt.Sprintf("%020d-%s", now.UnixNano(), uuid.NewString()),
+		User:      user,
+		Network:   node.Network,
+		NodeID:    node.ID,
+		Action:    action,
+		Timestamp: now.Unix(),
+		Changes:   changes,
+	}, nil
+}
+
+func saveAuditEntry(entry *models.AuditEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return database.Insert(entry.ID, string(data), database.AUDIT_TABLE_NAME)
+}
+
+// diffAuditNodes - the fields that differ between two versions of a node, sorted by field, a missing node diffs as empty
+func diffAuditNodes(before, after *models.Node) ([]models.AuditChange, error) {
+	oldFields, err := auditNodeFields(before)
+	if err != nil {
+		return nil, err
+	}
+	newFields, err := auditNodeFields(after)
+	if err != nil {
+		return nil, err
+	}
+	var fields []string
+	for field := range oldFields {
+		fields = append(fields, field)
+	}
+	for field := range newFields {
+		if _, ok := oldFields[field]; !ok {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+	changes := []models.AuditChange{}
+	for _, field := range fields {
+		if auditIgnoredFields[field] || reflect.DeepEqual(oldFields[field], newFields[field]) {
+			continue
+		}
+		changes = append(changes, models.AuditChange{Field: field, Old: oldFields[field], New: newFields[field]})
+	}
+	return changes, nil
+}
+
+func auditNodeFields(node *models.Node) (map[string]interface{}, error) {
+	if node == nil {
+		node = &models.Node{}
+	}
+	data, err := json.Marshal(node)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]interface{}
+	err = json.Unmarshal(data, &fields)
+	return fields, err
+}
@@ -0,0 +1,40 @@
+package logic
+
+import (
+	"testing"
+
+	"github.com/gravitl/netmaker/models"
+)
+
+func TestDiffAuditNodes(t *testing.T) {
+	before := models.Node{ID: "node", Network: "skynet", Name: "node", Password: "secret", LastModified: 1, EgressGatewayRanges: []string{"10.100.0.0/16"}}
+	after := before
+	after.Name = "renamed"
+	after.Password = "rotated"
+	after.LastModified = 2
+	after.EgressGatewayRanges = []string{"10.100.0.0/16", "10.200.0.0/16"}
+
+	changes, err := diffAuditNodes(&before, &after)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 2 || changes[0].Field != "egressgatewayranges" || changes[1].Field != "name" {
+		t.Fatalf("expected egressgatewayranges and name to change, got %+v", changes)
+	}
+	if changes[1].Old != "node" || changes[1].New != "renamed" {
+		t.Fatalf("expected name change from node to renamed, got %+v", changes[1])
+	}
+
+	changes, err = diffAuditNodes(&before, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, change := range changes {
+		if change.Field == "password" {
+			t.Fatal("expected password to be left out of the diff")
+		}
+	}
+	if len(changes) == 0 {
+		t.Fatal("expected a deleted node to diff against an empty node")
+	}
+}
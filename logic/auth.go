@@ -85,6 +85,12 @@ func CreateUser(user models.User) (models.User, error) {
 	if err != nil {
 		return models.User{}, err
 	}
+	if user.IsAdmin && user.Role == models.USER_ROLE_READ_ONLY {
+		return models.User{}, errors.New("admin users can not be read-only")
+	}
+	if user.IsAdmin && user.Role == models.USER_ROLE_NETWORK_ADMIN {
+		return models.User{}, errors.New("admin users can not be network admins")
+	}
 
 	// encrypt that password so we never see it again
 	hash, err := bcrypt.GenerateFromPassword([]byte(user.Password), 5)
@@ -164,6 +170,7 @@ func UpdateUserNetworks(newNetworks []string, isadmin bool, currentUser *models.
 	if isadmin {
 		currentUser.IsAdmin = true
 		currentUser.Networks = nil
+		currentUser.Role = ""
 	} else {
 		currentUser.Networks = newNetworks
 	}
@@ -175,6 +182,7 @@ func UpdateUserNetworks(newNetworks []string, isadmin bool, currentUser *models.
 	if err = database.Insert(currentUser.UserName, string(data), database.USERS_TABLE_NAME); err != nil {
 		return err
 	}
+	InvalidateUserTokens(currentUser.UserName)
 
 	return nil
 }
@@ -221,6 +229,7 @@ func UpdateUser(userchange models.User, user models.User) (models.User, error) {
 	if err = database.Insert(user.UserName, string(data), database.USERS_TABLE_NAME); err != nil {
 		return models.User{}, err
 	}
+	InvalidateUserTokens(queryUser)
 	logger.Log(1, "updated user", queryUser)
 	return user, nil
 }
@@ -251,6 +260,7 @@ func DeleteUser(user string) (bool, error) {
 	if err != nil {
 		return false, err
 	}
+	InvalidateUserTokens(user)
 	return true, nil
 }
 
@@ -2,6 +2,7 @@ package logic
 
 import (
 	"encoding/json"
+	"net"
 	"os"
 
 	"github.com/go-playground/validator/v10"
@@ -110,6 +111,84 @@ func GetCustomDNS(network string) ([]models.DNSEntry, error) {
 	return dns, err
 }
 
+// GetNodeDNSRecords - the records SetDNS writes that resolve to a node, its own and those of custom entries
+// pointing at it, at ext clients of its ingress gateway or into its egress ranges,
+// only the ipv4 address of node entries is written as a name holds one address in the hosts file
+func GetNodeDNSRecords(node *models.Node) ([]models.DNSRecord, error) {
+	records := []models.DNSRecord{}
+	if record, ok := dnsRecord(models.DNSEntry{Name: node.Name, Network: node.Network, Address: node.Address}, models.DNS_SOURCE_NODE); ok {
+		records = append(records, record)
+	}
+	customdns, err := GetCustomDNS(node.Network)
+	if err != nil && !database.IsEmptyRecord(err) {
+		return nil, err
+	}
+	extClientAddresses := make(map[string]bool)
+	if node.IsIngressGateway == "yes" {
+		extclients, err := GetNetworkExtClients(node.Network)
+		if err != nil && !database.IsEmptyRecord(err) {
+			return nil, err
+		}
+		for _, extclient := range extclients {
+			if extclient.IngressGatewayID == node.ID {
+				extClientAddresses[extclient.Address] = true
+				extClientAddresses[extclient.Address6] = true
+			}
+		}
+		delete(extClientAddresses, "")
+	}
+	var egressRanges []*net.IPNet
+	if node.IsEgressGateway == "yes" {
+		for _, egressRange := range node.EgressGatewayRanges {
+			if _, cidr, err := net.ParseCIDR(egressRange); err == nil {
+				egressRanges = append(egressRanges, cidr)
+			}
+		}
+	}
+	for _, entry := range customdns {
+		source := ""
+		switch ip := net.ParseIP(entry.Address); {
+		case ip == nil:
+		case entry.Address == node.Address || entry.Address == node.Address6:
+			source = models.DNS_SOURCE_CUSTOM
+		case extClientAddresses[entry.Address]:
+			source = models.DNS_SOURCE_EXT_CLIENT
+		default:
+			for _, cidr := range egressRanges {
+				if cidr.Contains(ip) {
+					source = models.DNS_SOURCE_EGRESS
+					break
+				}
+			}
+		}
+		if source == "" {
+			continue
+		}
+		if record, ok := dnsRecord(entry, source); ok {
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+// dnsRecord - the hosts file record of an entry, SetDNS writes the entry's address under its name and network
+func dnsRecord(entry models.DNSEntry, source string) (models.DNSRecord, bool) {
+	ip := net.ParseIP(entry.Address)
+	if ip == nil || entry.Name == "" {
+		return models.DNSRecord{}, false
+	}
+	recordType := "A"
+	if ip.To4() == nil {
+		recordType = "AAAA"
+	}
+	return models.DNSRecord{
+		Name:    entry.Name + "." + entry.Network,
+		Type:    recordType,
+		Address: ip.String(),
+		Source:  source,
+	}, true
+}
+
 // SetCorefile - sets the core file of the system
 func SetCorefile(domains string) error {
 	dir, err := os.Getwd()
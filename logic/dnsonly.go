@@ -0,0 +1,36 @@
+package logic
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gravitl/netmaker/models"
+)
+
+// ErrDNSOnlyNode - a dns only node has no tunnel, so it cannot be a gateway, a relay or relayed
+var ErrDNSOnlyNode = errors.New("dns only nodes cannot be gateways, relays or relayed")
+
+// checkDNSOnlyRoles - refuses a dns only node that also holds a gateway or relay role
+func checkDNSOnlyRoles(node *models.Node) error {
+	if node.IsDNSOnly != "yes" {
+		return nil
+	}
+	var roles []string
+	if node.IsEgressGateway == "yes" {
+		roles = append(roles, "egress gateway")
+	}
+	if node.IsIngressGateway == "yes" {
+		roles = append(roles, "ingress gateway")
+	}
+	if node.IsRelay == "yes" {
+		roles = append(roles, "relay")
+	}
+	if node.IsRelayed == "yes" {
+		roles = append(roles, "relayed")
+	}
+	if len(roles) > 0 {
+		return fmt.Errorf("%w: %s is %s", ErrDNSOnlyNode, node.Name, strings.Join(roles, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package logic
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/gravitl/netmaker/database"
+	"github.com/gravitl/netmaker/models"
+	"github.com/gravitl/netmaker/servercfg"
+)
+
+// DrainNode - marks a node as draining so peers stop routing through it before it is deleted
+func DrainNode(nodeid string) (models.Node, error) {
+	node, err := GetNodeByID(nodeid)
+	if err != nil {
+		return models.Node{}, err
+	}
+	if node.IsServer == "yes" {
+		return models.Node{}, errors.New("cannot drain server node")
+	}
+	if node.IsDraining == "yes" {
+		return node, nil
+	}
+	node.IsDraining = "yes"
+	node.DrainStarted = time.Now().Unix()
+	node.SetLastModified()
+	data, err := json.Marshal(&node)
+	if err != nil {
+		return models.Node{}, err
+	}
+	if err = database.Insert(node.ID, string(data), database.NODES_TABLE_NAME); err != nil {
+		return models.Node{}, err
+	}
+	if err = SetNetworkNodesLastModified(node.Network); err != nil {
+		return models.Node{}, err
+	}
+	return node, nil
+}
+
+// GetNodeDrainStatus - returns the drain progress of a node
+func GetNodeDrainStatus(node *models.Node) models.NodeDrainStatus {
+	status := models.NodeDrainStatus{
+		NodeID:   node.ID,
+		Draining: node.IsDraining == "yes",
+	}
+	if status.Draining {
+		status.Started = node.DrainStarted
+		status.Ends = node.DrainStarted + servercfg.GetNodeDrainGracePeriod()
+		status.Complete = time.Now().Unix() >= status.Ends
+	}
+	return status
+}
+
+// IsNodeDraining - checks if a node is draining, draining nodes are not advertised as gateways or relays
+func IsNodeDraining(node *models.Node) bool {
+	return node.IsDraining == "yes"
+}
@@ -0,0 +1,204 @@
+package logic
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gravitl/netmaker/database"
+	"github.com/gravitl/netmaker/logger"
+	"github.com/gravitl/netmaker/models"
+	"github.com/gravitl/netmaker/servercfg"
+)
+
+// ErrInvalidEgressTarget - returned when an egress target is not a dns name
+var ErrInvalidEgressTarget = errors.New("egress target must be a fully qualified domain name")
+
+// ErrUnresolvedEgressTarget - returned when an egress target has never resolved to an address
+var ErrUnresolvedEgressTarget = errors.New("egress target could not be resolved")
+
+// lookupEgressTarget - resolves an egress target, replaced in tests
+var lookupEgressTarget = net.LookupIP
+
+// ManageEgressTargets - goroutine which re-resolves the dns targets of egress gateways on the configured interval
+func ManageEgressTargets(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second * time.Duration(servercfg.GetEgressTargetRefresh())):
+			RefreshEgressTargets()
+		}
+	}
+}
+
+// RefreshEgressTargets - re-resolves the dns targets of every egress gateway,
+// saving the gateways whose ranges changed and queueing peer updates for their networks
+func RefreshEgressTargets() {
+	nodes, err := GetAllNodes()
+	if err != nil {
+		logger.Log(1, "failed to retrieve nodes to refresh egress targets", err.Error())
+		return
+	}
+	for i := range nodes {
+		if nodes[i].IsEgressGateway != "yes" || len(nodes[i].EgressGatewayTargets) == 0 {
+			continue
+		}
+		changed, err := refreshEgressTargets(&nodes[i])
+		if err != nil {
+			logger.Log(1, "failed to refresh egress targets of node", nodes[i].Name, nodes[i].ID, err.Error())
+			continue
+		}
+		if changed {
+			logger.Log(1, "egress targets of node", nodes[i].Name, nodes[i].ID, "resolved to new ranges")
+			PeerUpdateQueue(nodes[i].Network)
+		}
+	}
+}
+
+// refreshEgressTargets - resolves a gateway's targets and saves its ranges if they changed
+func refreshEgressTargets(node *models.Node) (bool, error) {
+	// resolve before locking, lookups can be slow
+	targetRanges, err := resolveEgressTargets(node.EgressGatewayTargets, node.EgressGatewayTargetRanges)
+	if err != nil {
+		logger.Log(1, "egress gateway", node.ID, err.Error())
+	}
+
+	nodeUpdateMutex.Lock()
+	defer nodeUpdateMutex.Unlock()
+	current, err := GetNodeByID(node.ID)
+	if err != nil {
+		return false, err
+	}
+	// the gateway was removed or changed while resolving
+	if current.IsEgressGateway != "yes" || !StringSliceEqual(current.EgressGatewayTargets, node.EgressGatewayTargets) {
+		return false, nil
+	}
+	ranges := mergeEgressRanges(getEgressStaticRanges(&current), targetRanges)
+	if StringSliceEqual(ranges, current.EgressGatewayRanges) {
+		return false, nil
+	}
+	current.EgressGatewayRanges = ranges
+	current.EgressGatewayTargetRanges = targetRanges
+	current.SetLastModified()
+	data, err := json.Marshal(&current)
+	if err != nil {
+		return false, err
+	}
+	if err = database.Insert(current.ID, string(data), database.NODES_TABLE_NAME); err != nil {
+		return false, err
+	}
+	if err = SetNetworkNodesLastModified(current.Network); err != nil {
+		logger.Log(1, "failed to set nodes last modified on network", current.Network, err.Error())
+	}
+	return true, nil
+}
+
+// resolveEgressTargets - resolves each target to host ranges, a target that fails to resolve keeps its
+// last known ranges and only errors when it has none
+func resolveEgressTargets(targets []string, lastKnown map[string][]string) (map[string][]string, error) {
+	var err error
+	targetRanges := make(map[string][]string, len(targets))
+	for _, target := range targets {
+		ranges, lookupErr := resolveEgressTarget(target)
+		if lookupErr == nil {
+			targetRanges[target] = ranges
+			continue
+		}
+		if previous, ok := lastKnown[target]; ok {
+			logger.Log(1, "keeping last known ranges of egress target", target, lookupErr.Error())
+			targetRanges[target] = previous
+			continue
+		}
+		err = fmt.Errorf("%w: %s %s", ErrUnresolvedEgressTarget, target, lookupErr.Error())
+	}
+	return targetRanges, err
+}
+
+// resolveEgressTarget - the sorted host ranges a dns name currently resolves to
+func resolveEgressTarget(target string) ([]string, error) {
+	ips, err := lookupEgressTarget(target)
+	if err != nil {
+		return nil, err
+	}
+	if len(ips) == 0 {
+		return nil, errors.New("no addresses found")
+	}
+	var ranges []string
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			ranges = append(ranges, ip.String()+"/32")
+		} else {
+			ranges = append(ranges, ip.String()+"/128")
+		}
+	}
+	sort.Strings(ranges)
+	return ranges, nil
+}
+
+// getEgressStaticRanges - the egress ranges of a gateway that were not resolved from its targets
+func getEgressStaticRanges(node *models.Node) []string {
+	resolved := make(map[string]bool)
+	for _, ranges := range node.EgressGatewayTargetRanges {
+		for _, egressRange := range ranges {
+			resolved[egressRange] = true
+		}
+	}
+	var static []string
+	for _, egressRange := range node.EgressGatewayRanges {
+		if !resolved[egressRange] {
+			static = append(static, egressRange)
+		}
+	}
+	return static
+}
+
+// mergeEgressRanges - the static ranges followed by the resolved ranges of every target, without duplicates
+func mergeEgressRanges(static []string, targetRanges map[string][]string) []string {
+	var targets []string
+	for target := range targetRanges {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+	ranges := []string{}
+	seen := make(map[string]bool)
+	add := func(egressRange string) {
+		if !seen[egressRange] {
+			seen[egressRange] = true
+			ranges = append(ranges, egressRange)
+		}
+	}
+	for _, egressRange := range static {
+		add(egressRange)
+	}
+	for _, target := range targets {
+		for _, egressRange := range targetRanges[target] {
+			add(egressRange)
+		}
+	}
+	return ranges
+}
+
+// isValidEgressTarget - checks that a target is a dns name rather than an address or range
+func isValidEgressTarget(target string) bool {
+	target = strings.TrimSuffix(target, ".")
+	if len(target) == 0 || len(target) > 253 || net.ParseIP(target) != nil || !strings.Contains(target, ".") {
+		return false
+	}
+	for _, label := range strings.Split(target, ".") {
+		if len(label) == 0 || len(label) > 63 || strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+			return false
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
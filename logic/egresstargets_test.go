@@ -0,0 +1,72 @@
+package logic
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/gravitl/netmaker/models"
+)
+
+func TestResolveEgressTargets(t *testing.T) {
+	defer func(lookup func(string) ([]net.IP, error)) { lookupEgressTarget = lookup }(lookupEgressTarget)
+	lookupEgressTarget = func(target string) ([]net.IP, error) {
+		if target == "lb.example.com" {
+			return []net.IP{net.ParseIP("10.20.0.2"), net.ParseIP("10.20.0.1"), net.ParseIP("fd00::1")}, nil
+		}
+		return nil, errors.New("no such host")
+	}
+
+	targetRanges, err := resolveEgressTargets([]string{"lb.example.com"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"10.20.0.1/32", "10.20.0.2/32", "fd00::1/128"}; !reflect.DeepEqual(want, targetRanges["lb.example.com"]) {
+		t.Fatalf("expected %v, got %v", want, targetRanges["lb.example.com"])
+	}
+
+	lastKnown := map[string][]string{"gone.example.com": {"10.30.0.1/32"}}
+	targetRanges, err = resolveEgressTargets([]string{"gone.example.com"}, lastKnown)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(lastKnown, targetRanges) {
+		t.Fatalf("expected last known ranges to be kept, got %v", targetRanges)
+	}
+
+	if _, err = resolveEgressTargets([]string{"gone.example.com"}, nil); !errors.Is(err, ErrUnresolvedEgressTarget) {
+		t.Fatalf("expected unresolved target error, got %v", err)
+	}
+}
+
+func TestMergeEgressRanges(t *testing.T) {
+	node := models.Node{
+		EgressGatewayRanges:       []string{"10.100.0.0/16", "10.20.0.1/32"},
+		EgressGatewayTargetRanges: map[string][]string{"lb.example.com": {"10.20.0.1/32"}},
+	}
+	static := getEgressStaticRanges(&node)
+	if want := []string{"10.100.0.0/16"}; !reflect.DeepEqual(want, static) {
+		t.Fatalf("expected %v, got %v", want, static)
+	}
+	ranges := mergeEgressRanges(static, map[string][]string{"lb.example.com": {"10.20.0.2/32"}, "db.example.com": {"10.100.0.0/16"}})
+	if want := []string{"10.100.0.0/16", "10.20.0.2/32"}; !reflect.DeepEqual(want, ranges) {
+		t.Fatalf("expected %v, got %v", want, ranges)
+	}
+}
+
+func TestIsValidEgressTarget(t *testing.T) {
+	for target, valid := range map[string]bool{
+		"lb.example.com":  true,
+		"lb.example.com.": true,
+		"localhost":       false,
+		"10.0.0.1":        false,
+		"10.0.0.0/24":     false,
+		"-lb.example.com": false,
+		"lb..example.com": false,
+	} {
+		if isValidEgressTarget(target) != valid {
+			t.Errorf("expected %s valid to be %v", target, valid)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package logic
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gravitl/netmaker/logger"
+	"github.com/gravitl/netmaker/models"
+)
+
+// NODE_EVENT_BUFFER - events held per subscriber before new ones are dropped
+const NODE_EVENT_BUFFER = 32
+
+var (
+	nodeEventMutex       sync.Mutex
+	nodeEventSubscribers = make(map[string]map[chan models.NodeEvent]bool)
+)
+
+// PublishNodeEvent - sends a node change to every subscriber of the node's network,
+// a subscriber that is not keeping up misses the event rather than blocking the caller
+func PublishNodeEvent(eventType string, node *models.Node) {
+	event := models.NodeEvent{
+		Type:     eventType,
+		Network:  node.Network,
+		NodeID:   node.ID,
+		Name:     node.Name,
+		Address:  node.Address,
+		Address6: node.Address6,
+		Time:     time.Now().Unix(),
+	}
+	nodeEventMutex.Lock()
+	defer nodeEventMutex.Unlock()
+	for events := range nodeEventSubscribers[node.Network] {
+		select {
+		case events <- event:
+		default:
+			logger.Log(2, "dropped", eventType, "event for node", node.ID, "on network", node.Network)
+		}
+	}
+}
+
+// SubscribeNodeEvents - subscribes to the node changes of a network, the returned func unsubscribes and closes the channel
+func SubscribeNodeEvents(network string) (<-chan models.NodeEvent, func()) {
+	events := make(chan models.NodeEvent, NODE_EVENT_BUFFER)
+	nodeEventMutex.Lock()
+	if nodeEventSubscribers[network] == nil {
+		nodeEventSubscribers[network] = make(map[chan models.NodeEvent]bool)
+	}
+	nodeEventSubscribers[network][events] = true
+	nodeEventMutex.Unlock()
+	return events, func() {
+		nodeEventMutex.Lock()
+		defer nodeEventMutex.Unlock()
+		delete(nodeEventSubscribers[network], events)
+		if len(nodeEventSubscribers[network]) == 0 {
+			delete(nodeEventSubscribers, network)
+		}
+		close(events)
+	}
+}
@@ -2,6 +2,9 @@ package logic
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
 	"time"
 
 	"github.com/gravitl/netmaker/database"
@@ -131,9 +134,27 @@ func CreateExtClient(extclient *models.ExtClient) error {
 		return err
 	}
 
+	client4, client6, err := getIngressClientRanges(extclient.IngressGatewayID, &parentNetwork)
+	if err != nil {
+		return err
+	}
+	unlock := lockNetworkAddresses(extclient.Network)
+	defer unlock()
+	if err = checkExtClientAddress(extclient, extclient.Address, client4); err != nil {
+		return err
+	}
+	if err = checkExtClientAddress(extclient, extclient.Address6, client6); err != nil {
+		return err
+	}
+
 	if extclient.Address == "" {
 		if parentNetwork.IsIPv4 == "yes" {
-			newAddress, err := UniqueAddress(extclient.Network, false)
+			var newAddress string
+			if client4 != nil {
+				newAddress, err = uniqueAddressInRange(&parentNetwork, client4, false)
+			} else {
+				newAddress, err = UniqueAddress(extclient.Network, false)
+			}
 			if err != nil {
 				return err
 			}
@@ -143,7 +164,12 @@ func CreateExtClient(extclient *models.ExtClient) error {
 
 	if extclient.Address6 == "" {
 		if parentNetwork.IsIPv6 == "yes" {
-			addr6, err := UniqueAddress6(extclient.Network, false)
+			var addr6 string
+			if client6 != nil {
+				addr6, err = uniqueAddressInRange(&parentNetwork, client6, true)
+			} else {
+				addr6, err = UniqueAddress6(extclient.Network, false)
+			}
 			if err != nil {
 				return err
 			}
@@ -171,6 +197,61 @@ func CreateExtClient(extclient *models.ExtClient) error {
 	return SetNetworkNodesLastModified(extclient.Network)
 }
 
+// ErrExtClientOutsideCIDR - returned when an ext client address is outside its ingress gateway's client cidr
+var ErrExtClientOutsideCIDR = errors.New("ext client address is outside the ingress gateway's client cidr")
+
+// getIngressClientRanges - the client cidr of an ingress gateway as its ipv4 or ipv6 range, both nil when it has none
+func getIngressClientRanges(ingressID string, network *models.Network) (*net.IPNet, *net.IPNet, error) {
+	if ingressID == "" {
+		return nil, nil, nil
+	}
+	ingress, err := GetNodeByID(ingressID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return parseRequestedAddressRange(network, ingress.IngressClientCIDR)
+}
+
+// checkExtClientAddress - an address asked for by an ext client must be free and within the client cidr of its family,
+// the client itself may hold it already as updates recreate clients with their addresses
+func checkExtClientAddress(extclient *models.ExtClient, address string, clientRange *net.IPNet) error {
+	if address == "" {
+		return nil
+	}
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return fmt.Errorf("invalid ext client address %s", address)
+	}
+	if clientRange != nil && (ip.To4() == nil) == (clientRange.IP.To4() == nil) && !clientRange.Contains(ip) {
+		return fmt.Errorf("%w: %s is not within %s", ErrExtClientOutsideCIDR, address, clientRange.String())
+	}
+	if owner := getAddressOwner(extclient.Network, address, ""); owner != "" && owner != extclient.ClientID {
+		return &AddressConflictError{Address: address, OwnerID: owner}
+	}
+	return nil
+}
+
+// checkExtClientsInCIDR - the ext clients already behind an ingress gateway must fit a client cidr set on it
+func checkExtClientsInCIDR(ingress *models.Node, clientRange *net.IPNet) error {
+	extclients, err := GetNetworkExtClients(ingress.Network)
+	if err != nil {
+		return nil
+	}
+	for i := range extclients {
+		if extclients[i].IngressGatewayID != ingress.ID {
+			continue
+		}
+		address := extclients[i].Address
+		if clientRange.IP.To4() == nil {
+			address = extclients[i].Address6
+		}
+		if ip := net.ParseIP(address); ip != nil && !clientRange.Contains(ip) {
+			return fmt.Errorf("%w: ext client %s has %s", ErrExtClientOutsideCIDR, extclients[i].ClientID, address)
+		}
+	}
+	return nil
+}
+
 // UpdateExtClient - only supports name changes right now
 func UpdateExtClient(newclientid string, network string, enabled bool, client *models.ExtClient) (*models.ExtClient, error) {
 
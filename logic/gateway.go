@@ -3,20 +3,51 @@ package logic
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"net"
+	"sort"
 	"strings"
-	"time"
 
 	"github.com/gravitl/netmaker/database"
 	"github.com/gravitl/netmaker/logger"
+	"github.com/gravitl/netmaker/logic/acls/nodeacls"
 	"github.com/gravitl/netmaker/models"
 )
 
+// ErrGatewayNodePending - returned when making a gateway of a node that has not been approved yet
+var ErrGatewayNodePending = errors.New("node is pending approval and cannot be a gateway")
+
 // CreateEgressGateway - creates an egress gateway
 func CreateEgressGateway(gateway models.EgressGatewayRequest) (models.Node, error) {
+	node, err := ComputeEgressGateway(gateway)
+	if err != nil {
+		return models.Node{}, err
+	}
+	nodeData, err := json.Marshal(&node)
+	if err != nil {
+		return node, err
+	}
+	if err = database.Insert(node.ID, string(nodeData), database.NODES_TABLE_NAME); err != nil {
+		return models.Node{}, err
+	}
+	if err = NetworkNodesUpdatePullChanges(node.Network); err != nil {
+		return models.Node{}, err
+	}
+	return node, nil
+}
+
+// ComputeEgressGateway - builds the node config an egress gateway would have without persisting it
+func ComputeEgressGateway(gateway models.EgressGatewayRequest) (models.Node, error) {
 	node, err := GetNodeByID(gateway.NodeID)
 	if err != nil {
 		return models.Node{}, err
 	}
+	if node.IsPending == "yes" {
+		return models.Node{}, fmt.Errorf("%w: %s", ErrGatewayNodePending, node.ID)
+	}
+	if node.IsDNSOnly == "yes" {
+		return models.Node{}, fmt.Errorf("%w: %s", ErrDNSOnlyNode, node.ID)
+	}
 	if node.OS != "linux" && node.OS != "freebsd" { // add in darwin later
 		return models.Node{}, errors.New(node.OS + " is unsupported for egress gateways")
 	}
@@ -24,17 +55,57 @@ func CreateEgressGateway(gateway models.EgressGatewayRequest) (models.Node, erro
 	if err != nil {
 		return models.Node{}, err
 	}
+	// ipfw nat is configured per interface, there is nothing to fall back to
+	if gateway.Interface == "" && node.OS == "freebsd" {
+		return models.Node{}, fmt.Errorf("%w: freebsd egress gateways need an interface", ErrInvalidEgressInterface)
+	}
+	// ipfw nat is configured for the whole interface and cannot be limited to some sources
+	if len(gateway.NATRules) > 0 && node.OS == "freebsd" {
+		return models.Node{}, fmt.Errorf("%w: freebsd egress gateways do not support nat rules", ErrInvalidEgressNATRule)
+	}
+	if gateway.Interface != "" && len(node.LocalInterfaces) > 0 && !StringSliceContains(node.LocalInterfaces, gateway.Interface) {
+		return models.Node{}, fmt.Errorf("%w: %s", ErrUnknownEgressInterface, gateway.Interface)
+	}
+	targetRanges, err := resolveEgressTargets(gateway.Targets, nil)
+	if err != nil {
+		return models.Node{}, err
+	}
+	ranges := mergeEgressRanges(gateway.Ranges, targetRanges)
+	if conflict := getEgressRangeConflict(&node, ranges, gateway.Metric); conflict != nil {
+		if !gateway.Force {
+			return models.Node{}, conflict
+		}
+		logger.Log(1, "forcing egress gateway on node", node.ID, "despite", conflict.Error())
+	}
 	node.IsEgressGateway = "yes"
-	node.EgressGatewayRanges = gateway.Ranges
+	node.EgressGatewayRanges = ranges
+	node.EgressGatewayTargets = gateway.Targets
+	node.EgressGatewayTargetRanges = targetRanges
+	node.EgressGatewayMetric = gateway.Metric
+	node.EgressGatewayInterface = gateway.Interface
+	node.EgressGatewayNATRules = orderEgressNATRules(gateway.NATRules)
+	node.EgressGatewayStatus = egressGatewayStatus(&node)
 	postUpCmd := ""
 	postDownCmd := ""
 	if node.OS == "linux" {
-		postUpCmd = "iptables -A FORWARD -i " + node.Interface + " -j ACCEPT ; "
-		postUpCmd += "iptables -A FORWARD -o " + node.Interface + " -j ACCEPT ; "
-		postUpCmd += "iptables -t nat -A POSTROUTING -o " + gateway.Interface + " -j MASQUERADE"
-		postDownCmd = "iptables -D FORWARD -i " + node.Interface + " -j ACCEPT ; "
-		postDownCmd += "iptables -D FORWARD -o " + node.Interface + " -j ACCEPT ; "
-		postDownCmd += "iptables -t nat -D POSTROUTING -o " + gateway.Interface + " -j MASQUERADE"
+		// without an interface traffic is masqueraded out of whichever interface routing picks
+		outbound := "! -o " + node.Interface
+		if gateway.Interface != "" {
+			outbound = "-o " + gateway.Interface
+		}
+		// each address family has its own tables, rules are only added for the families the ranges use
+		var postUps, postDowns []string
+		hasIPv4, hasIPv6 := egressRangeFamilies(ranges)
+		if hasIPv4 || !hasIPv6 {
+			postUp, postDown := egressForwardingCommands("iptables", node.Interface, outbound, node.EgressGatewayNATRules)
+			postUps, postDowns = append(postUps, postUp), append(postDowns, postDown)
+		}
+		if hasIPv6 {
+			postUp, postDown := egressForwardingCommands("ip6tables", node.Interface, outbound, node.EgressGatewayNATRules)
+			postUps, postDowns = append(postUps, postUp), append(postDowns, postDown)
+		}
+		postUpCmd = strings.Join(postUps, " ; ")
+		postDownCmd = strings.Join(postDowns, " ; ")
 	}
 	if node.OS == "freebsd" {
 		postUpCmd = "kldload ipfw ipfw_nat ; "
@@ -70,34 +141,231 @@ func CreateEgressGateway(gateway models.EgressGatewayRequest) (models.Node, erro
 	node.PostUp = postUpCmd
 	node.PostDown = postDownCmd
 	node.SetLastModified()
-	nodeData, err := json.Marshal(&node)
-	if err != nil {
-		return node, err
-	}
-	if err = database.Insert(node.ID, string(nodeData), database.NODES_TABLE_NAME); err != nil {
-		return models.Node{}, err
+	return node, nil
+}
+
+// egressForwardingCommands - the postup and postdown forwarding and masquerading traffic of a linux egress
+// gateway with iptables or ip6tables, the nat rules of the table's family come before the catch all
+// masquerade in the order given so the first matching source decides
+func egressForwardingCommands(iptables, iface, outbound string, natRules []models.EgressNATRule) (string, string) {
+	postUp := iptables + " -A FORWARD -i " + iface + " -j ACCEPT ; "
+	postUp += iptables + " -A FORWARD -o " + iface + " -j ACCEPT ; "
+	postDown := iptables + " -D FORWARD -i " + iface + " -j ACCEPT ; "
+	postDown += iptables + " -D FORWARD -o " + iface + " -j ACCEPT ; "
+	for _, rule := range natRules {
+		if _, ipv6 := egressRangeFamilies([]string{rule.Source}); ipv6 != (iptables == "ip6tables") {
+			continue
+		}
+		// returning from the nat chain leaves the source address as it is
+		target := "RETURN"
+		if rule.NAT {
+			target = "MASQUERADE"
+		}
+		postUp += iptables + " -t nat -A POSTROUTING -s " + rule.Source + " " + outbound + " -j " + target + " ; "
+		postDown += iptables + " -t nat -D POSTROUTING -s " + rule.Source + " " + outbound + " -j " + target + " ; "
 	}
-	if err = NetworkNodesUpdatePullChanges(node.Network); err != nil {
-		return models.Node{}, err
+	postUp += iptables + " -t nat -A POSTROUTING " + outbound + " -j MASQUERADE"
+	postDown += iptables + " -t nat -D POSTROUTING " + outbound + " -j MASQUERADE"
+	return postUp, postDown
+}
+
+// orderEgressNATRules - the nat rules with their sources in canonical form, duplicates dropped and the most
+// specific sources first so a narrower source overrides the broader one containing it
+func orderEgressNATRules(natRules []models.EgressNATRule) []models.EgressNATRule {
+	ordered := []models.EgressNATRule{}
+	seen := make(map[string]bool)
+	for _, rule := range natRules {
+		_, source, err := net.ParseCIDR(rule.Source)
+		if err != nil || seen[source.String()] {
+			continue
+		}
+		seen[source.String()] = true
+		ordered = append(ordered, models.EgressNATRule{Source: source.String(), NAT: rule.NAT})
+	}
+	sort.SliceStable(ordered, func(i, j int) bool {
+		_, first, _ := net.ParseCIDR(ordered[i].Source)
+		_, second, _ := net.ParseCIDR(ordered[j].Source)
+		firstOnes, _ := first.Mask.Size()
+		secondOnes, _ := second.Mask.Size()
+		return firstOnes > secondOnes
+	})
+	return ordered
+}
+
+// egressRangeFamilies - whether any of the egress ranges are ipv4 and whether any are ipv6,
+// judged by the size of the mask so ipv4 mapped ipv6 ranges count as ipv6
+func egressRangeFamilies(ranges []string) (bool, bool) {
+	var hasIPv4, hasIPv6 bool
+	for _, egressRange := range ranges {
+		_, cidr, err := net.ParseCIDR(egressRange)
+		if err != nil {
+			continue
+		}
+		if _, bits := cidr.Mask.Size(); bits == net.IPv6len*8 {
+			hasIPv6 = true
+		} else {
+			hasIPv4 = true
+		}
 	}
-	return node, nil
+	return hasIPv4, hasIPv6
 }
 
 // ValidateEgressGateway - validates the egress gateway model
 func ValidateEgressGateway(gateway models.EgressGatewayRequest) error {
 	var err error
 
-	empty := len(gateway.Ranges) == 0
+	empty := len(gateway.Ranges) == 0 && len(gateway.Targets) == 0
 	if empty {
 		err = errors.New("IP Ranges Cannot Be Empty")
 	}
-	empty = gateway.Interface == ""
-	if empty {
-		err = errors.New("interface cannot be empty")
+	for _, egressRange := range gateway.Ranges {
+		if _, _, cidrErr := net.ParseCIDR(egressRange); cidrErr != nil {
+			err = fmt.Errorf("%w: %s", ErrInvalidEgressRange, egressRange)
+		}
+	}
+	for _, target := range gateway.Targets {
+		if !isValidEgressTarget(target) {
+			err = fmt.Errorf("%w: %s", ErrInvalidEgressTarget, target)
+		}
+	}
+	if gateway.Metric < 0 {
+		err = ErrInvalidEgressMetric
+	}
+	if gateway.Interface != "" && !isValidEgressInterface(gateway.Interface) {
+		err = fmt.Errorf("%w: %s", ErrInvalidEgressInterface, gateway.Interface)
+	}
+	natSources := make(map[string]bool)
+	for _, rule := range gateway.NATRules {
+		_, source, cidrErr := net.ParseCIDR(rule.Source)
+		if cidrErr != nil {
+			err = fmt.Errorf("%w: source %s is not in CIDR notation", ErrInvalidEgressNATRule, rule.Source)
+			continue
+		}
+		if nat, ok := natSources[source.String()]; ok && nat != rule.NAT {
+			err = fmt.Errorf("%w: %s is both masqueraded and not", ErrEgressNATConflict, source.String())
+		}
+		natSources[source.String()] = rule.NAT
 	}
 	return err
 }
 
+// ErrInvalidEgressNATRule - returned when an egress nat rule cannot be applied
+var ErrInvalidEgressNATRule = errors.New("invalid egress nat rule")
+
+// ErrEgressNATConflict - returned when egress nat rules for the same source disagree on masquerading it
+var ErrEgressNATConflict = errors.New("egress nat rules contradict each other")
+
+// ErrInvalidEgressRange - returned when an egress range is not in CIDR notation
+var ErrInvalidEgressRange = errors.New("egress range must be in CIDR notation")
+
+// ErrInvalidEgressInterface - returned when an egress interface is not a valid interface name
+var ErrInvalidEgressInterface = errors.New("egress interface must be at most 15 letters, digits, '.', '-' or '_'")
+
+// ErrUnknownEgressInterface - returned when the node reported its interfaces and the egress interface is not one of them
+var ErrUnknownEgressInterface = errors.New("egress interface does not exist on the node")
+
+// isValidEgressInterface - checks an interface name fits the kernel's limits and is safe to put in a command
+func isValidEgressInterface(name string) bool {
+	if len(name) == 0 || len(name) > 15 || name == "." || name == ".." {
+		return false
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// egressGatewayStatus - the problem with a node's egress gateway, a chosen interface missing from the
+// interfaces the node last reported, empty when there is none or the node has not reported its interfaces
+func egressGatewayStatus(node *models.Node) string {
+	if node.IsEgressGateway != "yes" || node.EgressGatewayInterface == "" || len(node.LocalInterfaces) == 0 {
+		return ""
+	}
+	if StringSliceContains(node.LocalInterfaces, node.EgressGatewayInterface) {
+		return ""
+	}
+	return fmt.Sprintf("egress interface %s does not exist on the node", node.EgressGatewayInterface)
+}
+
+// ErrInvalidEgressMetric - returned when an egress gateway metric is negative
+var ErrInvalidEgressMetric = errors.New("egress gateway metric cannot be negative")
+
+// EgressRangeConflictError - returned when an egress range overlaps a range advertised by another gateway on the network
+type EgressRangeConflictError struct {
+	Range      string
+	OwnerRange string
+	OwnerID    string
+	OwnerName  string
+}
+
+// EgressRangeConflictError.Error - describes the overlapping ranges and the gateway advertising the existing one
+func (e *EgressRangeConflictError) Error() string {
+	return fmt.Sprintf("egress range %s overlaps %s advertised by %s (%s), use force to create it anyway", e.Range, e.OwnerRange, e.OwnerName, e.OwnerID)
+}
+
+// getEgressRangeConflict - first overlap between the ranges and those of the other egress gateways on the node's network,
+// gateways with another metric may overlap as the lower metric is preferred
+func getEgressRangeConflict(node *models.Node, ranges []string, metric int32) *EgressRangeConflictError {
+	nodes, err := GetNetworkNodes(node.Network)
+	if err != nil {
+		return nil
+	}
+	for _, egressRange := range ranges {
+		_, requested, err := net.ParseCIDR(egressRange)
+		if err != nil {
+			continue
+		}
+		for _, peer := range nodes {
+			if peer.ID == node.ID || peer.IsEgressGateway != "yes" || peer.EgressGatewayMetric != metric {
+				continue
+			}
+			for _, peerRange := range peer.EgressGatewayRanges {
+				_, existing, err := net.ParseCIDR(peerRange)
+				if err != nil {
+					continue
+				}
+				if requested.Contains(existing.IP) || existing.Contains(requested.IP) {
+					return &EgressRangeConflictError{Range: egressRange, OwnerRange: peerRange, OwnerID: peer.ID, OwnerName: peer.Name}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// getPreferredEgressGateway - the gateway a node routes an egress range of peer through instead, one with a lower
+// metric (ties go to the lower node id) whose ranges cover it, nil when peer is preferred; wireguard routes an
+// address to a single peer so only the preferred gateway may be given the range
+func getPreferredEgressGateway(node, peer *models.Node, gateways []models.Node, egressRange *net.IPNet) *models.Node {
+	ones, bits := egressRange.Mask.Size()
+	for i := range gateways {
+		gateway := &gateways[i]
+		if gateway.ID == peer.ID || gateway.IsEgressGateway != "yes" || gateway.IsPending == "yes" || IsNodeDraining(gateway) {
+			continue
+		}
+		if gateway.EgressGatewayMetric > peer.EgressGatewayMetric ||
+			(gateway.EgressGatewayMetric == peer.EgressGatewayMetric && gateway.ID > peer.ID) {
+			continue
+		}
+		if gateway.ID != node.ID && !nodeacls.AreNodesAllowed(nodeacls.NetworkID(node.Network), nodeacls.NodeID(node.ID), nodeacls.NodeID(gateway.ID)) {
+			continue
+		}
+		for _, gatewayRange := range gateway.EgressGatewayRanges {
+			_, covering, err := net.ParseCIDR(gatewayRange)
+			if err != nil {
+				continue
+			}
+			coveringOnes, coveringBits := covering.Mask.Size()
+			if coveringBits == bits && coveringOnes <= ones && covering.Contains(egressRange.IP) {
+				return gateway
+			}
+		}
+	}
+	return nil
+}
+
 // DeleteEgressGateway - deletes egress from node
 func DeleteEgressGateway(network, nodeid string) (models.Node, error) {
 
@@ -108,6 +376,12 @@ func DeleteEgressGateway(network, nodeid string) (models.Node, error) {
 
 	node.IsEgressGateway = "no"
 	node.EgressGatewayRanges = []string{}
+	node.EgressGatewayTargets = []string{}
+	node.EgressGatewayTargetRanges = map[string][]string{}
+	node.EgressGatewayMetric = 0
+	node.EgressGatewayInterface = ""
+	node.EgressGatewayNATRules = []models.EgressNATRule{}
+	node.EgressGatewayStatus = ""
 	node.PostUp = ""
 	node.PostDown = ""
 	if node.IsIngressGateway == "yes" { // check if node is still an ingress gateway before completely deleting postdown/up rules
@@ -142,15 +416,47 @@ func DeleteEgressGateway(network, nodeid string) (models.Node, error) {
 }
 
 // CreateIngressGateway - creates an ingress gateway
-func CreateIngressGateway(netid string, nodeid string) (models.Node, error) {
+func CreateIngressGateway(netid string, nodeid string, request models.IngressGatewayRequest) (models.Node, error) {
+	node, err := ComputeIngressGateway(netid, nodeid, request)
+	if err != nil {
+		return models.Node{}, err
+	}
+	data, err := json.Marshal(&node)
+	if err != nil {
+		return models.Node{}, err
+	}
+	err = database.Insert(node.ID, string(data), database.NODES_TABLE_NAME)
+	if err != nil {
+		return models.Node{}, err
+	}
+	err = SetNetworkNodesLastModified(netid)
+	return node, err
+}
+
+// ComputeIngressGateway - builds the node config an ingress gateway would have without persisting it
+func ComputeIngressGateway(netid string, nodeid string, request models.IngressGatewayRequest) (models.Node, error) {
 
 	node, err := GetNodeByID(nodeid)
+	if err != nil {
+		return models.Node{}, err
+	}
+	if node.IsPending == "yes" {
+		return models.Node{}, fmt.Errorf("%w: %s", ErrGatewayNodePending, node.ID)
+	}
+	if node.IsDNSOnly == "yes" {
+		return models.Node{}, fmt.Errorf("%w: %s", ErrDNSOnlyNode, node.ID)
+	}
 	if node.OS != "linux" { // add in darwin later
 		return models.Node{}, errors.New(node.OS + " is unsupported for ingress gateways")
 	}
-
-	if err != nil {
-		return models.Node{}, err
+	if request.Port != 0 {
+		if request.Port < 1 || request.Port > 65535 {
+			return models.Node{}, fmt.Errorf("%w %d", ErrInvalidIngressPort, request.Port)
+		}
+		if owner := getGatewayPortOwner(&node, request.Port); owner != "" {
+			return models.Node{}, &PortConflictError{Endpoint: node.Endpoint, Port: request.Port, OwnerID: owner}
+		}
+		node.ListenPort = request.Port
 	}
 
 	network, err := GetParentNetwork(netid)
@@ -159,6 +465,21 @@ func CreateIngressGateway(netid string, nodeid string) (models.Node, error) {
 	}
 	node.IsIngressGateway = "yes"
 	node.IngressGatewayRange = network.AddressRange
+	node.IngressClientCIDR = ""
+	if request.ClientCIDR != "" {
+		client4, client6, err := parseRequestedAddressRange(&network, request.ClientCIDR)
+		if err != nil {
+			return models.Node{}, err
+		}
+		clientRange := client4
+		if clientRange == nil {
+			clientRange = client6
+		}
+		if err = checkExtClientsInCIDR(&node, clientRange); err != nil {
+			return models.Node{}, err
+		}
+		node.IngressClientCIDR = clientRange.String()
+	}
 	postUpCmd := "iptables -A FORWARD -i " + node.Interface + " -j ACCEPT ; "
 	postUpCmd += "iptables -A FORWARD -o " + node.Interface + " -j ACCEPT ; "
 	postUpCmd += "iptables -t nat -A POSTROUTING -o " + node.Interface + " -j MASQUERADE"
@@ -179,17 +500,64 @@ func CreateIngressGateway(netid string, nodeid string) (models.Node, error) {
 	node.PostUp = postUpCmd
 	node.PostDown = postDownCmd
 	node.UDPHolePunch = "no"
+	return node, nil
+}
 
-	data, err := json.Marshal(&node)
+// ErrInvalidIngressPort - returned when a requested ingress port is outside 1-65535
+var ErrInvalidIngressPort = errors.New("invalid ingress port")
+
+// PortConflictError - returned when a listen port is already used behind the same public endpoint
+type PortConflictError struct {
+	Endpoint string
+	Port     int32
+	OwnerID  string
+}
+
+// PortConflictError.Error - describes the conflicting port and its owner
+func (e *PortConflictError) Error() string {
+	return fmt.Sprintf("port %d on %s is already in use by %s", e.Port, e.Endpoint, e.OwnerID)
+}
+
+// getGatewayPortOwner - id of an ingress gateway or server node on any network that shares the node's
+// public endpoint and listens on the port, such nodes sit behind the same NAT and cannot share a forward
+func getGatewayPortOwner(node *models.Node, port int32) string {
+	nodes, err := GetAllNodes()
 	if err != nil {
-		return models.Node{}, err
+		return ""
 	}
-	err = database.Insert(node.ID, string(data), database.NODES_TABLE_NAME)
+	for _, other := range nodes {
+		if other.ID == node.ID || other.Endpoint != node.Endpoint || other.ListenPort != port {
+			continue
+		}
+		if other.IsIngressGateway == "yes" || other.IsServer == "yes" {
+			return other.ID
+		}
+	}
+	return ""
+}
+
+// GetGatewayDryRun - wraps a computed gateway node with the allowed ips each peer would route to it
+func GetGatewayDryRun(node *models.Node) (models.GatewayDryRun, error) {
+	dryrun := models.GatewayDryRun{
+		DryRun:         true,
+		Node:           *node,
+		PeerAllowedIPs: make(map[string][]string),
+	}
+	peers, err := GetNetworkNodes(node.Network)
 	if err != nil {
-		return models.Node{}, err
+		return dryrun, err
 	}
-	err = SetNetworkNodesLastModified(netid)
-	return node, err
+	for i := range peers {
+		if peers[i].ID == node.ID {
+			continue
+		}
+		var allowedips = []string{}
+		for _, ipnet := range GetAllowedIPs(&peers[i], node, peers) {
+			allowedips = append(allowedips, ipnet.String())
+		}
+		dryrun.PeerAllowedIPs[peers[i].ID] = allowedips
+	}
+	return dryrun, nil
 }
 
 // DeleteIngressGateway - deletes an ingress gateway
@@ -209,9 +577,10 @@ func DeleteIngressGateway(networkName string, nodeid string) (models.Node, error
 	}
 
 	node.UDPHolePunch = network.DefaultUDPHolePunch
-	node.LastModified = time.Now().Unix()
+	node.SetLastModified()
 	node.IsIngressGateway = "no"
 	node.IngressGatewayRange = ""
+	node.IngressClientCIDR = ""
 
 	data, err := json.Marshal(&node)
 	if err != nil {
@@ -241,3 +610,32 @@ func DeleteGatewayExtClients(gatewayID string, networkName string) error {
 	}
 	return nil
 }
+
+// GetNetworkGateways - lists the egress and ingress gateways of a network
+func GetNetworkGateways(network string) ([]models.GatewayInfo, error) {
+	var gateways = []models.GatewayInfo{}
+	nodes, err := GetNetworkNodes(network)
+	if err != nil {
+		return gateways, err
+	}
+	for _, node := range nodes {
+		if node.IsEgressGateway != "yes" && node.IsIngressGateway != "yes" {
+			continue
+		}
+		gateways = append(gateways, models.GatewayInfo{
+			NodeID:               node.ID,
+			Name:                 node.Name,
+			Network:              node.Network,
+			Address:              node.Address,
+			Address6:             node.Address6,
+			Endpoint:             node.Endpoint,
+			IsEgressGateway:      node.IsEgressGateway,
+			EgressGatewayRanges:  node.EgressGatewayRanges,
+			EgressGatewayTargets: node.EgressGatewayTargets,
+			IsIngressGateway:     node.IsIngressGateway,
+			IngressGatewayRange:  node.IngressGatewayRange,
+			ListenPort:           node.ListenPort,
+		})
+	}
+	return gateways, nil
+}
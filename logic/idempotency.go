@@ -0,0 +1,105 @@
+package logic
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/gravitl/netmaker/database"
+	"github.com/gravitl/netmaker/logger"
+	"github.com/gravitl/netmaker/models"
+	"github.com/gravitl/netmaker/servercfg"
+)
+
+// idempotencyKeyLock - lock of one idempotency key, dropped once no request holds or waits for it
+type idempotencyKeyLock struct {
+	sync.Mutex
+	refs int
+}
+
+var (
+	// idempotencyKeyLocks - one lock per idempotency key in use, so retries with the same key run one after another
+	idempotencyKeyLocks      = make(map[string]*idempotencyKeyLock)
+	idempotencyKeyLocksMutex sync.Mutex
+)
+
+// LockIdempotencyKey - takes the lock of an idempotency key on a network, held from looking the key up until the
+// created node is saved under it so a concurrent retry waits and gets that node back, the returned func releases it
+func LockIdempotencyKey(network, key string) func() {
+	recordKey := idempotencyRecordKey(network, key)
+	idempotencyKeyLocksMutex.Lock()
+	lock, ok := idempotencyKeyLocks[recordKey]
+	if !ok {
+		lock = &idempotencyKeyLock{}
+		idempotencyKeyLocks[recordKey] = lock
+	}
+	lock.refs++
+	idempotencyKeyLocksMutex.Unlock()
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+		idempotencyKeyLocksMutex.Lock()
+		if lock.refs--; lock.refs == 0 {
+			delete(idempotencyKeyLocks, recordKey)
+		}
+		idempotencyKeyLocksMutex.Unlock()
+	}
+}
+
+// GetIdempotentNodeID - returns the id of the node created with the given key on a network, if the key has not expired
+func GetIdempotentNodeID(network, key string) (string, bool) {
+	record, err := database.FetchRecord(database.IDEMPOTENCY_KEYS_TABLE_NAME, idempotencyRecordKey(network, key))
+	if err != nil {
+		return "", false
+	}
+	var idempotencyRecord models.IdempotencyRecord
+	if err = json.Unmarshal([]byte(record), &idempotencyRecord); err != nil {
+		return "", false
+	}
+	if isIdempotencyRecordExpired(&idempotencyRecord) {
+		if err = database.DeleteRecord(database.IDEMPOTENCY_KEYS_TABLE_NAME, idempotencyRecordKey(network, key)); err != nil {
+			logger.Log(2, "failed to remove expired idempotency key", key, err.Error())
+		}
+		return "", false
+	}
+	return idempotencyRecord.NodeID, true
+}
+
+// SaveIdempotencyKey - stores the node created with the given key on a network
+func SaveIdempotencyKey(network, key, nodeID string) error {
+	data, err := json.Marshal(&models.IdempotencyRecord{
+		Key:     key,
+		Network: network,
+		NodeID:  nodeID,
+		Created: time.Now().Unix(),
+	})
+	if err != nil {
+		return err
+	}
+	pruneIdempotencyKeys()
+	return database.Insert(idempotencyRecordKey(network, key), string(data), database.IDEMPOTENCY_KEYS_TABLE_NAME)
+}
+
+// == private ==
+
+func idempotencyRecordKey(network, key string) string {
+	return network + "###" + key
+}
+
+func isIdempotencyRecordExpired(record *models.IdempotencyRecord) bool {
+	return time.Since(time.Unix(record.Created, 0)) > time.Duration(servercfg.GetIdempotencyKeyTTL())*time.Second
+}
+
+// pruneIdempotencyKeys - removes all expired idempotency keys
+func pruneIdempotencyKeys() {
+	records, err := database.FetchRecords(database.IDEMPOTENCY_KEYS_TABLE_NAME)
+	if err != nil {
+		return
+	}
+	for key, value := range records {
+		var record models.IdempotencyRecord
+		if err = json.Unmarshal([]byte(value), &record); err != nil || isIdempotencyRecordExpired(&record) {
+			database.DeleteRecord(database.IDEMPOTENCY_KEYS_TABLE_NAME, key)
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package logic
 
 import (
+	"crypto/sha256"
+	"crypto/subtle"
 	"errors"
 	"fmt"
 	"time"
@@ -13,6 +15,21 @@ import (
 
 var jwtSecretKey []byte
 
+// ErrTokenExpired - returned when a correctly signed token is past its expiry
+var ErrTokenExpired = errors.New("token is expired")
+
+// IsMasterKey - whether a token is the configured master key, compared in constant time over the hashes
+// so neither the key nor its length leak, no token matches while the master key is unset
+func IsMasterKey(token string) bool {
+	masterKey := servercfg.GetMasterKey()
+	if masterKey == "" {
+		return false
+	}
+	tokenHash := sha256.Sum256([]byte(token))
+	masterKeyHash := sha256.Sum256([]byte(masterKey))
+	return subtle.ConstantTimeCompare(tokenHash[:], masterKeyHash[:]) == 1
+}
+
 // SetJWTSecret - sets the jwt secret on server startup
 func SetJWTSecret() {
 	currentSecret, jwtErr := FetchJWTSecret()
@@ -30,9 +47,18 @@ func SetJWTSecret() {
 	}
 }
 
+// GetNodeTokenLifetime - lifetime of node tokens on a network, networks without a setting use 5 minutes
+func GetNodeTokenLifetime(network *models.Network) time.Duration {
+	if network.TokenLifetime <= 0 {
+		return 5 * time.Minute
+	}
+	return time.Duration(network.TokenLifetime) * time.Second
+}
+
 // CreateJWT func will used to create the JWT while signing in and signing out
-func CreateJWT(uuid string, macAddress string, network string) (response string, err error) {
-	expirationTime := time.Now().Add(5 * time.Minute)
+// the token carries its expiry, once it passes nodes call authenticate again for a new token
+func CreateJWT(uuid string, macAddress string, network string, lifetime time.Duration) (response string, err error) {
+	expirationTime := time.Now().Add(lifetime)
 	claims := &models.Claims{
 		ID:         uuid,
 		Network:    network,
@@ -78,10 +104,21 @@ func CreateUserJWT(username string, networks []string, isadmin bool) (response s
 
 // VerifyToken func will used to Verify the JWT Token while using APIS
 func VerifyUserToken(tokenString string) (username string, networks []string, isadmin bool, err error) {
+	username, networks, isadmin, _, err = VerifyUserTokenRole(tokenString)
+	return username, networks, isadmin, err
+}
+
+// VerifyUserTokenRole - verifies a user token like VerifyUserToken and also returns the user's role,
+// the role is read from the user rather than the token so changing it applies to issued tokens
+func VerifyUserTokenRole(tokenString string) (username string, networks []string, isadmin bool, role string, err error) {
 	claims := &models.UserClaims{}
 
-	if tokenString == servercfg.GetMasterKey() && servercfg.GetMasterKey() != "" {
-		return "masteradministrator", nil, true, nil
+	if IsMasterKey(tokenString) {
+		return "masteradministrator", nil, true, "", nil
+	}
+	// skip parsing and the user lookup for tokens verified moments ago
+	if entry, ok := getCachedUserToken(tokenString); ok {
+		return entry.username, entry.networks, entry.isadmin, entry.role, nil
 	}
 
 	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
@@ -91,11 +128,12 @@ func VerifyUserToken(tokenString string) (username string, networks []string, is
 	if token != nil && token.Valid {
 		// check that user exists
 		if user, err := GetUser(claims.UserName); user.UserName != "" && err == nil {
-			return claims.UserName, claims.Networks, claims.IsAdmin, nil
+			cacheUserToken(tokenString, claims.UserName, claims.Networks, claims.IsAdmin, user.Role, time.Unix(claims.ExpiresAt, 0))
+			return claims.UserName, claims.Networks, claims.IsAdmin, user.Role, nil
 		}
 		err = errors.New("user does not exist")
 	}
-	return "", nil, false, err
+	return "", nil, false, "", tokenError(err)
 }
 
 // VerifyToken - [nodes] Only
@@ -104,7 +142,7 @@ func VerifyToken(tokenString string) (nodeID string, mac string, network string,
 
 	//this may be a stupid way of serving up a master key
 	//TODO: look into a different method. Encryption?
-	if tokenString == servercfg.GetMasterKey() && servercfg.GetMasterKey() != "" {
+	if IsMasterKey(tokenString) {
 		return "mastermac", "", "", nil
 	}
 
@@ -112,8 +150,20 @@ func VerifyToken(tokenString string) (nodeID string, mac string, network string,
 		return jwtSecretKey, nil
 	})
 
-	if token != nil {
+	if token != nil && token.Valid {
 		return claims.ID, claims.MacAddress, claims.Network, nil
 	}
-	return "", "", "", err
+	return "", "", "", tokenError(err)
+}
+
+// tokenError - maps an expired token to ErrTokenExpired so callers can tell it apart from an invalid one
+func tokenError(err error) error {
+	var validationErr *jwt.ValidationError
+	if errors.As(err, &validationErr) && validationErr.Errors&jwt.ValidationErrorExpired != 0 {
+		return ErrTokenExpired
+	}
+	if err == nil {
+		return errors.New("invalid token")
+	}
+	return err
 }
@@ -0,0 +1,40 @@
+package logic
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gravitl/netmaker/models"
+)
+
+func TestNodeTokenLifetime(t *testing.T) {
+	jwtSecretKey = []byte("jwt-test-secret")
+	if lifetime := GetNodeTokenLifetime(&models.Network{}); lifetime != 5*time.Minute {
+		t.Fatalf("expected default lifetime of 5m, got %s", lifetime)
+	}
+	network := models.Network{NetID: "skynet", TokenLifetime: 900}
+	if lifetime := GetNodeTokenLifetime(&network); lifetime != 15*time.Minute {
+		t.Fatalf("expected network lifetime of 15m, got %s", lifetime)
+	}
+	token, err := CreateJWT("node-id", "01:02:03:04:05:06", network.NetID, GetNodeTokenLifetime(&network))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, _, _, err := VerifyToken(token); err != nil || id != "node-id" {
+		t.Fatalf("expected valid token for node-id, got %q %v", id, err)
+	}
+	expired, err := CreateJWT("node-id", "01:02:03:04:05:06", network.NetID, -time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := VerifyToken(expired); !errors.Is(err, ErrTokenExpired) {
+		t.Fatalf("expected ErrTokenExpired for node token, got %v", err)
+	}
+	if _, _, _, err := VerifyUserToken(expired); !errors.Is(err, ErrTokenExpired) {
+		t.Fatalf("expected ErrTokenExpired when checked as a user token, got %v", err)
+	}
+	if _, _, _, err := VerifyToken("not-a-token"); err == nil || errors.Is(err, ErrTokenExpired) {
+		t.Fatalf("expected invalid token error, got %v", err)
+	}
+}
@@ -0,0 +1,123 @@
+package logic
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gravitl/netmaker/models"
+)
+
+const (
+	// ACCESS_KEY_CHALLENGE_TTL - seconds a node has to sign an access key challenge
+	ACCESS_KEY_CHALLENGE_TTL = 300
+	// MAX_ACCESS_KEY_CHALLENGES - max number of unanswered challenges held in memory
+	MAX_ACCESS_KEY_CHALLENGES = 10000
+	// MAX_NETWORK_ACCESS_KEY_CHALLENGES - max number of unanswered challenges of a single network, so a flood
+	// of challenges on one network leaves room for joins on the others
+	MAX_NETWORK_ACCESS_KEY_CHALLENGES = 1000
+)
+
+// ErrTooManyAccessKeyChallenges - returned when no more access key challenges can be held, on the network or at all
+var ErrTooManyAccessKeyChallenges = errors.New("too many pending access key challenges")
+
+var (
+	accessKeyChallenges = make(map[string]models.AccessKeyChallenge)
+	// networkAccessKeyChallenges - number of challenges held per network
+	networkAccessKeyChallenges = make(map[string]int)
+	accessKeyChallengesMutex   sync.Mutex
+)
+
+// CreateAccessKeyChallenge - creates a single use nonce for a node to sign with its access key
+func CreateAccessKeyChallenge(network string) (models.AccessKeyChallenge, error) {
+	nonce, err := GenerateCryptoString(32)
+	if err != nil {
+		return models.AccessKeyChallenge{}, err
+	}
+	challenge := models.AccessKeyChallenge{
+		Network: network,
+		Nonce:   nonce,
+		Expires: time.Now().Unix() + ACCESS_KEY_CHALLENGE_TTL,
+	}
+	accessKeyChallengesMutex.Lock()
+	defer accessKeyChallengesMutex.Unlock()
+	pruneAccessKeyChallenges()
+	if len(accessKeyChallenges) >= MAX_ACCESS_KEY_CHALLENGES {
+		return models.AccessKeyChallenge{}, ErrTooManyAccessKeyChallenges
+	}
+	if networkAccessKeyChallenges[network] >= MAX_NETWORK_ACCESS_KEY_CHALLENGES {
+		return models.AccessKeyChallenge{}, fmt.Errorf("%w: %s", ErrTooManyAccessKeyChallenges, network)
+	}
+	accessKeyChallenges[nonce] = challenge
+	networkAccessKeyChallenges[network]++
+	return challenge, nil
+}
+
+// VerifyAccessKeyChallenge - consumes a challenge and returns the network access key whose public key signed it
+func VerifyAccessKeyChallenge(network, nonce, signature string) (models.AccessKey, error) {
+	accessKeyChallengesMutex.Lock()
+	challenge, ok := accessKeyChallenges[nonce]
+	if ok {
+		removeAccessKeyChallenge(nonce, challenge.Network)
+	}
+	accessKeyChallengesMutex.Unlock()
+	if !ok || challenge.Network != network || challenge.Expires < time.Now().Unix() {
+		return models.AccessKey{}, errors.New("invalid or expired access key challenge")
+	}
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return models.AccessKey{}, errors.New("invalid access key challenge signature")
+	}
+	parentNetwork, err := GetParentNetwork(network)
+	if err != nil {
+		return models.AccessKey{}, err
+	}
+	if parentNetwork.AsymmetricKeys != "yes" {
+		return models.AccessKey{}, errors.New("network " + network + " does not use asymmetric access keys")
+	}
+	for _, key := range parentNetwork.AccessKeys {
+		if key.PublicKey == "" || !key.IsUsable() {
+			continue
+		}
+		pubKey, err := parseAccessKeyPublicKey(key.PublicKey)
+		if err != nil {
+			continue
+		}
+		if ed25519.Verify(pubKey, []byte(nonce), sig) {
+			return key, nil
+		}
+	}
+	return models.AccessKey{}, errors.New("no access key matches challenge signature")
+}
+
+// == private ==
+
+// parseAccessKeyPublicKey - decodes a base64 encoded ed25519 public key
+func parseAccessKeyPublicKey(publicKey string) (ed25519.PublicKey, error) {
+	data, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil || len(data) != ed25519.PublicKeySize {
+		return nil, errors.New("access key public key must be a base64 encoded ed25519 public key")
+	}
+	return ed25519.PublicKey(data), nil
+}
+
+// pruneAccessKeyChallenges - removes expired challenges, caller must hold the lock
+func pruneAccessKeyChallenges() {
+	now := time.Now().Unix()
+	for nonce, challenge := range accessKeyChallenges {
+		if challenge.Expires < now {
+			removeAccessKeyChallenge(nonce, challenge.Network)
+		}
+	}
+}
+
+// removeAccessKeyChallenge - drops a challenge and its count on its network, caller must hold the lock
+func removeAccessKeyChallenge(nonce, network string) {
+	delete(accessKeyChallenges, nonce)
+	if networkAccessKeyChallenges[network]--; networkAccessKeyChallenges[network] < 1 {
+		delete(networkAccessKeyChallenges, network)
+	}
+}
@@ -0,0 +1,62 @@
+package logic
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"github.com/gravitl/netmaker/models"
+)
+
+func TestAccessKeyChallengeSingleUse(t *testing.T) {
+	challenge, err := CreateAccessKeyChallenge("skynet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, priv, _ := ed25519.GenerateKey(rand.Reader)
+	sig := base64.StdEncoding.EncodeToString(ed25519.Sign(priv, []byte(challenge.Nonce)))
+	// wrong network consumes the challenge
+	if _, err = VerifyAccessKeyChallenge("othernet", challenge.Nonce, sig); err == nil {
+		t.Fatal("expected challenge for another network to fail")
+	}
+	if _, err = VerifyAccessKeyChallenge("skynet", challenge.Nonce, sig); err == nil {
+		t.Fatal("expected consumed challenge to fail")
+	}
+}
+
+func TestParseAccessKeyPublicKey(t *testing.T) {
+	pub, _, _ := ed25519.GenerateKey(rand.Reader)
+	if _, err := parseAccessKeyPublicKey(base64.StdEncoding.EncodeToString(pub)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parseAccessKeyPublicKey("bm90LWEta2V5"); err == nil {
+		t.Fatal("expected short key to be rejected")
+	}
+}
+
+func TestAccessKeyChallengeNetworkCap(t *testing.T) {
+	defer func() {
+		accessKeyChallengesMutex.Lock()
+		accessKeyChallenges = make(map[string]models.AccessKeyChallenge)
+		networkAccessKeyChallenges = make(map[string]int)
+		accessKeyChallengesMutex.Unlock()
+	}()
+	for i := 0; i < MAX_NETWORK_ACCESS_KEY_CHALLENGES; i++ {
+		if _, err := CreateAccessKeyChallenge("floodnet"); err != nil {
+			t.Fatalf("challenge %d failed: %v", i, err)
+		}
+	}
+	if _, err := CreateAccessKeyChallenge("floodnet"); !errors.Is(err, ErrTooManyAccessKeyChallenges) {
+		t.Fatalf("expected flooded network to be refused, got %v", err)
+	}
+	challenge, err := CreateAccessKeyChallenge("othernet")
+	if err != nil {
+		t.Fatalf("expected other networks to get challenges, got %v", err)
+	}
+	VerifyAccessKeyChallenge("othernet", challenge.Nonce, "not base64")
+	if networkAccessKeyChallenges["othernet"] != 0 {
+		t.Fatal("expected answered challenge to leave the network count")
+	}
+}
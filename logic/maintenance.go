@@ -0,0 +1,63 @@
+package logic
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gravitl/netmaker/database"
+	"github.com/gravitl/netmaker/models"
+)
+
+// MAINTENANCE_KEY - serverconf record holding the maintenance mode
+const MAINTENANCE_KEY = "nm-maintenance"
+
+// DEFAULT_MAINTENANCE_RETRY_AFTER - seconds clients are told to wait when no retry time was given
+const DEFAULT_MAINTENANCE_RETRY_AFTER = 300
+
+// ErrMaintenance - returned for node changes while the server is in maintenance mode
+var ErrMaintenance = errors.New("maintenance in progress, node changes are paused")
+
+// ErrInvalidMaintenanceMode - returned when a maintenance mode asks for a negative retry time
+var ErrInvalidMaintenanceMode = errors.New("maintenance retry after must not be negative")
+
+// GetMaintenanceMode - the stored maintenance mode, off when it was never set
+func GetMaintenanceMode() (models.MaintenanceMode, error) {
+	var mode models.MaintenanceMode
+	record, err := database.FetchRecord(database.SERVERCONF_TABLE_NAME, MAINTENANCE_KEY)
+	if err != nil {
+		if database.IsEmptyRecord(err) {
+			return mode, nil
+		}
+		return mode, err
+	}
+	err = json.Unmarshal([]byte(record), &mode)
+	return mode, err
+}
+
+// SetMaintenanceMode - stores the maintenance mode, turning it on again keeps the time it started
+func SetMaintenanceMode(mode models.MaintenanceMode) (models.MaintenanceMode, error) {
+	if mode.RetryAfter < 0 {
+		return mode, fmt.Errorf("%w: %d", ErrInvalidMaintenanceMode, mode.RetryAfter)
+	}
+	current, err := GetMaintenanceMode()
+	if err != nil {
+		return mode, err
+	}
+	mode.Started = 0
+	if mode.Enabled {
+		if mode.RetryAfter == 0 {
+			mode.RetryAfter = DEFAULT_MAINTENANCE_RETRY_AFTER
+		}
+		mode.Started = current.Started
+		if !current.Enabled {
+			mode.Started = time.Now().Unix()
+		}
+	}
+	data, err := json.Marshal(&mode)
+	if err != nil {
+		return mode, err
+	}
+	return mode, database.Insert(MAINTENANCE_KEY, string(data), database.SERVERCONF_TABLE_NAME)
+}
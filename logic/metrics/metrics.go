@@ -0,0 +1,76 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	// OUTCOME_SUCCESS - label value for operations that succeeded
+	OUTCOME_SUCCESS = "success"
+	// OUTCOME_ERROR - label value for operations that failed
+	OUTCOME_ERROR = "error"
+)
+
+var (
+	// Requests - api requests by route, method, network and outcome
+	Requests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "netmaker",
+		Name:      "api_requests_total",
+		Help:      "Number of API requests handled.",
+	}, []string{"endpoint", "method", "network", "outcome"})
+	// RequestDuration - api request latency by route and method
+	RequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "netmaker",
+		Name:      "api_request_duration_seconds",
+		Help:      "Latency of API requests.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"endpoint", "method"})
+	// AuthFailures - requests rejected by the auth middlewares
+	AuthFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "netmaker",
+		Name:      "auth_failures_total",
+		Help:      "Number of requests rejected by authorize or nodeauth.",
+	}, []string{"middleware", "network", "reason"})
+	// NodeOperations - node create, update and delete calls
+	NodeOperations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "netmaker",
+		Name:      "node_operations_total",
+		Help:      "Number of node create, update and delete operations.",
+	}, []string{"operation", "network", "outcome"})
+	// PeerUpdateDuration - time spent computing peer updates
+	PeerUpdateDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "netmaker",
+		Name:      "peer_update_duration_seconds",
+		Help:      "Latency of computing a node's peer update.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"network", "outcome"})
+)
+
+// Outcome - maps an error to the outcome label
+func Outcome(err error) string {
+	if err != nil {
+		return OUTCOME_ERROR
+	}
+	return OUTCOME_SUCCESS
+}
+
+// StatusOutcome - maps an http status code to the outcome label
+func StatusOutcome(status int) string {
+	if status >= 400 {
+		return OUTCOME_ERROR
+	}
+	return OUTCOME_SUCCESS
+}
+
+// RecordAuthFailure - counts a request rejected by an auth middleware
+func RecordAuthFailure(middleware, network, reason string) {
+	AuthFailures.WithLabelValues(middleware, network, reason).Inc()
+}
+
+// ObservePeerUpdate - records how long a peer update took to compute
+func ObservePeerUpdate(network string, start time.Time, err error) {
+	PeerUpdateDuration.WithLabelValues(network, Outcome(err)).Observe(time.Since(start).Seconds())
+}
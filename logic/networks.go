@@ -62,6 +62,9 @@ func DeleteNetwork(network string) error {
 		} else {
 			logger.Log(1, "could not remove servers before deleting network", network)
 		}
+		if err = database.DeleteRecord(database.PRESHARED_KEYS_TABLE_NAME, network); err != nil && !database.IsEmptyRecord(err) {
+			logger.Log(1, "failed to remove the preshared key secret during network delete for network,", network)
+		}
 		return database.DeleteRecord(database.NETWORKS_TABLE_NAME, network)
 	}
 	return errors.New("node check failed. All nodes must be deleted before deleting network")
@@ -87,6 +90,7 @@ func CreateNetwork(network models.Network) (models.Network, error) {
 	if err = database.Insert(network.NetID, string(data), database.NETWORKS_TABLE_NAME); err != nil {
 		return models.Network{}, err
 	}
+	invalidateAccessKeyIndex()
 
 	return network, nil
 }
@@ -117,10 +121,17 @@ func NetworkNodesUpdatePullChanges(networkName string) error {
 			database.Insert(node.ID, string(data), database.NODES_TABLE_NAME)
 		}
 	}
+	if err = SetNetworkNodesLastModified(networkName); err != nil {
+		logger.Log(1, "failed to set nodes last modified on network", networkName, err.Error())
+	}
+	PeerUpdateQueue(networkName)
 
 	return nil
 }
 
+// PeerUpdateQueue - queues a batched peer update for a network, set by the mq package
+var PeerUpdateQueue = func(network string) {}
+
 // GetNetworkNonServerNodeCount - get number of network non server nodes
 func GetNetworkNonServerNodeCount(networkName string) (int, error) {
 
@@ -199,6 +210,7 @@ func UniqueAddress(networkName string, reverse bool) (string, error) {
 
 	for {
 		if IsIPUnique(networkName, newAddrs.String(), database.NODES_TABLE_NAME, false) &&
+			IsIPUnique(networkName, newAddrs.String(), database.DELETED_NODES_TABLE_NAME, false) &&
 			IsIPUnique(networkName, newAddrs.String(), database.EXT_CLIENT_TABLE_NAME, false) {
 			return newAddrs.String(), nil
 		}
@@ -212,7 +224,7 @@ func UniqueAddress(networkName string, reverse bool) (string, error) {
 		}
 	}
 
-	return "W1R3: NO UNIQUE ADDRESSES AVAILABLE", errors.New("ERROR: No unique addresses available. Check network subnet")
+	return "W1R3: NO UNIQUE ADDRESSES AVAILABLE", addressExhausted(networkName, false)
 }
 
 // IsIPUnique - checks if an IP is unique
@@ -271,6 +283,7 @@ func UniqueAddress6(networkName string, reverse bool) (string, error) {
 	for {
 
 		if IsIPUnique(networkName, newAddrs.String(), database.NODES_TABLE_NAME, true) &&
+			IsIPUnique(networkName, newAddrs.String(), database.DELETED_NODES_TABLE_NAME, true) &&
 			IsIPUnique(networkName, newAddrs.String(), database.EXT_CLIENT_TABLE_NAME, true) {
 			return newAddrs.String(), nil
 		}
@@ -284,7 +297,7 @@ func UniqueAddress6(networkName string, reverse bool) (string, error) {
 		}
 	}
 
-	return "W1R3: NO UNIQUE ADDRESSES AVAILABLE", errors.New("ERROR: No unique IPv6 addresses available. Check network subnet")
+	return "W1R3: NO UNIQUE ADDRESSES AVAILABLE", addressExhausted(networkName, true)
 }
 
 // GetLocalIP - gets the local ip
@@ -361,7 +374,8 @@ func UpdateNetworkLocalAddresses(networkName string) error {
 			fmt.Println("error in node address assignment!")
 			return err
 		}
-		if node.Network == networkName {
+		// static addresses are never renumbered, range changes were checked to still hold them
+		if node.Network == networkName && node.IsStaticAddress != "yes" {
 			var ipaddr string
 			var iperr error
 			if node.IsServer == "yes" {
@@ -438,6 +452,27 @@ func RemoveNetworkNodeIPv6Addresses(networkName string) error {
 	return nil
 }
 
+// checkStaticAddressesInRange - errors when a node with a static address on the network would fall outside its new ranges,
+// such a node keeps its address when the others are renumbered
+func checkStaticAddressesInRange(network *models.Network) error {
+	nodes, err := GetNetworkNodes(network.NetID)
+	if err != nil {
+		return err
+	}
+	for _, node := range nodes {
+		if node.IsStaticAddress != "yes" {
+			continue
+		}
+		if node.Address != "" && !IsAddressInCIDR(node.Address, network.AddressRange) {
+			return fmt.Errorf("%w: %s keeps %s which is outside %s", ErrStaticAddress, node.ID, node.Address, network.AddressRange)
+		}
+		if node.Address6 != "" && !isAddress6InCIDR(node.Address6, network.AddressRange6) {
+			return fmt.Errorf("%w: %s keeps %s which is outside %s", ErrStaticAddress, node.ID, node.Address6, network.AddressRange6)
+		}
+	}
+	return nil
+}
+
 // UpdateNetworkNodeAddresses - updates network node addresses
 func UpdateNetworkNodeAddresses(networkName string) error {
 
@@ -454,7 +489,8 @@ func UpdateNetworkNodeAddresses(networkName string) error {
 			logger.Log(1, "error in node ipv4 address assignment!")
 			return err
 		}
-		if node.Network == networkName {
+		// static addresses are never renumbered, range changes were checked to still hold them
+		if node.Network == networkName && node.IsStaticAddress != "yes" {
 			var ipaddr string
 			var iperr error
 			if node.IsServer == "yes" {
@@ -495,7 +531,8 @@ func UpdateNetworkNodeAddresses6(networkName string) error {
 			logger.Log(1, "error in node ipv6 address assignment!")
 			return err
 		}
-		if node.Network == networkName {
+		// static addresses are never renumbered, range changes were checked to still hold them
+		if node.Network == networkName && node.IsStaticAddress != "yes" {
 			var ipaddr string
 			var iperr error
 			if node.IsServer == "yes" {
@@ -551,6 +588,18 @@ func UpdateNetwork(currentNetwork *models.Network, newNetwork *models.Network) (
 		hasrangeupdate6 := newNetwork.AddressRange6 != currentNetwork.AddressRange6
 		localrangeupdate := newNetwork.LocalRange != currentNetwork.LocalRange
 		hasholepunchupdate := newNetwork.DefaultUDPHolePunch != currentNetwork.DefaultUDPHolePunch
+		if hasrangeupdate4 || hasrangeupdate6 {
+			if err := checkStaticAddressesInRange(newNetwork); err != nil {
+				return false, false, false, false, err
+			}
+		}
+		// the peer epoch only moves forward, whatever the update carries the stored one is kept
+		networkNodesModifiedMutex.Lock()
+		defer networkNodesModifiedMutex.Unlock()
+		newNetwork.PeerEpoch = currentNetwork.PeerEpoch
+		if stored, err := GetParentNetwork(newNetwork.NetID); err == nil {
+			newNetwork.PeerEpoch = stored.PeerEpoch
+		}
 		data, err := json.Marshal(newNetwork)
 		if err != nil {
 			return false, false, false, false, err
@@ -610,9 +659,10 @@ func ValidateNetwork(network *models.Network, isUpdate bool) error {
 		for _, e := range err.(validator.ValidationErrors) {
 			fmt.Println(e)
 		}
+		return err
 	}
 
-	return err
+	return validatePostCommandTemplates(network)
 }
 
 // ParseNetwork - parses a network into a model
@@ -662,6 +712,7 @@ func SaveNetwork(network *models.Network) error {
 	if err := database.Insert(network.NetID, string(data), database.NETWORKS_TABLE_NAME); err != nil {
 		return err
 	}
+	invalidateAccessKeyIndex()
 	return nil
 }
 
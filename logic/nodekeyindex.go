@@ -0,0 +1,127 @@
+package logic
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/gravitl/netmaker/models"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+var (
+	// nodeKeyIndex - ids of the nodes holding each public key, keys are stored decoded and re-encoded,
+	// nil until the first lookup builds it
+	nodeKeyIndex      map[string][]string
+	nodeKeyIndexMutex sync.Mutex
+)
+
+// GetNodesByPublicKey - the nodes of any network holding a wireguard public key, ordered by id; they are found
+// through an in memory index that is checked against the stored nodes and rebuilt when it is out of date, so the
+// nodes table is only scanned for keys the index does not know
+func GetNodesByPublicKey(publicKey string) ([]models.Node, error) {
+	key, err := wgtypes.ParseKey(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidPublicKey, publicKey)
+	}
+	nodeKeyIndexMutex.Lock()
+	defer nodeKeyIndexMutex.Unlock()
+	if nodes, ok := getIndexedKeyNodes(key); ok {
+		return nodes, nil
+	}
+	if err = rebuildNodeKeyIndex(); err != nil {
+		return nil, err
+	}
+	if nodes, ok := getIndexedKeyNodes(key); ok {
+		return nodes, nil
+	}
+	return []models.Node{}, nil
+}
+
+// == private ==
+
+// indexNodeKey - adds a node that was just given its public key to the index, once the index is built; a key
+// shared across networks would otherwise go unnoticed, nodes that left the key behind are dropped on lookup
+func indexNodeKey(node *models.Node) {
+	key, err := wgtypes.ParseKey(node.PublicKey)
+	if err != nil {
+		return
+	}
+	nodeKeyIndexMutex.Lock()
+	defer nodeKeyIndexMutex.Unlock()
+	if nodeKeyIndex == nil {
+		return
+	}
+	ids := nodeKeyIndex[key.String()]
+	for _, id := range ids {
+		if id == node.ID {
+			return
+		}
+	}
+	ids = append(ids, node.ID)
+	sort.Strings(ids)
+	nodeKeyIndex[key.String()] = ids
+}
+
+// reindexNodeKey - moves a node that changed its public key from the entry of its old key to the
+// entry of its new one, once the index is built
+func reindexNodeKey(node *models.Node, oldPublicKey string) {
+	if key, err := wgtypes.ParseKey(oldPublicKey); err == nil {
+		nodeKeyIndexMutex.Lock()
+		if nodeKeyIndex != nil {
+			ids := make([]string, 0, len(nodeKeyIndex[key.String()]))
+			for _, id := range nodeKeyIndex[key.String()] {
+				if id != node.ID {
+					ids = append(ids, id)
+				}
+			}
+			if len(ids) == 0 {
+				delete(nodeKeyIndex, key.String())
+			} else {
+				nodeKeyIndex[key.String()] = ids
+			}
+		}
+		nodeKeyIndexMutex.Unlock()
+	}
+	indexNodeKey(node)
+}
+
+// getIndexedKeyNodes - the nodes the index holds for a key, false when the key is not indexed or one of
+// its nodes was deleted or changed its key since it was indexed
+func getIndexedKeyNodes(key wgtypes.Key) ([]models.Node, bool) {
+	ids, ok := nodeKeyIndex[key.String()]
+	if !ok {
+		return nil, false
+	}
+	nodes := make([]models.Node, 0, len(ids))
+	for _, id := range ids {
+		node, err := GetNodeByID(id)
+		if err != nil {
+			return nil, false
+		}
+		if nodeKey, err := wgtypes.ParseKey(node.PublicKey); err != nil || nodeKey != key {
+			return nil, false
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes, true
+}
+
+// rebuildNodeKeyIndex - indexes the public keys of every stored node, nodeKeyIndexMutex must be held
+func rebuildNodeKeyIndex() error {
+	nodes, err := GetAllNodes()
+	if err != nil {
+		return err
+	}
+	index := make(map[string][]string, len(nodes))
+	for _, node := range nodes {
+		if key, err := wgtypes.ParseKey(node.PublicKey); err == nil {
+			index[key.String()] = append(index[key.String()], node.ID)
+		}
+	}
+	for _, ids := range index {
+		sort.Strings(ids)
+	}
+	nodeKeyIndex = index
+	return nil
+}
@@ -0,0 +1,126 @@
+package logic
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/gravitl/netmaker/database"
+	"github.com/gravitl/netmaker/models"
+)
+
+// ErrInvalidMetrics - returned when a node reports negative measurements or packet loss above 100 percent
+var ErrInvalidMetrics = errors.New("metrics must not be negative and packet loss must be at most 100 percent")
+
+// UpdateNodeMetrics - stores the measurements a node reported of its peers, only the latest sample of
+// each peer pair is kept and samples of nodes that are not peers on the network are dropped
+func UpdateNodeMetrics(node *models.Node, reported *models.Metrics) (models.Metrics, error) {
+	for _, metric := range reported.Connectivity {
+		if metric.Latency < 0 || metric.Throughput < 0 || metric.PacketLoss < 0 || metric.PacketLoss > 100 {
+			return models.Metrics{}, ErrInvalidMetrics
+		}
+	}
+	current, err := GetNodeMetrics(node.ID)
+	if err != nil && !database.IsEmptyRecord(err) {
+		return models.Metrics{}, err
+	}
+	peers, err := getNetworkPeerIDs(node.Network)
+	if err != nil {
+		return models.Metrics{}, err
+	}
+	now := time.Now().Unix()
+	metrics := models.Metrics{
+		Network:      node.Network,
+		NodeID:       node.ID,
+		Connectivity: make(map[string]models.Metric),
+		Updated:      now,
+	}
+	for peerID, metric := range current.Connectivity {
+		if peers[peerID] && peerID != node.ID {
+			metrics.Connectivity[peerID] = metric
+		}
+	}
+	for peerID, metric := range reported.Connectivity {
+		if !peers[peerID] || peerID == node.ID {
+			continue
+		}
+		if metric.Collected <= 0 || metric.Collected > now {
+			metric.Collected = now
+		}
+		// samples arriving out of order never replace a newer one
+		if stored, ok := metrics.Connectivity[peerID]; ok && stored.Collected > metric.Collected {
+			continue
+		}
+		metrics.Connectivity[peerID] = metric
+	}
+	data, err := json.Marshal(&metrics)
+	if err != nil {
+		return models.Metrics{}, err
+	}
+	return metrics, database.Insert(node.ID, string(data), database.METRICS_TABLE_NAME)
+}
+
+// GetNodeMetrics - the latest metrics a node reported
+func GetNodeMetrics(nodeid string) (models.Metrics, error) {
+	var metrics models.Metrics
+	record, err := database.FetchRecord(database.METRICS_TABLE_NAME, nodeid)
+	if err != nil {
+		return metrics, err
+	}
+	err = json.Unmarshal([]byte(record), &metrics)
+	return metrics, err
+}
+
+// GetNetworkMetrics - the latest metrics of every node of a network that reported any, ordered by node id,
+// samples of peers that left the network since are left out
+func GetNetworkMetrics(network string) ([]models.Metrics, error) {
+	networkMetrics := []models.Metrics{}
+	collection, err := database.FetchRecords(database.METRICS_TABLE_NAME)
+	if err != nil {
+		if database.IsEmptyRecord(err) {
+			return networkMetrics, nil
+		}
+		return networkMetrics, err
+	}
+	peers, err := getNetworkPeerIDs(network)
+	if err != nil {
+		return networkMetrics, err
+	}
+	for _, value := range collection {
+		var metrics models.Metrics
+		if err := json.Unmarshal([]byte(value), &metrics); err != nil || metrics.Network != network || !peers[metrics.NodeID] {
+			continue
+		}
+		for peerID := range metrics.Connectivity {
+			if !peers[peerID] {
+				delete(metrics.Connectivity, peerID)
+			}
+		}
+		networkMetrics = append(networkMetrics, metrics)
+	}
+	sort.Slice(networkMetrics, func(i, j int) bool { return networkMetrics[i].NodeID < networkMetrics[j].NodeID })
+	return networkMetrics, nil
+}
+
+// DeleteNodeMetrics - removes the metrics a node reported
+func DeleteNodeMetrics(nodeid string) error {
+	err := database.DeleteRecord(database.METRICS_TABLE_NAME, nodeid)
+	if err != nil && database.IsEmptyRecord(err) {
+		return nil
+	}
+	return err
+}
+
+// getNetworkPeerIDs - the ids of the nodes of a network
+func getNetworkPeerIDs(network string) (map[string]bool, error) {
+	ids := make(map[string]bool)
+	nodes, err := GetNetworkNodes(network)
+	if err != nil && !database.IsEmptyRecord(err) {
+		return ids, err
+	}
+	for _, node := range nodes {
+		ids[node.ID] = true
+	}
+	return ids, nil
+}
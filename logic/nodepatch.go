@@ -0,0 +1,97 @@
+package logic
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/gravitl/netmaker/models"
+)
+
+// ErrInvalidNodePatch - returned when a node patch is not a json merge patch object that can be applied
+var ErrInvalidNodePatch = errors.New("invalid node patch")
+
+// nullableNodeFields - node fields a patch may remove with null, updates only clear them when told to
+var nullableNodeFields = map[string]bool{
+	"notes": true,
+}
+
+// PatchNode - applies a json merge patch (RFC 7386) to a node and returns the patched node, fields
+// missing from the patch keep their current values, removing a field with null is only supported for
+// nullableNodeFields as updates fill other empty fields from the current node
+func PatchNode(node *models.Node, patch []byte) (models.Node, error) {
+	var patchDoc interface{}
+	if err := json.Unmarshal(patch, &patchDoc); err != nil {
+		return models.Node{}, fmt.Errorf("%w: %s", ErrInvalidNodePatch, err.Error())
+	}
+	if _, ok := patchDoc.(map[string]interface{}); !ok {
+		return models.Node{}, fmt.Errorf("%w: patch must be a json object", ErrInvalidNodePatch)
+	}
+	if field := findNullField(patchDoc, ""); field != "" {
+		return models.Node{}, fmt.Errorf("%w: field %s can not be removed, set it to a value instead", ErrInvalidNodePatch, field)
+	}
+	current, err := json.Marshal(node)
+	if err != nil {
+		return models.Node{}, err
+	}
+	var target interface{}
+	if err = json.Unmarshal(current, &target); err != nil {
+		return models.Node{}, err
+	}
+	patched, err := json.Marshal(mergePatch(target, patchDoc))
+	if err != nil {
+		return models.Node{}, err
+	}
+	var patchedNode models.Node
+	decoder := json.NewDecoder(bytes.NewReader(patched))
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(&patchedNode); err != nil {
+		return models.Node{}, fmt.Errorf("%w: %s", ErrInvalidNodePatch, err.Error())
+	}
+	return patchedNode, nil
+}
+
+// == private ==
+
+// mergePatch - RFC 7386 merge of a patch into a target document, objects merge member by member
+// and any other patch value replaces the target
+func mergePatch(target, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = make(map[string]interface{})
+	}
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+			continue
+		}
+		targetObject[key] = mergePatch(targetObject[key], value)
+	}
+	return targetObject
+}
+
+// findNullField - the path of the first member of a patch object set to null, empty when there is none
+func findNullField(patch interface{}, path string) string {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	for key, value := range patchObject {
+		field := key
+		if path != "" {
+			field = path + "." + key
+		}
+		if value == nil && !(path == "" && nullableNodeFields[key]) {
+			return field
+		}
+		if nested := findNullField(value, field); nested != "" {
+			return nested
+		}
+	}
+	return ""
+}
@@ -0,0 +1,37 @@
+package logic
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/gravitl/netmaker/models"
+)
+
+func TestMergePatch(t *testing.T) {
+	target := map[string]interface{}{"a": "b", "c": map[string]interface{}{"d": "e", "f": "g"}, "h": []interface{}{"i"}}
+	patch := map[string]interface{}{"a": "z", "c": map[string]interface{}{"f": nil}, "h": []interface{}{"j", "k"}}
+	expected := map[string]interface{}{"a": "z", "c": map[string]interface{}{"d": "e"}, "h": []interface{}{"j", "k"}}
+	if merged := mergePatch(target, patch); !reflect.DeepEqual(expected, merged) {
+		t.Fatalf("expected %v, got %v", expected, merged)
+	}
+}
+
+func TestPatchNode(t *testing.T) {
+	node := models.Node{ID: "node", Network: "skynet", Name: "node", IsStatic: "no", PersistentKeepalive: 20, RelayAddrs: []string{"10.0.0.2"}}
+	patched, err := PatchNode(&node, []byte(`{"isstatic":"yes","relayaddrs":["10.0.0.3"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if patched.IsStatic != "yes" || !reflect.DeepEqual(patched.RelayAddrs, []string{"10.0.0.3"}) {
+		t.Fatalf("patched fields not applied, got %+v", patched)
+	}
+	if patched.Name != "node" || patched.PersistentKeepalive != 20 || patched.ID != "node" {
+		t.Fatalf("fields missing from the patch changed, got %+v", patched)
+	}
+	for _, patch := range []string{`["isstatic"]`, `{"isstatic":null}`, `{"isstatc":"yes"}`, `{"persistentkeepalive":"20"}`, `{`} {
+		if _, err := PatchNode(&node, []byte(patch)); !errors.Is(err, ErrInvalidNodePatch) {
+			t.Fatalf("expected patch %s to be invalid, got %v", patch, err)
+		}
+	}
+}
@@ -1,10 +1,15 @@
 package logic
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
 	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-playground/validator/v10"
@@ -18,15 +23,27 @@ import (
 	"github.com/gravitl/netmaker/servercfg"
 	"github.com/gravitl/netmaker/validation"
 	"golang.org/x/crypto/bcrypt"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 )
 
 // RELAY_NODE_ERR - error to return if relay node is unfound
 const RELAY_NODE_ERR = "could not find relay for node"
 
+// ErrNodeVersionConflict - returned when an update was based on a stale copy of the node
+var ErrNodeVersionConflict = errors.New("node was modified since it was read, refresh and retry")
+
+// serializes versioned node updates so the version check and write are atomic
+var nodeUpdateMutex sync.Mutex
+
 // GetNetworkNodes - gets the nodes of a network
 func GetNetworkNodes(network string) ([]models.Node, error) {
+	return GetNetworkNodesContext(context.Background(), network)
+}
+
+// GetNetworkNodesContext - gets the nodes of a network, giving up with the context's error once it ends
+func GetNetworkNodesContext(ctx context.Context, network string) ([]models.Node, error) {
 	var nodes []models.Node
-	allnodes, err := GetAllNodes()
+	allnodes, err := GetAllNodesContext(ctx)
 	if err != nil {
 		return []models.Node{}, err
 	}
@@ -86,13 +103,47 @@ func UncordonNode(nodeid string) (models.Node, error) {
 	}
 	node.SetLastModified()
 	node.IsPending = "no"
+	node.PendingReason = ""
 	data, err := json.Marshal(&node)
 	if err != nil {
 		return node, err
 	}
 
-	err = database.Insert(node.ID, string(data), database.NODES_TABLE_NAME)
-	return node, err
+	if err = database.Insert(node.ID, string(data), database.NODES_TABLE_NAME); err != nil {
+		return node, err
+	}
+	return node, SetNetworkNodesLastModified(node.Network)
+}
+
+// ApproveNodes - uncordons the pending nodes of a network, nodes that are not pending are skipped,
+// returns the outcome per requested node and the nodes that were approved
+func ApproveNodes(network string, nodeids []string) ([]models.NodeApprovalResult, []models.Node) {
+	results := make([]models.NodeApprovalResult, 0, len(nodeids))
+	var approved []models.Node
+	for _, nodeid := range nodeids {
+		result := models.NodeApprovalResult{NodeID: nodeid}
+		node, err := GetNodeByID(nodeid)
+		if err == nil && node.Network != network {
+			err = errors.New("node " + nodeid + " is not on network " + network)
+		}
+		switch {
+		case err != nil:
+			result.Status = models.NODE_APPROVAL_FAILED
+			result.Error = err.Error()
+		case node.IsPending != "yes":
+			result.Status = models.NODE_APPROVAL_SKIPPED
+		default:
+			if node, err = UncordonNode(nodeid); err != nil {
+				result.Status = models.NODE_APPROVAL_FAILED
+				result.Error = err.Error()
+			} else {
+				result.Status = models.NODE_APPROVAL_APPROVED
+				approved = append(approved, node)
+			}
+		}
+		results = append(results, result)
+	}
+	return results, approved
 }
 
 // SetIfLeader - gets the peers of a given server node
@@ -111,10 +162,10 @@ func IsLeader(node *models.Node) bool {
 	}
 	for _, n := range nodes {
 		if n.LastModified > time.Now().Add(-1*time.Minute).Unix() {
-			return n.Address == node.Address
+			return n.PrimaryAddress() == node.PrimaryAddress()
 		}
 	}
-	return len(nodes) <= 1 || nodes[1].Address == node.Address
+	return len(nodes) <= 1 || nodes[1].PrimaryAddress() == node.PrimaryAddress()
 }
 
 // == DB related functions ==
@@ -136,6 +187,28 @@ func UpdateNode(currentNode *models.Node, newNode *models.Node) error {
 		}
 	}
 	newNode.Fill(currentNode)
+	if err = hashNodePassword(currentNode, newNode); err != nil {
+		return err
+	}
+	// acknowledgement requests only travel with a pushed update
+	newNode.UpdateAckID = ""
+	if err = checkStaticAddress(currentNode, newNode.Address, newNode.Address6); err != nil {
+		return err
+	}
+	if err = checkDNSOnlyRoles(newNode); err != nil {
+		return err
+	}
+	newNode.DedupeTags()
+	// nodes report their interfaces on update, a missing egress interface is surfaced on the node
+	newNode.EgressGatewayStatus = egressGatewayStatus(newNode)
+	if newNode.EgressGatewayStatus != "" && newNode.EgressGatewayStatus != currentNode.EgressGatewayStatus {
+		logger.Log(0, "node", newNode.Name, newNode.ID, newNode.EgressGatewayStatus)
+	}
+	if !strings.EqualFold(newNode.Name, currentNode.Name) {
+		if owner := getNodeNameOwner(newNode); owner != "" {
+			return &NodeNameConflictError{Name: newNode.Name, OwnerID: owner}
+		}
+	}
 
 	if currentNode.IsServer == "yes" && !validateServer(currentNode, newNode) {
 		return fmt.Errorf("this operation is not supported on server nodes")
@@ -149,13 +222,58 @@ func UpdateNode(currentNode *models.Node, newNode *models.Node) error {
 		newNode.SetLastModified()
 		if data, err := json.Marshal(newNode); err != nil {
 			return err
-		} else {
-			return database.Insert(newNode.ID, string(data), database.NODES_TABLE_NAME)
+		} else if err = database.Insert(newNode.ID, string(data), database.NODES_TABLE_NAME); err != nil {
+			return err
+		}
+		if newNode.PublicKey != currentNode.PublicKey {
+			reindexNodeKey(newNode, currentNode.PublicKey)
 		}
+		return nil
 	}
 	return fmt.Errorf("failed to update node " + currentNode.ID + ", cannot change ID.")
 }
 
+// UpdateNodeWithVersion - updates a node only if its stored version still matches the version the caller read,
+// a version of 0 skips the check
+func UpdateNodeWithVersion(currentNode *models.Node, newNode *models.Node, version int64) error {
+	nodeUpdateMutex.Lock()
+	defer nodeUpdateMutex.Unlock()
+	if version != 0 {
+		storedNode, err := GetNodeByID(currentNode.ID)
+		if err != nil {
+			return err
+		}
+		if storedNode.ResourceVersion != version {
+			return ErrNodeVersionConflict
+		}
+	}
+	return UpdateNode(currentNode, newNode)
+}
+
+// RevertNodeUpdate - writes a node back as it was before an update that could not be completed, as a new
+// write so its resource version keeps going up, and puts its public key back in the key index
+func RevertNodeUpdate(original *models.Node) error {
+	nodeUpdateMutex.Lock()
+	defer nodeUpdateMutex.Unlock()
+	reverted := *original
+	storedNode, storedErr := GetNodeByID(original.ID)
+	if storedErr == nil {
+		reverted.ResourceVersion = storedNode.ResourceVersion
+	}
+	reverted.SetLastModified()
+	data, err := json.Marshal(&reverted)
+	if err != nil {
+		return err
+	}
+	if err = database.Insert(reverted.ID, string(data), database.NODES_TABLE_NAME); err != nil {
+		return err
+	}
+	if storedErr == nil && storedNode.PublicKey != reverted.PublicKey {
+		reindexNodeKey(&reverted, storedNode.PublicKey)
+	}
+	return nil
+}
+
 // DeleteNodeByID - deletes a node from database or moves into delete nodes table
 func DeleteNodeByID(node *models.Node, exterminate bool) error {
 	var err error
@@ -168,6 +286,7 @@ func DeleteNodeByID(node *models.Node, exterminate bool) error {
 	}
 	if !exterminate {
 		node.Action = models.NODE_DELETE
+		node.DeletedAt = time.Now().Unix()
 		nodedata, err := json.Marshal(&node)
 		if err != nil {
 			return err
@@ -176,6 +295,9 @@ func DeleteNodeByID(node *models.Node, exterminate bool) error {
 		if err != nil {
 			return err
 		}
+		// the node is paused right away rather than left running until the reaper tells it to leave
+		deleted := *node
+		go NodeDeleted(&deleted)
 	} else {
 		if err := database.DeleteRecord(database.DELETED_NODES_TABLE_NAME, key); err != nil {
 			logger.Log(2, err.Error())
@@ -184,6 +306,13 @@ func DeleteNodeByID(node *models.Node, exterminate bool) error {
 	if err = database.DeleteRecord(database.NODES_TABLE_NAME, key); err != nil {
 		return err
 	}
+	if err = DeleteNodeMetrics(node.ID); err != nil {
+		logger.Log(1, "failed to delete metrics of node", node.ID, err.Error())
+	}
+	forgetNodeUpdateStatus(node.ID)
+	if err = SetNetworkNodesLastModified(node.Network); err != nil {
+		logger.Log(1, "failed to set nodes last modified on network", node.Network, err.Error())
+	}
 	if servercfg.IsDNSMode() {
 		SetDNS()
 	}
@@ -197,6 +326,122 @@ func DeleteNodeByID(node *models.Node, exterminate bool) error {
 	return removeLocalServer(node)
 }
 
+// ErrInvalidEndpointOverride - returned when an endpoint override is not a host and port
+var ErrInvalidEndpointOverride = errors.New("endpoint override must be host:port with a port from 1 to 65535")
+
+// ValidateEndpointOverride - checks an endpoint override is a host, an ip or dns name, and a port,
+// empty and ENDPOINT_OVERRIDE_NONE leave or remove an override and are always valid
+func ValidateEndpointOverride(override string) error {
+	if override == "" || override == models.ENDPOINT_OVERRIDE_NONE {
+		return nil
+	}
+	host, port, err := net.SplitHostPort(override)
+	if err != nil || host == "" {
+		return fmt.Errorf("%w: %s", ErrInvalidEndpointOverride, override)
+	}
+	if portNum, err := strconv.Atoi(port); err != nil || portNum < 1 || portNum > 65535 {
+		return fmt.Errorf("%w: %s", ErrInvalidEndpointOverride, override)
+	}
+	return nil
+}
+
+// NODE_NAME_ATTEMPTS - number of random names tried before a numeric suffix is used to make a generated name unique
+const NODE_NAME_ATTEMPTS = 10
+
+// ErrInvalidNodeName - returned when a requested node name breaks the naming rules
+var ErrInvalidNodeName = errors.New("node name must be at most 62 characters of letters, numbers and hyphens")
+
+// NodeNameConflictError - returned when a node name is already used by another node on the network
+type NodeNameConflictError struct {
+	Name    string
+	OwnerID string
+}
+
+// NodeNameConflictError.Error - describes the conflicting name and its owner
+func (e *NodeNameConflictError) Error() string {
+	return fmt.Sprintf("node name %s is already in use by %s", e.Name, e.OwnerID)
+}
+
+// getNodeNameOwner - id of another node on the network with the same name, compared case-insensitively,
+// server nodes and nodes sharing the mac address (soon to be zombies) are not considered
+func getNodeNameOwner(node *models.Node) string {
+	if node.IsServer == "yes" {
+		return ""
+	}
+	nodes, err := GetNetworkNodes(node.Network)
+	if err != nil {
+		return ""
+	}
+	for _, peer := range nodes {
+		if peer.ID == node.ID || peer.IsServer == "yes" || (node.MacAddress != "" && peer.MacAddress == node.MacAddress) {
+			continue
+		}
+		if strings.EqualFold(peer.Name, node.Name) {
+			return peer.ID
+		}
+	}
+	return ""
+}
+
+// ErrInvalidPublicKey - returned when a node's public key is not a wireguard key
+var ErrInvalidPublicKey = errors.New("public key must be a base64 encoded wireguard key")
+
+// PublicKeyConflictError - returned when a public key is already used by another node on the network
+type PublicKeyConflictError struct {
+	PublicKey string
+	OwnerID   string
+}
+
+// PublicKeyConflictError.Error - describes the conflicting key and its owner
+func (e *PublicKeyConflictError) Error() string {
+	return fmt.Sprintf("public key %s is already in use by %s", e.PublicKey, e.OwnerID)
+}
+
+// getPublicKeyOwner - id of another node on the network with the same public key, compared decoded as
+// wireguard compares them, nodes sharing the mac address (soon to be zombies) are not considered
+func getPublicKeyOwner(node *models.Node, key wgtypes.Key) string {
+	nodes, err := GetNetworkNodes(node.Network)
+	if err != nil {
+		return ""
+	}
+	for _, peer := range nodes {
+		if peer.ID == node.ID || (node.MacAddress != "" && peer.MacAddress == node.MacAddress) {
+			continue
+		}
+		if peerKey, err := wgtypes.ParseKey(peer.PublicKey); err == nil && peerKey == key {
+			return peer.ID
+		}
+	}
+	return ""
+}
+
+// generateNodeName - generates a default name that is not used by any node on the network
+func generateNodeName(network string) string {
+	taken := make(map[string]bool)
+	if nodes, err := GetNetworkNodes(network); err == nil {
+		for _, node := range nodes {
+			taken[strings.ToLower(node.Name)] = true
+		}
+	}
+	name := models.GenerateNodeName()
+	for i := 1; i < NODE_NAME_ATTEMPTS && taken[name]; i++ {
+		name = models.GenerateNodeName()
+	}
+	base := name
+	for i := 2; taken[name]; i++ {
+		name = fmt.Sprintf("%s-%d", base, i)
+	}
+	return name
+}
+
+// validateNodeName - checks a requested node name against the node naming rules
+func validateNodeName(node *models.Node) error {
+	if len(node.Name) > 62 || !node.NameInNodeCharSet() {
+		return ErrInvalidNodeName
+	}
+	return nil
+}
+
 // IsNodeIDUnique - checks if node id is unique
 func IsNodeIDUnique(node *models.Node) (bool, error) {
 	_, err := database.FetchRecord(database.NODES_TABLE_NAME, node.ID)
@@ -205,6 +450,11 @@ func IsNodeIDUnique(node *models.Node) (bool, error) {
 
 // ValidateNode - validates node values
 func ValidateNode(node *models.Node, isUpdate bool) error {
+	return newNodeValidator(node, isUpdate).Struct(node)
+}
+
+// newNodeValidator - a validator with the custom node validations registered against node
+func newNodeValidator(node *models.Node, isUpdate bool) *validator.Validate {
 	v := validator.New()
 	_ = v.RegisterValidation("id_unique", func(fl validator.FieldLevel) bool {
 		if isUpdate {
@@ -224,16 +474,20 @@ func ValidateNode(node *models.Node, isUpdate bool) error {
 	_ = v.RegisterValidation("checkyesorno", func(fl validator.FieldLevel) bool {
 		return validation.CheckYesOrNo(fl)
 	})
-	err := v.Struct(node)
-
-	return err
+	_ = v.RegisterValidation("tag_charset", func(fl validator.FieldLevel) bool {
+		return models.TagInNodeCharSet(fl.Field().String())
+	})
+	_ = v.RegisterValidation("description_charset", func(fl validator.FieldLevel) bool {
+		return models.DescriptionInNodeCharSet(fl.Field().String())
+	})
+	return v
 }
 
 // CreateNode - creates a node in database
 func CreateNode(node *models.Node) error {
 
 	//encrypt that password so we never see it
-	hash, err := bcrypt.GenerateFromPassword([]byte(node.Password), 5)
+	hash, err := bcrypt.GenerateFromPassword([]byte(node.Password), servercfg.GetNodePasswordCost())
 	if err != nil {
 		return err
 	}
@@ -242,6 +496,26 @@ func CreateNode(node *models.Node) error {
 	if node.Name == models.NODE_SERVER_NAME {
 		node.IsServer = "yes"
 	}
+	// a requested name is kept as is or rejected, only empty names are generated
+	if node.Name == "" {
+		node.Name = generateNodeName(node.Network)
+	} else if err = validateNodeName(node); err != nil {
+		return err
+	}
+	if owner := getNodeNameOwner(node); owner != "" {
+		return &NodeNameConflictError{Name: node.Name, OwnerID: owner}
+	}
+	// nodes bring their own keys, adopted wireguard peers keep the keypair they already have
+	publicKey, err := wgtypes.ParseKey(node.PublicKey)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidPublicKey, node.PublicKey)
+	}
+	if owner := getPublicKeyOwner(node, publicKey); owner != "" {
+		return &PublicKeyConflictError{PublicKey: node.PublicKey, OwnerID: owner}
+	}
+	if err = checkDNSOnlyRoles(node); err != nil {
+		return err
+	}
 	if node.DNSOn == "" {
 		if servercfg.IsDNSMode() {
 			node.DNSOn = "yes"
@@ -250,6 +524,8 @@ func CreateNode(node *models.Node) error {
 		}
 	}
 
+	// the network's post up and post down are rendered once the node has its addresses
+	postUpFromNetwork, postDownFromNetwork := node.PostUp == "", node.PostDown == ""
 	SetNodeDefaults(node)
 
 	defaultACLVal := acls.Allowed
@@ -260,31 +536,68 @@ func CreateNode(node *models.Node) error {
 		}
 	}
 
+	requested4, requested6, err := parseRequestedAddressRange(&parentNetwork, node.AddressRange)
+	if err != nil {
+		return err
+	}
+	unlock := lockNetworkAddresses(node.Network)
+	defer unlock()
+	// fail with the network's utilization rather than somewhere inside address assignment
+	if err = checkAddressCapacity(node.Network, node.Address == "" && parentNetwork.IsIPv4 == "yes", node.Address6 == "" && parentNetwork.IsIPv6 == "yes"); err != nil {
+		return err
+	}
 	reverse := node.IsServer == "yes"
 	if node.Address == "" {
 		if parentNetwork.IsIPv4 == "yes" {
-			if node.Address, err = UniqueAddress(node.Network, reverse); err != nil {
+			if requested4 != nil {
+				node.Address, err = uniqueAddressInRange(&parentNetwork, requested4, false)
+			} else {
+				node.Address, err = UniqueAddress(node.Network, reverse)
+			}
+			if err != nil {
 				return err
 			}
 		}
-	} else if !IsIPUnique(node.Network, node.Address, database.NODES_TABLE_NAME, false) {
+	} else if !IsIPUnique(node.Network, node.Address, database.NODES_TABLE_NAME, false) ||
+		!IsIPUnique(node.Network, node.Address, database.DELETED_NODES_TABLE_NAME, false) {
 		return fmt.Errorf("invalid address: ipv4 " + node.Address + " is not unique")
 	}
 
 	if node.Address6 == "" {
 		if parentNetwork.IsIPv6 == "yes" {
-			if node.Address6, err = UniqueAddress6(node.Network, reverse); err != nil {
+			if requested6 != nil {
+				node.Address6, err = uniqueAddressInRange(&parentNetwork, requested6, true)
+			} else {
+				node.Address6, err = UniqueAddress6(node.Network, reverse)
+			}
+			if err != nil {
 				return err
 			}
 		}
-	} else if !IsIPUnique(node.Network, node.Address6, database.NODES_TABLE_NAME, true) {
+	} else if !IsIPUnique(node.Network, node.Address6, database.NODES_TABLE_NAME, true) ||
+		!IsIPUnique(node.Network, node.Address6, database.DELETED_NODES_TABLE_NAME, true) {
 		return fmt.Errorf("invalid address: ipv6 " + node.Address6 + " is not unique")
 	}
+	if node.Address == "" && node.Address6 == "" {
+		return fmt.Errorf("no ipv4 or ipv6 address available for node on network " + node.Network)
+	}
+	if postUpFromNetwork {
+		if node.PostUp, err = renderPostCommand(parentNetwork.DefaultPostUp, node); err != nil {
+			return fmt.Errorf("%w: defaultpostup: %s", ErrInvalidPostCommandTemplate, err)
+		}
+	}
+	if postDownFromNetwork {
+		if node.PostDown, err = renderPostCommand(parentNetwork.DefaultPostDown, node); err != nil {
+			return fmt.Errorf("%w: defaultpostdown: %s", ErrInvalidPostCommandTemplate, err)
+		}
+	}
 
 	node.ID = uuid.NewString()
+	node.CreatedAt = time.Now().Unix()
+	node.DedupeTags()
 
 	//Create a JWT for the node
-	tokenString, _ := CreateJWT(node.ID, node.MacAddress, node.Network)
+	tokenString, _ := CreateJWT(node.ID, node.MacAddress, node.Network, GetNodeTokenLifetime(&parentNetwork))
 	if tokenString == "" {
 		//returnErrorResponse(w, r, errorResponse)
 		return err
@@ -294,6 +607,12 @@ func CreateNode(node *models.Node) error {
 		return err
 	}
 	CheckZombies(node)
+	// the key is checked and a use taken under the network lock, so concurrent joins can not spend the same use
+	if node.IsPending != "yes" {
+		if err = DecrimentKey(node.Network, node.AccessKey); err != nil {
+			return err
+		}
+	}
 
 	nodebytes, err := json.Marshal(&node)
 	if err != nil {
@@ -303,6 +622,7 @@ func CreateNode(node *models.Node) error {
 	if err != nil {
 		return err
 	}
+	indexNodeKey(node)
 
 	_, err = nodeacls.CreateNodeACL(nodeacls.NetworkID(node.Network), nodeacls.NodeID(node.ID), defaultACLVal)
 	if err != nil {
@@ -310,9 +630,6 @@ func CreateNode(node *models.Node) error {
 		return err
 	}
 
-	if node.IsPending != "yes" {
-		DecrimentKey(node.Network, node.AccessKey)
-	}
 	SetNetworkNodesLastModified(node.Network)
 	if servercfg.IsDNSMode() {
 		err = SetDNS()
@@ -322,9 +639,14 @@ func CreateNode(node *models.Node) error {
 
 // GetAllNodes - returns all nodes in the DB
 func GetAllNodes() ([]models.Node, error) {
+	return GetAllNodesContext(context.Background())
+}
+
+// GetAllNodesContext - gets all nodes, giving up with the context's error once it ends
+func GetAllNodesContext(ctx context.Context) ([]models.Node, error) {
 	var nodes []models.Node
 
-	collection, err := database.FetchRecords(database.NODES_TABLE_NAME)
+	collection, err := database.FetchRecordsContext(ctx, database.NODES_TABLE_NAME)
 	if err != nil {
 		if database.IsEmptyRecord(err) {
 			return []models.Node{}, nil
@@ -395,12 +717,10 @@ func SetNodeDefaults(node *models.Node) {
 		node.PersistentKeepalive = parentNetwork.DefaultKeepalive
 	}
 	if node.PostUp == "" {
-		postup := parentNetwork.DefaultPostUp
-		node.PostUp = postup
+		node.PostUp, _ = renderPostCommand(parentNetwork.DefaultPostUp, node)
 	}
 	if node.PostDown == "" {
-		postdown := parentNetwork.DefaultPostDown
-		node.PostDown = postdown
+		node.PostDown, _ = renderPostCommand(parentNetwork.DefaultPostDown, node)
 	}
 	if node.IsStatic == "" {
 		node.IsStatic = "no"
@@ -538,6 +858,55 @@ func GetNodeRelay(network string, relayedNodeAddr string) (models.Node, error) {
 	return relay, errors.New(RELAY_NODE_ERR + " " + relayedNodeAddr)
 }
 
+// RehashNodePassword - stores the password a node just authenticated with hashed at the configured cost
+// when its stored hash is weaker, only the hash of the stored node changes and it is left alone when
+// the password changed since the node authenticated
+func RehashNodePassword(node *models.Node, password string) error {
+	target := servercfg.GetNodePasswordCost()
+	cost, err := bcrypt.Cost([]byte(node.Password))
+	if err != nil || cost >= target {
+		return err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), target)
+	if err != nil {
+		return err
+	}
+	nodeUpdateMutex.Lock()
+	defer nodeUpdateMutex.Unlock()
+	storedNode, err := GetNodeByID(node.ID)
+	if err != nil {
+		return err
+	}
+	if storedNode.Password != node.Password {
+		return nil
+	}
+	storedNode.Password = string(hash)
+	data, err := json.Marshal(&storedNode)
+	if err != nil {
+		return err
+	}
+	if err = database.Insert(storedNode.ID, string(data), database.NODES_TABLE_NAME); err != nil {
+		return err
+	}
+	node.Password = storedNode.Password
+	return nil
+}
+
+// hashNodePassword - hashes a password an update changed at the configured cost, one sent as the
+// stored hash, or hashing the stored hash, is kept as it is
+func hashNodePassword(currentNode, newNode *models.Node) error {
+	if newNode.Password == currentNode.Password ||
+		bcrypt.CompareHashAndPassword([]byte(newNode.Password), []byte(currentNode.Password)) == nil {
+		return nil
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(newNode.Password), servercfg.GetNodePasswordCost())
+	if err != nil {
+		return err
+	}
+	newNode.Password = string(hash)
+	return nil
+}
+
 func GetNodeByID(uuid string) (models.Node, error) {
 	var record, err = database.FetchRecord(database.NODES_TABLE_NAME, uuid)
 	if err != nil {
@@ -611,6 +980,12 @@ func IsLocalServer(node *models.Node) bool {
 	return node.ID != "" && local.ID == node.ID
 }
 
+// IsNodeConnected - checks if a node has checked in within the configured timeout
+func IsNodeConnected(node *models.Node) bool {
+	timeout := time.Duration(servercfg.GetNodeCheckInTimeout()) * time.Second
+	return time.Since(time.Unix(node.LastCheckIn, 0)) < timeout
+}
+
 // validateServer - make sure servers dont change port or address
 func validateServer(currentNode, newNode *models.Node) bool {
 	return (newNode.Address == currentNode.Address &&
@@ -677,7 +1052,7 @@ func FindRelay(node *models.Node) *models.Node {
 			continue
 		}
 		for _, ip := range peer.RelayAddrs {
-			if ip == node.Address || ip == node.Address6 {
+			if ip != "" && (ip == node.Address || ip == node.Address6) {
 				return &peer
 			}
 		}
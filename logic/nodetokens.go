@@ -0,0 +1,103 @@
+package logic
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gravitl/netmaker/models"
+	"github.com/gravitl/netmaker/netclient/ncutils"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+const (
+	// NODE_TOKEN_CHALLENGE_TTL - seconds a node has to answer a node token challenge
+	NODE_TOKEN_CHALLENGE_TTL = 300
+)
+
+// ErrInvalidNodeTokenChallenge - returned when a node token challenge is unknown, expired or wrongly answered
+var ErrInvalidNodeTokenChallenge = errors.New("invalid or expired node token challenge")
+
+var (
+	// nodeTokenChallenges - the outstanding challenge of each node by node id, so there are never more
+	// challenges than nodes
+	nodeTokenChallenges      = make(map[string]models.NodeTokenChallenge)
+	nodeTokenChallengesMutex sync.Mutex
+)
+
+// CreateNodeTokenChallenge - creates a single use nonce for a node to seal with its wireguard private key,
+// along with the server traffic key to seal it to; it replaces the node's earlier challenge, if any
+func CreateNodeTokenChallenge(nodeid string) (models.NodeTokenChallenge, error) {
+	serverKey, err := RetrievePublicTrafficKey()
+	if err != nil {
+		return models.NodeTokenChallenge{}, err
+	}
+	nonce, err := GenerateCryptoString(32)
+	if err != nil {
+		return models.NodeTokenChallenge{}, err
+	}
+	challenge := models.NodeTokenChallenge{
+		NodeID:    nodeid,
+		Nonce:     nonce,
+		Expires:   time.Now().Unix() + NODE_TOKEN_CHALLENGE_TTL,
+		ServerKey: serverKey,
+	}
+	nodeTokenChallengesMutex.Lock()
+	defer nodeTokenChallengesMutex.Unlock()
+	pruneNodeTokenChallenges()
+	nodeTokenChallenges[nodeid] = challenge
+	return challenge, nil
+}
+
+// VerifyNodeTokenChallenge - consumes a challenge and checks it was sealed with the private key
+// matching the node's wireguard public key, a box only opens for the key pair that sealed it
+func VerifyNodeTokenChallenge(node *models.Node, nonce, signature string) error {
+	nodeTokenChallengesMutex.Lock()
+	challenge, ok := nodeTokenChallenges[node.ID]
+	// a wrong nonce leaves the challenge for the node to answer
+	if ok && subtle.ConstantTimeCompare([]byte(challenge.Nonce), []byte(nonce)) != 1 {
+		ok = false
+	} else {
+		delete(nodeTokenChallenges, node.ID)
+	}
+	nodeTokenChallengesMutex.Unlock()
+	if !ok || challenge.Expires < time.Now().Unix() {
+		return ErrInvalidNodeTokenChallenge
+	}
+	sealed, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil || len(sealed) < 24 {
+		return ErrInvalidNodeTokenChallenge
+	}
+	nodeKey, err := wgtypes.ParseKey(node.PublicKey)
+	if err != nil {
+		return err
+	}
+	privateKey, err := RetrievePrivateTrafficKey()
+	if err != nil {
+		return err
+	}
+	serverKey, err := ncutils.ConvertBytesToKey(privateKey)
+	if err != nil {
+		return err
+	}
+	nodePublicKey := [32]byte(nodeKey)
+	opened, err := ncutils.BoxDecrypt(sealed, &nodePublicKey, serverKey)
+	if err != nil || subtle.ConstantTimeCompare(opened, []byte(challenge.Nonce)) != 1 {
+		return ErrInvalidNodeTokenChallenge
+	}
+	return nil
+}
+
+// == private ==
+
+// pruneNodeTokenChallenges - removes expired challenges, caller must hold the lock
+func pruneNodeTokenChallenges() {
+	now := time.Now().Unix()
+	for nodeid, challenge := range nodeTokenChallenges {
+		if challenge.Expires < now {
+			delete(nodeTokenChallenges, nodeid)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package logic
+
+import (
+	"net"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gravitl/netmaker/models"
+)
+
+// InvalidNodeFieldsError - returned when fields of a node update fail validation, lists every one of them
+type InvalidNodeFieldsError struct {
+	Fields []models.FieldError
+}
+
+// InvalidNodeFieldsError.Error - names each invalid field and why it was rejected
+func (e *InvalidNodeFieldsError) Error() string {
+	reasons := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		reasons[i] = field.Field + " " + field.Reason
+	}
+	return "invalid node fields: " + strings.Join(reasons, ", ")
+}
+
+// ValidateNodeUpdate - checks each field of an update as it would be stored, empty fields keep the
+// current node's value, and returns an InvalidNodeFieldsError listing every invalid field
+func ValidateNodeUpdate(currentNode, newNode *models.Node) error {
+	candidate := *newNode
+	candidate.Fill(currentNode)
+	var fields []models.FieldError
+	v := newNodeValidator(&candidate, true)
+	// report fields by the names clients send them as
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		return strings.Split(field.Tag.Get("json"), ",")[0]
+	})
+	if err := v.Struct(&candidate); err != nil {
+		validationErrors, ok := err.(validator.ValidationErrors)
+		if !ok {
+			return err
+		}
+		for _, e := range validationErrors {
+			fields = append(fields, models.FieldError{Field: e.Field(), Reason: fieldErrorReason(e)})
+		}
+	}
+	if network, err := GetParentNetwork(candidate.Network); err == nil {
+		if candidate.Address != currentNode.Address && candidate.Address != "" && !IsAddressInCIDR(candidate.Address, network.AddressRange) {
+			fields = append(fields, models.FieldError{Field: "address", Reason: "must be within the network range " + network.AddressRange})
+		}
+		if candidate.Address6 != currentNode.Address6 && candidate.Address6 != "" && !IsAddressInCIDR(candidate.Address6, network.AddressRange6) {
+			fields = append(fields, models.FieldError{Field: "address6", Reason: "must be within the network range " + network.AddressRange6})
+		}
+	}
+	if checkDNSOnlyRoles(&candidate) != nil {
+		fields = append(fields, models.FieldError{Field: "isdnsonly", Reason: "cannot be combined with gateway or relay roles"})
+	}
+	// stored values were accepted before, only ranges sent with the update are checked
+	if newNode.LocalRange != "" {
+		if _, _, err := net.ParseCIDR(newNode.LocalRange); err != nil {
+			fields = append(fields, models.FieldError{Field: "localrange", Reason: "must be in CIDR notation"})
+		}
+	}
+	for _, allowedIP := range newNode.AllowedIPs {
+		if _, _, err := net.ParseCIDR(allowedIP); err != nil && net.ParseIP(allowedIP) == nil {
+			fields = append(fields, models.FieldError{Field: "allowedips", Reason: allowedIP + " is not an ip address or in CIDR notation"})
+		}
+	}
+	if len(fields) > 0 {
+		return &InvalidNodeFieldsError{Fields: fields}
+	}
+	return nil
+}
+
+// fieldErrorReason - why a field failed a validation tag, worded for the client
+func fieldErrorReason(e validator.FieldError) string {
+	switch e.Tag() {
+	case "required":
+		return "is required"
+	case "ip":
+		return "must be an ip address"
+	case "ipv4":
+		return "must be an ipv4 address"
+	case "ipv6":
+		return "must be an ipv6 address"
+	case "numeric":
+		return "must be a number"
+	case "base64":
+		return "must be base64 encoded"
+	case "min":
+		return "must be at least " + e.Param() + lengthUnit(e.Kind())
+	case "max":
+		return "must be at most " + e.Param() + lengthUnit(e.Kind())
+	case "checkyesorno":
+		return `must be "yes" or "no"`
+	case "in_charset":
+		return "may only contain letters, numbers and hyphens"
+	case "tag_charset", "description_charset":
+		return "contains characters that are not allowed"
+	case "network_exists":
+		return "must be an existing network"
+	}
+	return "failed the " + e.Tag() + " check"
+}
+
+// lengthUnit - what a min or max counts for a kind of field, nothing for numbers
+func lengthUnit(kind reflect.Kind) string {
+	switch kind {
+	case reflect.String:
+		return " characters"
+	case reflect.Slice, reflect.Map:
+		return " entries"
+	}
+	return ""
+}
@@ -1,10 +1,12 @@
 package logic
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
 	"net"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -12,7 +14,9 @@ import (
 	"github.com/c-robinson/iplib"
 	"github.com/gravitl/netmaker/database"
 	"github.com/gravitl/netmaker/logger"
+	"github.com/gravitl/netmaker/logic/acls"
 	"github.com/gravitl/netmaker/logic/acls/nodeacls"
+	"github.com/gravitl/netmaker/logic/metrics"
 	"github.com/gravitl/netmaker/models"
 	"github.com/gravitl/netmaker/netclient/ncutils"
 	"github.com/gravitl/netmaker/servercfg"
@@ -21,8 +25,27 @@ import (
 
 // GetPeerUpdate - gets a wireguard peer config for each peer of a node
 func GetPeerUpdate(node *models.Node) (models.PeerUpdate, error) {
-	var peerUpdate models.PeerUpdate
-	var peers []wgtypes.PeerConfig
+	return GetPeerUpdateContext(context.Background(), node)
+}
+
+// GetPeerUpdateContext - gets the peer update of a node, giving up with the context's error once it ends
+func GetPeerUpdateContext(ctx context.Context, node *models.Node) (models.PeerUpdate, error) {
+	start := time.Now()
+	peerUpdate, err := getPeerUpdate(ctx, node)
+	metrics.ObservePeerUpdate(node.Network, start, err)
+	return peerUpdate, err
+}
+
+func getPeerUpdate(ctx context.Context, node *models.Node) (models.PeerUpdate, error) {
+	// returned as is on the empty record path, so callers never see nil slices
+	var peerUpdate = models.PeerUpdate{
+		Network:       node.Network,
+		ServerVersion: servercfg.Version,
+		ServerAddrs:   []models.ServerAddr{},
+		Peers:         []wgtypes.PeerConfig{},
+		ACLDecisions:  []models.PeerACLDecision{},
+	}
+	var peers = []wgtypes.PeerConfig{}
 	var serverNodeAddresses = []models.ServerAddr{}
 	var isP2S bool
 	network, err := GetNetwork(node.Network)
@@ -31,6 +54,8 @@ func GetPeerUpdate(node *models.Node) (models.PeerUpdate, error) {
 	} else if network.IsPointToSite == "yes" && node.IsHub != "yes" {
 		isP2S = true
 	}
+	peerUpdate.DefaultACL = network.DefaultACL
+	presharedKeySecret := getNetworkPresharedKeySecret(&network, node)
 
 	// udppeers = the peers parsed from the local interface
 	// gives us correct port to reach
@@ -39,19 +64,32 @@ func GetPeerUpdate(node *models.Node) (models.PeerUpdate, error) {
 		logger.Log(2, errN.Error())
 	}
 
-	currentPeers, err := GetNetworkNodes(node.Network)
+	currentPeers, err := GetNetworkNodesContext(ctx, node.Network)
 	if err != nil {
-		return models.PeerUpdate{}, err
+		return peerUpdate, err
+	}
+	networkACL, err := nodeacls.FetchAllACLs(nodeacls.NetworkID(node.Network))
+	if err != nil {
+		networkACL = acls.ACLContainer{}
 	}
+	aclDecisions := getPeerACLDecisions(node, currentPeers, networkACL)
 
 	if node.IsRelayed == "yes" {
-		return GetPeerUpdateForRelayedNode(node, udppeers)
+		relayedPeerUpdate, err := GetPeerUpdateForRelayedNode(node, udppeers)
+		relayedPeerUpdate.DefaultACL = network.DefaultACL
+		relayedPeerUpdate.ACLDecisions = aclDecisions
+		relayedPeerUpdate.PeerEpoch = network.PeerEpoch
+		return relayedPeerUpdate, err
 	}
 
 	// #1 Set Keepalive values: set_keepalive
 	// #2 Set local address: set_local - could be a LOT BETTER and fix some bugs with additional logic
 	// #3 Set allowedips: set_allowedips
 	for _, peer := range currentPeers {
+		// the allowed ips of gateway and relay peers read the database again
+		if err := ctx.Err(); err != nil {
+			return peerUpdate, err
+		}
 
 		// if the node is not a server, set the endpoint
 		var setEndpoint = !(node.IsServer == "yes")
@@ -60,6 +98,10 @@ func GetPeerUpdate(node *models.Node) (models.PeerUpdate, error) {
 			//skip yourself
 			continue
 		}
+		if peer.IsDNSOnly == "yes" || node.IsDNSOnly == "yes" {
+			// dns only nodes have no tunnel, they only anchor dns records
+			continue
+		}
 		if peer.IsRelayed == "yes" {
 			if !(node.IsRelay == "yes" && ncutils.StringSliceContains(node.RelayAddrs, peer.PrimaryAddress())) {
 				//skip -- will be added to relay
@@ -69,7 +111,7 @@ func GetPeerUpdate(node *models.Node) (models.PeerUpdate, error) {
 				setEndpoint = false
 			}
 		}
-		if !nodeacls.AreNodesAllowed(nodeacls.NetworkID(node.Network), nodeacls.NodeID(node.ID), nodeacls.NodeID(peer.ID)) {
+		if !networkACL.IsAllowed(acls.AclID(node.ID), acls.AclID(peer.ID)) {
 			//skip if not permitted by acl
 			continue
 		}
@@ -81,7 +123,8 @@ func GetPeerUpdate(node *models.Node) (models.PeerUpdate, error) {
 		if err != nil {
 			return models.PeerUpdate{}, err
 		}
-		if node.Endpoint == peer.Endpoint {
+		// an endpoint override is used as is, even for peers that share the node's public ip
+		if node.Endpoint == peer.Endpoint && peer.EndpointOverride == "" {
 			//peer is on same network
 			// set_local
 			if node.LocalAddress != peer.LocalAddress && peer.LocalAddress != "" {
@@ -103,6 +146,9 @@ func GetPeerUpdate(node *models.Node) (models.PeerUpdate, error) {
 		// - udppeers retrieval did not return an error
 		// - the endpoint is valid
 		if setEndpoint {
+			address = getEndpointOverride(&peer)
+		}
+		if setEndpoint && address == nil {
 
 			var setUDPPort = false
 			if peer.UDPHolePunch == "yes" && errN == nil && CheckEndpoint(udppeers[peer.PublicKey]) {
@@ -130,14 +176,12 @@ func GetPeerUpdate(node *models.Node) (models.PeerUpdate, error) {
 			}
 		}
 		// set_allowedips
-		allowedips := GetAllowedIPs(node, &peer)
-		var keepalive time.Duration
-		if node.PersistentKeepalive != 0 {
-			// set_keepalive
-			keepalive, _ = time.ParseDuration(strconv.FormatInt(int64(node.PersistentKeepalive), 10) + "s")
-		}
+		allowedips := GetAllowedIPs(node, &peer, currentPeers)
+		// set_keepalive
+		keepalive := getPeerKeepalive(node, network.DefaultKeepalive)
 		var peerData = wgtypes.PeerConfig{
 			PublicKey:                   pubkey,
+			PresharedKey:                getPeerPresharedKey(presharedKeySecret, node, &peer),
 			Endpoint:                    address,
 			ReplaceAllowedIPs:           true,
 			AllowedIPs:                  allowedips,
@@ -146,7 +190,7 @@ func GetPeerUpdate(node *models.Node) (models.PeerUpdate, error) {
 
 		peers = append(peers, peerData)
 		if peer.IsServer == "yes" {
-			serverNodeAddresses = append(serverNodeAddresses, models.ServerAddr{IsLeader: IsLeader(&peer), Address: peer.Address})
+			serverNodeAddresses = append(serverNodeAddresses, models.ServerAddr{IsLeader: IsLeader(&peer), Address: peer.PrimaryAddress()})
 		}
 	}
 	if node.IsIngressGateway == "yes" {
@@ -163,9 +207,135 @@ func GetPeerUpdate(node *models.Node) (models.PeerUpdate, error) {
 	peerUpdate.Peers = peers
 	peerUpdate.ServerAddrs = serverNodeAddresses
 	peerUpdate.DNS = getPeerDNS(node.Network)
+	peerUpdate.DefaultACL = network.DefaultACL
+	peerUpdate.ACLDecisions = aclDecisions
+	peerUpdate.PeerLabels = getPeerLabels(currentPeers, peers)
+	peerUpdate.PeerEpoch = network.PeerEpoch
+	sortPeerUpdate(&peerUpdate)
 	return peerUpdate, nil
 }
 
+// sortPeerUpdate - orders the peers by public key, their allowed ips and the server addresses by address, nodes
+// come out of the database in no particular order and clients and etags compare updates to spot changes
+func sortPeerUpdate(peerUpdate *models.PeerUpdate) {
+	for i := range peerUpdate.Peers {
+		allowedIPs := peerUpdate.Peers[i].AllowedIPs
+		sort.Slice(allowedIPs, func(a, b int) bool {
+			return allowedIPs[a].String() < allowedIPs[b].String()
+		})
+	}
+	sort.Slice(peerUpdate.Peers, func(i, j int) bool {
+		return peerUpdate.Peers[i].PublicKey.String() < peerUpdate.Peers[j].PublicKey.String()
+	})
+	sort.Slice(peerUpdate.ServerAddrs, func(i, j int) bool {
+		return peerUpdate.ServerAddrs[i].Address < peerUpdate.ServerAddrs[j].Address
+	})
+}
+
+// getPeerLabels - the descriptions of the nodes among the peers, nil when none of them has one
+func getPeerLabels(nodes []models.Node, peers []wgtypes.PeerConfig) map[string]string {
+	descriptions := make(map[string]string)
+	for _, node := range nodes {
+		if node.Description != "" {
+			descriptions[node.PublicKey] = node.Description
+		}
+	}
+	var labels map[string]string
+	for _, peer := range peers {
+		if description, ok := descriptions[peer.PublicKey.String()]; ok {
+			if labels == nil {
+				labels = make(map[string]string)
+			}
+			labels[peer.PublicKey.String()] = description
+		}
+	}
+	return labels
+}
+
+// getPeerACLDecisions - the acl decision between a node and every other node of its network,
+// so operators can tell an acl denial apart from the other reasons a peer is left out
+func getPeerACLDecisions(node *models.Node, nodes []models.Node, networkACL acls.ACLContainer) []models.PeerACLDecision {
+	decisions := []models.PeerACLDecision{}
+	for _, peer := range nodes {
+		if peer.ID == node.ID {
+			continue
+		}
+		decision := models.PeerACLDecision{NodeID: peer.ID, Name: peer.Name, Reason: models.PEER_ACL_ALLOWED}
+		switch {
+		case !networkACL[acls.AclID(node.ID)].IsAllowed(acls.AclID(peer.ID)):
+			decision.Reason = models.PEER_ACL_DENIED_BY_NODE
+		case !networkACL[acls.AclID(peer.ID)].IsAllowed(acls.AclID(node.ID)):
+			decision.Reason = models.PEER_ACL_DENIED_BY_PEER
+		default:
+			decision.Allowed = true
+		}
+		decisions = append(decisions, decision)
+	}
+	sort.Slice(decisions, func(i, j int) bool { return decisions[i].NodeID < decisions[j].NodeID })
+	return decisions
+}
+
+// ExplainPeerUpdate - annotates every peer of a node's peer update with the reason it was included
+// and lists the nodes of the network left out by the acl
+func ExplainPeerUpdate(node *models.Node, peerUpdate *models.PeerUpdate) (models.PeerUpdateExplanation, error) {
+	explanation := models.PeerUpdateExplanation{
+		PeerUpdate:    *peerUpdate,
+		Peers:         []models.PeerExplanation{},
+		ExcludedByACL: []models.PeerACLDecision{},
+	}
+	nodes, err := GetNetworkNodes(node.Network)
+	if err != nil {
+		return explanation, err
+	}
+	nodesByKey := make(map[string]models.Node, len(nodes))
+	for _, peer := range nodes {
+		nodesByKey[peer.PublicKey] = peer
+	}
+	extClientsByKey := make(map[string]models.ExtClient)
+	if node.IsIngressGateway == "yes" {
+		if extClients, err := GetNetworkExtClients(node.Network); err == nil {
+			for _, extClient := range extClients {
+				extClientsByKey[extClient.PublicKey] = extClient
+			}
+		}
+	}
+	for _, peer := range peerUpdate.Peers {
+		peerExplanation := models.PeerExplanation{PublicKey: peer.PublicKey.String()}
+		if peerNode, ok := nodesByKey[peerExplanation.PublicKey]; ok {
+			peerExplanation.NodeID = peerNode.ID
+			peerExplanation.Name = peerNode.Name
+			peerExplanation.Reason = getPeerReason(node, &peerNode)
+		} else {
+			peerExplanation.Name = extClientsByKey[peerExplanation.PublicKey].ClientID
+			peerExplanation.Reason = models.PEER_REASON_EXT_CLIENT
+		}
+		explanation.Peers = append(explanation.Peers, peerExplanation)
+	}
+	for _, decision := range peerUpdate.ACLDecisions {
+		if !decision.Allowed {
+			explanation.ExcludedByACL = append(explanation.ExcludedByACL, decision)
+		}
+	}
+	return explanation, nil
+}
+
+// getPeerReason - why a node of the network is a peer of the given node
+func getPeerReason(node, peer *models.Node) string {
+	switch {
+	case node.IsRelayed == "yes" && peer.IsRelay == "yes" &&
+		(ncutils.StringSliceContains(peer.RelayAddrs, node.Address) || ncutils.StringSliceContains(peer.RelayAddrs, node.Address6)):
+		return models.PEER_REASON_RELAY
+	case node.IsRelay == "yes" && ncutils.StringSliceContains(node.RelayAddrs, peer.PrimaryAddress()):
+		return models.PEER_REASON_RELAYED
+	case peer.IsEgressGateway == "yes":
+		return models.PEER_REASON_EGRESS_GATEWAY
+	case peer.IsIngressGateway == "yes":
+		return models.PEER_REASON_INGRESS_GATEWAY
+	default:
+		return models.PEER_REASON_NETWORK
+	}
+}
+
 func getExtPeers(node *models.Node) ([]wgtypes.PeerConfig, error) {
 	var peers []wgtypes.PeerConfig
 	extPeers, err := GetExtPeersList(node)
@@ -215,8 +385,9 @@ func getExtPeers(node *models.Node) ([]wgtypes.PeerConfig, error) {
 
 }
 
-// GetAllowedIPs - calculates the wireguard allowedip field for a peer of a node based on the peer and node settings
-func GetAllowedIPs(node, peer *models.Node) []net.IPNet {
+// GetAllowedIPs - calculates the wireguard allowedip field for a peer of a node based on the peer and node settings,
+// networkNodes are the nodes of the peer's network the caller already loaded, checked for preferred egress gateways
+func GetAllowedIPs(node, peer *models.Node, networkNodes []models.Node) []net.IPNet {
 	var allowedips []net.IPNet
 
 	if peer.Address != "" {
@@ -260,6 +431,10 @@ func GetAllowedIPs(node, peer *models.Node) []net.IPNet {
 			}
 		}
 	}
+	// draining peers keep their own addresses but are no longer gateway or relay targets
+	if IsNodeDraining(peer) {
+		return allowedips
+	}
 	// handle egress gateway peers
 	if peer.IsEgressGateway == "yes" {
 		//hasGateway = true
@@ -280,6 +455,10 @@ func GetAllowedIPs(node, peer *models.Node) []net.IPNet {
 				logger.Log(2, "egress IP range of ", iprange, " overlaps with ", node.LocalAddress, ", omitting")
 				continue // skip adding egress range if overlaps with node's local ip
 			}
+			if preferred := getPreferredEgressGateway(node, peer, networkNodes, ipnet); preferred != nil {
+				logger.Log(2, "egress IP range of ", iprange, " is routed through ", preferred.Name, " over ", peer.Name, ", omitting")
+				continue // skip adding egress range if a gateway with a lower metric covers it
+			}
 			if err != nil {
 				logger.Log(1, "error encountered when setting egress range", err.Error())
 			} else {
@@ -299,24 +478,31 @@ func GetAllowedIPs(node, peer *models.Node) []net.IPNet {
 	}
 	// handle relay gateway peers
 	if peer.IsRelay == "yes" {
-		for _, ip := range peer.RelayAddrs {
-			//find node ID of relayed peer
-			relayedPeer, err := findNode(ip)
-			if err != nil {
-				logger.Log(0, "failed to find node for ip ", ip, err.Error())
-				continue
-			}
-			if relayedPeer == nil {
-				continue
-			}
-			if relayedPeer.ID == node.ID {
-				//skip self
-				continue
-			}
-			//check if acl permits comms
-			if !nodeacls.AreNodesAllowed(nodeacls.NetworkID(node.Network), nodeacls.NodeID(node.ID), nodeacls.NodeID(relayedPeer.ID)) {
-				continue
-			}
+		allowedips = append(allowedips, getRelayedAllowedIPs(node, peer, map[string]bool{peer.ID: true})...)
+	}
+	return allowedips
+}
+
+// getRelayedAllowedIPs - the addresses of the nodes a relay carries for the given node, a relayed node
+// that is a relay itself adds the nodes it relays so traffic is routed down every hop of the chain
+func getRelayedAllowedIPs(node, relay *models.Node, visited map[string]bool) []net.IPNet {
+	var allowedips []net.IPNet
+	for _, ip := range relay.RelayAddrs {
+		//find node ID of relayed peer
+		relayedPeer, err := findNode(ip)
+		if err != nil {
+			logger.Log(0, "failed to find node for ip ", ip, err.Error())
+			continue
+		}
+		if relayedPeer == nil {
+			continue
+		}
+		if relayedPeer.ID == node.ID {
+			//skip self, the node reaches what it relays directly
+			continue
+		}
+		//check if acl permits comms
+		if nodeacls.AreNodesAllowed(nodeacls.NetworkID(node.Network), nodeacls.NodeID(node.ID), nodeacls.NodeID(relayedPeer.ID)) {
 			if iplib.Version(net.ParseIP(ip)) == 4 {
 				relayAddr := net.IPNet{
 					IP:   net.ParseIP(ip),
@@ -332,15 +518,51 @@ func GetAllowedIPs(node, peer *models.Node) []net.IPNet {
 				allowedips = append(allowedips, relayAddr)
 			}
 		}
+		if relayedPeer.IsRelay == "yes" && !visited[relayedPeer.ID] {
+			visited[relayedPeer.ID] = true
+			allowedips = append(allowedips, getRelayedAllowedIPs(node, relayedPeer, visited)...)
+		}
 	}
 	return allowedips
 }
 
+// getRelayedNodePeers - the nodes relayed by a relay that is relayed itself, they reach the relay
+// through their own endpoints so none is set
+func getRelayedNodePeers(node *models.Node, presharedKeySecret []byte, keepalive *time.Duration) ([]wgtypes.PeerConfig, error) {
+	var peers []wgtypes.PeerConfig
+	networkNodes, err := GetNetworkNodes(node.Network)
+	if err != nil {
+		return peers, err
+	}
+	for _, peer := range networkNodes {
+		if peer.ID == node.ID || !ncutils.StringSliceContains(node.RelayAddrs, peer.PrimaryAddress()) {
+			continue
+		}
+		if !nodeacls.AreNodesAllowed(nodeacls.NetworkID(node.Network), nodeacls.NodeID(node.ID), nodeacls.NodeID(peer.ID)) {
+			continue
+		}
+		pubkey, err := wgtypes.ParseKey(peer.PublicKey)
+		if err != nil {
+			return peers, err
+		}
+		peers = append(peers, wgtypes.PeerConfig{
+			PublicKey:                   pubkey,
+			PresharedKey:                getPeerPresharedKey(presharedKeySecret, node, &peer),
+			ReplaceAllowedIPs:           true,
+			AllowedIPs:                  GetAllowedIPs(node, &peer, networkNodes),
+			PersistentKeepaliveInterval: keepalive,
+		})
+	}
+	return peers, nil
+}
+
 func getPeerDNS(network string) string {
 	var dns string
 	if nodes, err := GetNetworkNodes(network); err == nil {
 		for i := range nodes {
-			dns = dns + fmt.Sprintf("%s %s.%s\n", nodes[i].Address, nodes[i].Name, nodes[i].Network)
+			if address := nodes[i].PrimaryAddress(); address != "" {
+				dns = dns + fmt.Sprintf("%s %s.%s\n", address, nodes[i].Name, nodes[i].Network)
+			}
 		}
 	}
 
@@ -354,12 +576,17 @@ func getPeerDNS(network string) string {
 }
 
 // GetPeerUpdateForRelayedNode - calculates peer update for a relayed node by getting the relay
-// copying the relay node's allowed ips and making appropriate substitutions
+// copying the relay node's allowed ips and making appropriate substitutions,
+// a relayed node that is a relay itself also peers directly with the nodes it relays
 func GetPeerUpdateForRelayedNode(node *models.Node, udppeers map[string]string) (models.PeerUpdate, error) {
 	var peerUpdate models.PeerUpdate
 	var peers []wgtypes.PeerConfig
 	var serverNodeAddresses = []models.ServerAddr{}
 	var allowedips []net.IPNet
+	// the relay's peer update is built from its own relay's, so a loop would never return
+	if err := checkRelayChain(node); err != nil {
+		return models.PeerUpdate{}, err
+	}
 	//find node that is relaying us
 	relay := FindRelay(node)
 	if relay == nil {
@@ -412,42 +639,61 @@ func GetPeerUpdateForRelayedNode(node *models.Node, udppeers map[string]string)
 			allowedips = append(allowedips[:i], allowedips[i+1:]...)
 		}
 	}
+	//delete the nodes below us in the relay chain, they are routed to directly rather than back up through the relay
+	if node.IsRelay == "yes" {
+		var relayedIPs = make(map[string]bool)
+		for _, relayedIP := range getRelayedAllowedIPs(node, node, map[string]bool{node.ID: true}) {
+			relayedIPs[relayedIP.String()] = true
+		}
+		for i := len(allowedips) - 1; i >= 0; i-- {
+			if relayedIPs[allowedips[i].String()] {
+				allowedips = append(allowedips[:i], allowedips[i+1:]...)
+			}
+		}
+	}
 
 	pubkey, err := wgtypes.ParseKey(relay.PublicKey)
 	if err != nil {
 		return models.PeerUpdate{}, err
 	}
-	var setUDPPort = false
-	if relay.UDPHolePunch == "yes" && CheckEndpoint(udppeers[relay.PublicKey]) {
-		endpointstring := udppeers[relay.PublicKey]
-		endpointarr := strings.Split(endpointstring, ":")
-		if len(endpointarr) == 2 {
-			port, err := strconv.Atoi(endpointarr[1])
-			if err == nil {
-				setUDPPort = true
-				relay.ListenPort = int32(port)
+	address := getEndpointOverride(relay)
+	if address == nil {
+		var setUDPPort = false
+		if relay.UDPHolePunch == "yes" && CheckEndpoint(udppeers[relay.PublicKey]) {
+			endpointstring := udppeers[relay.PublicKey]
+			endpointarr := strings.Split(endpointstring, ":")
+			if len(endpointarr) == 2 {
+				port, err := strconv.Atoi(endpointarr[1])
+				if err == nil {
+					setUDPPort = true
+					relay.ListenPort = int32(port)
+				}
 			}
 		}
-	}
-	// if udp hole punching is on, but udp hole punching did not set it, use the LocalListenPort instead
-	// or, if port is for some reason zero use the LocalListenPort
-	// but only do this if LocalListenPort is not zero
-	if ((relay.UDPHolePunch == "yes" && !setUDPPort) || relay.ListenPort == 0) && relay.LocalListenPort != 0 {
-		relay.ListenPort = relay.LocalListenPort
-	}
+		// if udp hole punching is on, but udp hole punching did not set it, use the LocalListenPort instead
+		// or, if port is for some reason zero use the LocalListenPort
+		// but only do this if LocalListenPort is not zero
+		if ((relay.UDPHolePunch == "yes" && !setUDPPort) || relay.ListenPort == 0) && relay.LocalListenPort != 0 {
+			relay.ListenPort = relay.LocalListenPort
+		}
 
-	endpoint := relay.Endpoint + ":" + strconv.FormatInt(int64(relay.ListenPort), 10)
-	address, err := net.ResolveUDPAddr("udp", endpoint)
-	if err != nil {
-		return models.PeerUpdate{}, err
+		endpoint := relay.Endpoint + ":" + strconv.FormatInt(int64(relay.ListenPort), 10)
+		address, err = net.ResolveUDPAddr("udp", endpoint)
+		if err != nil {
+			return models.PeerUpdate{}, err
+		}
 	}
-	var keepalive time.Duration
-	if node.PersistentKeepalive != 0 {
-		// set_keepalive
-		keepalive, _ = time.ParseDuration(strconv.FormatInt(int64(node.PersistentKeepalive), 10) + "s")
+	var presharedKeySecret []byte
+	var networkKeepalive int32
+	if network, err := GetNetwork(node.Network); err == nil {
+		networkKeepalive = network.DefaultKeepalive
+		presharedKeySecret = getNetworkPresharedKeySecret(&network, node)
 	}
+	// set_keepalive
+	keepalive := getPeerKeepalive(node, networkKeepalive)
 	var peerData = wgtypes.PeerConfig{
 		PublicKey:                   pubkey,
+		PresharedKey:                getPeerPresharedKey(presharedKeySecret, node, relay),
 		Endpoint:                    address,
 		ReplaceAllowedIPs:           true,
 		AllowedIPs:                  allowedips,
@@ -455,12 +701,49 @@ func GetPeerUpdateForRelayedNode(node *models.Node, udppeers map[string]string)
 	}
 	peers = append(peers, peerData)
 	if relay.IsServer == "yes" {
-		serverNodeAddresses = append(serverNodeAddresses, models.ServerAddr{IsLeader: IsLeader(relay), Address: relay.Address})
+		serverNodeAddresses = append(serverNodeAddresses, models.ServerAddr{IsLeader: IsLeader(relay), Address: relay.PrimaryAddress()})
+	}
+	if node.IsRelay == "yes" {
+		relayedPeers, err := getRelayedNodePeers(node, presharedKeySecret, &keepalive)
+		if err != nil {
+			return models.PeerUpdate{}, err
+		}
+		peers = append(peers, relayedPeers...)
 	}
 	peerUpdate.Network = node.Network
 	peerUpdate.ServerVersion = servercfg.Version
 	peerUpdate.Peers = peers
 	peerUpdate.ServerAddrs = serverNodeAddresses
 	peerUpdate.DNS = getPeerDNS(node.Network)
+	if nodes, err := GetNetworkNodes(node.Network); err == nil {
+		peerUpdate.PeerLabels = getPeerLabels(nodes, peers)
+	}
+	sortPeerUpdate(&peerUpdate)
 	return peerUpdate, nil
 }
+
+// getEndpointOverride - the address of a node's endpoint override, nil when it has none or it does not
+// resolve so its discovered endpoint is used instead
+func getEndpointOverride(node *models.Node) *net.UDPAddr {
+	if node.EndpointOverride == "" {
+		return nil
+	}
+	address, err := net.ResolveUDPAddr("udp", node.EndpointOverride)
+	if err != nil {
+		logger.Log(1, "failed to resolve endpoint override", node.EndpointOverride, "of node", node.ID, err.Error())
+		return nil
+	}
+	return address
+}
+
+// getPeerKeepalive - the keepalive a node keeps its peers with, the network's default when the node has none of its own
+func getPeerKeepalive(node *models.Node, networkKeepalive int32) time.Duration {
+	keepalive := node.PersistentKeepalive
+	if keepalive == 0 {
+		keepalive = networkKeepalive
+	}
+	if keepalive < 0 {
+		return 0
+	}
+	return time.Duration(keepalive) * time.Second
+}
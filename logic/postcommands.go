@@ -0,0 +1,57 @@
+package logic
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/gravitl/netmaker/models"
+)
+
+// ErrInvalidPostCommandTemplate - a network's default post up or post down does not parse or uses an unknown variable
+var ErrInvalidPostCommandTemplate = errors.New("invalid post command template")
+
+// postCommandVars - the variables a network's default post up and post down can use, e.g. {{.Interface}}
+type postCommandVars struct {
+	Interface string
+	Address   string
+	Address6  string
+	Network   string
+	Name      string
+}
+
+// renderPostCommand - fills a network's post up or post down template in with the node's values
+func renderPostCommand(command string, node *models.Node) (string, error) {
+	if !strings.Contains(command, "{{") {
+		return command, nil
+	}
+	tmpl, err := template.New("postcommand").Option("missingkey=error").Parse(command)
+	if err != nil {
+		return "", err
+	}
+	var rendered strings.Builder
+	if err = tmpl.Execute(&rendered, postCommandVars{
+		Interface: node.Interface,
+		Address:   node.Address,
+		Address6:  node.Address6,
+		Network:   node.Network,
+		Name:      node.Name,
+	}); err != nil {
+		return "", err
+	}
+	return rendered.String(), nil
+}
+
+// validatePostCommandTemplates - renders the network's default post up and post down against a
+// sample node, so a broken template is refused when the network is saved rather than on a node
+func validatePostCommandTemplates(network *models.Network) error {
+	sample := models.Node{Interface: network.DefaultInterface, Address: "10.0.0.1", Address6: "fd00::1", Network: network.NetID, Name: "node"}
+	if _, err := renderPostCommand(network.DefaultPostUp, &sample); err != nil {
+		return fmt.Errorf("%w: defaultpostup: %s", ErrInvalidPostCommandTemplate, err)
+	}
+	if _, err := renderPostCommand(network.DefaultPostDown, &sample); err != nil {
+		return fmt.Errorf("%w: defaultpostdown: %s", ErrInvalidPostCommandTemplate, err)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package logic
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/gravitl/netmaker/database"
+	"github.com/gravitl/netmaker/logger"
+	"github.com/gravitl/netmaker/models"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// presharedKeyMutex - keeps concurrent peer updates from each generating a network's first secret
+var presharedKeyMutex sync.Mutex
+
+// RotatePresharedKeys - replaces the secret a network's preshared keys are derived from,
+// giving every peer pair a new key, and queues a peer update so nodes pick them up
+func RotatePresharedKeys(network string) (models.PresharedKeySecret, error) {
+	if _, err := GetNetwork(network); err != nil {
+		return models.PresharedKeySecret{}, err
+	}
+	presharedKeyMutex.Lock()
+	secret, err := createPresharedKeySecret(network)
+	presharedKeyMutex.Unlock()
+	if err != nil {
+		return secret, err
+	}
+	if err = SetNetworkNodesLastModified(network); err != nil {
+		logger.Log(1, "failed to set nodes last modified on network", network, err.Error())
+	}
+	PeerUpdateQueue(network)
+	return secret, nil
+}
+
+// getPresharedKeySecret - the secret of a network, generated on first use
+func getPresharedKeySecret(network string) ([]byte, error) {
+	presharedKeyMutex.Lock()
+	defer presharedKeyMutex.Unlock()
+	var secret models.PresharedKeySecret
+	record, err := database.FetchRecord(database.PRESHARED_KEYS_TABLE_NAME, network)
+	if err != nil {
+		if !database.IsEmptyRecord(err) {
+			return nil, err
+		}
+		if secret, err = createPresharedKeySecret(network); err != nil {
+			return nil, err
+		}
+	} else if err = json.Unmarshal([]byte(record), &secret); err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(secret.Secret)
+}
+
+func createPresharedKeySecret(network string) (models.PresharedKeySecret, error) {
+	key := make([]byte, wgtypes.KeyLen)
+	if _, err := rand.Read(key); err != nil {
+		return models.PresharedKeySecret{}, err
+	}
+	secret := models.PresharedKeySecret{
+		Network: network,
+		Secret:  base64.StdEncoding.EncodeToString(key),
+		Rotated: time.Now().Unix(),
+	}
+	data, err := json.Marshal(&secret)
+	if err != nil {
+		return models.PresharedKeySecret{}, err
+	}
+	return secret, database.Insert(network, string(data), database.PRESHARED_KEYS_TABLE_NAME)
+}
+
+// getPeerPresharedKey - the preshared key of a node pair, both nodes must support preshared keys
+// or neither side is given one, the pair is ordered so both sides derive the same key
+func getPeerPresharedKey(secret []byte, node, peer *models.Node) *wgtypes.Key {
+	if secret == nil || node.PresharedKeySupport != "yes" || peer.PresharedKeySupport != "yes" {
+		return nil
+	}
+	first, second := node.ID, peer.ID
+	if second < first {
+		first, second = second, first
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(first + "|" + second))
+	key, err := wgtypes.NewKey(mac.Sum(nil))
+	if err != nil {
+		return nil
+	}
+	return &key
+}
+
+// getNetworkPresharedKeySecret - the secret to derive a node's peer keys from, nil when the network
+// has preshared keys off or the node cannot apply them
+func getNetworkPresharedKeySecret(network *models.Network, node *models.Node) []byte {
+	if network.PresharedKeys != "yes" || node.PresharedKeySupport != "yes" {
+		return nil
+	}
+	secret, err := getPresharedKeySecret(network.NetID)
+	if err != nil {
+		logger.Log(0, "failed to get preshared key secret of network", network.NetID, err.Error())
+		return nil
+	}
+	return secret
+}
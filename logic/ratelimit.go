@@ -0,0 +1,122 @@
+package logic
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gravitl/netmaker/servercfg"
+)
+
+// authBucket - token bucket of failed authentication attempts for a single key
+type authBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// AUTH_BUCKET_PRUNE_INTERVAL - number of recorded attempts between two walks over the buckets to drop full ones
+const AUTH_BUCKET_PRUNE_INTERVAL = 1000
+
+var (
+	authBuckets      = make(map[string]*authBucket)
+	authBucketsMutex sync.Mutex
+	// authBucketWrites - attempts recorded since the buckets were last pruned
+	authBucketWrites int
+)
+
+// IsAuthRateLimited - checks if any of the given keys (node id, source ip, ...) has used up its failed attempts
+func IsAuthRateLimited(keys ...string) bool {
+	authBucketsMutex.Lock()
+	defer authBucketsMutex.Unlock()
+	now := time.Now()
+	for _, key := range keys {
+		if bucket, ok := authBuckets[key]; ok && refillAuthBucket(bucket, now) < 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// RecordAuthFailure - consumes a token from the bucket of each given key
+func RecordAuthFailure(keys ...string) {
+	authBucketsMutex.Lock()
+	defer authBucketsMutex.Unlock()
+	now := time.Now()
+	for _, key := range keys {
+		bucket, ok := authBuckets[key]
+		if !ok {
+			bucket = &authBucket{tokens: float64(servercfg.GetAuthRateLimitAttempts()), updated: now}
+			authBuckets[key] = bucket
+		}
+		refillAuthBucket(bucket, now)
+		if bucket.tokens >= 1 {
+			bucket.tokens--
+		}
+	}
+	maybePruneAuthBuckets(now)
+}
+
+// AllowAuthRequest - consumes a token from the bucket of each given key for a pre-auth request that is limited
+// whether it succeeds or not, like issuing a challenge; false, consuming nothing, when any bucket is empty
+func AllowAuthRequest(keys ...string) bool {
+	authBucketsMutex.Lock()
+	defer authBucketsMutex.Unlock()
+	now := time.Now()
+	for _, key := range keys {
+		if bucket, ok := authBuckets[key]; ok && refillAuthBucket(bucket, now) < 1 {
+			return false
+		}
+	}
+	for _, key := range keys {
+		bucket, ok := authBuckets[key]
+		if !ok {
+			bucket = &authBucket{tokens: float64(servercfg.GetAuthRateLimitAttempts()), updated: now}
+			authBuckets[key] = bucket
+		}
+		bucket.tokens--
+	}
+	maybePruneAuthBuckets(now)
+	return true
+}
+
+// ResetAuthFailures - clears the failed attempts of each given key, called on a successful auth
+func ResetAuthFailures(keys ...string) {
+	authBucketsMutex.Lock()
+	defer authBucketsMutex.Unlock()
+	for _, key := range keys {
+		delete(authBuckets, key)
+	}
+}
+
+// == private ==
+
+// refillAuthBucket - adds tokens to a bucket at a rate of attempts per window, returns the current tokens
+func refillAuthBucket(bucket *authBucket, now time.Time) float64 {
+	attempts := float64(servercfg.GetAuthRateLimitAttempts())
+	window := time.Duration(servercfg.GetAuthRateLimitWindow()) * time.Second
+	bucket.tokens += now.Sub(bucket.updated).Seconds() * attempts / window.Seconds()
+	if bucket.tokens > attempts {
+		bucket.tokens = attempts
+	}
+	bucket.updated = now
+	return bucket.tokens
+}
+
+// maybePruneAuthBuckets - prunes the buckets once every AUTH_BUCKET_PRUNE_INTERVAL recorded attempts, so a
+// single attempt does not walk the whole map, caller must hold the lock
+func maybePruneAuthBuckets(now time.Time) {
+	if authBucketWrites++; authBucketWrites < AUTH_BUCKET_PRUNE_INTERVAL {
+		return
+	}
+	authBucketWrites = 0
+	pruneAuthBuckets(now)
+}
+
+// pruneAuthBuckets - drops buckets that have refilled completely so the map does not grow forever
+func pruneAuthBuckets(now time.Time) {
+	attempts := float64(servercfg.GetAuthRateLimitAttempts())
+	for key, bucket := range authBuckets {
+		if refillAuthBucket(bucket, now) >= attempts {
+			delete(authBuckets, key)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package logic
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestAuthRateLimit(t *testing.T) {
+	os.Setenv("AUTH_RATE_LIMIT_ATTEMPTS", "3")
+	os.Setenv("AUTH_RATE_LIMIT_WINDOW", "3600")
+	defer os.Unsetenv("AUTH_RATE_LIMIT_ATTEMPTS")
+	defer os.Unsetenv("AUTH_RATE_LIMIT_WINDOW")
+	keys := []string{"node:ratelimit-test", "ip:192.0.2.1"}
+	for i := 0; i < 3; i++ {
+		if IsAuthRateLimited(keys...) {
+			t.Fatalf("rate limited after %d failures, expected 3 allowed", i)
+		}
+		RecordAuthFailure(keys...)
+	}
+	if !IsAuthRateLimited(keys...) {
+		t.Fatal("expected rate limit after 3 failures")
+	}
+	if !IsAuthRateLimited("ip:192.0.2.1") {
+		t.Fatal("expected source ip to be rate limited on its own")
+	}
+	ResetAuthFailures("node:ratelimit-test")
+	if IsAuthRateLimited("node:ratelimit-test") {
+		t.Fatal("expected rate limit to be reset after successful auth")
+	}
+	if !IsAuthRateLimited("ip:192.0.2.1") {
+		t.Fatal("expected source ip to stay rate limited after resetting the node")
+	}
+	ResetAuthFailures("ip:192.0.2.1")
+}
+
+func TestPruneAuthBuckets(t *testing.T) {
+	os.Setenv("AUTH_RATE_LIMIT_WINDOW", "1")
+	defer os.Unsetenv("AUTH_RATE_LIMIT_WINDOW")
+	RecordAuthFailure("ip:192.0.2.3")
+	authBucketsMutex.Lock()
+	authBuckets["ip:192.0.2.3"].updated = authBuckets["ip:192.0.2.3"].updated.Add(-time.Hour)
+	authBucketWrites = 0
+	authBucketsMutex.Unlock()
+	for i := 1; i < AUTH_BUCKET_PRUNE_INTERVAL; i++ {
+		RecordAuthFailure("ip:192.0.2.4")
+	}
+	authBucketsMutex.Lock()
+	_, kept := authBuckets["ip:192.0.2.3"]
+	authBucketsMutex.Unlock()
+	if !kept {
+		t.Fatal("expected buckets to be kept until the prune interval is reached")
+	}
+	RecordAuthFailure("ip:192.0.2.4")
+	authBucketsMutex.Lock()
+	_, kept = authBuckets["ip:192.0.2.3"]
+	authBucketsMutex.Unlock()
+	if kept {
+		t.Fatal("expected refilled bucket to be pruned once the interval is reached")
+	}
+	ResetAuthFailures("ip:192.0.2.4")
+}
+
+func TestAllowAuthRequest(t *testing.T) {
+	os.Setenv("AUTH_RATE_LIMIT_ATTEMPTS", "2")
+	os.Setenv("AUTH_RATE_LIMIT_WINDOW", "3600")
+	defer os.Unsetenv("AUTH_RATE_LIMIT_ATTEMPTS")
+	defer os.Unsetenv("AUTH_RATE_LIMIT_WINDOW")
+	defer ResetAuthFailures("challenge:ip:192.0.2.2")
+	for i := 0; i < 2; i++ {
+		if !AllowAuthRequest("challenge:ip:192.0.2.2") {
+			t.Fatalf("request %d refused, expected 2 allowed", i)
+		}
+	}
+	if AllowAuthRequest("challenge:ip:192.0.2.2") {
+		t.Fatal("expected requests past the limit to be refused")
+	}
+	if IsAuthRateLimited("ip:192.0.2.2") {
+		t.Fatal("expected failed auth attempts of the source to be counted apart")
+	}
+}
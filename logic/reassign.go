@@ -0,0 +1,263 @@
+package logic
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/gravitl/netmaker/database"
+	"github.com/gravitl/netmaker/logger"
+	"github.com/gravitl/netmaker/logic/acls"
+	"github.com/gravitl/netmaker/logic/acls/nodeacls"
+	"github.com/gravitl/netmaker/models"
+	"github.com/gravitl/netmaker/servercfg"
+)
+
+// ErrNodeAlreadyInNetwork - returned when a node is moved to the network it is already in
+var ErrNodeAlreadyInNetwork = errors.New("node is already in the target network")
+
+// ErrMoveServerNode - returned when moving a server node, which belongs to its network
+var ErrMoveServerNode = errors.New("server nodes cannot be moved between networks")
+
+// ErrStaticAddress - returned when a change would alter the address of a node marked as having a static address
+var ErrStaticAddress = errors.New("node has a static address that cannot be changed")
+
+// checkStaticAddress - errors when a node has a static address and address or address6 differ from it
+func checkStaticAddress(node *models.Node, address, address6 string) error {
+	if node.IsStaticAddress != "yes" {
+		return nil
+	}
+	if address != node.Address || address6 != node.Address6 {
+		return fmt.Errorf("%w: %s", ErrStaticAddress, node.ID)
+	}
+	return nil
+}
+
+// AddressConflictError - returned when a requested address is already held by another node or ext client
+type AddressConflictError struct {
+	Address string
+	OwnerID string
+}
+
+// AddressConflictError.Error - describes the conflicting address and its owner
+func (e *AddressConflictError) Error() string {
+	return fmt.Sprintf("address %s is already in use by %s", e.Address, e.OwnerID)
+}
+
+// ReassignNodeAddress - moves a node to the requested ipv4 and/or ipv6 address, returns the node before and after the change
+func ReassignNodeAddress(nodeid string, request models.IPReassignRequest) (models.Node, models.Node, error) {
+	if request.Address == "" && request.Address6 == "" {
+		return models.Node{}, models.Node{}, errors.New("address or address6 must be provided")
+	}
+	nodeUpdateMutex.Lock()
+	defer nodeUpdateMutex.Unlock()
+	node, err := GetNodeByID(nodeid)
+	if err != nil {
+		return models.Node{}, models.Node{}, err
+	}
+	network, err := GetParentNetwork(node.Network)
+	if err != nil {
+		return models.Node{}, models.Node{}, err
+	}
+	unlock := lockNetworkAddresses(node.Network)
+	defer unlock()
+	address, address6 := node.Address, node.Address6
+	if request.Address != "" {
+		address = request.Address
+	}
+	if request.Address6 != "" {
+		address6 = request.Address6
+	}
+	if err = checkStaticAddress(&node, address, address6); err != nil {
+		return models.Node{}, models.Node{}, err
+	}
+	newNode := node
+	if request.Address != "" && request.Address != node.Address {
+		if network.AddressRange == "" || !IsAddressInCIDR(request.Address, network.AddressRange) {
+			return models.Node{}, models.Node{}, fmt.Errorf("address %s is not in network range %s", request.Address, network.AddressRange)
+		}
+		if ownerID := getAddressOwner(node.Network, request.Address, node.ID); ownerID != "" {
+			return models.Node{}, models.Node{}, &AddressConflictError{Address: request.Address, OwnerID: ownerID}
+		}
+		newNode.Address = request.Address
+	}
+	if request.Address6 != "" && request.Address6 != node.Address6 {
+		if network.AddressRange6 == "" || !isAddress6InCIDR(request.Address6, network.AddressRange6) {
+			return models.Node{}, models.Node{}, fmt.Errorf("address6 %s is not in network range %s", request.Address6, network.AddressRange6)
+		}
+		if ownerID := getAddressOwner(node.Network, request.Address6, node.ID); ownerID != "" {
+			return models.Node{}, models.Node{}, &AddressConflictError{Address: request.Address6, OwnerID: ownerID}
+		}
+		newNode.Address6 = request.Address6
+	}
+	if err = UpdateNode(&node, &newNode); err != nil {
+		return models.Node{}, models.Node{}, err
+	}
+	return node, newNode, SetNetworkNodesLastModified(node.Network)
+}
+
+// MoveNode - moves a node to another network keeping its keys, it gets new addresses there and loses the
+// relay and gateway roles it held in its old network, returns the node before and after the move
+func MoveNode(nodeid, target string) (models.Node, models.Node, error) {
+	node, err := GetNodeByID(nodeid)
+	if err != nil {
+		return models.Node{}, models.Node{}, err
+	}
+	if node.IsServer == "yes" {
+		return models.Node{}, models.Node{}, ErrMoveServerNode
+	}
+	if node.Network == target {
+		return models.Node{}, models.Node{}, ErrNodeAlreadyInNetwork
+	}
+	// a move always gives the node addresses of the target network
+	if node.IsStaticAddress == "yes" {
+		return models.Node{}, models.Node{}, fmt.Errorf("%w: %s", ErrStaticAddress, node.ID)
+	}
+	network, err := GetNetwork(target)
+	if err != nil {
+		return models.Node{}, models.Node{}, err
+	}
+	newNode := node
+	newNode.Network = target
+	if owner := getNodeNameOwner(&newNode); owner != "" {
+		return models.Node{}, models.Node{}, &NodeNameConflictError{Name: node.Name, OwnerID: owner}
+	}
+	// roles only make sense within the old network, they are removed before the move
+	if err = dropNetworkRoles(&node); err != nil {
+		return models.Node{}, models.Node{}, err
+	}
+
+	nodeUpdateMutex.Lock()
+	defer nodeUpdateMutex.Unlock()
+	if node, err = GetNodeByID(nodeid); err != nil {
+		return models.Node{}, models.Node{}, err
+	}
+	unlock := lockNetworkAddresses(target)
+	defer unlock()
+	newNode = node
+	newNode.Network = target
+	newNode.Address = ""
+	newNode.Address6 = ""
+	newNode.IsRelayed = "no"
+	newNode.IsHub = "no"
+	if network.IsIPv4 == "yes" {
+		if newNode.Address, err = UniqueAddress(target, false); err != nil {
+			return models.Node{}, models.Node{}, err
+		}
+	}
+	if network.IsIPv6 == "yes" {
+		if newNode.Address6, err = UniqueAddress6(target, false); err != nil {
+			return models.Node{}, models.Node{}, err
+		}
+	}
+	if newNode.Address == "" && newNode.Address6 == "" {
+		return models.Node{}, models.Node{}, fmt.Errorf("no ipv4 or ipv6 address available for node on network %s", target)
+	}
+	newNode.SetLastModified()
+	data, err := json.Marshal(&newNode)
+	if err != nil {
+		return models.Node{}, models.Node{}, err
+	}
+	if err = database.Insert(newNode.ID, string(data), database.NODES_TABLE_NAME); err != nil {
+		return models.Node{}, models.Node{}, err
+	}
+
+	if _, err = nodeacls.RemoveNodeACL(nodeacls.NetworkID(node.Network), nodeacls.NodeID(node.ID)); err != nil {
+		logger.Log(1, "failed to remove node ACL of moved node", node.ID, err.Error())
+	}
+	defaultACLVal := acls.Allowed
+	if network.DefaultACL != "yes" {
+		defaultACLVal = acls.NotAllowed
+	}
+	if _, err = nodeacls.CreateNodeACL(nodeacls.NetworkID(target), nodeacls.NodeID(node.ID), defaultACLVal); err != nil {
+		logger.Log(1, "failed to create node ACL for moved node", node.ID, err.Error())
+	}
+	for _, networkName := range []string{node.Network, target} {
+		if err = SetNetworkNodesLastModified(networkName); err != nil {
+			return node, newNode, err
+		}
+	}
+	if servercfg.IsDNSMode() {
+		err = SetDNS()
+	}
+	return node, newNode, err
+}
+
+// dropNetworkRoles - removes the relay and gateway roles of a node and takes it out of its relay
+func dropNetworkRoles(node *models.Node) error {
+	if node.IsRelay == "yes" {
+		if _, _, err := DeleteRelay(node.Network, node.ID); err != nil {
+			return err
+		}
+	}
+	if node.IsEgressGateway == "yes" {
+		if _, err := DeleteEgressGateway(node.Network, node.ID); err != nil {
+			return err
+		}
+	}
+	if node.IsIngressGateway == "yes" {
+		if _, err := DeleteIngressGateway(node.Network, node.ID); err != nil {
+			return err
+		}
+	}
+	if node.IsRelayed != "yes" {
+		return nil
+	}
+	relay := FindRelay(node)
+	if relay == nil {
+		return nil
+	}
+	var relayAddrs = []string{}
+	for _, addr := range relay.RelayAddrs {
+		if addr != node.Address && addr != node.Address6 {
+			relayAddrs = append(relayAddrs, addr)
+		}
+	}
+	relay.RelayAddrs = relayAddrs
+	relay.SetLastModified()
+	data, err := json.Marshal(relay)
+	if err != nil {
+		return err
+	}
+	if err = database.Insert(relay.ID, string(data), database.NODES_TABLE_NAME); err != nil {
+		return err
+	}
+	return NetworkNodesUpdatePullChanges(node.Network)
+}
+
+// getAddressOwner - returns the id of the node or ext client on a network holding an address, other than the given node
+func getAddressOwner(network, address, nodeid string) string {
+	if nodes, err := GetNetworkNodes(network); err == nil {
+		for _, node := range nodes {
+			if node.ID != nodeid && (node.Address == address || node.Address6 == address) {
+				return node.ID
+			}
+		}
+	}
+	// deleted nodes hold their addresses until the recovery window elapses
+	if deleted, err := GetDeletedNodes(network); err == nil {
+		for _, node := range deleted {
+			if node.ID != nodeid && (node.Address == address || node.Address6 == address) {
+				return node.ID
+			}
+		}
+	}
+	if extclients, err := GetNetworkExtClients(network); err == nil {
+		for _, extclient := range extclients {
+			if extclient.Address == address || extclient.Address6 == address {
+				return extclient.ClientID
+			}
+		}
+	}
+	return ""
+}
+
+func isAddress6InCIDR(address, cidr string) bool {
+	_, ipnet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(address)
+	return ip != nil && ip.To4() == nil && ipnet.Contains(ip)
+}
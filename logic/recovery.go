@@ -0,0 +1,220 @@
+package logic
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gravitl/netmaker/database"
+	"github.com/gravitl/netmaker/logger"
+	"github.com/gravitl/netmaker/logic/acls"
+	"github.com/gravitl/netmaker/logic/acls/nodeacls"
+	"github.com/gravitl/netmaker/models"
+	"github.com/gravitl/netmaker/servercfg"
+)
+
+// DELETED_NODE_REAP_INTERVAL - interval in seconds between checks for expired deleted nodes
+const DELETED_NODE_REAP_INTERVAL = 60
+
+// NODE_DELETE_ACK_TIMEOUT - seconds to wait for a node to acknowledge its delete instruction before it is purged anyway
+const NODE_DELETE_ACK_TIMEOUT = 10
+
+// ErrNodeRecoveryExpired - returned when restoring a node past its recovery window
+var ErrNodeRecoveryExpired = errors.New("node recovery window has elapsed")
+
+// NodeReaped - tells a node whose recovery window elapsed to leave its network, set by the mq package,
+// returns false when the instruction could not be sent
+var NodeReaped = func(node *models.Node) bool { return false }
+
+// NodeDeleted - tells a node that was just deleted to pause until it is restored or reaped, set by the mq package,
+// returns false when the instruction could not be sent
+var NodeDeleted = func(node *models.Node) bool { return false }
+
+var (
+	nodeDeleteAckMutex sync.Mutex
+	nodeDeleteAcks     = make(map[string]chan struct{})
+)
+
+// AckNodeDelete - records that a node received its delete instruction,
+// returns false if no delete instruction was awaiting an acknowledgement
+func AckNodeDelete(nodeid string) bool {
+	nodeDeleteAckMutex.Lock()
+	defer nodeDeleteAckMutex.Unlock()
+	ack, ok := nodeDeleteAcks[nodeid]
+	if ok {
+		close(ack)
+		delete(nodeDeleteAcks, nodeid)
+	}
+	return ok
+}
+
+// notifyNodeDelete - sends a node its delete instruction and waits up to timeout for the node to acknowledge it
+func notifyNodeDelete(node *models.Node, timeout time.Duration) bool {
+	ack := make(chan struct{})
+	nodeDeleteAckMutex.Lock()
+	nodeDeleteAcks[node.ID] = ack
+	nodeDeleteAckMutex.Unlock()
+	defer func() {
+		nodeDeleteAckMutex.Lock()
+		if nodeDeleteAcks[node.ID] == ack {
+			delete(nodeDeleteAcks, node.ID)
+		}
+		nodeDeleteAckMutex.Unlock()
+	}()
+
+	if !NodeReaped(node) {
+		return false
+	}
+	select {
+	case <-ack:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// GetNodeRecoveryDeadline - unix time after which a deleted node can no longer be restored
+func GetNodeRecoveryDeadline(node *models.Node) int64 {
+	return node.DeletedAt + servercfg.GetNodeRecoveryWindow()
+}
+
+// GetDeletedNodes - gets the deleted nodes of a network that are still within their recovery window
+func GetDeletedNodes(network string) ([]models.Node, error) {
+	var nodes []models.Node
+	collection, err := database.FetchRecords(database.DELETED_NODES_TABLE_NAME)
+	if err != nil {
+		if database.IsEmptyRecord(err) {
+			return nodes, nil
+		}
+		return nodes, err
+	}
+	for _, value := range collection {
+		var node models.Node
+		if err := json.Unmarshal([]byte(value), &node); err != nil {
+			continue
+		}
+		if node.Network == network {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes, nil
+}
+
+// RestoreNode - moves a deleted node back into its network with its keys and addresses intact
+func RestoreNode(nodeid string) (models.Node, error) {
+	nodeUpdateMutex.Lock()
+	defer nodeUpdateMutex.Unlock()
+
+	record, err := database.FetchRecord(database.DELETED_NODES_TABLE_NAME, nodeid)
+	if err != nil {
+		return models.Node{}, err
+	}
+	var node models.Node
+	if err = json.Unmarshal([]byte(record), &node); err != nil {
+		return models.Node{}, err
+	}
+	if time.Now().Unix() >= GetNodeRecoveryDeadline(&node) {
+		return node, ErrNodeRecoveryExpired
+	}
+	network, err := GetNetwork(node.Network)
+	if err != nil {
+		return node, err
+	}
+	for _, address := range []string{node.Address, node.Address6} {
+		if address == "" {
+			continue
+		}
+		if owner := getAddressOwner(node.Network, address, node.ID); owner != "" {
+			return node, &AddressConflictError{Address: address, OwnerID: owner}
+		}
+	}
+
+	if owner := getNodeNameOwner(&node); owner != "" {
+		return node, &NodeNameConflictError{Name: node.Name, OwnerID: owner}
+	}
+
+	node.Action = models.NODE_NOOP
+	node.DeletedAt = 0
+	node.SetLastModified()
+	data, err := json.Marshal(&node)
+	if err != nil {
+		return node, err
+	}
+	if err = database.Insert(node.ID, string(data), database.NODES_TABLE_NAME); err != nil {
+		return node, err
+	}
+	if err = database.DeleteRecord(database.DELETED_NODES_TABLE_NAME, node.ID); err != nil {
+		logger.Log(1, "failed to remove restored node", node.ID, "from deleted nodes", err.Error())
+	}
+
+	defaultACLVal := acls.Allowed
+	if network.DefaultACL != "yes" {
+		defaultACLVal = acls.NotAllowed
+	}
+	if _, err = nodeacls.CreateNodeACL(nodeacls.NetworkID(node.Network), nodeacls.NodeID(node.ID), defaultACLVal); err != nil {
+		logger.Log(1, "failed to create node ACL for restored node", node.ID, err.Error())
+	}
+	if err = SetNetworkNodesLastModified(node.Network); err != nil {
+		return node, err
+	}
+	if servercfg.IsDNSMode() {
+		err = SetDNS()
+	}
+	return node, err
+}
+
+// ReapDeletedNodes - purges deleted nodes whose recovery window has elapsed, freeing their addresses
+func ReapDeletedNodes() {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	collection, err := database.FetchRecords(database.DELETED_NODES_TABLE_NAME)
+	if err != nil {
+		if !database.IsEmptyRecord(err) {
+			logger.Log(1, "failed to retrieve deleted nodes", err.Error())
+		}
+		return
+	}
+	now := time.Now().Unix()
+	for key, value := range collection {
+		var node models.Node
+		if err := json.Unmarshal([]byte(value), &node); err != nil {
+			continue
+		}
+		// nodes deleted before recovery was tracked have no DeletedAt and are purged straight away
+		if now < GetNodeRecoveryDeadline(&node) {
+			continue
+		}
+		wg.Add(1)
+		go func(key string, node models.Node) {
+			defer wg.Done()
+			purgeDeletedNode(key, &node)
+		}(key, node)
+	}
+}
+
+// purgeDeletedNode - tells a node to leave its network and purges its record once it acknowledges,
+// or once NODE_DELETE_ACK_TIMEOUT elapses so an unreachable node cannot hold its addresses forever
+func purgeDeletedNode(key string, node *models.Node) {
+	if !notifyNodeDelete(node, time.Second*NODE_DELETE_ACK_TIMEOUT) {
+		logger.Log(0, "node", node.Name, node.ID, "did not acknowledge its delete instruction, it may be left orphaned with its interface up")
+	}
+	if err := database.DeleteRecord(database.DELETED_NODES_TABLE_NAME, key); err != nil {
+		logger.Log(1, "failed to purge deleted node", key, err.Error())
+		return
+	}
+	logger.Log(1, "purged deleted node", node.Name, node.ID, "from network", node.Network)
+}
+
+// ManageDeletedNodes - goroutine which purges deleted nodes once their recovery window elapses
+func ManageDeletedNodes(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second * DELETED_NODE_REAP_INTERVAL):
+			ReapDeletedNodes()
+		}
+	}
+}
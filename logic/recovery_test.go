@@ -0,0 +1,34 @@
+package logic
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gravitl/netmaker/models"
+)
+
+func TestNotifyNodeDelete(t *testing.T) {
+	defer func(hook func(*models.Node) bool) { NodeReaped = hook }(NodeReaped)
+	node := models.Node{ID: "deleted-node"}
+
+	NodeReaped = func(node *models.Node) bool {
+		go AckNodeDelete(node.ID)
+		return true
+	}
+	if !notifyNodeDelete(&node, time.Second) {
+		t.Fatal("expected acknowledged delete to succeed")
+	}
+
+	NodeReaped = func(node *models.Node) bool { return true }
+	if notifyNodeDelete(&node, time.Millisecond*10) {
+		t.Fatal("expected unacknowledged delete to time out")
+	}
+
+	NodeReaped = func(node *models.Node) bool { return false }
+	if notifyNodeDelete(&node, time.Second) {
+		t.Fatal("expected unsent delete to fail")
+	}
+	if AckNodeDelete(node.ID) {
+		t.Fatal("expected acknowledgement without a pending delete to be ignored")
+	}
+}
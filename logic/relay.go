@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/gravitl/netmaker/database"
@@ -11,10 +12,32 @@ import (
 	"github.com/gravitl/netmaker/models"
 )
 
-// CreateRelay - creates a relay
+// UnknownRelayAddrsError - returned when relay addresses do not belong to any node on the network
+type UnknownRelayAddrsError struct {
+	Addrs []string
+}
+
+// UnknownRelayAddrsError.Error - lists the unknown addresses
+func (e *UnknownRelayAddrsError) Error() string {
+	return "relay addresses do not match any node on the network: " + strings.Join(e.Addrs, ", ")
+}
+
+// RelayLoopError - returned when relay addresses would have a relay relay itself through a chain of relays
+type RelayLoopError struct {
+	Path []string
+}
+
+// RelayLoopError.Error - shows the loop as the names of the nodes along it
+func (e *RelayLoopError) Error() string {
+	return "relay addresses would form a relay loop: " + strings.Join(e.Path, " -> ")
+}
+
+// CreateRelay - creates a relay, relay addresses are validated and the relay is rolled back if relayed nodes cannot be set
 func CreateRelay(relay models.RelayRequest) ([]models.Node, models.Node, error) {
 	var returnnodes []models.Node
 
+	nodeUpdateMutex.Lock()
+	defer nodeUpdateMutex.Unlock()
 	node, err := GetNodeByID(relay.NodeID)
 	if err != nil {
 		return returnnodes, models.Node{}, err
@@ -22,10 +45,20 @@ func CreateRelay(relay models.RelayRequest) ([]models.Node, models.Node, error)
 	if node.OS != "linux" {
 		return returnnodes, models.Node{}, fmt.Errorf("only linux machines can be relay nodes")
 	}
+	if node.IsDNSOnly == "yes" {
+		return returnnodes, models.Node{}, fmt.Errorf("%w: %s", ErrDNSOnlyNode, node.ID)
+	}
 	err = ValidateRelay(relay)
 	if err != nil {
 		return returnnodes, models.Node{}, err
 	}
+	if err = ValidateRelayAddrs(node.Network, node.ID, relay.RelayAddrs); err != nil {
+		return returnnodes, models.Node{}, err
+	}
+	originalData, err := json.Marshal(&node)
+	if err != nil {
+		return returnnodes, models.Node{}, err
+	}
 	node.IsRelay = "yes"
 	node.RelayAddrs = relay.RelayAddrs
 
@@ -39,7 +72,14 @@ func CreateRelay(relay models.RelayRequest) ([]models.Node, models.Node, error)
 	}
 	returnnodes, err = SetRelayedNodes(true, node.Network, node.RelayAddrs)
 	if err != nil {
-		return returnnodes, node, err
+		// roll back so a partial failure does not leave a half configured relay
+		if _, unsetErr := SetRelayedNodes(false, node.Network, node.RelayAddrs); unsetErr != nil {
+			logger.Log(1, "failed to unset relayed nodes for", node.ID, unsetErr.Error())
+		}
+		if insertErr := database.Insert(node.ID, string(originalData), database.NODES_TABLE_NAME); insertErr != nil {
+			logger.Log(1, "failed to roll back relay", node.ID, insertErr.Error())
+		}
+		return nil, models.Node{}, err
 	}
 	if err = NetworkNodesUpdatePullChanges(node.Network); err != nil {
 		return returnnodes, models.Node{}, err
@@ -57,7 +97,7 @@ func SetRelayedNodes(setRelayed bool, networkName string, addrs []string) ([]mod
 	for _, node := range networkNodes {
 		if node.IsServer != "yes" {
 			for _, addr := range addrs {
-				if addr == node.Address || addr == node.Address6 {
+				if addr != "" && (addr == node.Address || addr == node.Address6) {
 					if setRelayed {
 						node.IsRelayed = "yes"
 					} else {
@@ -87,19 +127,116 @@ func ValidateRelay(relay models.RelayRequest) error {
 	return err
 }
 
-// UpdateRelay - updates a relay
-func UpdateRelay(network string, oldAddrs []string, newAddrs []string) []models.Node {
-	var returnnodes []models.Node
-	time.Sleep(time.Second / 4)
-	_, err := SetRelayedNodes(false, network, oldAddrs)
+// ValidateRelayAddrs - checks every relay address belongs to a node on the network other than the relay itself
+// that is not dns only, and that relaying them would not lead back to the relay through relays further down the chain
+func ValidateRelayAddrs(network, relayID string, addrs []string) error {
+	nodes, err := GetNetworkNodes(network)
 	if err != nil {
-		logger.Log(1, err.Error())
+		return err
 	}
-	returnnodes, err = SetRelayedNodes(true, network, newAddrs)
-	if err != nil {
-		logger.Log(1, err.Error())
+	var known = make(map[string]*models.Node)
+	for i := range nodes {
+		if nodes[i].ID == relayID {
+			continue
+		}
+		if nodes[i].Address != "" {
+			known[nodes[i].Address] = &nodes[i]
+		}
+		if nodes[i].Address6 != "" {
+			known[nodes[i].Address6] = &nodes[i]
+		}
+	}
+	var unknown []string
+	for _, addr := range addrs {
+		if known[addr] == nil {
+			unknown = append(unknown, addr)
+		}
+	}
+	if len(unknown) > 0 {
+		return &UnknownRelayAddrsError{Addrs: unknown}
+	}
+	for _, addr := range addrs {
+		if known[addr].IsDNSOnly == "yes" {
+			return fmt.Errorf("%w: %s", ErrDNSOnlyNode, known[addr].ID)
+		}
+	}
+	if loop := findRelayLoop(nodes, relayID, addrs); loop != nil {
+		return &RelayLoopError{Path: loop}
+	}
+	return nil
+}
+
+// findRelayLoop - follows the relays below the given addresses and returns the node names
+// leading back to the relay, nil when the chain never returns to it
+func findRelayLoop(nodes []models.Node, relayID string, addrs []string) []string {
+	var relay models.Node
+	var byAddr = make(map[string]*models.Node)
+	for i := range nodes {
+		if nodes[i].ID == relayID {
+			relay = nodes[i]
+			continue
+		}
+		if nodes[i].Address != "" {
+			byAddr[nodes[i].Address] = &nodes[i]
+		}
+		if nodes[i].Address6 != "" {
+			byAddr[nodes[i].Address6] = &nodes[i]
+		}
+	}
+	var visited = make(map[string]bool)
+	var walk func(node *models.Node, path []string) []string
+	walk = func(node *models.Node, path []string) []string {
+		// copy so sibling branches do not share the path's backing array
+		path = append(path[:len(path):len(path)], node.Name)
+		if visited[node.ID] || node.IsRelay != "yes" {
+			return nil
+		}
+		visited[node.ID] = true
+		for _, addr := range node.RelayAddrs {
+			if addr != "" && (addr == relay.Address || addr == relay.Address6) {
+				return append(path, relay.Name)
+			}
+			if next, ok := byAddr[addr]; ok {
+				if loop := walk(next, path); loop != nil {
+					return loop
+				}
+			}
+		}
+		return nil
+	}
+	for _, addr := range addrs {
+		if target, ok := byAddr[addr]; ok {
+			if loop := walk(target, []string{relay.Name}); loop != nil {
+				return loop
+			}
+		}
+	}
+	return nil
+}
+
+// checkRelayChain - walks up the relays above a relayed node, errors when the chain loops back on itself
+// as a loop stored before loops were rejected would otherwise recurse forever in peer updates
+func checkRelayChain(node *models.Node) error {
+	var path = []string{node.Name}
+	var seen = map[string]bool{node.ID: true}
+	for relay := FindRelay(node); relay != nil; relay = FindRelay(relay) {
+		path = append(path, relay.Name)
+		if seen[relay.ID] {
+			return &RelayLoopError{Path: path}
+		}
+		seen[relay.ID] = true
+	}
+	return nil
+}
+
+// UpdateRelay - unsets the nodes at the old relay addresses as relayed and sets those at the new ones,
+// stops at the first node that cannot be saved
+func UpdateRelay(network string, oldAddrs []string, newAddrs []string) ([]models.Node, error) {
+	time.Sleep(time.Second / 4)
+	if _, err := SetRelayedNodes(false, network, oldAddrs); err != nil {
+		return nil, err
 	}
-	return returnnodes
+	return SetRelayedNodes(true, network, newAddrs)
 }
 
 // DeleteRelay - deletes a relay
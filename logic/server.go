@@ -68,6 +68,8 @@ func ServerJoin(networkSettings *models.Network) (models.Node, error) {
 		OS:           runtime.GOOS,
 		Version:      servercfg.Version,
 		IsHub:        ishub,
+		// the server applies peers with the netclient wireguard package, which sets preshared keys
+		PresharedKeySupport: "yes",
 	}
 
 	SetNodeDefaults(node)
@@ -0,0 +1,146 @@
+package logic
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gravitl/netmaker/database"
+	"github.com/gravitl/netmaker/models"
+)
+
+// SERVICE_ACCOUNT_TOKEN_PREFIX - prefix which tells service account tokens apart from jwts and access keys
+const SERVICE_ACCOUNT_TOKEN_PREFIX = "nmsa_"
+
+// ErrInvalidServiceAccount - returned when a service account has no name or no known operations
+var ErrInvalidServiceAccount = errors.New("service account requires a name and at least one known operation")
+
+// ErrInvalidServiceAccountToken - returned when a service account token is malformed, unknown or revoked
+var ErrInvalidServiceAccountToken = errors.New("invalid service account token")
+
+var serviceAccountOperations = []string{
+	models.SERVICE_ACCOUNT_READ_NODES,
+	models.SERVICE_ACCOUNT_CREATE_NODES,
+	models.SERVICE_ACCOUNT_UPDATE_NODES,
+	models.SERVICE_ACCOUNT_DELETE_NODES,
+}
+
+// IsServiceAccountToken - checks whether a bearer token is meant to be a service account token
+func IsServiceAccountToken(token string) bool {
+	return strings.HasPrefix(token, SERVICE_ACCOUNT_TOKEN_PREFIX)
+}
+
+// CreateServiceAccount - stores a service account for an existing network and generates its token
+func CreateServiceAccount(account models.ServiceAccount) (models.ServiceAccountToken, error) {
+	account.Name = strings.TrimSpace(account.Name)
+	operations := []string{}
+	for _, operation := range account.Operations {
+		if !StringSliceContains(serviceAccountOperations, operation) {
+			return models.ServiceAccountToken{}, fmt.Errorf("%w: unknown operation %s", ErrInvalidServiceAccount, operation)
+		}
+		if !StringSliceContains(operations, operation) {
+			operations = append(operations, operation)
+		}
+	}
+	if account.Name == "" || len(operations) == 0 {
+		return models.ServiceAccountToken{}, ErrInvalidServiceAccount
+	}
+	if _, err := GetNetwork(account.Network); err != nil {
+		return models.ServiceAccountToken{}, err
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return models.ServiceAccountToken{}, err
+	}
+	account.ID = uuid.NewString()
+	account.Operations = operations
+	account.Created = time.Now().Unix()
+	token := SERVICE_ACCOUNT_TOKEN_PREFIX + account.ID + "_" + hex.EncodeToString(secret)
+	account.TokenHash = hashServiceAccountToken(token)
+	data, err := json.Marshal(&account)
+	if err != nil {
+		return models.ServiceAccountToken{}, err
+	}
+	if err = database.Insert(account.ID, string(data), database.SERVICE_ACCOUNTS_TABLE_NAME); err != nil {
+		return models.ServiceAccountToken{}, err
+	}
+	account.TokenHash = ""
+	return models.ServiceAccountToken{ServiceAccount: account, Token: token}, nil
+}
+
+// GetServiceAccounts - lists the service accounts, oldest first, without their token hashes
+func GetServiceAccounts() ([]models.ServiceAccount, error) {
+	accounts := []models.ServiceAccount{}
+	collection, err := database.FetchRecords(database.SERVICE_ACCOUNTS_TABLE_NAME)
+	if err != nil {
+		if database.IsEmptyRecord(err) {
+			return accounts, nil
+		}
+		return accounts, err
+	}
+	for _, value := range collection {
+		var account models.ServiceAccount
+		if err := json.Unmarshal([]byte(value), &account); err != nil {
+			continue
+		}
+		account.TokenHash = ""
+		accounts = append(accounts, account)
+	}
+	sort.Slice(accounts, func(i, j int) bool {
+		if accounts[i].Created != accounts[j].Created {
+			return accounts[i].Created < accounts[j].Created
+		}
+		return accounts[i].ID < accounts[j].ID
+	})
+	return accounts, nil
+}
+
+// DeleteServiceAccount - revokes a service account, its token stops working immediately
+func DeleteServiceAccount(id string) error {
+	if _, err := database.FetchRecord(database.SERVICE_ACCOUNTS_TABLE_NAME, id); err != nil {
+		return err
+	}
+	return database.DeleteRecord(database.SERVICE_ACCOUNTS_TABLE_NAME, id)
+}
+
+// VerifyServiceAccountToken - gets the service account a token belongs to
+func VerifyServiceAccountToken(token string) (models.ServiceAccount, error) {
+	id, _, ok := strings.Cut(strings.TrimPrefix(token, SERVICE_ACCOUNT_TOKEN_PREFIX), "_")
+	if !IsServiceAccountToken(token) || !ok {
+		return models.ServiceAccount{}, ErrInvalidServiceAccountToken
+	}
+	record, err := database.FetchRecord(database.SERVICE_ACCOUNTS_TABLE_NAME, id)
+	if err != nil {
+		return models.ServiceAccount{}, ErrInvalidServiceAccountToken
+	}
+	var account models.ServiceAccount
+	if err = json.Unmarshal([]byte(record), &account); err != nil {
+		return models.ServiceAccount{}, ErrInvalidServiceAccountToken
+	}
+	if subtle.ConstantTimeCompare([]byte(account.TokenHash), []byte(hashServiceAccountToken(token))) != 1 {
+		return models.ServiceAccount{}, ErrInvalidServiceAccountToken
+	}
+	account.TokenHash = ""
+	return account, nil
+}
+
+// ServiceAccountAllows - checks whether a service account may perform an operation on a network
+func ServiceAccountAllows(account *models.ServiceAccount, network, operation string) bool {
+	return account.Network == network && StringSliceContains(account.Operations, operation)
+}
+
+// == private ==
+
+func hashServiceAccountToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
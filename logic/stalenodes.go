@@ -0,0 +1,60 @@
+package logic
+
+import (
+	"sort"
+	"time"
+
+	"github.com/gravitl/netmaker/models"
+)
+
+// GetStaleNodes - nodes of a network that have not checked in for threshold seconds, nodes that
+// never checked in are listed apart once they joined more than threshold seconds ago, oldest first in both lists
+func GetStaleNodes(network string, threshold int64) (models.StaleNodes, error) {
+	var staleNodes = models.StaleNodes{
+		Network:        network,
+		Threshold:      threshold,
+		Stale:          []models.StaleNode{},
+		NeverCheckedIn: []models.StaleNode{},
+	}
+	nodes, err := GetNetworkNodes(network)
+	if err != nil {
+		return staleNodes, err
+	}
+	cutoff := time.Now().Unix() - threshold
+	for i := range nodes {
+		node := &nodes[i]
+		staleNode := models.StaleNode{
+			ID:          node.ID,
+			Name:        node.Name,
+			Address:     node.Address,
+			Address6:    node.Address6,
+			CreatedAt:   node.CreatedAt,
+			LastCheckIn: node.LastCheckIn,
+		}
+		if !hasCheckedIn(node) {
+			if node.CreatedAt >= cutoff {
+				// just joined, the first check in may still be on its way
+				continue
+			}
+			staleNodes.NeverCheckedIn = append(staleNodes.NeverCheckedIn, staleNode)
+		} else if node.LastCheckIn < cutoff {
+			staleNodes.Stale = append(staleNodes.Stale, staleNode)
+		}
+	}
+	sort.SliceStable(staleNodes.Stale, func(i, j int) bool {
+		return staleNodes.Stale[i].LastCheckIn < staleNodes.Stale[j].LastCheckIn
+	})
+	sort.SliceStable(staleNodes.NeverCheckedIn, func(i, j int) bool {
+		return staleNodes.NeverCheckedIn[i].CreatedAt < staleNodes.NeverCheckedIn[j].CreatedAt
+	})
+	return staleNodes, nil
+}
+
+// hasCheckedIn - whether the node checked in after joining, creating a node stamps its
+// last check in, so only a later one counts; nodes older than CreatedAt only need a check in at all
+func hasCheckedIn(node *models.Node) bool {
+	if node.CreatedAt == 0 {
+		return node.LastCheckIn != 0
+	}
+	return node.LastCheckIn > node.CreatedAt
+}
@@ -0,0 +1,76 @@
+package logic
+
+import (
+	"github.com/gravitl/netmaker/logic/acls"
+	"github.com/gravitl/netmaker/logic/acls/nodeacls"
+	"github.com/gravitl/netmaker/models"
+	"github.com/gravitl/netmaker/netclient/ncutils"
+)
+
+// GetNetworkNodeSummaries - lists every node of a network with its peer count,
+// the network topology is read once rather than building a peer update per node
+func GetNetworkNodeSummaries(network string) ([]models.NodeSummary, error) {
+	var summaries = []models.NodeSummary{}
+	parentNetwork, err := GetNetwork(network)
+	if err != nil {
+		return summaries, err
+	}
+	nodes, err := GetNetworkNodes(network)
+	if err != nil {
+		return summaries, err
+	}
+	networkACL, err := nodeacls.FetchAllACLs(nodeacls.NetworkID(network))
+	if err != nil {
+		networkACL = acls.ACLContainer{}
+	}
+	for i := range nodes {
+		node := &nodes[i]
+		summaries = append(summaries, models.NodeSummary{
+			ID:               node.ID,
+			Name:             node.Name,
+			Address:          node.Address,
+			Address6:         node.Address6,
+			Connected:        IsNodeConnected(node),
+			PeerCount:        countPeers(node, nodes, networkACL, parentNetwork.IsPointToSite == "yes"),
+			IsEgressGateway:  node.IsEgressGateway == "yes",
+			IsIngressGateway: node.IsIngressGateway == "yes",
+			IsRelay:          node.IsRelay == "yes",
+			IsRelayed:        node.IsRelayed == "yes",
+		})
+	}
+	return summaries, nil
+}
+
+// countPeers - number of wireguard peers getPeerUpdate would hand a node, following the same skip rules
+func countPeers(node *models.Node, nodes []models.Node, networkACL acls.ACLContainer, pointToSite bool) int {
+	if node.IsRelayed == "yes" {
+		// relayed nodes only peer with their relay
+		for _, peer := range nodes {
+			if peer.IsRelay == "yes" && ncutils.StringSliceContains(peer.RelayAddrs, node.PrimaryAddress()) {
+				return 1
+			}
+		}
+		return 0
+	}
+	isP2S := pointToSite && node.IsHub != "yes"
+	count := 0
+	for _, peer := range nodes {
+		if peer.ID == node.ID {
+			continue
+		}
+		if peer.IsRelayed == "yes" && !(node.IsRelay == "yes" && ncutils.StringSliceContains(node.RelayAddrs, peer.PrimaryAddress())) {
+			continue
+		}
+		if !networkACL.IsAllowed(acls.AclID(node.ID), acls.AclID(peer.ID)) {
+			continue
+		}
+		if isP2S && peer.IsHub != "yes" {
+			continue
+		}
+		if node.Endpoint == peer.Endpoint && (node.LocalAddress == peer.LocalAddress || peer.LocalAddress == "") {
+			continue
+		}
+		count++
+	}
+	return count
+}
@@ -0,0 +1,78 @@
+package logic
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gravitl/netmaker/servercfg"
+)
+
+// userTokenEntry - result of a successful user token verification
+type userTokenEntry struct {
+	username string
+	networks []string
+	isadmin  bool
+	role     string
+	expires  time.Time
+}
+
+var (
+	userTokenCache      = make(map[string]userTokenEntry)
+	userTokenCacheMutex sync.Mutex
+)
+
+// InvalidateUserTokens - drops the cached verifications of a user, called whenever the user changes
+func InvalidateUserTokens(username string) {
+	userTokenCacheMutex.Lock()
+	defer userTokenCacheMutex.Unlock()
+	for token, entry := range userTokenCache {
+		if entry.username == username {
+			delete(userTokenCache, token)
+		}
+	}
+}
+
+// == private ==
+
+// getCachedUserToken - returns the cached verification of a token if it has not expired
+func getCachedUserToken(token string) (userTokenEntry, bool) {
+	userTokenCacheMutex.Lock()
+	defer userTokenCacheMutex.Unlock()
+	entry, ok := userTokenCache[token]
+	if !ok {
+		return entry, false
+	}
+	if time.Now().After(entry.expires) {
+		delete(userTokenCache, token)
+		return entry, false
+	}
+	return entry, true
+}
+
+// cacheUserToken - remembers a verified token for the configured ttl, never past the token's own expiry,
+// does nothing when caching is disabled
+func cacheUserToken(token string, username string, networks []string, isadmin bool, role string, tokenExpires time.Time) {
+	ttl := servercfg.GetUserTokenCacheTTL()
+	if ttl <= 0 {
+		return
+	}
+	userTokenCacheMutex.Lock()
+	defer userTokenCacheMutex.Unlock()
+	now := time.Now()
+	for key, entry := range userTokenCache {
+		if now.After(entry.expires) {
+			delete(userTokenCache, key)
+		}
+	}
+	expires := now.Add(time.Duration(ttl) * time.Second)
+	if tokenExpires.Before(expires) {
+		expires = tokenExpires
+	}
+	userTokenCache[token] = userTokenEntry{
+		username: username,
+		networks: networks,
+		isadmin:  isadmin,
+		role:     role,
+		expires:  expires,
+	}
+}
@@ -0,0 +1,35 @@
+package logic
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestUserTokenCache(t *testing.T) {
+	expires := time.Now().Add(time.Hour)
+	cacheUserToken("token-a", "alice", []string{"skynet"}, false, "", expires)
+	cacheUserToken("token-b", "bob", nil, true, "", expires)
+	entry, ok := getCachedUserToken("token-a")
+	if !ok || entry.username != "alice" || len(entry.networks) != 1 || entry.isadmin {
+		t.Fatalf("expected cached verification for alice, got %+v %v", entry, ok)
+	}
+	InvalidateUserTokens("alice")
+	if _, ok := getCachedUserToken("token-a"); ok {
+		t.Fatal("expected alice's token to be invalidated")
+	}
+	if _, ok := getCachedUserToken("token-b"); !ok {
+		t.Fatal("expected bob's token to stay cached")
+	}
+	cacheUserToken("token-c", "carol", nil, false, "", time.Now().Add(-time.Second))
+	if _, ok := getCachedUserToken("token-c"); ok {
+		t.Fatal("expected token to not be cached past its own expiry")
+	}
+	os.Setenv("USER_TOKEN_CACHE_TTL", "0")
+	defer os.Unsetenv("USER_TOKEN_CACHE_TTL")
+	cacheUserToken("token-d", "dave", nil, false, "", expires)
+	if _, ok := getCachedUserToken("token-d"); ok {
+		t.Fatal("expected no caching when the ttl is zero")
+	}
+	InvalidateUserTokens("bob")
+}
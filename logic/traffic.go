@@ -1,5 +1,27 @@
 package logic
 
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gravitl/netmaker/database"
+	"github.com/gravitl/netmaker/models"
+)
+
+// TRAFFIC_KEY_ROTATION_TTL - seconds a node has to answer a traffic key rotation with its new public key
+const TRAFFIC_KEY_ROTATION_TTL = 300
+
+// ErrServerTrafficKeys - returned when rotating the traffic keys of a server node
+var ErrServerTrafficKeys = errors.New("traffic keys of server nodes can not be rotated")
+
+var (
+	trafficKeyRotations      = make(map[string]int64)
+	trafficKeyRotationsMutex sync.Mutex
+)
+
 // RetrievePrivateTrafficKey - retrieves private key of server
 func RetrievePrivateTrafficKey() ([]byte, error) {
 	var telRecord, err = fetchTelemetryRecord()
@@ -19,3 +41,66 @@ func RetrievePublicTrafficKey() ([]byte, error) {
 
 	return telRecord.TrafficKeyPub, nil
 }
+
+// RotateNodeTrafficKeys - re-pairs a node with the server traffic key and asks it to generate new traffic keys,
+// the node keeps using its old key until it answers with its new public key
+func RotateNodeTrafficKeys(nodeid string) (models.Node, error) {
+	nodeUpdateMutex.Lock()
+	defer nodeUpdateMutex.Unlock()
+
+	node, err := GetNodeByID(nodeid)
+	if err != nil {
+		return models.Node{}, err
+	}
+	if node.IsServer == "yes" {
+		return node, ErrServerTrafficKeys
+	}
+	serverKey, err := RetrievePublicTrafficKey()
+	if err != nil {
+		return node, err
+	}
+	node.TrafficKeys.Server = serverKey
+	node.Action = models.NODE_ROTATE_TRAFFIC_KEYS
+	node.SetLastModified()
+	data, err := json.Marshal(&node)
+	if err != nil {
+		return node, err
+	}
+	if err = database.Insert(node.ID, string(data), database.NODES_TABLE_NAME); err != nil {
+		return node, err
+	}
+
+	trafficKeyRotationsMutex.Lock()
+	defer trafficKeyRotationsMutex.Unlock()
+	trafficKeyRotations[node.ID] = time.Now().Unix() + TRAFFIC_KEY_ROTATION_TTL
+	return node, nil
+}
+
+// CompleteTrafficKeyRotation - stores the new public traffic key sent by a node with a pending rotation,
+// from then on messages signed with the old key fail to decrypt, returns false when no rotation took place
+func CompleteTrafficKeyRotation(node *models.Node, newKey []byte) (bool, error) {
+	if len(newKey) == 0 || bytes.Equal(newKey, node.TrafficKeys.Mine) {
+		return false, nil
+	}
+	trafficKeyRotationsMutex.Lock()
+	expires, ok := trafficKeyRotations[node.ID]
+	delete(trafficKeyRotations, node.ID)
+	trafficKeyRotationsMutex.Unlock()
+	if !ok || expires < time.Now().Unix() {
+		return false, nil
+	}
+
+	nodeUpdateMutex.Lock()
+	defer nodeUpdateMutex.Unlock()
+	node.TrafficKeys.Mine = newKey
+	node.Action = models.NODE_NOOP
+	node.SetLastModified()
+	data, err := json.Marshal(node)
+	if err != nil {
+		return false, err
+	}
+	if err = database.Insert(node.ID, string(data), database.NODES_TABLE_NAME); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,97 @@
+package logic
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gravitl/netmaker/models"
+)
+
+// UPDATE_ACK_RETENTION - hours the confirmation state of an acknowledged update is kept
+const UPDATE_ACK_RETENTION = 24
+
+// ErrUpdateAckNotFound - returned for an acknowledged update that was never requested or has expired
+var ErrUpdateAckNotFound = errors.New("acknowledged update not found")
+
+// ErrUpdateAckNotExpected - returned when a node confirms an update that was not pushed to it
+var ErrUpdateAckNotExpected = errors.New("node was not asked to acknowledge the update")
+
+var (
+	// updateAcks - confirmation state of acknowledged updates by id, kept in memory only
+	updateAcks      = make(map[string]*models.UpdateAck)
+	updateAcksMutex sync.Mutex
+)
+
+// RequestUpdateAck - starts tracking an update of the given kind pushed to nodes, each of them is
+// pending until it confirms applying the update
+func RequestUpdateAck(network, kind string, nodes []models.Node) models.UpdateAck {
+	updateAcksMutex.Lock()
+	defer updateAcksMutex.Unlock()
+	now := time.Now()
+	for id, ack := range updateAcks {
+		if now.Sub(time.Unix(ack.Requested, 0)) > UPDATE_ACK_RETENTION*time.Hour {
+			delete(updateAcks, id)
+		}
+	}
+	ack := &models.UpdateAck{
+		ID:            uuid.NewString(),
+		Network:       network,
+		Kind:          kind,
+		Requested:     now.Unix(),
+		Expected:      len(nodes),
+		Confirmations: make(map[string]int64),
+		Pending:       []string{},
+	}
+	for _, node := range nodes {
+		ack.Pending = append(ack.Pending, node.ID)
+	}
+	updateAcks[ack.ID] = ack
+	return copyUpdateAck(ack)
+}
+
+// ConfirmUpdateAck - records that a node applied an acknowledged update, confirming twice is not an error
+func ConfirmUpdateAck(ackID, nodeid string) error {
+	updateAcksMutex.Lock()
+	defer updateAcksMutex.Unlock()
+	ack, ok := updateAcks[ackID]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUpdateAckNotFound, ackID)
+	}
+	if _, ok := ack.Confirmations[nodeid]; ok {
+		return nil
+	}
+	for i, pending := range ack.Pending {
+		if pending == nodeid {
+			ack.Pending = append(ack.Pending[:i], ack.Pending[i+1:]...)
+			ack.Confirmations[nodeid] = time.Now().Unix()
+			ack.Confirmed++
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrUpdateAckNotExpected, nodeid)
+}
+
+// GetUpdateAck - the confirmation state of an acknowledged update
+func GetUpdateAck(ackID string) (models.UpdateAck, error) {
+	updateAcksMutex.Lock()
+	defer updateAcksMutex.Unlock()
+	ack, ok := updateAcks[ackID]
+	if !ok {
+		return models.UpdateAck{}, fmt.Errorf("%w: %s", ErrUpdateAckNotFound, ackID)
+	}
+	return copyUpdateAck(ack), nil
+}
+
+// copyUpdateAck - a copy of the state that later confirmations do not change
+func copyUpdateAck(ack *models.UpdateAck) models.UpdateAck {
+	copied := *ack
+	copied.Pending = append([]string{}, ack.Pending...)
+	copied.Confirmations = make(map[string]int64, len(ack.Confirmations))
+	for id, confirmed := range ack.Confirmations {
+		copied.Confirmations[id] = confirmed
+	}
+	return copied
+}
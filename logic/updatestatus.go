@@ -0,0 +1,50 @@
+package logic
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gravitl/netmaker/models"
+)
+
+var (
+	// nodeUpdateStatuses - outcome of the latest update pushed to each node, by node id, kept in memory only
+	nodeUpdateStatuses      = make(map[string]models.NodeUpdateStatus)
+	nodeUpdateStatusesMutex sync.Mutex
+)
+
+// RecordNodeUpdate - records the outcome of an update pushed to a node in the background,
+// published over mq to clients or applied locally for server nodes
+func RecordNodeUpdate(node *models.Node, err error) {
+	nodeUpdateStatusesMutex.Lock()
+	defer nodeUpdateStatusesMutex.Unlock()
+	status := nodeUpdateStatuses[node.ID]
+	status.NodeID = node.ID
+	status.Network = node.Network
+	status.Attempted = time.Now().Unix()
+	status.Succeeded = err == nil
+	status.Error = ""
+	if err != nil {
+		status.Error = err.Error()
+		status.Failures++
+	} else {
+		status.LastSucceeded = status.Attempted
+		status.Failures = 0
+	}
+	nodeUpdateStatuses[node.ID] = status
+}
+
+// GetNodeUpdateStatus - outcome of the latest update pushed to a node, false when none was pushed since the server started
+func GetNodeUpdateStatus(nodeid string) (models.NodeUpdateStatus, bool) {
+	nodeUpdateStatusesMutex.Lock()
+	defer nodeUpdateStatusesMutex.Unlock()
+	status, ok := nodeUpdateStatuses[nodeid]
+	return status, ok
+}
+
+// forgetNodeUpdateStatus - drops the update outcome of a deleted node
+func forgetNodeUpdateStatus(nodeid string) {
+	nodeUpdateStatusesMutex.Lock()
+	defer nodeUpdateStatusesMutex.Unlock()
+	delete(nodeUpdateStatuses, nodeid)
+}
@@ -11,6 +11,7 @@ import (
 	"net"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gravitl/netmaker/database"
@@ -64,16 +65,26 @@ func IsAddressInCIDR(address, cidr string) bool {
 	return currentCIDR.Contains(ip)
 }
 
-// SetNetworkNodesLastModified - sets the network nodes last modified
-func SetNetworkNodesLastModified(networkName string) error {
+// networkNodesModifiedMutex - keeps concurrent changes from each reading and moving the network's
+// last modified time and peer epoch forward only once
+var networkNodesModifiedMutex sync.Mutex
 
+// SetNetworkNodesLastModified - sets the network nodes last modified and moves its peer epoch forward
+func SetNetworkNodesLastModified(networkName string) error {
+	networkNodesModifiedMutex.Lock()
+	defer networkNodesModifiedMutex.Unlock()
 	timestamp := time.Now().Unix()
 
 	network, err := GetParentNetwork(networkName)
 	if err != nil {
 		return err
 	}
+	// always move forward so changes made within the same second are still seen by pollers
+	if timestamp <= network.NodesLastModified {
+		timestamp = network.NodesLastModified + 1
+	}
 	network.NodesLastModified = timestamp
+	network.PeerEpoch++
 	data, err := json.Marshal(&network)
 	if err != nil {
 		return err
@@ -143,6 +154,19 @@ func StringSliceContains(slice []string, item string) bool {
 	return false
 }
 
+// StringSliceEqual - sees if two string slices hold the same elements in the same order
+func StringSliceEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
 // == private ==
 
 // sets the network server peers of a given node
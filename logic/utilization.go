@@ -0,0 +1,132 @@
+package logic
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gravitl/netmaker/database"
+	"github.com/gravitl/netmaker/logger"
+	"github.com/gravitl/netmaker/models"
+	"github.com/gravitl/netmaker/servercfg"
+)
+
+// UTILIZATION_CHECK_INTERVAL - seconds between checks of the address utilization of every network
+const UTILIZATION_CHECK_INTERVAL = 60
+
+// UTILIZATION_REARM_MARGIN - percentage points utilization must drop below the threshold before
+// a range that already sent an event can send another
+const UTILIZATION_REARM_MARGIN = 5
+
+var (
+	// utilizationAlerted - the network ranges which sent an event and have not dropped back below the threshold
+	utilizationAlerted = make(map[string]bool)
+	utilizationMutex   sync.Mutex
+)
+
+// sendUtilizationEvent - delivers a utilization event, replaced in tests
+var sendUtilizationEvent = postUtilizationEvent
+
+// ManageAddressUtilization - goroutine which checks the address utilization of every network on an interval
+func ManageAddressUtilization(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second * UTILIZATION_CHECK_INTERVAL):
+			CheckAddressUtilization()
+		}
+	}
+}
+
+// CheckAddressUtilization - sends an event for every network range which crossed the utilization threshold
+// since the last check, a range sends again only after dropping UTILIZATION_REARM_MARGIN below the threshold
+func CheckAddressUtilization() {
+	networks, err := GetNetworks()
+	if err != nil {
+		if !database.IsEmptyRecord(err) {
+			logger.Log(1, "failed to retrieve networks to check address utilization", err.Error())
+		}
+		return
+	}
+	threshold := servercfg.GetUtilizationThreshold()
+	for _, network := range networks {
+		utilization, err := GetAddressUtilization(network.NetID)
+		if err != nil {
+			logger.Log(1, "failed to get address utilization of network", network.NetID, err.Error())
+			continue
+		}
+		if utilization.AddressRange != "" {
+			checkRangeUtilization(utilization.Network, utilization.AddressRange, false, utilization.Used, utilization.Total, threshold)
+		}
+		// ranges larger than 64 bits cannot realistically fill up
+		if total6, ok := new(big.Int).SetString(utilization.Total6, 10); ok && total6.IsUint64() {
+			checkRangeUtilization(utilization.Network, utilization.AddressRange6, true, utilization.Used6, total6.Uint64(), threshold)
+		}
+	}
+}
+
+// checkRangeUtilization - sends an event when a range is at or above the threshold and has not sent one yet
+func checkRangeUtilization(network, addressRange string, ipv6 bool, used int, total uint64, threshold int) {
+	if total == 0 {
+		return
+	}
+	key := fmt.Sprintf("%s|%s", network, addressRange)
+	percent := float64(used) * 100 / float64(total)
+
+	utilizationMutex.Lock()
+	alerted := utilizationAlerted[key]
+	if percent < float64(threshold) {
+		if alerted && percent < float64(threshold-UTILIZATION_REARM_MARGIN) {
+			delete(utilizationAlerted, key)
+		}
+		utilizationMutex.Unlock()
+		return
+	}
+	utilizationAlerted[key] = true
+	utilizationMutex.Unlock()
+	if alerted {
+		return
+	}
+
+	event := models.UtilizationEvent{
+		Network:      network,
+		AddressRange: addressRange,
+		IPv6:         ipv6,
+		Used:         used,
+		Total:        total,
+		Threshold:    threshold,
+		Time:         time.Now().Unix(),
+	}
+	logger.Log(0, "network", network, "is using", fmt.Sprint(used), "of", fmt.Sprint(total), "addresses of", addressRange)
+	if err := sendUtilizationEvent(&event); err != nil {
+		logger.Log(0, "failed to send utilization event of network", network, err.Error())
+	}
+}
+
+// postUtilizationEvent - posts a utilization event as json to the configured webhook, if there is one
+func postUtilizationEvent(event *models.UtilizationEvent) error {
+	webhook := servercfg.GetUtilizationWebhook()
+	if webhook == "" {
+		return nil
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	client := http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(webhook, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package logic
+
+import (
+	"testing"
+
+	"github.com/gravitl/netmaker/models"
+)
+
+func TestCheckRangeUtilization(t *testing.T) {
+	defer func(send func(*models.UtilizationEvent) error) { sendUtilizationEvent = send }(sendUtilizationEvent)
+	var events []models.UtilizationEvent
+	sendUtilizationEvent = func(event *models.UtilizationEvent) error {
+		events = append(events, *event)
+		return nil
+	}
+	check := func(used int) {
+		checkRangeUtilization("skynet", "10.0.0.0/24", false, used, 254, 80)
+	}
+
+	check(200)
+	if len(events) != 0 {
+		t.Fatalf("expected no event below the threshold, got %v", events)
+	}
+	check(204)
+	if len(events) != 1 {
+		t.Fatalf("expected one event at the threshold, got %d", len(events))
+	}
+	if event := events[0]; event.Network != "skynet" || event.Used != 204 || event.Total != 254 || event.Threshold != 80 {
+		t.Fatalf("unexpected event %+v", event)
+	}
+	// hovering around the threshold does not send again
+	check(210)
+	check(200)
+	check(204)
+	if len(events) != 1 {
+		t.Fatalf("expected no events while hovering, got %d", len(events))
+	}
+	// dropping below the margin re-arms the range
+	check(180)
+	check(204)
+	if len(events) != 2 {
+		t.Fatalf("expected a second event after re-arming, got %d", len(events))
+	}
+	// ranges are tracked separately
+	checkRangeUtilization("skynet", "fd00::/120", true, 250, 256, 80)
+	if len(events) != 3 || !events[2].IPv6 {
+		t.Fatalf("expected an ipv6 event, got %v", events)
+	}
+}
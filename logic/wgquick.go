@@ -0,0 +1,153 @@
+package logic
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gravitl/netmaker/models"
+)
+
+// WG_QUICK_FORMAT - format parameter value that asks for a node config as a wg-quick file
+const WG_QUICK_FORMAT = "wg-quick"
+
+// GetNodeWGQuickConf - renders a node's interface and peers as a wg-quick config,
+// the private key is left as a placeholder and nameserver is only used when the node has dns on
+func GetNodeWGQuickConf(node *models.Node, peerUpdate *models.PeerUpdate, nameserver string) string {
+	var conf strings.Builder
+	conf.WriteString("[Interface]\n")
+	addrString := node.Address
+	if node.Address6 != "" {
+		if addrString != "" {
+			addrString += ", "
+		}
+		addrString += node.Address6
+	}
+	fmt.Fprintf(&conf, "Address = %s\n", addrString)
+	fmt.Fprintf(&conf, "PrivateKey = %s\n", models.PLACEHOLDER_PRIVATE_KEY_TEXT)
+	if node.ListenPort > 0 && node.UDPHolePunch != "yes" {
+		fmt.Fprintf(&conf, "ListenPort = %d\n", node.ListenPort)
+	}
+	if node.MTU != 0 {
+		fmt.Fprintf(&conf, "MTU = %d\n", node.MTU)
+	}
+	if node.DNSOn == "yes" && nameserver != "" {
+		fmt.Fprintf(&conf, "DNS = %s\n", nameserver)
+	}
+	if node.PostUp != "" {
+		fmt.Fprintf(&conf, "PostUp = %s\n", node.PostUp)
+	}
+	if node.PostDown != "" {
+		fmt.Fprintf(&conf, "PostDown = %s\n", node.PostDown)
+	}
+	for _, peer := range peerUpdate.Peers {
+		conf.WriteString("\n[Peer]\n")
+		if label, ok := peerUpdate.PeerLabels[peer.PublicKey.String()]; ok {
+			fmt.Fprintf(&conf, "# %s\n", label)
+		}
+		fmt.Fprintf(&conf, "PublicKey = %s\n", peer.PublicKey.String())
+		if peer.PresharedKey != nil {
+			fmt.Fprintf(&conf, "PresharedKey = %s\n", peer.PresharedKey.String())
+		}
+		if len(peer.AllowedIPs) > 0 {
+			allowedIPs := make([]string, len(peer.AllowedIPs))
+			for i, ip := range peer.AllowedIPs {
+				allowedIPs[i] = ip.String()
+			}
+			fmt.Fprintf(&conf, "AllowedIPs = %s\n", strings.Join(allowedIPs, ", "))
+		}
+		if peer.Endpoint != nil {
+			fmt.Fprintf(&conf, "Endpoint = %s\n", peer.Endpoint.String())
+		}
+		if peer.PersistentKeepaliveInterval != nil && peer.PersistentKeepaliveInterval.Seconds() > 0 {
+			fmt.Fprintf(&conf, "PersistentKeepalive = %d\n", int64(peer.PersistentKeepaliveInterval.Seconds()))
+		}
+	}
+	return conf.String()
+}
+
+// GetIngressClientConfs - renders the wg-quick configs of every ext client attached to an ingress gateway, sorted by client id
+func GetIngressClientConfs(gwnode *models.Node) ([]models.ExtClientConf, error) {
+	var confs = []models.ExtClientConf{}
+	network, err := GetParentNetwork(gwnode.Network)
+	if err != nil {
+		return confs, err
+	}
+	extClients, err := GetNetworkExtClients(gwnode.Network)
+	if err != nil {
+		return confs, err
+	}
+	for i := range extClients {
+		if extClients[i].IngressGatewayID != gwnode.ID {
+			continue
+		}
+		confs = append(confs, models.ExtClientConf{
+			ClientID: extClients[i].ClientID,
+			Config:   GetExtClientWGQuickConf(&extClients[i], gwnode, &network),
+		})
+	}
+	sort.Slice(confs, func(i, j int) bool { return confs[i].ClientID < confs[j].ClientID })
+	return confs, nil
+}
+
+// GetExtClientWGQuickConf - renders an ext client's wg-quick config from the current state of its ingress gateway and network
+func GetExtClientWGQuickConf(client *models.ExtClient, gwnode *models.Node, network *models.Network) string {
+	addrString := client.Address
+	if addrString != "" {
+		addrString += "/32"
+	}
+	if client.Address6 != "" {
+		if addrString != "" {
+			addrString += ","
+		}
+		addrString += client.Address6 + "/128"
+	}
+
+	keepalive := ""
+	if network.DefaultKeepalive != 0 {
+		keepalive = "PersistentKeepalive = " + strconv.Itoa(int(network.DefaultKeepalive))
+	}
+	gwendpoint := gwnode.Endpoint + ":" + strconv.Itoa(int(gwnode.ListenPort))
+	newAllowedIPs := network.AddressRange
+	if newAllowedIPs != "" && network.AddressRange6 != "" {
+		newAllowedIPs += ","
+	}
+	if network.AddressRange6 != "" {
+		newAllowedIPs += network.AddressRange6
+	}
+	if egressGatewayRanges, err := GetEgressRangesOnNetwork(client); err == nil {
+		for _, egressGatewayRange := range egressGatewayRanges {
+			newAllowedIPs += "," + egressGatewayRange
+		}
+	}
+	defaultDNS := ""
+	if network.DefaultExtClientDNS != "" {
+		defaultDNS = "DNS = " + network.DefaultExtClientDNS
+	}
+
+	defaultMTU := 1420
+	if gwnode.MTU != 0 {
+		defaultMTU = int(gwnode.MTU)
+	}
+	return fmt.Sprintf(`[Interface]
+Address = %s
+PrivateKey = %s
+MTU = %d
+%s
+
+[Peer]
+PublicKey = %s
+AllowedIPs = %s
+Endpoint = %s
+%s
+
+`, addrString,
+		client.PrivateKey,
+		defaultMTU,
+		defaultDNS,
+		gwnode.PublicKey,
+		newAllowedIPs,
+		gwendpoint,
+		keepalive)
+}
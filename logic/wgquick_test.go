@@ -0,0 +1,50 @@
+package logic
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gravitl/netmaker/models"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestGetNodeWGQuickConf(t *testing.T) {
+	peerKey, err := wgtypes.GeneratePrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, allowed, _ := net.ParseCIDR("10.0.0.2/32")
+	_, egress, _ := net.ParseCIDR("10.100.0.0/16")
+	keepalive := 20 * time.Second
+	node := models.Node{Address: "10.0.0.1", Address6: "fd00::1", ListenPort: 51821, MTU: 1280, DNSOn: "yes"}
+	peerUpdate := models.PeerUpdate{Peers: []wgtypes.PeerConfig{{
+		PublicKey:                   peerKey.PublicKey(),
+		Endpoint:                    &net.UDPAddr{IP: net.ParseIP("192.0.2.10"), Port: 51821},
+		AllowedIPs:                  []net.IPNet{*allowed, *egress},
+		PersistentKeepaliveInterval: &keepalive,
+	}}, PeerLabels: map[string]string{peerKey.PublicKey().String(): "office router"}}
+	conf := GetNodeWGQuickConf(&node, &peerUpdate, "192.0.2.53")
+	for _, line := range []string{
+		"[Interface]",
+		"Address = 10.0.0.1, fd00::1",
+		"PrivateKey = " + models.PLACEHOLDER_PRIVATE_KEY_TEXT,
+		"ListenPort = 51821",
+		"MTU = 1280",
+		"DNS = 192.0.2.53",
+		"[Peer]\n# office router",
+		"PublicKey = " + peerKey.PublicKey().String(),
+		"AllowedIPs = 10.0.0.2/32, 10.100.0.0/16",
+		"Endpoint = 192.0.2.10:51821",
+		"PersistentKeepalive = 20",
+	} {
+		if !strings.Contains(conf, line+"\n") {
+			t.Fatalf("expected %q in config:\n%s", line, conf)
+		}
+	}
+	node.DNSOn = "no"
+	if conf := GetNodeWGQuickConf(&node, &models.PeerUpdate{}, "192.0.2.53"); strings.Contains(conf, "DNS") || strings.Contains(conf, "[Peer]") {
+		t.Fatalf("expected no dns and no peers in config:\n%s", conf)
+	}
+}
@@ -8,3 +8,23 @@ type DNSEntry struct {
 	Name     string `json:"name" bson:"name" validate:"required,name_unique,min=1,max=192"`
 	Network  string `json:"network" bson:"network" validate:"network_exists"`
 }
+
+// DNSRecord - an A or AAAA record written to the hosts file served by CoreDNS
+type DNSRecord struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Address string `json:"address"`
+	// Source - why the record belongs to a node, one of the DNS_SOURCE_* values
+	Source string `json:"source"`
+}
+
+const (
+	// DNS_SOURCE_NODE - the record generated from the node's own name and address
+	DNS_SOURCE_NODE = "node"
+	// DNS_SOURCE_CUSTOM - a custom entry pointing at the node's address
+	DNS_SOURCE_CUSTOM = "custom"
+	// DNS_SOURCE_EXT_CLIENT - a custom entry pointing at an ext client of the node's ingress gateway
+	DNS_SOURCE_EXT_CLIENT = "extclient"
+	// DNS_SOURCE_EGRESS - a custom entry pointing into the ranges of the node's egress gateway
+	DNS_SOURCE_EGRESS = "egress"
+)
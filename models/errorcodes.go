@@ -0,0 +1,91 @@
+package models
+
+// == ERROR CODES == (machine readable, returned as ErrorResponse.ErrorCode)
+const (
+	// ERR_INTERNAL - unexpected server side failure, may be retried
+	ERR_INTERNAL = "INTERNAL_ERROR"
+	// ERR_BAD_REQUEST - generic malformed or invalid request
+	ERR_BAD_REQUEST = "BAD_REQUEST"
+	// ERR_INVALID_REQUEST - request body or params could not be parsed
+	ERR_INVALID_REQUEST = "INVALID_REQUEST"
+	// ERR_NOT_FOUND - generic missing resource
+	ERR_NOT_FOUND = "NOT_FOUND"
+	// ERR_UNAUTHORIZED - caller is not permitted to access the endpoint
+	ERR_UNAUTHORIZED = "UNAUTHORIZED"
+	// ERR_FORBIDDEN - caller is authenticated but the operation is forbidden
+	ERR_FORBIDDEN = "FORBIDDEN"
+	// ERR_CONFLICT - request conflicts with the current state of the resource
+	ERR_CONFLICT = "CONFLICT"
+	// ERR_RATE_LIMITED - too many requests, retry later
+	ERR_RATE_LIMITED = "RATE_LIMITED"
+	// ERR_MISSING_AUTH_TOKEN - no bearer token was provided
+	ERR_MISSING_AUTH_TOKEN = "MISSING_AUTH_TOKEN"
+	// ERR_INVALID_AUTH_TOKEN - bearer token could not be verified
+	ERR_INVALID_AUTH_TOKEN = "INVALID_AUTH_TOKEN"
+	// ERR_TOKEN_EXPIRED - bearer token was valid but has expired, the client should authenticate again
+	ERR_TOKEN_EXPIRED = "TOKEN_EXPIRED"
+	// ERR_INVALID_CREDENTIALS - node id or password is wrong
+	ERR_INVALID_CREDENTIALS = "INVALID_CREDENTIALS"
+	// ERR_INVALID_ACCESS_KEY - access key is invalid, used up or missing
+	ERR_INVALID_ACCESS_KEY = "INVALID_ACCESS_KEY"
+	// ERR_NETWORK_NOT_FOUND - requested network does not exist
+	ERR_NETWORK_NOT_FOUND = "NETWORK_NOT_FOUND"
+	// ERR_NODE_NOT_FOUND - requested node does not exist
+	ERR_NODE_NOT_FOUND = "NODE_NOT_FOUND"
+	// ERR_NODE_IS_SERVER - operation is not supported on server nodes
+	ERR_NODE_IS_SERVER = "NODE_IS_SERVER"
+	// ERR_NODE_PENDING - node has not been approved yet
+	ERR_NODE_PENDING = "NODE_PENDING"
+	// ERR_NODE_DRAINING - node is draining and the grace period has not passed
+	ERR_NODE_DRAINING = "NODE_DRAINING"
+	// ERR_NODE_VERSION_CONFLICT - node was modified since the client read it
+	ERR_NODE_VERSION_CONFLICT = "NODE_VERSION_CONFLICT"
+	// ERR_ADDRESS_IN_USE - requested address is held by another node or ext client
+	ERR_ADDRESS_IN_USE = "ADDRESS_IN_USE"
+	// ERR_UNKNOWN_RELAY_ADDRS - relay addresses do not belong to nodes on the network
+	ERR_UNKNOWN_RELAY_ADDRS = "UNKNOWN_RELAY_ADDRS"
+	// ERR_RELAY_LOOP - relay addresses would have a relay relay itself through a chain of relays
+	ERR_RELAY_LOOP = "RELAY_LOOP"
+	// ERR_TRAFFIC_KEY_MISSING - server or node traffic key is unavailable
+	ERR_TRAFFIC_KEY_MISSING = "TRAFFIC_KEY_MISSING"
+	// ERR_NODE_RECOVERY_EXPIRED - deleted node is past its recovery window
+	ERR_NODE_RECOVERY_EXPIRED = "NODE_RECOVERY_EXPIRED"
+	// ERR_NODE_NAME_IN_USE - node name is held by another node on the network
+	ERR_NODE_NAME_IN_USE = "NODE_NAME_IN_USE"
+	// ERR_PUBLIC_KEY_IN_USE - public key is held by another node on the network
+	ERR_PUBLIC_KEY_IN_USE = "PUBLIC_KEY_IN_USE"
+	// ERR_INVALID_NODE_NAME - requested node name breaks the node naming rules
+	ERR_INVALID_NODE_NAME = "INVALID_NODE_NAME"
+	// ERR_PORT_IN_USE - listen port is held by another gateway behind the same public endpoint
+	ERR_PORT_IN_USE = "PORT_IN_USE"
+	// ERR_EGRESS_RANGE_OVERLAP - egress range overlaps a range advertised by another gateway on the network
+	ERR_EGRESS_RANGE_OVERLAP = "EGRESS_RANGE_OVERLAP"
+	// ERR_ADDRESS_RANGE_EXHAUSTED - every address of the network's range, or of the sub range a node asked for, is in use
+	ERR_ADDRESS_RANGE_EXHAUSTED = "ADDRESS_RANGE_EXHAUSTED"
+	// ERR_REQUEST_CANCELLED - the request was cancelled by the client or ran past its deadline before it was answered
+	ERR_REQUEST_CANCELLED = "REQUEST_CANCELLED"
+	// ERR_STATIC_ADDRESS - node has a static address and the change would alter it
+	ERR_STATIC_ADDRESS = "STATIC_ADDRESS"
+	// ERR_INVALID_NODE_FIELDS - fields of a node update failed validation, each one is listed with the reason
+	ERR_INVALID_NODE_FIELDS = "INVALID_NODE_FIELDS"
+	// ERR_UPDATE_ACK_NOT_FOUND - no acknowledged update with the given id was pushed to the network
+	ERR_UPDATE_ACK_NOT_FOUND = "UPDATE_ACK_NOT_FOUND"
+	// ERR_MESSAGE_QUEUE_OFF - the request needs the message queue backend, which is turned off
+	ERR_MESSAGE_QUEUE_OFF = "MESSAGE_QUEUE_OFF"
+	// ERR_MAINTENANCE - node changes are paused while the server is in maintenance mode, retry later
+	ERR_MAINTENANCE = "MAINTENANCE"
+	// ERR_INVALID_POST_COMMAND_TEMPLATE - a network's default post up or post down template does not render
+	ERR_INVALID_POST_COMMAND_TEMPLATE = "INVALID_POST_COMMAND_TEMPLATE"
+	// ERR_ACCESS_KEY_NOT_FOUND - the network has no access key with the given name
+	ERR_ACCESS_KEY_NOT_FOUND = "ACCESS_KEY_NOT_FOUND"
+	// ERR_DNS_ONLY_NODE - a dns only node cannot be a gateway, a relay or relayed
+	ERR_DNS_ONLY_NODE = "DNS_ONLY_NODE"
+	// ERR_USER_LOOKUP_FAILED - the user making the request could not be read
+	ERR_USER_LOOKUP_FAILED = "USER_LOOKUP_FAILED"
+	// ERR_NODE_LIST_FAILED - the nodes could not be read to be listed
+	ERR_NODE_LIST_FAILED = "NODE_LIST_FAILED"
+	// ERR_ASYMMETRIC_KEYS_DISABLED - the network does not use asymmetric access keys, its keys are sent as they are
+	ERR_ASYMMETRIC_KEYS_DISABLED = "ASYMMETRIC_KEYS_DISABLED"
+	// ERR_NODE_UPDATE_NOT_FOUND - no update was pushed to the node yet, so there is no delivery status
+	ERR_NODE_UPDATE_NOT_FOUND = "NODE_UPDATE_NOT_FOUND"
+)
@@ -14,3 +14,9 @@ type ExtClient struct {
 	LastModified           int64  `json:"lastmodified" bson:"lastmodified"`
 	Enabled                bool   `json:"enabled" bson:"enabled"`
 }
+
+// ExtClientConf - wg-quick config of an ext client
+type ExtClientConf struct {
+	ClientID string `json:"clientid" bson:"clientid"`
+	Config   string `json:"config" bson:"config"`
+}
@@ -2,6 +2,28 @@ package models
 
 import "golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 
+const (
+	// PEER_ACL_ALLOWED - both nodes allow each other
+	PEER_ACL_ALLOWED = "allowed"
+	// PEER_ACL_DENIED_BY_NODE - the node's acl does not allow the peer
+	PEER_ACL_DENIED_BY_NODE = "denied by node acl"
+	// PEER_ACL_DENIED_BY_PEER - the peer's acl does not allow the node
+	PEER_ACL_DENIED_BY_PEER = "denied by peer acl"
+
+	// PEER_REASON_NETWORK - peer is another node of the network
+	PEER_REASON_NETWORK = "same network"
+	// PEER_REASON_RELAY - peer relays the node's traffic
+	PEER_REASON_RELAY = "relay"
+	// PEER_REASON_RELAYED - peer's traffic is relayed by the node
+	PEER_REASON_RELAYED = "relayed by node"
+	// PEER_REASON_EGRESS_GATEWAY - peer is an egress gateway of the network
+	PEER_REASON_EGRESS_GATEWAY = "egress gateway"
+	// PEER_REASON_INGRESS_GATEWAY - peer is an ingress gateway of the network
+	PEER_REASON_INGRESS_GATEWAY = "ingress gateway"
+	// PEER_REASON_EXT_CLIENT - peer is an ext client of the node
+	PEER_REASON_EXT_CLIENT = "ext client"
+)
+
 // PeerUpdate - struct
 type PeerUpdate struct {
 	Network       string               `json:"network" bson:"network" yaml:"network"`
@@ -9,6 +31,45 @@ type PeerUpdate struct {
 	ServerAddrs   []ServerAddr         `json:"serveraddrs" bson:"serveraddrs" yaml:"serveraddrs"`
 	Peers         []wgtypes.PeerConfig `json:"peers" bson:"peers" yaml:"peers"`
 	DNS           string               `json:"dns" bson:"dns" yaml:"dns"`
+	DefaultACL    string               `json:"defaultacl" bson:"defaultacl" yaml:"defaultacl"`
+	ACLDecisions  []PeerACLDecision    `json:"acldecisions" bson:"acldecisions" yaml:"acldecisions"`
+	// PeerLabels - descriptions of the peers that have one, by public key
+	PeerLabels map[string]string `json:"peerlabels,omitempty" bson:"peerlabels,omitempty" yaml:"peerlabels,omitempty"`
+	// PeerEpoch - the network's peer epoch the peers were computed at
+	PeerEpoch int64 `json:"peerepoch" bson:"peerepoch" yaml:"peerepoch"`
+	// AckID - set when the server wants the node to confirm it applied the peers, see UpdateAckReply
+	AckID string `json:"ackid,omitempty" bson:"ackid,omitempty" yaml:"ackid,omitempty"`
+	// ResyncID - set on updates of a requested resync, agents skip an update equal to the last one
+	// they received, a new id makes them apply unchanged peers again
+	ResyncID string `json:"resyncid,omitempty" bson:"resyncid,omitempty" yaml:"resyncid,omitempty"`
+}
+
+// UpdateAckReply - sent by a node on ack/<node id> once it applied an update that asked for an acknowledgement
+type UpdateAckReply struct {
+	AckID string `json:"ackid" bson:"ackid" yaml:"ackid"`
+}
+
+// PeerUpdateExplanation - a node's peer update along with why each peer is present and which nodes the acl keeps out
+type PeerUpdateExplanation struct {
+	PeerUpdate    PeerUpdate        `json:"peerupdate" bson:"peerupdate" yaml:"peerupdate"`
+	Peers         []PeerExplanation `json:"peers" bson:"peers" yaml:"peers"`
+	ExcludedByACL []PeerACLDecision `json:"excludedbyacl" bson:"excludedbyacl" yaml:"excludedbyacl"`
+}
+
+// PeerExplanation - why a peer is included in a node's peer update
+type PeerExplanation struct {
+	PublicKey string `json:"publickey" bson:"publickey" yaml:"publickey"`
+	NodeID    string `json:"nodeid" bson:"nodeid" yaml:"nodeid"`
+	Name      string `json:"name" bson:"name" yaml:"name"`
+	Reason    string `json:"reason" bson:"reason" yaml:"reason"`
+}
+
+// PeerACLDecision - whether the network acl lets a node peer with another node, and why
+type PeerACLDecision struct {
+	NodeID  string `json:"nodeid" bson:"nodeid" yaml:"nodeid"`
+	Name    string `json:"name" bson:"name" yaml:"name"`
+	Allowed bool   `json:"allowed" bson:"allowed" yaml:"allowed"`
+	Reason  string `json:"reason" bson:"reason" yaml:"reason"`
 }
 
 // KeyUpdate - key update struct
@@ -17,7 +17,7 @@ type Network struct {
 	NodeLimit           int32       `json:"nodelimit" bson:"nodelimit"`
 	DefaultPostUp       string      `json:"defaultpostup" bson:"defaultpostup"`
 	DefaultPostDown     string      `json:"defaultpostdown" bson:"defaultpostdown"`
-	DefaultKeepalive    int32       `json:"defaultkeepalive" bson:"defaultkeepalive" validate:"omitempty,max=1000"`
+	DefaultKeepalive    int32       `json:"defaultkeepalive" bson:"defaultkeepalive" validate:"omitempty,min=0,max=1000"`
 	AccessKeys          []AccessKey `json:"accesskeys" bson:"accesskeys"`
 	AllowManualSignUp   string      `json:"allowmanualsignup" bson:"allowmanualsignup" validate:"checkyesorno"`
 	IsLocal             string      `json:"islocal" bson:"islocal" validate:"checkyesorno"`
@@ -27,8 +27,21 @@ type Network struct {
 	LocalRange          string      `json:"localrange" bson:"localrange" validate:"omitempty,cidr"`
 	DefaultUDPHolePunch string      `json:"defaultudpholepunch" bson:"defaultudpholepunch" validate:"checkyesorno"`
 	DefaultExtClientDNS string      `json:"defaultextclientdns" bson:"defaultextclientdns"`
-	DefaultMTU          int32       `json:"defaultmtu" bson:"defaultmtu"`
+	DefaultMTU          int32       `json:"defaultmtu" bson:"defaultmtu" validate:"omitempty,min=576,max=9000"`
 	DefaultACL          string      `json:"defaultacl" bson:"defaultacl" yaml:"defaultacl" validate:"checkyesorno"`
+	AsymmetricKeys      string      `json:"asymmetrickeys" bson:"asymmetrickeys" yaml:"asymmetrickeys" validate:"omitempty,checkyesorno"`
+	// PresharedKeys - yes to give every pair of nodes that support it a wireguard preshared key
+	PresharedKeys string `json:"presharedkeys" bson:"presharedkeys" yaml:"presharedkeys" validate:"omitempty,checkyesorno"`
+	// TokenLifetime - seconds a node auth token issued on this network stays valid
+	TokenLifetime int64 `json:"tokenlifetime" bson:"tokenlifetime" yaml:"tokenlifetime" validate:"omitempty,min=60,max=2592000"`
+	// PeerEpoch - incremented whenever the peers of the network change, kept by the server only
+	PeerEpoch int64 `json:"peerepoch" bson:"peerepoch" yaml:"peerepoch"`
+}
+
+// PeerEpoch - the peer epoch of a network, agents holding peers of the same epoch are up to date
+type PeerEpoch struct {
+	Network   string `json:"network" bson:"network"`
+	PeerEpoch int64  `json:"peerepoch" bson:"peerepoch"`
 }
 
 // SaveData - sensitive fields of a network that should be kept the same
@@ -92,4 +105,16 @@ func (network *Network) SetDefaults() {
 	if network.DefaultACL == "" {
 		network.DefaultACL = "yes"
 	}
+
+	if network.AsymmetricKeys == "" {
+		network.AsymmetricKeys = "no"
+	}
+
+	if network.PresharedKeys == "" {
+		network.PresharedKeys = "no"
+	}
+
+	if network.TokenLifetime == 0 {
+		network.TokenLifetime = 300
+	}
 }
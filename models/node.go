@@ -6,8 +6,7 @@ import (
 	"net"
 	"strings"
 	"time"
-
-	"golang.org/x/crypto/bcrypt"
+	"unicode"
 )
 
 const (
@@ -26,8 +25,31 @@ const (
 	NODE_IS_PENDING = "pending"
 	// NODE_NOOP - node no op action
 	NODE_NOOP = "noop"
+	// NODE_PAUSE - node was deleted and takes its interface down, keeping its config so a restore can bring it back
+	NODE_PAUSE = "pause"
+	// NODE_EVENT_CREATE - node added to a network
+	NODE_EVENT_CREATE = "create"
+	// NODE_EVENT_UPDATE - node changed
+	NODE_EVENT_UPDATE = "update"
+	// NODE_EVENT_DELETE - node removed from a network
+	NODE_EVENT_DELETE = "delete"
 	// NODE_FORCE_UPDATE - indicates a node should pull all changes
 	NODE_FORCE_UPDATE = "force"
+	// NODE_ROTATE_TRAFFIC_KEYS - node should generate new traffic keys and send its new public key
+	NODE_ROTATE_TRAFFIC_KEYS = "rotatetraffickeys"
+	// NODE_APPROVAL_APPROVED - pending node was approved
+	NODE_APPROVAL_APPROVED = "approved"
+	// NODE_APPROVAL_SKIPPED - node was not pending so nothing was done
+	NODE_APPROVAL_SKIPPED = "skipped"
+	// NODE_APPROVAL_FAILED - node could not be found or approved
+	NODE_APPROVAL_FAILED = "failed"
+	// PENDING_REASON_MANUAL_SIGNUP - node joined without an access key on a network that allows manual sign up
+	PENDING_REASON_MANUAL_SIGNUP = "MANUAL_SIGNUP"
+	// PENDING_REASON_INVALID_KEY_GRACE - node joined with an invalid, expired or used up access key
+	// and the network's manual sign up let it wait for approval instead of rejecting it
+	PENDING_REASON_INVALID_KEY_GRACE = "INVALID_KEY_GRACE"
+	// ENDPOINT_OVERRIDE_NONE - endpoint override value that removes a node's override
+	ENDPOINT_OVERRIDE_NONE = "none"
 )
 
 var seededRand *rand.Rand = rand.New(
@@ -67,8 +89,13 @@ type Node struct {
 	IsEgressGateway     string   `json:"isegressgateway" bson:"isegressgateway" yaml:"isegressgateway"`
 	IsIngressGateway    string   `json:"isingressgateway" bson:"isingressgateway" yaml:"isingressgateway"`
 	EgressGatewayRanges []string `json:"egressgatewayranges" bson:"egressgatewayranges" yaml:"egressgatewayranges"`
-	RelayAddrs          []string `json:"relayaddrs" bson:"relayaddrs" yaml:"relayaddrs"`
-	IngressGatewayRange string   `json:"ingressgatewayrange" bson:"ingressgatewayrange" yaml:"ingressgatewayrange"`
+	// EgressGatewayTargets - dns names whose addresses are added to the egress ranges, EgressGatewayTargetRanges holds the last addresses they resolved to
+	EgressGatewayTargets      []string            `json:"egressgatewaytargets" bson:"egressgatewaytargets" yaml:"egressgatewaytargets"`
+	EgressGatewayTargetRanges map[string][]string `json:"egressgatewaytargetranges" bson:"egressgatewaytargetranges" yaml:"egressgatewaytargetranges"`
+	EgressGatewayMetric       int32               `json:"egressgatewaymetric" bson:"egressgatewaymetric" yaml:"egressgatewaymetric"`
+	RelayAddrs                []string            `json:"relayaddrs" bson:"relayaddrs" yaml:"relayaddrs"`
+	IngressGatewayRange       string              `json:"ingressgatewayrange" bson:"ingressgatewayrange" yaml:"ingressgatewayrange"`
+	IngressClientCIDR         string              `json:"ingressclientcidr" bson:"ingressclientcidr" yaml:"ingressclientcidr"`
 	// IsStatic - refers to if the Endpoint is set manually or dynamically
 	IsStatic     string      `json:"isstatic" bson:"isstatic" yaml:"isstatic" validate:"checkyesorno"`
 	UDPHolePunch string      `json:"udpholepunch" bson:"udpholepunch" yaml:"udpholepunch" validate:"checkyesorno"`
@@ -79,10 +106,60 @@ type Node struct {
 	LocalRange   string      `json:"localrange" bson:"localrange" yaml:"localrange"`
 	IPForwarding string      `json:"ipforwarding" bson:"ipforwarding" yaml:"ipforwarding" validate:"checkyesorno"`
 	OS           string      `json:"os" bson:"os" yaml:"os"`
-	MTU          int32       `json:"mtu" bson:"mtu" yaml:"mtu"`
+	MTU          int32       `json:"mtu" bson:"mtu" yaml:"mtu" validate:"omitempty,min=576,max=9000"`
 	Version      string      `json:"version" bson:"version" yaml:"version"`
 	Server       string      `json:"server" bson:"server" yaml:"server"`
 	TrafficKeys  TrafficKeys `json:"traffickeys" bson:"traffickeys" yaml:"traffickeys"`
+	IsDraining   string      `json:"isdraining" bson:"isdraining" yaml:"isdraining" validate:"omitempty,checkyesorno"`
+	DrainStarted int64       `json:"drainstarted" bson:"drainstarted" yaml:"drainstarted"`
+	// ResourceVersion - incremented on every write, used to detect concurrent updates
+	ResourceVersion int64    `json:"resourceversion" bson:"resourceversion" yaml:"resourceversion"`
+	Tags            []string `json:"tags" bson:"tags" yaml:"tags" validate:"omitempty,max=32,dive,min=1,max=32,tag_charset"`
+	// DeletedAt - unix time the node was soft deleted, zero for live nodes
+	DeletedAt int64 `json:"deletedat" bson:"deletedat" yaml:"deletedat"`
+	// CreatedAt - unix time the node joined its network, zero for nodes created before it was tracked
+	CreatedAt int64 `json:"createdat" bson:"createdat" yaml:"createdat"`
+	// PresharedKeySupport - yes when the node's client applies the preshared keys sent in peer updates
+	PresharedKeySupport string `json:"presharedkeysupport" bson:"presharedkeysupport" yaml:"presharedkeysupport" validate:"omitempty,checkyesorno"`
+	// PendingReason - why a pending node is waiting for approval, empty for nodes that are not pending
+	PendingReason string `json:"pendingreason" bson:"pendingreason" yaml:"pendingreason"`
+	// AddressRange - sub range of the network the node asked to be given its address from when it joined
+	AddressRange string `json:"addressrange" bson:"addressrange" yaml:"addressrange"`
+	// EndpointOverride - host:port set by an admin that peers reach the node on instead of its discovered endpoint
+	EndpointOverride string `json:"endpointoverride" bson:"endpointoverride" yaml:"endpointoverride"`
+	// EgressGatewayInterface - interface egress traffic is masqueraded out of, empty to use whichever interface routing picks
+	EgressGatewayInterface string `json:"egressgatewayinterface" bson:"egressgatewayinterface" yaml:"egressgatewayinterface"`
+	// EgressGatewayStatus - why the egress gateway cannot work as configured, empty when nothing is wrong
+	EgressGatewayStatus string `json:"egressgatewaystatus" bson:"egressgatewaystatus" yaml:"egressgatewaystatus"`
+	// Description - short label for operators, sent to peers so they can annotate their peer entries
+	Description string `json:"description" bson:"description" yaml:"description" validate:"omitempty,max=64,description_charset"`
+	// LocalInterfaces - names of the network interfaces the node reported it has
+	LocalInterfaces []string `json:"localinterfaces" bson:"localinterfaces" yaml:"localinterfaces"`
+	// Notes - free text kept by admins about the node, never sent to peers or used in its config
+	Notes string `json:"notes" bson:"notes" yaml:"notes" validate:"omitempty,max=1024"`
+	// EgressGatewayNATRules - per source nat behavior of the egress gateway, ordered most specific source first
+	EgressGatewayNATRules []EgressNATRule `json:"egressgatewaynatrules" bson:"egressgatewaynatrules" yaml:"egressgatewaynatrules"`
+	// IsStaticAddress - the node's addresses are fixed, updates, reassignment, moves and range changes may not alter them
+	IsStaticAddress string `json:"isstaticaddress" bson:"isstaticaddress" yaml:"isstaticaddress" validate:"omitempty,checkyesorno"`
+	// UpdateAckID - set only on node updates the server wants acknowledged, never stored
+	UpdateAckID string `json:"updateackid,omitempty" bson:"updateackid,omitempty" yaml:"updateackid,omitempty"`
+	// AccessKeyHash - hex sha256 of the access key the node enrolled with, set by the server when the node joins
+	AccessKeyHash string `json:"accesskeyhash" bson:"accesskeyhash" yaml:"accesskeyhash"`
+	// AccessKeyName - name of the access key the node enrolled with, set with AccessKeyHash and kept after the key is used up or deleted
+	AccessKeyName string `json:"accesskeyname" bson:"accesskeyname" yaml:"accesskeyname"`
+	// IsDNSOnly - the node only anchors dns records, it is left out of every peer list and holds no gateway or relay role
+	IsDNSOnly string `json:"isdnsonly" bson:"isdnsonly" yaml:"isdnsonly" validate:"omitempty,checkyesorno"`
+	// NotesSet - set by the api when an update carries notes, so empty notes clear them instead of keeping the current ones, never stored
+	NotesSet bool `json:"-" bson:"-" yaml:"-"`
+}
+
+// NodeDrainStatus - progress of a node drain before deletion
+type NodeDrainStatus struct {
+	NodeID   string `json:"nodeid" bson:"nodeid" yaml:"nodeid"`
+	Draining bool   `json:"draining" bson:"draining" yaml:"draining"`
+	Started  int64  `json:"started" bson:"started" yaml:"started"`
+	Ends     int64  `json:"ends" bson:"ends" yaml:"ends"`
+	Complete bool   `json:"complete" bson:"complete" yaml:"complete"`
 }
 
 // NodesArray - used for node sorting
@@ -92,7 +169,7 @@ type NodesArray []Node
 func (a NodesArray) Len() int { return len(a) }
 
 // NodesArray.Less - gets returns lower rank of two node addresses
-func (a NodesArray) Less(i, j int) bool { return isLess(a[i].Address, a[j].Address) }
+func (a NodesArray) Less(i, j int) bool { return isLess(a[i].PrimaryAddress(), a[j].PrimaryAddress()) }
 
 // NodesArray.Swap - swaps two nodes in array
 func (a NodesArray) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
@@ -225,9 +302,10 @@ func (node *Node) SetIsStaticDefault() {
 	}
 }
 
-// Node.SetLastModified - set last modified initial time
+// Node.SetLastModified - set last modified initial time and bump the resource version
 func (node *Node) SetLastModified() {
 	node.LastModified = time.Now().Unix()
+	node.ResourceVersion++
 }
 
 // Node.SetLastCheckIn - time.Now().Unix()
@@ -280,6 +358,11 @@ func (newNode *Node) Fill(currentNode *Node) {
 	if newNode.Endpoint == "" {
 		newNode.Endpoint = currentNode.Endpoint
 	}
+	if newNode.EndpointOverride == "" {
+		newNode.EndpointOverride = currentNode.EndpointOverride
+	} else if newNode.EndpointOverride == ENDPOINT_OVERRIDE_NONE {
+		newNode.EndpointOverride = ""
+	}
 	if newNode.PostUp == "" {
 		newNode.PostUp = currentNode.PostUp
 	}
@@ -313,15 +396,8 @@ func (newNode *Node) Fill(currentNode *Node) {
 	if newNode.MacAddress == "" {
 		newNode.MacAddress = currentNode.MacAddress
 	}
-	if newNode.Password != "" {
-		err := bcrypt.CompareHashAndPassword([]byte(newNode.Password), []byte(currentNode.Password))
-		if err != nil && currentNode.Password != newNode.Password {
-			hash, err := bcrypt.GenerateFromPassword([]byte(newNode.Password), 5)
-			if err == nil {
-				newNode.Password = string(hash)
-			}
-		}
-	} else {
+	// a changed password is hashed by logic.UpdateNode at the configured cost
+	if newNode.Password == "" {
 		newNode.Password = currentNode.Password
 	}
 	if newNode.Network == "" {
@@ -339,15 +415,51 @@ func (newNode *Node) Fill(currentNode *Node) {
 	if newNode.EgressGatewayRanges == nil {
 		newNode.EgressGatewayRanges = currentNode.EgressGatewayRanges
 	}
+	if newNode.EgressGatewayTargets == nil {
+		newNode.EgressGatewayTargets = currentNode.EgressGatewayTargets
+	}
+	if newNode.EgressGatewayTargetRanges == nil {
+		newNode.EgressGatewayTargetRanges = currentNode.EgressGatewayTargetRanges
+	}
+	if newNode.EgressGatewayMetric == 0 {
+		newNode.EgressGatewayMetric = currentNode.EgressGatewayMetric
+	}
+	if newNode.EgressGatewayInterface == "" {
+		newNode.EgressGatewayInterface = currentNode.EgressGatewayInterface
+	}
+	if newNode.EgressGatewayNATRules == nil {
+		newNode.EgressGatewayNATRules = currentNode.EgressGatewayNATRules
+	}
+	if newNode.LocalInterfaces == nil {
+		newNode.LocalInterfaces = currentNode.LocalInterfaces
+	}
+	if newNode.Description == "" {
+		newNode.Description = currentNode.Description
+	}
+	if newNode.Notes == "" && !newNode.NotesSet {
+		newNode.Notes = currentNode.Notes
+	}
+	if newNode.IsStaticAddress == "" {
+		newNode.IsStaticAddress = currentNode.IsStaticAddress
+	}
+	if newNode.IsDNSOnly == "" {
+		newNode.IsDNSOnly = currentNode.IsDNSOnly
+	}
 	if newNode.IngressGatewayRange == "" {
 		newNode.IngressGatewayRange = currentNode.IngressGatewayRange
 	}
+	if newNode.IngressClientCIDR == "" {
+		newNode.IngressClientCIDR = currentNode.IngressClientCIDR
+	}
 	if newNode.IsStatic == "" {
 		newNode.IsStatic = currentNode.IsStatic
 	}
 	if newNode.UDPHolePunch == "" {
 		newNode.UDPHolePunch = currentNode.UDPHolePunch
 	}
+	if newNode.PresharedKeySupport == "" {
+		newNode.PresharedKeySupport = currentNode.PresharedKeySupport
+	}
 	if newNode.DNSOn == "" {
 		newNode.DNSOn = currentNode.DNSOn
 	}
@@ -396,7 +508,26 @@ func (newNode *Node) Fill(currentNode *Node) {
 	if newNode.Server == "" {
 		newNode.Server = currentNode.Server
 	}
+	if newNode.IsDraining == "" {
+		newNode.IsDraining = currentNode.IsDraining
+	}
+	if newNode.DrainStarted == 0 {
+		newNode.DrainStarted = currentNode.DrainStarted
+	}
 	newNode.TrafficKeys = currentNode.TrafficKeys
+	newNode.ResourceVersion = currentNode.ResourceVersion
+	newNode.DeletedAt = currentNode.DeletedAt
+	newNode.CreatedAt = currentNode.CreatedAt
+	newNode.AccessKeyHash = currentNode.AccessKeyHash
+	newNode.AccessKeyName = currentNode.AccessKeyName
+	if newNode.Tags == nil {
+		newNode.Tags = currentNode.Tags
+	}
+	// only set by the server when a node joins, cleared once the node stops pending
+	newNode.PendingReason = currentNode.PendingReason
+	if newNode.IsPending != "yes" {
+		newNode.PendingReason = ""
+	}
 }
 
 // StringWithCharset - returns random string inside defined charset
@@ -415,6 +546,56 @@ func IsIpv4Net(host string) bool {
 	return net.ParseIP(host) != nil
 }
 
+// Node.DedupeTags - removes repeated tags, keeping the first occurrence
+func (node *Node) DedupeTags() {
+	if node.Tags == nil {
+		return
+	}
+	var seen = make(map[string]bool)
+	var tags = []string{}
+	for _, tag := range node.Tags {
+		if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	node.Tags = tags
+}
+
+// Node.HasTag - checks if a node carries a tag
+func (node *Node) HasTag(tag string) bool {
+	for _, nodeTag := range node.Tags {
+		if nodeTag == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// TagInNodeCharSet - returns if a tag only uses lowercase letters, digits, dashes and underscores
+func TagInNodeCharSet(tag string) bool {
+
+	charset := "abcdefghijklmnopqrstuvwxyz1234567890-_"
+
+	for _, char := range tag {
+		if !strings.ContainsRune(charset, char) {
+			return false
+		}
+	}
+	return true
+}
+
+// DescriptionInNodeCharSet - checks a description is a single line of printable characters,
+// it ends up in comments of wireguard config files
+func DescriptionInNodeCharSet(description string) bool {
+	for _, char := range description {
+		if !unicode.IsPrint(char) {
+			return false
+		}
+	}
+	return true
+}
+
 // Node.NameInNodeCharset - returns if name is in charset below or not
 func (node *Node) NameInNodeCharSet() bool {
 
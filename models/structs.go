@@ -1,6 +1,8 @@
 package models
 
 import (
+	"time"
+
 	jwt "github.com/golang-jwt/jwt/v4"
 	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 )
@@ -8,6 +10,21 @@ import (
 const PLACEHOLDER_KEY_TEXT = "ACCESS_KEY"
 const PLACEHOLDER_TOKEN_TEXT = "ACCESS_TOKEN"
 
+// PLACEHOLDER_PRIVATE_KEY_TEXT - stands in for a node's private key, which never leaves the node, in generated configs
+const PLACEHOLDER_PRIVATE_KEY_TEXT = "PRIVATE_KEY"
+
+// HEALTH_OK - the server or dependency is healthy
+const HEALTH_OK = "ok"
+
+// HEALTH_DEGRADED - at least one dependency of the server is unhealthy
+const HEALTH_DEGRADED = "degraded"
+
+// HEALTH_ERROR - the dependency could not be reached
+const HEALTH_ERROR = "error"
+
+// HEALTH_DISABLED - the dependency is not used by this server
+const HEALTH_DISABLED = "disabled"
+
 // AuthParams - struct for auth params
 type AuthParams struct {
 	MacAddress string `json:"macaddress"`
@@ -21,13 +38,21 @@ type User struct {
 	Password string   `json:"password" bson:"password" validate:"required,min=5"`
 	Networks []string `json:"networks" bson:"networks"`
 	IsAdmin  bool     `json:"isadmin" bson:"isadmin"`
+	Role     string   `json:"role,omitempty" bson:"role,omitempty" validate:"omitempty,oneof=read-only netadmin"`
 }
 
+// USER_ROLE_READ_ONLY - role of users who may view every network's nodes but change nothing
+const USER_ROLE_READ_ONLY = "read-only"
+
+// USER_ROLE_NETWORK_ADMIN - role of users who manage the nodes and keys of their networks only, server nodes excluded
+const USER_ROLE_NETWORK_ADMIN = "netadmin"
+
 // ReturnUser - return user struct
 type ReturnUser struct {
 	UserName string   `json:"username" bson:"username" validate:"min=3,max=40,regexp=^(([a-zA-Z,\-,\.]*)|([A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,4})){3,40}$"`
 	Networks []string `json:"networks" bson:"networks"`
 	IsAdmin  bool     `json:"isadmin" bson:"isadmin"`
+	Role     string   `json:"role,omitempty" bson:"role,omitempty"`
 }
 
 // UserAuthParams - user auth params struct
@@ -63,12 +88,48 @@ type Claims struct {
 type SuccessfulLoginResponse struct {
 	ID        string
 	AuthToken string
+	Expires   int64 `json:",omitempty"`
 }
 
 // ErrorResponse is struct for error
 type ErrorResponse struct {
-	Code    int
-	Message string
+	Code              int
+	Message           string
+	ErrorCode         string
+	ConflictingNodeID string `json:",omitempty"`
+	// AddressUtilization - set when a network has no addresses left to hand out
+	AddressUtilization *AddressUtilization `json:",omitempty"`
+	// InvalidFields - set when fields of a request failed validation, one entry per field
+	InvalidFields []FieldError `json:",omitempty"`
+}
+
+// FieldError - a field of a request that failed validation and why
+type FieldError struct {
+	Field  string `json:"field" bson:"field"`
+	Reason string `json:"reason" bson:"reason"`
+}
+
+// AddressUtilization - how many addresses of a network's ranges are held by nodes, deleted nodes and ext clients,
+// Total6 is a decimal string as ipv6 ranges can hold more than 64 bits of addresses
+type AddressUtilization struct {
+	Network       string `json:"network"`
+	AddressRange  string `json:"addressrange"`
+	Used          int    `json:"used"`
+	Total         uint64 `json:"total"`
+	AddressRange6 string `json:"addressrange6,omitempty"`
+	Used6         int    `json:"used6"`
+	Total6        string `json:"total6,omitempty"`
+}
+
+// UtilizationEvent - sent once when the addresses in use of a network range cross the utilization threshold
+type UtilizationEvent struct {
+	Network      string `json:"network"`
+	AddressRange string `json:"addressrange"`
+	IPv6         bool   `json:"ipv6"`
+	Used         int    `json:"used"`
+	Total        uint64 `json:"total"`
+	Threshold    int    `json:"threshold"`
+	Time         int64  `json:"time"`
 }
 
 // NodeAuth - struct for node auth
@@ -92,6 +153,40 @@ type AccessKey struct {
 	Value        string `json:"value" bson:"value" validate:"omitempty,alphanum,max=16"`
 	AccessString string `json:"accessstring" bson:"accessstring"`
 	Uses         int    `json:"uses" bson:"uses" validate:"numeric,min=0"`
+	PublicKey    string `json:"publickey" bson:"publickey" validate:"omitempty,base64"`
+	Expiration   int64  `json:"expiration" bson:"expiration" validate:"numeric,min=0"`
+}
+
+// AccessKey.IsExpired - checks if the key's expiration has passed, 0 never expires
+func (key *AccessKey) IsExpired() bool {
+	return key.Expiration != 0 && time.Now().Unix() >= key.Expiration
+}
+
+// AccessKey.IsUsable - checks if the key has uses remaining and has not expired
+func (key *AccessKey) IsUsable() bool {
+	return key.Uses > 0 && !key.IsExpired()
+}
+
+// AccessKeyChallenge - single use nonce a node signs with an ed25519 access key to join a network
+type AccessKeyChallenge struct {
+	Network string `json:"network" bson:"network"`
+	Nonce   string `json:"nonce" bson:"nonce"`
+	Expires int64  `json:"expires" bson:"expires"`
+}
+
+// NodeTokenChallenge - single use nonce a node seals with its wireguard private key to get a token without its password
+type NodeTokenChallenge struct {
+	NodeID    string `json:"nodeid" bson:"nodeid"`
+	Nonce     string `json:"nonce" bson:"nonce"`
+	Expires   int64  `json:"expires" bson:"expires"`
+	ServerKey []byte `json:"serverkey" bson:"serverkey"`
+}
+
+// NodeTokenRequest - answer to a node token challenge, signature is the nonce sealed in a nacl box
+// from the node's wireguard private key to the server traffic key, base64 encoded
+type NodeTokenRequest struct {
+	Nonce     string `json:"nonce" bson:"nonce"`
+	Signature string `json:"signature" bson:"signature"`
 }
 
 // DisplayKey - what is displayed for key
@@ -142,15 +237,321 @@ type ExtPeersResponse struct {
 	KeepAlive       int32  `json:"persistentkeepalive" bson:"persistentkeepalive"`
 }
 
+// IngressGatewayRequest - ingress gateway request, a zero port keeps the node's current listen port
+type IngressGatewayRequest struct {
+	Port int32 `json:"port" bson:"port"`
+	// ClientCIDR - sub range of the network the gateway's ext clients are given addresses from, empty for the whole network
+	ClientCIDR string `json:"clientcidr" bson:"clientcidr"`
+}
+
 // EgressGatewayRequest - egress gateway request
+// EgressNATRule - whether egress traffic from a source range is masqueraded or forwarded with its source
+// address unchanged, traffic from sources without a rule is masqueraded
+type EgressNATRule struct {
+	Source string `json:"source" bson:"source" yaml:"source"`
+	NAT    bool   `json:"nat" bson:"nat" yaml:"nat"`
+}
+
 type EgressGatewayRequest struct {
 	NodeID      string   `json:"nodeid" bson:"nodeid"`
 	NetID       string   `json:"netid" bson:"netid"`
 	RangeString string   `json:"rangestring" bson:"rangestring"`
 	Ranges      []string `json:"ranges" bson:"ranges"`
+	Targets     []string `json:"targets" bson:"targets"`
 	Interface   string   `json:"interface" bson:"interface"`
 	PostUp      string   `json:"postup" bson:"postup"`
 	PostDown    string   `json:"postdown" bson:"postdown"`
+	// Metric - preference among gateways with overlapping ranges, the lowest metric is routed through
+	Metric int32 `json:"metric" bson:"metric"`
+	// NATRules - per source nat behavior, the most specific source matching the traffic applies
+	NATRules []EgressNATRule `json:"natrules" bson:"natrules"`
+	Force    bool            `json:"-" bson:"-"`
+}
+
+// ServerHealth - health of the server and the services it depends on
+type ServerHealth struct {
+	Status   string           `json:"status" bson:"status"`
+	Database DependencyHealth `json:"database" bson:"database"`
+	MQ       DependencyHealth `json:"mq" bson:"mq"`
+}
+
+// DependencyHealth - result of checking a single dependency
+type DependencyHealth struct {
+	Status string `json:"status" bson:"status"`
+	Error  string `json:"error,omitempty" bson:"error,omitempty"`
+}
+
+// NodeEvent - a node change streamed to subscribers of its network
+type NodeEvent struct {
+	Type     string `json:"type" bson:"type"`
+	Network  string `json:"network" bson:"network"`
+	NodeID   string `json:"nodeid" bson:"nodeid"`
+	Name     string `json:"name" bson:"name"`
+	Address  string `json:"address" bson:"address"`
+	Address6 string `json:"address6" bson:"address6"`
+	Time     int64  `json:"time" bson:"time"`
+}
+
+// NodeSummary - roster entry for a node without keys or peer lists
+type NodeSummary struct {
+	ID               string `json:"id" bson:"id"`
+	Name             string `json:"name" bson:"name"`
+	Address          string `json:"address" bson:"address"`
+	Address6         string `json:"address6" bson:"address6"`
+	Connected        bool   `json:"connected" bson:"connected"`
+	PeerCount        int    `json:"peercount" bson:"peercount"`
+	IsEgressGateway  bool   `json:"isegressgateway" bson:"isegressgateway"`
+	IsIngressGateway bool   `json:"isingressgateway" bson:"isingressgateway"`
+	IsRelay          bool   `json:"isrelay" bson:"isrelay"`
+	IsRelayed        bool   `json:"isrelayed" bson:"isrelayed"`
+}
+
+// StaleNode - a node that has gone quiet, with the times needed to decide whether to remove it
+type StaleNode struct {
+	ID          string `json:"id" bson:"id"`
+	Name        string `json:"name" bson:"name"`
+	Address     string `json:"address" bson:"address"`
+	Address6    string `json:"address6" bson:"address6"`
+	CreatedAt   int64  `json:"createdat" bson:"createdat"`
+	LastCheckIn int64  `json:"lastcheckin" bson:"lastcheckin"`
+}
+
+// StaleNodes - nodes of a network past the check in threshold, nodes that never checked in after joining are listed apart
+type StaleNodes struct {
+	Network        string      `json:"network" bson:"network"`
+	Threshold      int64       `json:"threshold" bson:"threshold"`
+	Stale          []StaleNode `json:"stale" bson:"stale"`
+	NeverCheckedIn []StaleNode `json:"nevercheckedin" bson:"nevercheckedin"`
+}
+
+// GatewayInfo - compact view of a node acting as an egress or ingress gateway
+type GatewayInfo struct {
+	NodeID               string   `json:"nodeid" bson:"nodeid"`
+	Name                 string   `json:"name" bson:"name"`
+	Network              string   `json:"network" bson:"network"`
+	Address              string   `json:"address" bson:"address"`
+	Address6             string   `json:"address6" bson:"address6"`
+	Endpoint             string   `json:"endpoint" bson:"endpoint"`
+	IsEgressGateway      string   `json:"isegressgateway" bson:"isegressgateway"`
+	EgressGatewayRanges  []string `json:"egressgatewayranges" bson:"egressgatewayranges"`
+	EgressGatewayTargets []string `json:"egressgatewaytargets" bson:"egressgatewaytargets"`
+	IsIngressGateway     string   `json:"isingressgateway" bson:"isingressgateway"`
+	IngressGatewayRange  string   `json:"ingressgatewayrange" bson:"ingressgatewayrange"`
+	ListenPort           int32    `json:"listenport" bson:"listenport"`
+}
+
+// GatewayDryRun - preview of a gateway change that was not persisted or pushed to nodes
+type GatewayDryRun struct {
+	DryRun         bool                `json:"dryrun" bson:"dryrun"`
+	Node           Node                `json:"node" bson:"node"`
+	PeerAllowedIPs map[string][]string `json:"peerallowedips" bson:"peerallowedips"`
+}
+
+// IdempotencyRecord - maps a client supplied idempotency key to the node it created
+type IdempotencyRecord struct {
+	Key     string `json:"key" bson:"key"`
+	Network string `json:"network" bson:"network"`
+	NodeID  string `json:"nodeid" bson:"nodeid"`
+	Created int64  `json:"created" bson:"created"`
+}
+
+const (
+	// SERVICE_ACCOUNT_READ_NODES - service account may list and get the nodes of its network
+	SERVICE_ACCOUNT_READ_NODES = "readnodes"
+	// SERVICE_ACCOUNT_CREATE_NODES - service account may create nodes on its network
+	SERVICE_ACCOUNT_CREATE_NODES = "createnodes"
+	// SERVICE_ACCOUNT_UPDATE_NODES - service account may update the nodes of its network
+	SERVICE_ACCOUNT_UPDATE_NODES = "updatenodes"
+	// SERVICE_ACCOUNT_DELETE_NODES - service account may delete the nodes of its network
+	SERVICE_ACCOUNT_DELETE_NODES = "deletenodes"
+)
+
+// ServiceAccount - a credential limited to a set of node operations on one network
+type ServiceAccount struct {
+	ID         string   `json:"id" bson:"id"`
+	Name       string   `json:"name" bson:"name"`
+	Network    string   `json:"network" bson:"network"`
+	Operations []string `json:"operations" bson:"operations"`
+	TokenHash  string   `json:"tokenhash,omitempty" bson:"tokenhash"`
+	Created    int64    `json:"created" bson:"created"`
+}
+
+// ServiceAccountToken - a newly created service account with its token, the token is only ever returned here
+type ServiceAccountToken struct {
+	ServiceAccount
+	Token string `json:"token"`
+}
+
+const (
+	// AUDIT_CREATE_NODE - a node joined a network
+	AUDIT_CREATE_NODE = "createnode"
+	// AUDIT_UPDATE_NODE - a node was updated
+	AUDIT_UPDATE_NODE = "updatenode"
+	// AUDIT_DELETE_NODE - a node was deleted
+	AUDIT_DELETE_NODE = "deletenode"
+	// AUDIT_CREATE_EGRESS - a node became an egress gateway
+	AUDIT_CREATE_EGRESS = "createegress"
+	// AUDIT_DELETE_EGRESS - a node stopped being an egress gateway
+	AUDIT_DELETE_EGRESS = "deleteegress"
+	// AUDIT_CREATE_INGRESS - a node became an ingress gateway
+	AUDIT_CREATE_INGRESS = "createingress"
+	// AUDIT_DELETE_INGRESS - a node stopped being an ingress gateway
+	AUDIT_DELETE_INGRESS = "deleteingress"
+	// AUDIT_CREATE_RELAY - a node became a relay
+	AUDIT_CREATE_RELAY = "createrelay"
+	// AUDIT_DELETE_RELAY - a node stopped being a relay
+	AUDIT_DELETE_RELAY = "deleterelay"
+	// AUDIT_APPROVE_NODE - a pending node was approved
+	AUDIT_APPROVE_NODE = "approvenode"
+	// AUDIT_DRAIN_NODE - a node started draining before its removal
+	AUDIT_DRAIN_NODE = "drainnode"
+	// AUDIT_REASSIGN_ADDRESS - a node was given new addresses
+	AUDIT_REASSIGN_ADDRESS = "reassignaddress"
+	// AUDIT_MOVE_NODE - a node was moved to another network
+	AUDIT_MOVE_NODE = "movenode"
+	// AUDIT_ROTATE_KEYS - a node was asked to replace its traffic keys
+	AUDIT_ROTATE_KEYS = "rotatekeys"
+	// AUDIT_RESTORE_NODE - a deleted node was restored
+	AUDIT_RESTORE_NODE = "restorenode"
+)
+
+// AuditEntry - a record of a mutating node operation, entries are never changed once written
+type AuditEntry struct {
+	ID        string        `json:"id" bson:"id"`
+	User      string        `json:"user" bson:"user"`
+	Network   string        `json:"network" bson:"network"`
+	NodeID    string        `json:"nodeid" bson:"nodeid"`
+	Action    string        `json:"action" bson:"action"`
+	Timestamp int64         `json:"timestamp" bson:"timestamp"`
+	Changes   []AuditChange `json:"changes" bson:"changes"`
+}
+
+// AuditChange - a node field changed by an audited operation
+type AuditChange struct {
+	Field string      `json:"field" bson:"field"`
+	Old   interface{} `json:"old,omitempty" bson:"old"`
+	New   interface{} `json:"new,omitempty" bson:"new"`
+}
+
+// MaintenanceMode - server wide switch pausing node changes, reads stay available while it is on
+type MaintenanceMode struct {
+	Enabled bool   `json:"enabled" bson:"enabled"`
+	Reason  string `json:"reason" bson:"reason"`
+	// RetryAfter - seconds rejected clients are told to wait before trying again
+	RetryAfter int   `json:"retryafter" bson:"retryafter"`
+	Started    int64 `json:"started" bson:"started"`
+}
+
+// PresharedKeySecret - the secret the preshared key of every peer pair on a network is derived from
+type PresharedKeySecret struct {
+	Network string `json:"network" bson:"network"`
+	Secret  string `json:"secret" bson:"secret"`
+	Rotated int64  `json:"rotated" bson:"rotated"`
+}
+
+// IPReassignRequest - addresses an admin wants a node moved to
+type IPReassignRequest struct {
+	Address  string `json:"address" bson:"address"`
+	Address6 string `json:"address6" bson:"address6"`
+}
+
+// NodeMoveRequest - network an admin wants a node moved to
+type NodeMoveRequest struct {
+	Network string `json:"network" bson:"network"`
+}
+
+// NodeApprovalRequest - pending nodes an admin wants to approve in one call
+type NodeApprovalRequest struct {
+	NodeIDs []string `json:"nodeids" bson:"nodeids"`
+}
+
+// NodeApprovalResult - outcome of approving a single node of a NodeApprovalRequest
+type NodeApprovalResult struct {
+	NodeID string `json:"nodeid" bson:"nodeid"`
+	Status string `json:"status" bson:"status"`
+	Error  string `json:"error,omitempty" bson:"error,omitempty"`
+}
+
+const (
+	// ACCESS_KEY_NOT_FOUND - the network has no access key with the given value
+	ACCESS_KEY_NOT_FOUND = "NOT_FOUND"
+	// ACCESS_KEY_EXPIRED - the access key's expiration has passed
+	ACCESS_KEY_EXPIRED = "EXPIRED"
+	// ACCESS_KEY_USED_UP - the access key has no uses left
+	ACCESS_KEY_USED_UP = "USED_UP"
+)
+
+// AccessKeyValidation - whether a node joining with an access key would be accepted, and why not when it would not
+type AccessKeyValidation struct {
+	Network string `json:"network" bson:"network"`
+	Valid   bool   `json:"valid" bson:"valid"`
+	Reason  string `json:"reason,omitempty" bson:"reason,omitempty"`
+}
+
+// NodeUpdateStatus - outcome of the latest update pushed to a node in the background, times are unix seconds
+type NodeUpdateStatus struct {
+	NodeID        string `json:"nodeid" bson:"nodeid"`
+	Network       string `json:"network" bson:"network"`
+	Succeeded     bool   `json:"succeeded" bson:"succeeded"`
+	Error         string `json:"error,omitempty" bson:"error,omitempty"`
+	Attempted     int64  `json:"attempted" bson:"attempted"`
+	LastSucceeded int64  `json:"lastsucceeded,omitempty" bson:"lastsucceeded,omitempty"`
+	Failures      int    `json:"failures" bson:"failures"`
+}
+
+// kinds of update an acknowledgement can be requested for
+const (
+	// UPDATE_ACK_PEERS - a peer update pushed to every node of a network
+	UPDATE_ACK_PEERS = "peers"
+	// UPDATE_ACK_NODE - a node update pushed to a single node
+	UPDATE_ACK_NODE = "node"
+)
+
+// UpdateAck - which nodes confirmed applying an update they were asked to acknowledge, Confirmations
+// holds the unix time each confirming node replied and Pending the nodes yet to reply
+type UpdateAck struct {
+	ID            string           `json:"id" bson:"id"`
+	Network       string           `json:"network" bson:"network"`
+	Kind          string           `json:"kind" bson:"kind"`
+	Requested     int64            `json:"requested" bson:"requested"`
+	Expected      int              `json:"expected" bson:"expected"`
+	Confirmed     int              `json:"confirmed" bson:"confirmed"`
+	Confirmations map[string]int64 `json:"confirmations" bson:"confirmations"`
+	Pending       []string         `json:"pending" bson:"pending"`
+}
+
+// PeerResync - a queued resync of a network, requests arriving before it is published join it and get the same id
+type PeerResync struct {
+	Network  string `json:"network" bson:"network"`
+	ResyncID string `json:"resyncid" bson:"resyncid"`
+}
+
+// SignupPolicy - how a network treats a node joining with the presented credentials, nodes that
+// are allowed but require approval join pending with the given reason
+type SignupPolicy struct {
+	Network           string `json:"network" bson:"network"`
+	AllowManualSignUp string `json:"allowmanualsignup" bson:"allowmanualsignup"`
+	Allowed           bool   `json:"allowed" bson:"allowed"`
+	RequiresApproval  bool   `json:"requiresapproval" bson:"requiresapproval"`
+	PendingReason     string `json:"pendingreason,omitempty" bson:"pendingreason,omitempty"`
+}
+
+// Metrics - the latest connectivity measurements a node reported of its peers, keyed by peer node id
+type Metrics struct {
+	Network      string            `json:"network" bson:"network"`
+	NodeID       string            `json:"nodeid" bson:"nodeid"`
+	Connectivity map[string]Metric `json:"connectivity" bson:"connectivity"`
+	Updated      int64             `json:"updated" bson:"updated"`
+}
+
+// Metric - one sample from a node to a peer, latency in milliseconds, throughput in bytes per second,
+// packet loss in percent and collected as unix seconds
+type Metric struct {
+	Latency    int64   `json:"latency" bson:"latency"`
+	Throughput int64   `json:"throughput" bson:"throughput"`
+	PacketLoss float64 `json:"packetloss" bson:"packetloss"`
+	Connected  bool    `json:"connected" bson:"connected"`
+	Collected  int64   `json:"collected" bson:"collected"`
 }
 
 // RelayRequest - relay request struct
@@ -193,16 +594,37 @@ type NodeGet struct {
 	Node         Node                 `json:"node" bson:"node" yaml:"node"`
 	Peers        []wgtypes.PeerConfig `json:"peers" bson:"peers" yaml:"peers"`
 	ServerConfig ServerConfig         `json:"serverconfig" bson:"serverconfig" yaml:"serverconfig"`
+	Connected    bool                 `json:"connected" bson:"connected" yaml:"connected"`
 }
 
 // ServerConfig - struct for dealing with the server information for a netclient
 type ServerConfig struct {
-	CoreDNSAddr string `yaml:"corednsaddr"`
-	API         string `yaml:"api"`
-	APIPort     string `yaml:"apiport"`
-	ClientMode  string `yaml:"clientmode"`
-	DNSMode     string `yaml:"dnsmode"`
-	Version     string `yaml:"version"`
-	MQPort      string `yaml:"mqport"`
-	Server      string `yaml:"server"`
+	CoreDNSAddr  string          `yaml:"corednsaddr"`
+	API          string          `yaml:"api"`
+	APIPort      string          `yaml:"apiport"`
+	ClientMode   string          `yaml:"clientmode"`
+	DNSMode      string          `yaml:"dnsmode"`
+	Version      string          `yaml:"version"`
+	MQPort       string          `yaml:"mqport"`
+	Server       string          `yaml:"server"`
+	Capabilities map[string]bool `yaml:"capabilities"`
 }
+
+// server capabilities, nodes check these before relying on a feature so they can fall back on servers
+// without it, a server missing from the map or answering without one has none of them
+const (
+	// CAPABILITY_PRESHARED_KEYS - peer updates carry per peer pair preshared keys on networks with them on
+	CAPABILITY_PRESHARED_KEYS = "presharedkeys"
+	// CAPABILITY_CHAINED_RELAYS - relays may themselves be relayed
+	CAPABILITY_CHAINED_RELAYS = "chainedrelays"
+	// CAPABILITY_NODE_TOKEN_CHALLENGE - nodes may get a token by sealing a challenge with their wireguard key
+	CAPABILITY_NODE_TOKEN_CHALLENGE = "nodetokenchallenge"
+	// CAPABILITY_ADDRESS_RANGE - joining nodes may ask for an address from a sub range of the network
+	CAPABILITY_ADDRESS_RANGE = "addressrange"
+	// CAPABILITY_MERGE_PATCH - nodes may be updated partially with a json merge patch
+	CAPABILITY_MERGE_PATCH = "mergepatch"
+	// CAPABILITY_NODE_ETAG - node gets answer If-None-Match with 304 when nothing changed
+	CAPABILITY_NODE_ETAG = "nodeetag"
+	// CAPABILITY_SIGNUP_POLICY - nodes may ask whether joining will leave them pending before they join
+	CAPABILITY_SIGNUP_POLICY = "signuppolicy"
+)
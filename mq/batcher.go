@@ -0,0 +1,74 @@
+package mq
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gravitl/netmaker/logger"
+	"github.com/gravitl/netmaker/logic"
+	"github.com/gravitl/netmaker/models"
+	"github.com/gravitl/netmaker/servercfg"
+)
+
+var (
+	peerUpdateMutex    sync.Mutex
+	pendingPeerUpdates = make(map[string]bool)
+	// pendingResyncs - the resync id a network's next batched peer update is published with
+	pendingResyncs = make(map[string]string)
+)
+
+func init() {
+	logic.PeerUpdateQueue = QueuePeerUpdate
+	logic.NodeReaped = publishNodeDelete
+	logic.NodeDeleted = publishNodePause
+}
+
+// QueuePeerUpdate - schedules a peer update for every node of a network,
+// updates queued for the same network within the batch window are published in one pass
+func QueuePeerUpdate(network string) {
+	if !servercfg.IsMessageQueueBackend() {
+		return
+	}
+	peerUpdateMutex.Lock()
+	defer peerUpdateMutex.Unlock()
+	schedulePeerUpdate(network)
+}
+
+// QueuePeerResync - schedules a peer update every node of a network applies even if its peers are unchanged,
+// it rides on the batched publisher, so resyncs and updates queued within the batch window go out in one pass
+func QueuePeerResync(network string) (models.PeerResync, error) {
+	if !servercfg.IsMessageQueueBackend() {
+		return models.PeerResync{}, ErrMessageQueueOff
+	}
+	peerUpdateMutex.Lock()
+	defer peerUpdateMutex.Unlock()
+	resyncID, ok := pendingResyncs[network]
+	if !ok {
+		resyncID = uuid.NewString()
+		pendingResyncs[network] = resyncID
+	}
+	schedulePeerUpdate(network)
+	return models.PeerResync{Network: network, ResyncID: resyncID}, nil
+}
+
+// schedulePeerUpdate - publishes the network's peers once the batch window passes, unless a pass is already waiting,
+// the caller holds peerUpdateMutex
+func schedulePeerUpdate(network string) {
+	if pendingPeerUpdates[network] {
+		return
+	}
+	pendingPeerUpdates[network] = true
+	window := time.Duration(servercfg.GetPeerUpdateBatchWindow()) * time.Millisecond
+	time.AfterFunc(window, func() {
+		// clear before publishing so changes made during the publish queue another pass
+		peerUpdateMutex.Lock()
+		delete(pendingPeerUpdates, network)
+		resyncID := pendingResyncs[network]
+		delete(pendingResyncs, network)
+		peerUpdateMutex.Unlock()
+		if err := publishNetworkPeerUpdate(network, resyncID); err != nil {
+			logger.Log(1, "failed to publish batched peer update for network", network, err.Error())
+		}
+	})
+}
@@ -77,6 +77,18 @@ func UpdateNode(client mqtt.Client, msg mqtt.Message) {
 			logger.Log(1, "error unmarshaling payload ", err.Error())
 			return
 		}
+		// a node answering a traffic key rotation sends its new public key, still encrypted with the old one
+		if rotated, err := logic.CompleteTrafficKeyRotation(&currentNode, newNode.TrafficKeys.Mine); err != nil {
+			logger.Log(1, "error storing rotated traffic key for node", id, err.Error())
+			return
+		} else if rotated {
+			logger.Log(1, "rotated traffic keys of node", id, currentNode.Name)
+			newNode.Action = models.NODE_NOOP
+		}
+		// only admins set endpoint overrides, notes and static addresses, the node's own view of its endpoint never replaces one
+		newNode.EndpointOverride = currentNode.EndpointOverride
+		newNode.Notes = currentNode.Notes
+		newNode.IsStaticAddress = currentNode.IsStaticAddress
 		if err := logic.UpdateNode(&currentNode, &newNode); err != nil {
 			logger.Log(1, "error saving node", err.Error())
 			return
@@ -94,16 +106,30 @@ func ClientPeerUpdate(client mqtt.Client, msg mqtt.Message) {
 			logger.Log(1, "error getting node.ID sent on ", msg.Topic(), err.Error())
 			return
 		}
+		var deleted bool
 		currentNode, err := logic.GetNodeByID(id)
 		if err != nil {
-			logger.Log(1, "error getting node ", id, err.Error())
-			return
+			// a node acknowledging its delete instruction has already been moved to the deleted nodes
+			if currentNode, err = logic.GetDeletedNodeByID(id); err != nil {
+				logger.Log(1, "error getting node ", id, err.Error())
+				return
+			}
+			deleted = true
 		}
 		decrypted, decryptErr := decryptMsg(&currentNode, msg.Payload())
 		if decryptErr != nil {
 			logger.Log(1, "failed to decrypt message during client peer update for node ", id, decryptErr.Error())
 			return
 		}
+		if decrypted[0] == ncutils.DELETE_ACK {
+			if logic.AckNodeDelete(id) {
+				logger.Log(1, "node", id, currentNode.Name, "acknowledged its delete instruction")
+			}
+			return
+		}
+		if deleted {
+			return
+		}
 		switch decrypted[0] {
 		case ncutils.ACK:
 			currentServerNode, err := logic.GetNetworkServerLocal(currentNode.Network)
@@ -122,6 +148,37 @@ func ClientPeerUpdate(client mqtt.Client, msg mqtt.Message) {
 	}()
 }
 
+// AckUpdate - message handler recording that a node applied an update the server asked it to acknowledge
+func AckUpdate(client mqtt.Client, msg mqtt.Message) {
+	go func() {
+		id, err := getID(msg.Topic())
+		if err != nil {
+			logger.Log(1, "error getting node.ID sent on ", msg.Topic(), err.Error())
+			return
+		}
+		currentNode, err := logic.GetNodeByID(id)
+		if err != nil {
+			logger.Log(1, "error getting node ", id, err.Error())
+			return
+		}
+		decrypted, decryptErr := decryptMsg(&currentNode, msg.Payload())
+		if decryptErr != nil {
+			logger.Log(1, "failed to decrypt update acknowledgement for node ", id, decryptErr.Error())
+			return
+		}
+		var reply models.UpdateAckReply
+		if err := json.Unmarshal(decrypted, &reply); err != nil {
+			logger.Log(1, "error unmarshaling update acknowledgement ", err.Error())
+			return
+		}
+		if err := logic.ConfirmUpdateAck(reply.AckID, id); err != nil {
+			logger.Log(1, "failed to record update acknowledgement of node", id, err.Error())
+			return
+		}
+		logger.Log(2, "node", id, currentNode.Name, "acknowledged update", reply.AckID)
+	}()
+}
+
 func updateNodePeers(currentNode *models.Node) {
 	currentServerNode, err := logic.GetNetworkServerLocal(currentNode.Network)
 	if err != nil {
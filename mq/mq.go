@@ -2,6 +2,7 @@ package mq
 
 import (
 	"context"
+	"errors"
 	"log"
 	"time"
 
@@ -19,6 +20,9 @@ const MQ_DISCONNECT = 250
 // MQ_TIMEOUT - timeout for MQ
 const MQ_TIMEOUT = 30
 
+// MQ_HEALTH_TIMEOUT - timeout in seconds for a broker health check
+const MQ_HEALTH_TIMEOUT = 5
+
 var peer_force_send = 0
 
 // SetupMQTT creates a connection to broker and return client
@@ -46,6 +50,10 @@ func SetupMQTT(publish bool) mqtt.Client {
 				client.Disconnect(240)
 				logger.Log(0, "node client subscription failed")
 			}
+			if token := client.Subscribe("ack/#", 0, mqtt.MessageHandler(AckUpdate)); token.WaitTimeout(MQ_TIMEOUT*time.Second) && token.Error() != nil {
+				client.Disconnect(240)
+				logger.Log(0, "update acknowledgement subscription failed")
+			}
 
 			opts.SetOrderMatters(true)
 			opts.SetResumeSubs(true)
@@ -71,6 +79,24 @@ func SetupMQTT(publish bool) mqtt.Client {
 	return client
 }
 
+// CheckConnection - connects to the broker once without retrying, used to report broker health
+func CheckConnection() error {
+	opts := mqtt.NewClientOptions()
+	opts.AddBroker(servercfg.GetMessageQueueEndpoint())
+	opts.ClientID = ncutils.MakeRandomString(23)
+	opts.SetConnectTimeout(MQ_HEALTH_TIMEOUT * time.Second)
+	client := mqtt.NewClient(opts)
+	token := client.Connect()
+	if !token.WaitTimeout(MQ_HEALTH_TIMEOUT * time.Second) {
+		return errors.New("timed out connecting to broker")
+	}
+	if token.Error() != nil {
+		return token.Error()
+	}
+	client.Disconnect(MQ_DISCONNECT)
+	return nil
+}
+
 // Keepalive -- periodically pings all nodes to let them know server is still alive and doing well
 func Keepalive(ctx context.Context) {
 	for {
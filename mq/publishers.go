@@ -2,7 +2,10 @@ package mq
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
+	"time"
 
 	"github.com/gravitl/netmaker/logger"
 	"github.com/gravitl/netmaker/logic"
@@ -13,15 +16,55 @@ import (
 
 // PublishPeerUpdate --- deterines and publishes a peer update to all the peers of a node
 func PublishPeerUpdate(newNode *models.Node) error {
+	return publishNetworkPeerUpdate(newNode.Network, "")
+}
+
+// publishNetworkPeerUpdate - publishes a peer update to every node of a network over a single broker connection,
+// a non empty resync id makes the nodes apply it even when their peers did not change
+func publishNetworkPeerUpdate(network, resyncID string) error {
 	if !servercfg.IsMessageQueueBackend() {
 		return nil
 	}
-	networkNodes, err := logic.GetNetworkNodes(newNode.Network)
+	networkNodes, err := logic.GetNetworkNodes(network)
 	if err != nil {
 		logger.Log(1, "err getting Network Nodes", err.Error())
 		return err
 	}
+	publishPeerUpdates(networkNodes, "", resyncID)
+	return nil
+}
+
+// ErrMessageQueueOff - returned when asking for an acknowledged update or a resync while the message queue backend is off
+var ErrMessageQueueOff = errors.New("acknowledged updates need the message queue backend")
+
+// PublishPeerUpdateWithAck - publishes a peer update to every node of a network asking each to confirm
+// it applied the peers, the returned ack tracks which nodes have; server nodes apply updates themselves
+// and are not asked
+func PublishPeerUpdateWithAck(network string) (models.UpdateAck, error) {
+	if !servercfg.IsMessageQueueBackend() {
+		return models.UpdateAck{}, ErrMessageQueueOff
+	}
+	networkNodes, err := logic.GetNetworkNodes(network)
+	if err != nil {
+		return models.UpdateAck{}, err
+	}
+	var clients []models.Node
 	for _, node := range networkNodes {
+		if node.IsServer != "yes" {
+			clients = append(clients, node)
+		}
+	}
+	ack := logic.RequestUpdateAck(network, models.UPDATE_ACK_PEERS, clients)
+	publishPeerUpdates(clients, ack.ID, "")
+	return ack, nil
+}
+
+// publishPeerUpdates - publishes a peer update to each of the nodes over a single broker connection,
+// a non empty ack id asks the nodes to confirm applying it
+func publishPeerUpdates(nodes []models.Node, ackID, resyncID string) {
+	client := SetupMQTT(true)
+	defer client.Disconnect(MQ_DISCONNECT)
+	for _, node := range nodes {
 
 		if node.IsServer == "yes" {
 			continue
@@ -31,18 +74,19 @@ func PublishPeerUpdate(newNode *models.Node) error {
 			logger.Log(1, "error getting peer update for node", node.ID, err.Error())
 			continue
 		}
+		peerUpdate.AckID = ackID
+		peerUpdate.ResyncID = resyncID
 		data, err := json.Marshal(&peerUpdate)
 		if err != nil {
 			logger.Log(2, "error marshaling peer update for node", node.ID, err.Error())
 			continue
 		}
-		if err = publish(&node, fmt.Sprintf("peers/%s/%s", node.Network, node.ID), data); err != nil {
+		if err = publishWithClient(client, &node, fmt.Sprintf("peers/%s/%s", node.Network, node.ID), data); err != nil {
 			logger.Log(1, "failed to publish peer update for node", node.ID)
 		} else {
 			logger.Log(1, "sent peer update for node", node.Name, "on network:", node.Network)
 		}
 	}
-	return nil
 }
 
 // PublishPeerUpdate --- publishes a peer update to all the peers of a node
@@ -92,6 +136,73 @@ func NodeUpdate(node *models.Node) error {
 	return nil
 }
 
+// NodeUpdateWithAck - publishes a node update asking the node to confirm it applied it, the returned ack
+// tracks whether it has
+func NodeUpdateWithAck(node *models.Node) (models.UpdateAck, error) {
+	if !servercfg.IsMessageQueueBackend() {
+		return models.UpdateAck{}, ErrMessageQueueOff
+	}
+	ack := logic.RequestUpdateAck(node.Network, models.UPDATE_ACK_NODE, []models.Node{*node})
+	update := *node
+	update.UpdateAckID = ack.ID
+	return ack, NodeUpdate(&update)
+}
+
+// NodeMoved - tells a node moved to another network about the move on the topic of its old network,
+// which is the one it is still subscribed to
+func NodeMoved(node *models.Node, oldNetwork string) error {
+	if !servercfg.IsMessageQueueBackend() || node.IsServer == "yes" {
+		return nil
+	}
+	data, err := json.Marshal(node)
+	if err != nil {
+		return err
+	}
+	if err = publish(node, fmt.Sprintf("update/%s/%s", oldNetwork, node.ID), data); err != nil {
+		logger.Log(2, "error publishing move to node ", node.ID, err.Error())
+		return err
+	}
+	return nil
+}
+
+// NODE_ACTION_ATTEMPTS - times an instruction to a deleted node is published before it is given up on
+const NODE_ACTION_ATTEMPTS = 3
+
+// NODE_ACTION_RETRY_DELAY - seconds between two attempts to publish an instruction to a deleted node
+const NODE_ACTION_RETRY_DELAY = 5
+
+// publishNodeDelete - tells a deleted node to leave its network, returns whether the instruction was sent
+func publishNodeDelete(node *models.Node) bool {
+	return publishNodeAction(node, models.NODE_DELETE)
+}
+
+// publishNodePause - tells a node that was just deleted to take its interface down until it is restored or reaped,
+// returns whether the instruction was sent
+func publishNodePause(node *models.Node) bool {
+	return publishNodeAction(node, models.NODE_PAUSE)
+}
+
+// publishNodeAction - publishes an action to a deleted node, retrying NODE_ACTION_ATTEMPTS times since the node
+// is not sent another update once it is gone
+func publishNodeAction(node *models.Node, action string) bool {
+	if !servercfg.IsMessageQueueBackend() || node.IsServer == "yes" {
+		return false
+	}
+	node.Action = action
+	for attempt := 1; attempt <= NODE_ACTION_ATTEMPTS; attempt++ {
+		err := NodeUpdate(node)
+		if err == nil {
+			return true
+		}
+		logger.Log(1, "failed to send", action, "to deleted node", node.ID, "attempt", strconv.Itoa(attempt), err.Error())
+		if attempt < NODE_ACTION_ATTEMPTS {
+			time.Sleep(time.Second * NODE_ACTION_RETRY_DELAY)
+		}
+	}
+	logger.Log(0, "gave up sending", action, "to deleted node", node.Name, node.ID, ", it may be left orphaned with its interface up")
+	return false
+}
+
 // sendPeers - retrieve networks, send peer ports to all peers
 func sendPeers() {
 
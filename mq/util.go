@@ -6,6 +6,7 @@ import (
 	"strings"
 	"time"
 
+	mqtt "github.com/eclipse/paho.mqtt.golang"
 	"github.com/gravitl/netmaker/logic"
 	"github.com/gravitl/netmaker/models"
 	"github.com/gravitl/netmaker/netclient/ncutils"
@@ -63,6 +64,11 @@ func encryptMsg(node *models.Node, msg []byte) ([]byte, error) {
 func publish(node *models.Node, dest string, msg []byte) error {
 	client := SetupMQTT(true)
 	defer client.Disconnect(250)
+	return publishWithClient(client, node, dest, msg)
+}
+
+// publishWithClient - encrypts and publishes a message for a node on an existing broker connection
+func publishWithClient(client mqtt.Client, node *models.Node, dest string, msg []byte) error {
 	encrypted, encryptErr := encryptMsg(node, msg)
 	if encryptErr != nil {
 		return encryptErr
@@ -99,6 +99,12 @@ func GetFlags(hostname string) []cli.Flag {
 			Value:   "",
 			Usage:   "WireGuard address for machine within Netmaker network.",
 		},
+		&cli.StringFlag{
+			Name:    "addressrange",
+			EnvVars: []string{"NETCLIENT_ADDRESSRANGE"},
+			Value:   "",
+			Usage:   "Sub range of the Netmaker network (CIDR) to be given an address from on join.",
+		},
 		&cli.StringFlag{
 			Name:    "interface",
 			Aliases: []string{"i"},
@@ -2,6 +2,7 @@ package functions
 
 import (
 	"bytes"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -20,6 +21,7 @@ import (
 	"github.com/gravitl/netmaker/netclient/ncutils"
 	"github.com/gravitl/netmaker/netclient/wireguard"
 	"golang.zx2c4.com/wireguard/wgctrl"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 )
 
 // LINUX_APP_DATA_PATH - linux path
@@ -348,7 +350,15 @@ func Authenticate(cfg *config.ClientConfig) (string, error) {
 
 	pass, err := os.ReadFile(ncutils.GetNetclientPathSpecific() + "secret-" + cfg.Network)
 	if err != nil {
-		return "", fmt.Errorf("could not read secrets file %w", err)
+		// the wireguard key still proves who we are when the password is gone, if the server can check it
+		if !cfg.Server.Capabilities[models.CAPABILITY_NODE_TOKEN_CHALLENGE] {
+			return "", fmt.Errorf("could not read secrets file %w", err)
+		}
+		token, keyErr := AuthenticateWithKey(cfg)
+		if keyErr != nil {
+			return "", fmt.Errorf("could not read secrets file %w, key authentication failed %s", err, keyErr.Error())
+		}
+		return token, nil
 	}
 	data := models.AuthParams{
 		MacAddress: cfg.Node.MacAddress,
@@ -374,6 +384,61 @@ func Authenticate(cfg *config.ClientConfig) (string, error) {
 	return token.(string), nil
 }
 
+// AuthenticateWithKey - gets a token without the password by sealing a server challenge with the node's wireguard private key
+func AuthenticateWithKey(cfg *config.ClientConfig) (string, error) {
+	privateKey, err := wireguard.RetrievePrivKey(cfg.Network)
+	if err != nil {
+		return "", fmt.Errorf("could not read wireguard key %w", err)
+	}
+	key, err := wgtypes.ParseKey(privateKey)
+	if err != nil {
+		return "", err
+	}
+	url := "https://" + cfg.Server.API + "/api/nodes/" + cfg.Network + "/" + cfg.Node.ID
+	response, err := API("", http.MethodPost, url+"/tokenchallenge", "")
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		bodybytes, _ := io.ReadAll(response.Body)
+		return "", fmt.Errorf("failed to get token challenge %s %s", response.Status, string(bodybytes))
+	}
+	var challenge models.NodeTokenChallenge
+	if err := json.NewDecoder(response.Body).Decode(&challenge); err != nil {
+		return "", fmt.Errorf("error decoding token challenge %w", err)
+	}
+	serverKey, err := ncutils.ConvertBytesToKey(challenge.ServerKey)
+	if err != nil {
+		return "", err
+	}
+	privateKeyBytes := [32]byte(key)
+	sealed, err := ncutils.BoxEncrypt([]byte(challenge.Nonce), serverKey, &privateKeyBytes)
+	if err != nil {
+		return "", err
+	}
+	data := models.NodeTokenRequest{
+		Nonce:     challenge.Nonce,
+		Signature: base64.StdEncoding.EncodeToString(sealed),
+	}
+	tokenResponse, err := API(data, http.MethodPost, url+"/token", "")
+	if err != nil {
+		return "", err
+	}
+	defer tokenResponse.Body.Close()
+	if tokenResponse.StatusCode != http.StatusOK {
+		bodybytes, _ := io.ReadAll(tokenResponse.Body)
+		return "", fmt.Errorf("failed to authenticate with key %s %s", tokenResponse.Status, string(bodybytes))
+	}
+	resp := models.SuccessResponse{}
+	if err := json.NewDecoder(tokenResponse.Body).Decode(&resp); err != nil {
+		return "", fmt.Errorf("error decoding respone %w", err)
+	}
+	tokenData := resp.Response.(map[string]interface{})
+	token := tokenData["AuthToken"]
+	return token.(string), nil
+}
+
 // RegisterWithServer calls the register endpoint with privatekey and commonname - api returns ca and client certificate
 func SetServerInfo(cfg *config.ClientConfig) error {
 	cfg, err := config.ReadConfig(cfg.Network)
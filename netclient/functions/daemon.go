@@ -6,6 +6,7 @@ import (
 	"crypto/rand"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
@@ -18,6 +19,7 @@ import (
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 	"github.com/gravitl/netmaker/logger"
+	"github.com/gravitl/netmaker/models"
 	"github.com/gravitl/netmaker/mq"
 	"github.com/gravitl/netmaker/netclient/auth"
 	"github.com/gravitl/netmaker/netclient/config"
@@ -26,6 +28,7 @@ import (
 	"github.com/gravitl/netmaker/netclient/ncutils"
 	"github.com/gravitl/netmaker/netclient/wireguard"
 	ssl "github.com/gravitl/netmaker/tls"
+	"golang.org/x/crypto/nacl/box"
 	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 )
 
@@ -117,6 +120,28 @@ func UpdateKeys(nodeCfg *config.ClientConfig, client mqtt.Client) error {
 	return nil
 }
 
+// RotateTrafficKeys -- generates new traffic keys and sends the new public key to the server,
+// the update is still encrypted with the old key, which the server stops accepting once it stores the new one
+func RotateTrafficKeys(nodeCfg *config.ClientConfig) error {
+	logger.Log(0, "received message to rotate traffic keys for network ", nodeCfg.Network)
+	trafficPubKey, trafficPrivKey, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	trafficPubKeyBytes, err := ncutils.ConvertKeyToBytes(trafficPubKey)
+	if err != nil {
+		return err
+	}
+	oldPubKey := nodeCfg.Node.TrafficKeys.Mine
+	nodeCfg.Node.TrafficKeys.Mine = trafficPubKeyBytes
+	nodeCfg.Node.Action = models.NODE_NOOP
+	if err = PublishNodeUpdate(nodeCfg); err != nil {
+		nodeCfg.Node.TrafficKeys.Mine = oldPubKey
+		return err
+	}
+	return auth.StoreTrafficKey(trafficPrivKey, nodeCfg.Network)
+}
+
 // == Private ==
 
 // sets MQ client subscriptions for a specific node config
@@ -280,6 +305,15 @@ func publishSignal(nodeCfg *config.ClientConfig, signal byte) error {
 	return nil
 }
 
+// publishUpdateAck - confirms to the server that an update it asked to be acknowledged was applied
+func publishUpdateAck(nodeCfg *config.ClientConfig, ackID string) error {
+	data, err := json.Marshal(&models.UpdateAckReply{AckID: ackID})
+	if err != nil {
+		return err
+	}
+	return publish(nodeCfg, fmt.Sprintf("ack/%s", nodeCfg.Node.ID), data, 1)
+}
+
 func initialPull(network string) {
 	logger.Log(0, "pulling latest config for ", network)
 	var configPath = fmt.Sprintf("%snetconfig-%s", ncutils.GetNetclientPathSpecific(), network)
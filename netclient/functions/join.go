@@ -100,6 +100,16 @@ func JoinNetwork(cfg *config.ClientConfig, privateKey string) error {
 		}
 		privateKey = wgPrivatekey.String()
 		cfg.Node.PublicKey = wgPrivatekey.PublicKey().String()
+	} else {
+		// an existing wireguard keypair is kept as is, the public key always matches the private key
+		wgPrivatekey, err := wgtypes.ParseKey(privateKey)
+		if err != nil {
+			return fmt.Errorf("invalid private key: %w", err)
+		}
+		if cfg.Node.PublicKey != "" && cfg.Node.PublicKey != wgPrivatekey.PublicKey().String() {
+			return errors.New("public key does not belong to the private key")
+		}
+		cfg.Node.PublicKey = wgPrivatekey.PublicKey().String()
 	}
 	// Find and set node MacAddress
 	if cfg.Node.MacAddress == "" {
@@ -119,10 +129,15 @@ func JoinNetwork(cfg *config.ClientConfig, privateKey string) error {
 	cfg.Node.Name = formatName(cfg.Node)
 	cfg.Node.OS = runtime.GOOS
 	cfg.Node.Version = ncutils.Version
+	cfg.Node.PresharedKeySupport = "yes"
 	cfg.Node.AccessKey = cfg.AccessKey
 	//not sure why this is needed ... setnode defaults should take care of this on server
 	cfg.Node.IPForwarding = "yes"
 	logger.Log(0, "joining "+cfg.Network+" at "+cfg.Server.API)
+	// servers without the sign up policy endpoint answer with an error, the join goes ahead either way
+	if policy, err := getSignupPolicy(cfg); err == nil && policy.RequiresApproval {
+		logger.Log(0, "network", cfg.Network, "requires approval of this node, it will be PENDING until an admin approves it")
+	}
 	url := "https://" + cfg.Server.API + "/api/nodes/" + cfg.Network
 	response, err := API(cfg.Node, http.MethodPost, url, cfg.AccessKey)
 	if err != nil {
@@ -164,6 +179,9 @@ func JoinNetwork(cfg *config.ClientConfig, privateKey string) error {
 	}
 	if node.IsPending == "yes" {
 		logger.Log(0, "Node is marked as PENDING.")
+		if node.PendingReason == models.PENDING_REASON_INVALID_KEY_GRACE {
+			logger.Log(0, "The access key was not accepted, check it if approval was not expected.")
+		}
 		logger.Log(0, "Awaiting approval from Admin before configuring WireGuard.")
 		if cfg.Daemon != "off" {
 			return daemon.InstallDaemon(cfg)
@@ -226,3 +244,19 @@ func formatName(node models.Node) string {
 	}
 	return node.Name
 }
+
+// getSignupPolicy - asks the server whether joining with the configured access key leaves the node pending
+func getSignupPolicy(cfg *config.ClientConfig) (models.SignupPolicy, error) {
+	var policy models.SignupPolicy
+	url := "https://" + cfg.Server.API + "/api/nodes/" + cfg.Network + "/signup"
+	response, err := API("", http.MethodGet, url, cfg.AccessKey)
+	if err != nil {
+		return policy, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return policy, fmt.Errorf("failed to get sign up policy %s", response.Status)
+	}
+	err = json.NewDecoder(response.Body).Decode(&policy)
+	return policy, err
+}
@@ -52,8 +52,12 @@ func NodeUpdate(client mqtt.Client, msg mqtt.Message) {
 	}
 	insert(newNode.Network, lastNodeUpdate, string(data)) // store new message in cache
 
+	// the acknowledgement request is answered below, it is not part of the node's config
+	ackID := newNode.UpdateAckID
+	newNode.UpdateAckID = ""
 	// ensure that OS never changes
 	newNode.OS = runtime.GOOS
+	newNode.PresharedKeySupport = "yes"
 	// check if interface needs to delta
 	ifaceDelta := ncutils.IfaceDelta(&nodeCfg.Node, &newNode)
 	shouldDNSChange := nodeCfg.Node.DNSOn != newNode.DNSOn
@@ -64,6 +68,10 @@ func NodeUpdate(client mqtt.Client, msg mqtt.Message) {
 	switch newNode.Action {
 	case models.NODE_DELETE:
 		logger.Log(0, "received delete request for %s", nodeCfg.Node.Name)
+		// acknowledge before leaving, leaving removes the traffic keys the signal is encrypted with
+		if err := publishSignal(&nodeCfg, ncutils.DELETE_ACK); err != nil {
+			logger.Log(0, "failed to acknowledge delete request", err.Error())
+		}
 		unsubscribeNode(client, &nodeCfg)
 		if err = LeaveNetwork(nodeCfg.Node.Network, true); err != nil {
 			if !strings.Contains("rpc error", err.Error()) {
@@ -73,6 +81,17 @@ func NodeUpdate(client mqtt.Client, msg mqtt.Message) {
 		}
 		logger.Log(0, nodeCfg.Node.Name, " was removed")
 		return
+	case models.NODE_PAUSE:
+		// the node was deleted but may still be restored, so its config is kept and only the interface goes down
+		logger.Log(0, "node", nodeCfg.Node.Name, "was deleted, taking its interface down until it is restored")
+		if err := wireguard.RemoveConf(nodeCfg.Node.Interface, true); err != nil {
+			logger.Log(0, "failed to take interface down", err.Error())
+		}
+		nodeCfg.Node.Action = models.NODE_NOOP
+		if err := config.Write(&nodeCfg, nodeCfg.Network); err != nil {
+			logger.Log(0, "error updating node configuration: ", err.Error())
+		}
+		return
 	case models.NODE_UPDATE_KEY:
 		// == get the current key for node ==
 		oldPrivateKey, retErr := wireguard.RetrievePrivKey(nodeCfg.Network)
@@ -87,6 +106,10 @@ func NodeUpdate(client mqtt.Client, msg mqtt.Message) {
 			}
 		}
 		ifaceDelta = true
+	case models.NODE_ROTATE_TRAFFIC_KEYS:
+		if err := RotateTrafficKeys(&nodeCfg); err != nil {
+			logger.Log(0, "error rotating traffic keys, keeping the current keys ", err.Error())
+		}
 	case models.NODE_FORCE_UPDATE:
 		ifaceDelta = true
 	case models.NODE_NOOP:
@@ -157,6 +180,11 @@ func NodeUpdate(client mqtt.Client, msg mqtt.Message) {
 		//			logger.Log(0, "error applying dns" + err.Error())
 		//		}
 	}
+	if ackID != "" {
+		if err := publishUpdateAck(&nodeCfg, ackID); err != nil {
+			logger.Log(0, "failed to acknowledge node update", err.Error())
+		}
+	}
 	_ = UpdateLocalListenPort(&nodeCfg)
 }
 
@@ -194,7 +222,7 @@ func UpdatePeers(client mqtt.Client, msg mqtt.Message) {
 	}
 
 	file := ncutils.GetNetclientPathSpecific() + cfg.Node.Interface + ".conf"
-	err = wireguard.UpdateWgPeers(file, peerUpdate.Peers)
+	err = wireguard.UpdateWgPeers(file, peerUpdate.Peers, peerUpdate.PeerLabels)
 	if err != nil {
 		logger.Log(0, "error updating wireguard peers"+err.Error())
 		return
@@ -216,6 +244,11 @@ func UpdatePeers(client mqtt.Client, msg mqtt.Message) {
 		return
 	}
 	logger.Log(0, "received peer update for node "+cfg.Node.Name+" "+cfg.Node.Network)
+	if peerUpdate.AckID != "" {
+		if err := publishUpdateAck(&cfg, peerUpdate.AckID); err != nil {
+			logger.Log(0, "failed to acknowledge peer update", err.Error())
+		}
+	}
 	if cfg.Node.DNSOn == "yes" {
 		if err := setHostDNS(peerUpdate.DNS, cfg.Node.Interface, ncutils.IsWindows()); err != nil {
 			logger.Log(0, "error updating /etc/hosts "+err.Error())
@@ -85,6 +85,8 @@ func Checkin(ctx context.Context, wg *sync.WaitGroup) {
 
 // PublishNodeUpdates -- saves node and pushes changes to broker
 func PublishNodeUpdate(nodeCfg *config.ClientConfig) error {
+	// lets the server flag an egress interface that does not exist here
+	nodeCfg.Node.LocalInterfaces = ncutils.GetInterfaceNames()
 	if err := config.Write(nodeCfg, nodeCfg.Network); err != nil {
 		return err
 	}
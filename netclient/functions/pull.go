@@ -54,6 +54,7 @@ func Pull(network string, iface bool) (*models.Node, error) {
 	resNode := nodeGET.Node
 	// ensure that the OS never changes
 	resNode.OS = runtime.GOOS
+	resNode.PresharedKeySupport = "yes"
 	if nodeGET.Peers == nil {
 		nodeGET.Peers = []wgtypes.PeerConfig{}
 	}
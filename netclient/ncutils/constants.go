@@ -5,4 +5,6 @@ const (
 	ACK = 1
 	// DONE - done signal for MQ
 	DONE = 2
+	// DELETE_ACK - signals the server that a delete instruction was received
+	DELETE_ACK = 3
 )
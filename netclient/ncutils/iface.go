@@ -90,3 +90,16 @@ func IfaceExists(ifacename string) bool {
 	}
 	return false
 }
+
+// GetInterfaceNames - names of the local network interfaces, nil if they cannot be listed
+func GetInterfaceNames() []string {
+	localnets, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, localnet := range localnets {
+		names = append(names, localnet.Name)
+	}
+	return names
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"net"
+	"os"
 	"runtime"
 	"strconv"
 	"strings"
@@ -71,16 +72,23 @@ func SetPeers(iface string, node *models.Node, peers []wgtypes.PeerConfig) error
 		if keepAliveString == "0" {
 			keepAliveString = "15"
 		}
+		presharedKey, err := presharedKeyArg(&peer)
+		if err != nil {
+			log.Println("error writing preshared key of peer", peer.PublicKey.String(), err.Error())
+		}
 		if node.IsHub == "yes" || node.IsServer == "yes" || peer.Endpoint == nil {
 			_, err = ncutils.RunCmd("wg set "+iface+" peer "+peer.PublicKey.String()+
+				presharedKey+
 				" persistent-keepalive "+keepAliveString+
 				" allowed-ips "+allowedips, true)
 		} else {
 			_, err = ncutils.RunCmd("wg set "+iface+" peer "+peer.PublicKey.String()+
+				presharedKey+
 				" endpoint "+udpendpoint+
 				" persistent-keepalive "+keepAliveString+
 				" allowed-ips "+allowedips, true)
 		}
+		removePresharedKeyFile(presharedKey)
 		if err != nil {
 			log.Println("error setting peer", peer.PublicKey.String())
 		}
@@ -125,6 +133,34 @@ func SetPeers(iface string, node *models.Node, peers []wgtypes.PeerConfig) error
 	return nil
 }
 
+// presharedKeyArg - the wg set argument for a peer's preshared key, wg reads the key from a file
+// so it is written to a temporary one, peers without a key have any previous key cleared
+func presharedKeyArg(peer *wgtypes.PeerConfig) (string, error) {
+	if peer.PresharedKey == nil {
+		if ncutils.IsWindows() {
+			return "", nil
+		}
+		return " preshared-key /dev/null", nil
+	}
+	file, err := os.CreateTemp("", "nm-psk-")
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	if _, err = file.WriteString(peer.PresharedKey.String()); err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+	return " preshared-key " + file.Name(), nil
+}
+
+// removePresharedKeyFile - removes the temporary file written by presharedKeyArg
+func removePresharedKeyFile(arg string) {
+	if path := strings.TrimPrefix(arg, " preshared-key "); path != arg && path != "/dev/null" {
+		os.Remove(path)
+	}
+}
+
 // Initializes a WireGuard interface
 func InitWireguard(node *models.Node, privkey string, peers []wgtypes.PeerConfig, syncconf bool) error {
 
@@ -398,8 +434,8 @@ func WriteWgConfig(node *models.Node, privateKey string, peers []wgtypes.PeerCon
 	return nil
 }
 
-// UpdateWgPeers - updates the peers of a network
-func UpdateWgPeers(file string, peers []wgtypes.PeerConfig) error {
+// UpdateWgPeers - updates the peers of a network, peers with a label get it as a comment
+func UpdateWgPeers(file string, peers []wgtypes.PeerConfig, labels map[string]string) error {
 	options := ini.LoadOptions{
 		AllowNonUniqueSections: true,
 		AllowShadows:           true,
@@ -411,6 +447,9 @@ func UpdateWgPeers(file string, peers []wgtypes.PeerConfig) error {
 	//delete the peers sections as they are going to be replaced
 	wireguard.DeleteSection(section_peers)
 	for i, peer := range peers {
+		if label, ok := labels[peer.PublicKey.String()]; ok {
+			wireguard.SectionWithIndex(section_peers, i).Comment = "# " + label
+		}
 		wireguard.SectionWithIndex(section_peers, i).Key("PublicKey").SetValue(peer.PublicKey.String())
 		if peer.PresharedKey != nil {
 			wireguard.SectionWithIndex(section_peers, i).Key("PreSharedKey").SetValue(peer.PresharedKey.String())
@@ -11,6 +11,7 @@ import (
 
 	"github.com/gravitl/netmaker/config"
 	"github.com/gravitl/netmaker/models"
+	"golang.org/x/crypto/bcrypt"
 )
 
 var (
@@ -38,6 +39,16 @@ func GetServerConfig() config.ServerConfig {
 	cfg.MasterKey = "(hidden)"
 	cfg.DNSKey = "(hidden)"
 	cfg.AllowedOrigin = GetAllowedOrigin()
+	cfg.AllowedMethods = strings.Join(GetAllowedMethods(), ",")
+	cfg.AllowedHeaders = strings.Join(GetAllowedHeaders(), ",")
+	cfg.AllowCredentials = "off"
+	if IsCORSAllowCredentials() {
+		cfg.AllowCredentials = "on"
+	}
+	cfg.StructuredLogging = "off"
+	if IsStructuredLogging() {
+		cfg.StructuredLogging = "on"
+	}
 	cfg.RestBackend = "off"
 	cfg.NodeID = GetNodeID()
 	if IsRestBackend() {
@@ -84,6 +95,18 @@ func GetServerConfig() config.ServerConfig {
 	cfg.PortForwardServices = services
 	cfg.Server = GetServer()
 	cfg.Verbosity = GetVerbosity()
+	cfg.NodeCheckInTimeout = GetNodeCheckInTimeout()
+	cfg.AuthRateLimitAttempts = GetAuthRateLimitAttempts()
+	cfg.AuthRateLimitWindow = GetAuthRateLimitWindow()
+	cfg.IdempotencyKeyTTL = GetIdempotencyKeyTTL()
+	cfg.NodeDrainGracePeriod = GetNodeDrainGracePeriod()
+	cfg.PeerUpdateBatchWindow = GetPeerUpdateBatchWindow()
+	cfg.NodeRecoveryWindow = GetNodeRecoveryWindow()
+	cfg.UserTokenCacheTTL = GetUserTokenCacheTTL()
+	cfg.EgressTargetRefresh = GetEgressTargetRefresh()
+	cfg.NodePasswordCost = GetNodePasswordCost()
+	cfg.UtilizationThreshold = GetUtilizationThreshold()
+	cfg.UtilizationWebhook = GetUtilizationWebhook()
 
 	return cfg
 }
@@ -101,10 +124,24 @@ func GetServerInfo() models.ServerConfig {
 	}
 	cfg.Version = GetVersion()
 	cfg.Server = GetServer()
+	cfg.Capabilities = GetCapabilities()
 
 	return cfg
 }
 
+// GetCapabilities - the features this server supports, add each new feature nodes may rely on here as it lands
+func GetCapabilities() map[string]bool {
+	return map[string]bool{
+		models.CAPABILITY_PRESHARED_KEYS:       true,
+		models.CAPABILITY_CHAINED_RELAYS:       true,
+		models.CAPABILITY_NODE_TOKEN_CHALLENGE: true,
+		models.CAPABILITY_ADDRESS_RANGE:        true,
+		models.CAPABILITY_MERGE_PATCH:          true,
+		models.CAPABILITY_NODE_ETAG:            true,
+		models.CAPABILITY_SIGNUP_POLICY:        true,
+	}
+}
+
 // GetFrontendURL - gets the frontend url
 func GetFrontendURL() string {
 	var frontend = ""
@@ -265,9 +302,9 @@ func GetDNSKey() string {
 	return key
 }
 
-// GetAllowedOrigin - get the allowed origin
+// GetAllowedOrigin - get the allowed origins as a comma separated list, empty allows no cross origin requests
 func GetAllowedOrigin() string {
-	allowedorigin := "*"
+	allowedorigin := ""
 	if os.Getenv("CORS_ALLOWED_ORIGIN") != "" {
 		allowedorigin = os.Getenv("CORS_ALLOWED_ORIGIN")
 	} else if config.Config.Server.AllowedOrigin != "" {
@@ -276,6 +313,60 @@ func GetAllowedOrigin() string {
 	return allowedorigin
 }
 
+// GetAllowedOrigins - get the origins allowed to make cross origin requests, "*" allows any origin
+func GetAllowedOrigins() []string {
+	return splitList(GetAllowedOrigin())
+}
+
+// GetAllowedMethods - get the methods allowed in cross origin requests
+func GetAllowedMethods() []string {
+	methods := "GET,PUT,PATCH,POST,DELETE"
+	if os.Getenv("CORS_ALLOWED_METHODS") != "" {
+		methods = os.Getenv("CORS_ALLOWED_METHODS")
+	} else if config.Config.Server.AllowedMethods != "" {
+		methods = config.Config.Server.AllowedMethods
+	}
+	return splitList(methods)
+}
+
+// GetAllowedHeaders - get the request headers allowed in cross origin requests
+func GetAllowedHeaders() []string {
+	headers := "Access-Control-Allow-Origin,X-Requested-With,Content-Type,authorization"
+	if os.Getenv("CORS_ALLOWED_HEADERS") != "" {
+		headers = os.Getenv("CORS_ALLOWED_HEADERS")
+	} else if config.Config.Server.AllowedHeaders != "" {
+		headers = config.Config.Server.AllowedHeaders
+	}
+	return splitList(headers)
+}
+
+// IsCORSAllowCredentials - checks if cross origin requests may carry credentials, off by default
+func IsCORSAllowCredentials() bool {
+	if os.Getenv("CORS_ALLOW_CREDENTIALS") != "" {
+		return os.Getenv("CORS_ALLOW_CREDENTIALS") == "on"
+	}
+	return config.Config.Server.AllowCredentials == "on"
+}
+
+// IsStructuredLogging - checks if node requests are logged as json access log lines, off by default
+func IsStructuredLogging() bool {
+	if os.Getenv("STRUCTURED_LOGGING") != "" {
+		return os.Getenv("STRUCTURED_LOGGING") == "on"
+	}
+	return config.Config.Server.StructuredLogging == "on"
+}
+
+// splitList - splits a comma separated setting, dropping blank entries
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 // IsRestBackend - checks if rest is on or off
 func IsRestBackend() bool {
 	isrest := true
@@ -541,6 +632,78 @@ func GetServerCheckinInterval() int64 {
 	return t
 }
 
+// GetNodeCheckInTimeout - gets the time in seconds after which a node that has not checked in is considered disconnected
+func GetNodeCheckInTimeout() int64 {
+	var t = int64(300)
+	var envt, _ = strconv.Atoi(os.Getenv("NODE_CHECKIN_TIMEOUT"))
+	if envt > 0 {
+		t = int64(envt)
+	} else if config.Config.Server.NodeCheckInTimeout > 0 {
+		t = config.Config.Server.NodeCheckInTimeout
+	}
+	return t
+}
+
+// GetAuthRateLimitAttempts - gets the number of failed node auth attempts allowed per rate limit window
+func GetAuthRateLimitAttempts() int64 {
+	var attempts = int64(5)
+	var enva, _ = strconv.Atoi(os.Getenv("AUTH_RATE_LIMIT_ATTEMPTS"))
+	if enva > 0 {
+		attempts = int64(enva)
+	} else if config.Config.Server.AuthRateLimitAttempts > 0 {
+		attempts = config.Config.Server.AuthRateLimitAttempts
+	}
+	return attempts
+}
+
+// GetAuthRateLimitWindow - gets the node auth rate limit window in seconds
+func GetAuthRateLimitWindow() int64 {
+	var t = int64(60)
+	var envt, _ = strconv.Atoi(os.Getenv("AUTH_RATE_LIMIT_WINDOW"))
+	if envt > 0 {
+		t = int64(envt)
+	} else if config.Config.Server.AuthRateLimitWindow > 0 {
+		t = config.Config.Server.AuthRateLimitWindow
+	}
+	return t
+}
+
+// GetIdempotencyKeyTTL - gets the time in seconds a node creation idempotency key is remembered
+func GetIdempotencyKeyTTL() int64 {
+	var t = int64(86400)
+	var envt, _ = strconv.Atoi(os.Getenv("IDEMPOTENCY_KEY_TTL"))
+	if envt > 0 {
+		t = int64(envt)
+	} else if config.Config.Server.IdempotencyKeyTTL > 0 {
+		t = config.Config.Server.IdempotencyKeyTTL
+	}
+	return t
+}
+
+// GetNodeDrainGracePeriod - gets the time in seconds a draining node keeps its peers before it may be deleted
+func GetNodeDrainGracePeriod() int64 {
+	var t = int64(60)
+	var envt, _ = strconv.Atoi(os.Getenv("NODE_DRAIN_GRACE_PERIOD"))
+	if envt > 0 {
+		t = int64(envt)
+	} else if config.Config.Server.NodeDrainGracePeriod > 0 {
+		t = config.Config.Server.NodeDrainGracePeriod
+	}
+	return t
+}
+
+// GetPeerUpdateBatchWindow - gets the time in milliseconds peer updates for a network are collected before publishing
+func GetPeerUpdateBatchWindow() int64 {
+	var t = int64(250)
+	var envt, _ = strconv.Atoi(os.Getenv("PEER_UPDATE_BATCH_WINDOW"))
+	if envt > 0 {
+		t = int64(envt)
+	} else if config.Config.Server.PeerUpdateBatchWindow > 0 {
+		t = config.Config.Server.PeerUpdateBatchWindow
+	}
+	return t
+}
+
 // GetAuthProviderInfo = gets the oauth provider info
 func GetAuthProviderInfo() []string {
 	var authProvider = ""
@@ -575,3 +738,75 @@ func GetAzureTenant() string {
 func GetRce() bool {
 	return os.Getenv("RCE") == "on" || config.Config.Server.RCE == "on"
 }
+
+// GetNodeRecoveryWindow - gets the time in seconds a deleted node can be restored before it is purged
+func GetNodeRecoveryWindow() int64 {
+	var t = int64(86400)
+	var envt, _ = strconv.Atoi(os.Getenv("NODE_RECOVERY_WINDOW"))
+	if envt > 0 {
+		t = int64(envt)
+	} else if config.Config.Server.NodeRecoveryWindow > 0 {
+		t = config.Config.Server.NodeRecoveryWindow
+	}
+	return t
+}
+
+// GetUserTokenCacheTTL - gets the time in seconds a verified user token is cached,
+// zero or less disables the cache (set USER_TOKEN_CACHE_TTL=0 or a negative usertokencachettl)
+func GetUserTokenCacheTTL() int64 {
+	var t = int64(10)
+	if envt, err := strconv.Atoi(os.Getenv("USER_TOKEN_CACHE_TTL")); err == nil {
+		t = int64(envt)
+	} else if config.Config.Server.UserTokenCacheTTL != 0 {
+		t = config.Config.Server.UserTokenCacheTTL
+	}
+	return t
+}
+
+// GetEgressTargetRefresh - gets the interval in seconds between re-resolving the dns targets of egress gateways
+func GetEgressTargetRefresh() int64 {
+	var t = int64(300)
+	var envt, _ = strconv.Atoi(os.Getenv("EGRESS_TARGET_REFRESH"))
+	if envt > 0 {
+		t = int64(envt)
+	} else if config.Config.Server.EgressTargetRefresh > 0 {
+		t = config.Config.Server.EgressTargetRefresh
+	}
+	return t
+}
+
+// GetNodePasswordCost - gets the bcrypt cost node passwords are hashed with, node passwords stored
+// with a lower cost are rehashed when the node next authenticates
+func GetNodePasswordCost() int {
+	var cost = 5
+	var envcost, _ = strconv.Atoi(os.Getenv("NODE_PASSWORD_COST"))
+	if envcost >= bcrypt.MinCost && envcost <= bcrypt.MaxCost {
+		cost = envcost
+	} else if config.Config.Server.NodePasswordCost >= bcrypt.MinCost && config.Config.Server.NodePasswordCost <= bcrypt.MaxCost {
+		cost = config.Config.Server.NodePasswordCost
+	}
+	return cost
+}
+
+// GetUtilizationThreshold - gets the percent of a network's addresses in use at which a utilization event is sent
+func GetUtilizationThreshold() int {
+	var threshold = 80
+	var envthreshold, _ = strconv.Atoi(os.Getenv("UTILIZATION_THRESHOLD"))
+	if envthreshold > 0 && envthreshold <= 100 {
+		threshold = envthreshold
+	} else if config.Config.Server.UtilizationThreshold > 0 && config.Config.Server.UtilizationThreshold <= 100 {
+		threshold = config.Config.Server.UtilizationThreshold
+	}
+	return threshold
+}
+
+// GetUtilizationWebhook - gets the url utilization events are posted to, empty when events are only logged
+func GetUtilizationWebhook() string {
+	webhook := ""
+	if os.Getenv("UTILIZATION_WEBHOOK") != "" {
+		webhook = os.Getenv("UTILIZATION_WEBHOOK")
+	} else if config.Config.Server.UtilizationWebhook != "" {
+		webhook = config.Config.Server.UtilizationWebhook
+	}
+	return webhook
+}